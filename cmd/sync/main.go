@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"os"
 	"os/signal"
 	"sync"
@@ -10,9 +11,13 @@ import (
 	"github.com/retail-ai-inc/sync/pkg/config"
 	"github.com/retail-ai-inc/sync/pkg/logger"
 	"github.com/retail-ai-inc/sync/pkg/syncer"
+	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	validate := flag.Bool("validate", false, "validate the MariaDB sync configurations and exit")
+	flag.Parse()
+
 	// Initialize context
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -29,6 +34,9 @@ func main() {
 	// Load configuration
 	cfg := config.NewConfig()
 	log := logger.InitLogger()
+	if *validate {
+		os.Exit(validateConfigs(cfg, log))
+	}
 
 	// Start syncer
 	var wg sync.WaitGroup
@@ -54,7 +62,9 @@ func main() {
 			go func(syncCfg config.SyncConfig) {
 				defer wg.Done()
 				syncer := syncer.NewMariaDBSyncer(syncCfg, log)
-				syncer.Start(ctx)
+				if err := syncer.Start(ctx); err != nil {
+					log.Errorf("MariaDB syncer stopped with error: %v", err)
+				}
 			}(syncCfg)
 		case "postgresql":
 			go func(syncCfg config.SyncConfig) {
@@ -72,7 +82,47 @@ func main() {
 	wg.Wait()
 	log.Info("All synchronization tasks have completed.")
 
-	// Wait for program to end
-	<-ctx.Done()
+	// Wait for program to end; one-shot copies exit without waiting for a signal
+	if !oneShot(cfg) {
+		<-ctx.Done()
+	}
 	log.Info("Program has exited")
 }
+
+// oneShot reports whether every enabled sync is a MariaDB full copy, which is done once Start
+// returns; other syncers keep streaming changes in the background after it returns
+func oneShot(cfg *config.Config) bool {
+	enabled := 0
+	for _, syncCfg := range cfg.SyncConfigs {
+		if !syncCfg.Enable {
+			continue
+		}
+		if syncCfg.Type != "mariadb" || syncCfg.Mode != config.ModeFull {
+			return false
+		}
+		enabled++
+	}
+	return enabled > 0
+}
+
+// validateConfigs logs the problems of every enabled MariaDB sync configuration and returns
+// the exit code: 1 when any was found
+func validateConfigs(cfg *config.Config, log *logrus.Logger) int {
+	code := 0
+	for i, syncCfg := range cfg.SyncConfigs {
+		if !syncCfg.Enable || syncCfg.Type != "mariadb" {
+			continue
+		}
+		problems := syncer.ValidateMariaDBConfig(syncCfg)
+		for _, problem := range problems {
+			log.Errorf("MariaDB sync %d: %v", i+1, problem)
+		}
+		if len(problems) > 0 {
+			code = 1
+		}
+	}
+	if code == 0 {
+		log.Info("Configuration is valid")
+	}
+	return code
+}
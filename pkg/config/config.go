@@ -1,18 +1,104 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
 type TableMapping struct {
-	SourceTable string `yaml:"source_table"`
-	TargetTable string `yaml:"target_table"`
+	SourceTable             string            `yaml:"source_table"`
+	TargetTable             string            `yaml:"target_table"`
+	ColumnMap               map[string]string `yaml:"column_map,omitempty"`                // Source->target column renames; "" drops the column
+	InsertMode              string            `yaml:"insert_mode,omitempty"`               // "insert" (default), "upsert", "ignore" or "replace"
+	ConflictResolution      string            `yaml:"conflict_resolution,omitempty"`       // With insert_mode upsert: "source-wins" (default), "newest-timestamp" or "skip" when an inserted row exists
+	ConflictTimestampColumn string            `yaml:"conflict_timestamp_column,omitempty"` // Target column newest-timestamp compares
+	SourceFilter            string            `yaml:"source_filter,omitempty"`             // WHERE predicate; incremental events support column = value / column IN (...)
+	SoftDelete              *SoftDeleteConfig `yaml:"soft_delete,omitempty"`               // Mark deleted rows instead of deleting them
+	Transforms              map[string]string `yaml:"transforms,omitempty"`                // Source column -> hash, redact, email-mask or null-out
+	ExcludeColumns          []string          `yaml:"exclude_columns,omitempty"`           // Source columns that are never read or written
+	SourceTag               string            `yaml:"source_tag,omitempty"`                // Target column written with the source db.table, for several sources merged into one target
+	Actions                 []string          `yaml:"actions,omitempty"`                   // Replicated DML actions: insert, update and/or delete (default all)
+	Enabled                 *bool             `yaml:"enabled,omitempty"`                   // Set to false to stop syncing the table (default true)
+	ExtraTargets            []TableTarget     `yaml:"extra_targets,omitempty"`             // Further destinations the table is written to, besides the mapping's target
+	KeyColumns              []string          `yaml:"key_columns,omitempty"`               // Unique key matching target rows of a table without a primary key, with allow_no_primary_key
+	PreApplySQL             []string          `yaml:"pre_apply_sql,omitempty"`             // Statements run on the target before the table's initial copy, in order
+	PostApplySQL            []string          `yaml:"post_apply_sql,omitempty"`            // Statements run on the target after the table's initial copy, in order
+	ApplySQLIncremental     bool              `yaml:"apply_sql_incremental,omitempty"`     // Also run pre/post_apply_sql within every incremental write transaction of the table
+	InitialSyncIndexHint    string            `yaml:"initial_sync_index_hint,omitempty"`   // Source index the initial sync SELECT is forced to use (FORCE INDEX)
+	InitialSyncOrderBy      []string          `yaml:"initial_sync_order_by,omitempty"`     // Source columns the initial sync reads rows in, before any remaining primary key columns
+}
+
+// TableTarget is a further destination of a table mapping on its own connection
+type TableTarget struct {
+	TargetConnection string `yaml:"target_connection"`
+	TargetDatabase   string `yaml:"target_database"`
+	TargetTable      string `yaml:"target_table,omitempty"` // Defaults to the mapping's target_table
+}
+
+// IsEnabled reports whether the table is synced, defaulting to true
+func (t TableMapping) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// DMLActions are the row actions a table mapping can replicate
+var DMLActions = []string{"insert", "update", "delete"}
+
+// EnabledActions returns the actions replicated for the table, defaulting to all of them
+func (t TableMapping) EnabledActions() []string {
+	if len(t.Actions) == 0 {
+		return DMLActions
+	}
+	actions := make([]string, len(t.Actions))
+	for i, action := range t.Actions {
+		actions[i] = strings.ToLower(strings.TrimSpace(action))
+	}
+	return actions
+}
+
+// ActionEnabled reports whether row events of the given action are replicated for the table
+func (t TableMapping) ActionEnabled(action string) bool {
+	for _, enabled := range t.EnabledActions() {
+		if enabled == action {
+			return true
+		}
+	}
+	return false
+}
+
+// validateActions rejects action names other than insert, update and delete
+func (t TableMapping) validateActions() error {
+	for _, action := range t.EnabledActions() {
+		valid := false
+		for _, known := range DMLActions {
+			valid = valid || action == known
+		}
+		if !valid {
+			return fmt.Errorf("unknown action %q for table %s: must be insert, update or delete", action, t.SourceTable)
+		}
+	}
+	return nil
+}
+
+// Sync modes: copy the mapped tables, stream binlog changes, or copy and then stream
+const (
+	ModeFull            = "full"
+	ModeIncremental     = "incremental"
+	ModeFullIncremental = "full+incremental"
+)
+
+// SoftDeleteConfig turns deletes into an UPDATE of a marker column on the target
+type SoftDeleteConfig struct {
+	Column string `yaml:"column"` // Target column to set, e.g. deleted_at or is_deleted
+	Value  string `yaml:"value"`  // Value to set; NOW() sets the current timestamp
 }
 
 type DatabaseMapping struct {
@@ -23,18 +109,113 @@ type DatabaseMapping struct {
 	Tables         []TableMapping `yaml:"tables"`
 }
 
+// TLSConfig describes the TLS settings used for database connections
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty"`              // PEM CA bundle used to verify the server
+	CertFile           string `yaml:"cert_file,omitempty"`            // PEM client certificate, requires key_file
+	KeyFile            string `yaml:"key_file,omitempty"`             // PEM client private key, requires cert_file
+	ServerName         string `yaml:"server_name,omitempty"`          // Name to verify the server certificate against (default: DSN host)
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"` // Do not verify the server certificate
+}
+
+// SSHTunnelConfig describes an SSH bastion the MariaDB source, and optionally the target, is
+// reached through
+type SSHTunnelConfig struct {
+	Host                  string `yaml:"host"`                               // Bastion host[:port] (port defaults to 22)
+	User                  string `yaml:"user"`                               // SSH user on the bastion
+	KeyFile               string `yaml:"key_file"`                           // PEM private key used to authenticate
+	KeyPassphrase         string `yaml:"key_passphrase,omitempty"`           // Passphrase of an encrypted key_file
+	KnownHostsFile        string `yaml:"known_hosts_file,omitempty"`         // known_hosts file verifying the bastion's host key
+	InsecureIgnoreHostKey bool   `yaml:"insecure_ignore_host_key,omitempty"` // Do not verify the bastion's host key
+	Target                bool   `yaml:"target,omitempty"`                   // Also reach target_connection through the tunnel
+}
+
 type SyncConfig struct {
-	Type                   string            `yaml:"type"`
-	Enable                 bool              `yaml:"enable"`
-	SourceConnection       string            `yaml:"source_connection"`
-	TargetConnection       string            `yaml:"target_connection"`
-	Mappings               []DatabaseMapping `yaml:"mappings"`
-	DumpExecutionPath      string            `yaml:"dump_execution_path,omitempty"`
-	MySQLPositionPath      string            `yaml:"mysql_position_path,omitempty"`
-	MongoDBResumeTokenPath string            `yaml:"mongodb_resume_token_path,omitempty"`
-	PGReplicationSlotName  string            `yaml:"pg_replication_slot,omitempty"`
-	PGPluginName           string            `yaml:"pg_plugin,omitempty"`
-	PGPositionPath         string            `yaml:"pg_position_path,omitempty"` // New field to store LSN position
+	Type                        string            `yaml:"type"`
+	Enable                      bool              `yaml:"enable"`
+	Mode                        string            `yaml:"mode,omitempty"` // full, incremental or full+incremental (default)
+	SourceConnection            string            `yaml:"source_connection"`
+	TargetConnection            string            `yaml:"target_connection"`
+	Mappings                    []DatabaseMapping `yaml:"mappings"`
+	TargetDatabasePrefix        string            `yaml:"target_database_prefix,omitempty"`      // Prefix of every MariaDB mapping's target database, which defaults to the source database
+	ExcludeDatabases            []string          `yaml:"exclude_databases,omitempty"`           // MariaDB source databases never replicated, besides the system databases
+	SkipTables                  []string          `yaml:"skip_tables,omitempty"`                 // MariaDB source db.table whose binlog events are dropped, even when mapped
+	ExcludeColumnTypes          []string          `yaml:"exclude_column_types,omitempty"`        // MariaDB source column types never read or written in any table, e.g. longblob or generated
+	ExcludeColumnsLargerThan    int               `yaml:"exclude_columns_larger_than,omitempty"` // MariaDB source columns above this declared length are never read or written
+	DumpExecutionPath           string            `yaml:"dump_execution_path,omitempty"`
+	DisableCanalDump            bool              `yaml:"disable_canal_dump,omitempty"`  // Never let MariaDB canal run mysqldump; the initial sync copies the tables
+	InitialSyncMethod           string            `yaml:"initial_sync_method,omitempty"` // How MariaDB tables are first copied: copy (the batched initial sync) or canal_dump (canal's mysqldump); default copy in full+incremental mode
+	MySQLPositionPath           string            `yaml:"mysql_position_path,omitempty"`
+	MongoDBResumeTokenPath      string            `yaml:"mongodb_resume_token_path,omitempty"`
+	PGReplicationSlotName       string            `yaml:"pg_replication_slot,omitempty"`
+	PGPluginName                string            `yaml:"pg_plugin,omitempty"`
+	PGPositionPath              string            `yaml:"pg_position_path,omitempty"`               // New field to store LSN position
+	UseGTID                     bool              `yaml:"use_gtid,omitempty"`                       // Resume MariaDB from a saved GTID set instead of file/offset
+	StartPositionFile           string            `yaml:"start_position_file,omitempty"`            // Binlog file MariaDB canal starts from instead of the saved position (disaster recovery)
+	StartPositionOffset         uint32            `yaml:"start_position_offset,omitempty"`          // Offset in start_position_file (default 4, its first event)
+	StartGTID                   string            `yaml:"start_gtid,omitempty"`                     // GTID set MariaDB canal starts from instead of the saved one; requires use_gtid
+	ConfirmStartOverride        bool              `yaml:"confirm_start_override,omitempty"`         // Required to start from start_position_file/start_gtid, which skip or replay events
+	PositionStore               string            `yaml:"position_store,omitempty"`                 // Where MariaDB keeps its binlog position: file (default) or db
+	PositionTable               string            `yaml:"position_table,omitempty"`                 // Target db.table holding the binlog position with position_store db
+	PositionKey                 string            `yaml:"position_key,omitempty"`                   // Row of position_table owned by this syncer; defaults to the source host:port
+	InitialSyncBatchSize        int               `yaml:"initial_sync_batch_size,omitempty"`        // Rows per batch insert during initial sync (default 100)
+	PropagateDDL                bool              `yaml:"propagate_ddl,omitempty"`                  // Apply source ALTER TABLE ... ADD COLUMN to the MariaDB target
+	PropagateTruncate           bool              `yaml:"propagate_truncate,omitempty"`             // Delete every row of the MariaDB target table when its source table is truncated
+	WriteRetryMaxAttempts       int               `yaml:"write_retry_max_attempts,omitempty"`       // Attempts for a transient MariaDB target write failure (default 3)
+	WriteRetryBaseDelay         time.Duration     `yaml:"write_retry_base_delay,omitempty"`         // First retry delay, doubled per attempt (default 100ms)
+	ErrorPolicy                 string            `yaml:"error_policy,omitempty"`                   // What to do with a MariaDB row event the target rejects: stop (default), skip or deadletter
+	IgnoreErrorCodes            []uint16          `yaml:"ignore_error_codes,omitempty"`             // MySQL error numbers of MariaDB target writes that are skipped under any error_policy, e.g. 1062
+	DeadLetterPath              string            `yaml:"dead_letter_path,omitempty"`               // JSON lines file receiving rejected rows with error_policy deadletter
+	DeadLetterTable             string            `yaml:"dead_letter_table,omitempty"`              // Target db.table receiving rejected rows with error_policy deadletter
+	WriteBatchSize              int               `yaml:"write_batch_size,omitempty"`               // Rows of consecutive MariaDB row events written per target transaction (default 0: one event per transaction)
+	WriteBatchDelay             time.Duration     `yaml:"write_batch_delay,omitempty"`              // Longest time a MariaDB row waits in a write batch (default 100ms)
+	ApplyConcurrency            int               `yaml:"apply_concurrency,omitempty"`              // MariaDB workers writing incremental rows in parallel, ordered per primary key (default 1)
+	ApplyQueueSize              int               `yaml:"apply_queue_size,omitempty"`               // Event parts each MariaDB apply worker queues before reading the binlog waits (default 256)
+	WriteTimeout                time.Duration     `yaml:"write_timeout,omitempty"`                  // Longest a single MariaDB target write may take (default 30s)
+	SlowWriteThreshold          time.Duration     `yaml:"slow_write_threshold,omitempty"`           // Warn about MariaDB target writes taking at least this long (default 0: off)
+	DebugRows                   bool              `yaml:"debug_rows,omitempty"`                     // Log the values of MariaDB rows written, at debug level, with transformed columns redacted
+	DebugRowsSampleRate         float64           `yaml:"debug_rows_sample_rate,omitempty"`         // Fraction of rows debug_rows logs, between 0 and 1 (default 1: every row)
+	MaxLag                      time.Duration     `yaml:"max_lag,omitempty"`                        // Warn and call OnLagExceeded when MariaDB replication lag stays above this (default 0: off)
+	CutoverLag                  time.Duration     `yaml:"cutover_lag,omitempty"`                    // Close MariaDB ReadyToCutover once replication lag stays at or below this (default 0: off)
+	CutoverHold                 time.Duration     `yaml:"cutover_hold,omitempty"`                   // How long the lag must stay within cutover_lag (default 30s)
+	ReconnectMaxAttempts        int               `yaml:"reconnect_max_attempts,omitempty"`         // Reconnects after a transient MariaDB source failure before giving up (default 5)
+	ReconnectBaseDelay          time.Duration     `yaml:"reconnect_base_delay,omitempty"`           // First reconnect delay, doubled per attempt up to 1m (default 1s)
+	PreflightMaxAttempts        int               `yaml:"preflight_max_attempts,omitempty"`         // Connection checks of the MariaDB source and target at startup before giving up (default 10)
+	PreflightTimeout            time.Duration     `yaml:"preflight_timeout,omitempty"`              // Longest time startup waits for each MariaDB database to accept connections (default 2m)
+	ServerID                    uint32            `yaml:"server_id,omitempty"`                      // Replication server ID of the MariaDB canal, unique per master (default: derived from the target DSN)
+	IgnoreOwnWrites             bool              `yaml:"ignore_own_writes,omitempty"`              // Stamp MariaDB target writes with server_id and skip source events carrying it (active-active)
+	ResumableInitialSync        bool              `yaml:"resumable_initial_sync,omitempty"`         // Copy MariaDB tables in primary key order and resume from a checkpoint
+	InitialSyncCheckpointPath   string            `yaml:"initial_sync_checkpoint_path,omitempty"`   // Checkpoint file (default: mysql_position_path + ".initial_sync")
+	InitialSyncConcurrency      int               `yaml:"initial_sync_concurrency,omitempty"`       // MariaDB tables copied in parallel during initial sync (default 1)
+	InitialSyncProgressRows     int               `yaml:"initial_sync_progress_rows,omitempty"`     // Log MariaDB initial sync progress every this many rows of a table
+	InitialSyncProgressInterval time.Duration     `yaml:"initial_sync_progress_interval,omitempty"` // Log MariaDB initial sync progress at least this often (default 30s)
+	ConsistentSnapshot          bool              `yaml:"consistent_snapshot,omitempty"`            // Copy MariaDB tables from one snapshot and stream from its binlog position
+	MaxStatementBytes           int               `yaml:"max_statement_bytes,omitempty"`            // Largest multi-row MariaDB INSERT written (default 3/4 of the target max_allowed_packet)
+	ForceFullResync             bool              `yaml:"force_full_resync,omitempty"`              // Copy MariaDB tables even when the target already has rows
+	TruncateBeforeResync        bool              `yaml:"truncate_before_resync,omitempty"`         // Truncate MariaDB target tables before a forced full resync
+	AllowNoPrimaryKey           bool              `yaml:"allow_no_primary_key,omitempty"`           // Match MariaDB updates and deletes of tables without a primary key by key_columns or all columns
+	StrictSchema                bool              `yaml:"strict_schema,omitempty"`                  // Fail MariaDB rows with columns the target table lacks instead of dropping those columns
+	StrictApply                 bool              `yaml:"strict_apply,omitempty"`                   // Fail MariaDB events whose writes affect an unexpected number of target rows
+	MinimalUpdates              bool              `yaml:"minimal_updates,omitempty"`                // Only SET the columns a MariaDB update changed
+	ResetAutoIncrement          bool              `yaml:"reset_auto_increment,omitempty"`           // Move each MariaDB target AUTO_INCREMENT past its largest key after the initial sync copies the table
+	VerifyAfterInitialSync      bool              `yaml:"verify_after_initial_sync,omitempty"`      // Compare row counts and key checksums after each MariaDB table is copied
+	DeferLargeColumns           bool              `yaml:"defer_large_columns,omitempty"`            // Copy large MariaDB TEXT/BLOB columns by key after the rows of each table
+	LargeColumnThreshold        int64             `yaml:"large_column_threshold,omitempty"`         // Declared size in bytes above which defer_large_columns defers a column (default 65535)
+	AutoCreateTarget            bool              `yaml:"auto_create_target,omitempty"`             // Create missing MariaDB target databases at startup
+	TargetCharset               string            `yaml:"target_charset,omitempty"`                 // Character set of databases created by auto_create_target (default: the target's)
+	TargetCollation             string            `yaml:"target_collation,omitempty"`               // Collation of databases created by auto_create_target (default: the target's)
+	TargetMaxOpenConns          int               `yaml:"target_max_open_conns,omitempty"`          // Max open MariaDB target connections (default 10)
+	TargetMaxIdleConns          int               `yaml:"target_max_idle_conns,omitempty"`          // Max idle MariaDB target connections (default 2)
+	TargetConnMaxLifetime       time.Duration     `yaml:"target_conn_max_lifetime,omitempty"`       // Recycle MariaDB target connections after this long (default 30m)
+	TLSConfig                   *TLSConfig        `yaml:"tls_config,omitempty"`                     // TLS for the MariaDB source (binlog) and target connections
+	SSHTunnel                   *SSHTunnelConfig  `yaml:"ssh_tunnel,omitempty"`                     // SSH bastion the MariaDB source (binlog and queries) is reached through
+	AuditLogPath                string            `yaml:"audit_log_path,omitempty"`                 // JSON lines file recording every change applied to the MariaDB target
+	ChangeBufferSize            int               `yaml:"change_buffer_size,omitempty"`             // Change events queued for MariaDB OnChange callbacks before events are dropped (default 1024)
+	SourceTimezone              string            `yaml:"source_timezone,omitempty"`                // IANA zone of the MariaDB source server's time_zone, converted to target_timezone (default: none)
+	TargetTimezone              string            `yaml:"target_timezone,omitempty"`                // IANA zone MariaDB DATETIME/TIMESTAMP values are written in (default: as delivered)
+	PositionSaveInterval        time.Duration     `yaml:"position_save_interval,omitempty"`         // How often the MariaDB binlog position is saved (default 3s)
+	PositionSaveThrottle        time.Duration     `yaml:"position_save_throttle,omitempty"`         // Minimum time between MariaDB position saves as canal syncs (default 1s)
+	PositionSaveEvents          int               `yaml:"position_save_events,omitempty"`           // Save the MariaDB position after this many synced events even within the throttle
 }
 
 type Config struct {
@@ -64,10 +245,69 @@ func NewConfig() *Config {
 		log.Fatalf("Failed to parse configuration file: %v", err)
 	}
 
+	for i := range cfg.SyncConfigs {
+		syncCfg := &cfg.SyncConfigs[i]
+		if err := syncCfg.expandConnectionEnv(); err != nil {
+			log.Fatalf("Invalid configuration for %s sync %d: %v", syncCfg.Type, i+1, err)
+		}
+		for _, mapping := range syncCfg.Mappings {
+			for _, table := range mapping.Tables {
+				if err := table.validateActions(); err != nil {
+					log.Fatalf("Invalid configuration for %s.%s: %v", mapping.SourceDatabase, table.SourceTable, err)
+				}
+			}
+		}
+	}
+
 	cfg.Logger = logrus.New()
 	return &cfg
 }
 
+// envPlaceholder matches ${NAME} placeholders in connection strings
+var envPlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandConnectionEnv replaces ${NAME} placeholders in the source and target connections
+// with environment variables, so credentials can be injected as secrets. Other uses of $,
+// e.g. in passwords, are kept.
+func (s *SyncConfig) expandConnectionEnv() error {
+	var err error
+	if s.SourceConnection, err = expandEnv(s.SourceConnection); err != nil {
+		return fmt.Errorf("source_connection: %w", err)
+	}
+	if s.TargetConnection, err = expandEnv(s.TargetConnection); err != nil {
+		return fmt.Errorf("target_connection: %w", err)
+	}
+	for i := range s.Mappings {
+		for j := range s.Mappings[i].Tables {
+			targets := s.Mappings[i].Tables[j].ExtraTargets
+			for k := range targets {
+				if targets[k].TargetConnection, err = expandEnv(targets[k].TargetConnection); err != nil {
+					return fmt.Errorf("extra_targets target_connection of %s: %w", s.Mappings[i].Tables[j].SourceTable, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// expandEnv replaces ${NAME} placeholders with environment variables; an unset variable is
+// an error, while one set to the empty string expands to nothing
+func expandEnv(value string) (string, error) {
+	var missing []string
+	expanded := envPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+		name := envPlaceholder.FindStringSubmatch(placeholder)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable(s) %s not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
 func (s *SyncConfig) PGReplicationSlot() string {
 	return s.PGReplicationSlotName
 }
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Sync phases used as the "phase" label
+const (
+	PhaseInitial     = "initial"
+	PhaseIncremental = "incremental"
+)
+
+var (
+	// RowsSynced counts rows written to the target per source table and action
+	RowsSynced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sync",
+		Name:      "rows_synced_total",
+		Help:      "Number of rows applied to the target, by source type, source table, action and phase.",
+	}, []string{"type", "table", "action", "phase"})
+
+	// ReplicationLag is the age of the last applied binlog event per source table
+	ReplicationLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sync",
+		Name:      "replication_lag_seconds",
+		Help:      "Seconds between the source event timestamp and the time it was applied.",
+	}, []string{"type", "table"})
+
+	// DeleteNoops counts deletes that found no target row to remove
+	DeleteNoops = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sync",
+		Name:      "delete_noops_total",
+		Help:      "Number of deletes that affected no target row, e.g. replayed or out-of-order events, by source type and source table.",
+	}, []string{"type", "table"})
+
+	// RowsDropped counts rows the target rejected and the skip error policy discarded
+	RowsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sync",
+		Name:      "rows_dropped_total",
+		Help:      "Number of rows rejected by the target and skipped, by source type, source table and action.",
+	}, []string{"type", "table", "action"})
+
+	// RowsDeadLettered counts rows the target rejected that were stored for reprocessing
+	RowsDeadLettered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sync",
+		Name:      "rows_dead_lettered_total",
+		Help:      "Number of rows rejected by the target and written to the dead-letter sink, by source type, source table and action.",
+	}, []string{"type", "table", "action"})
+
+	// InitialSyncProgress is the fraction of each table the initial sync has copied
+	InitialSyncProgress = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sync",
+		Name:      "initial_sync_progress_ratio",
+		Help:      "Fraction of the estimated rows of a source table copied by the initial sync, 1 once it completed.",
+	}, []string{"type", "table"})
+
+	// ApplyQueueDepth is the number of row events waiting to be written to the target
+	ApplyQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sync",
+		Name:      "apply_queue_depth",
+		Help:      "Row events read from the source and queued for the apply workers or held in the write batch, by source type.",
+	}, []string{"type"})
+)
+
+func init() {
+	prometheus.MustRegister(RowsSynced, ReplicationLag, DeleteNoops, RowsDropped, RowsDeadLettered, InitialSyncProgress, ApplyQueueDepth)
+}
+
+// AddRows records n rows applied for the given source table and action
+func AddRows(dbType, table, action, phase string, n int) {
+	if n <= 0 {
+		return
+	}
+	RowsSynced.WithLabelValues(dbType, table, action, phase).Add(float64(n))
+}
+
+// SetReplicationLag records the replication lag for the given source table
+func SetReplicationLag(dbType, table string, lag time.Duration) {
+	ReplicationLag.WithLabelValues(dbType, table).Set(lag.Seconds())
+}
+
+// AddDeleteNoop records a delete on the given source table that affected no target row
+func AddDeleteNoop(dbType, table string) {
+	DeleteNoops.WithLabelValues(dbType, table).Inc()
+}
+
+// AddDroppedRows records n rows of the given source table and action that were skipped
+func AddDroppedRows(dbType, table, action string, n int) {
+	if n <= 0 {
+		return
+	}
+	RowsDropped.WithLabelValues(dbType, table, action).Add(float64(n))
+}
+
+// AddDeadLetteredRows records n rows of the given source table and action that were dead-lettered
+func AddDeadLetteredRows(dbType, table, action string, n int) {
+	if n <= 0 {
+		return
+	}
+	RowsDeadLettered.WithLabelValues(dbType, table, action).Add(float64(n))
+}
+
+// SetInitialSyncProgress records the fraction of the given source table copied by the initial sync
+func SetInitialSyncProgress(dbType, table string, ratio float64) {
+	InitialSyncProgress.WithLabelValues(dbType, table).Set(ratio)
+}
+
+// SetApplyQueueDepth records the number of row events waiting to be written
+func SetApplyQueueDepth(dbType string, n int64) {
+	ApplyQueueDepth.WithLabelValues(dbType).Set(float64(n))
+}
+
+// Handler serves all registered metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
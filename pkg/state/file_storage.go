@@ -2,7 +2,6 @@ package state
 
 import (
 	"io/ioutil"
-	"os"
 	"path/filepath"
 )
 
@@ -0,0 +1,250 @@
+package mariadb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/retail-ai-inc/sync/pkg/metrics"
+)
+
+// defaultApplyQueueSize is the number of event parts a worker queues before OnRow waits for it
+const defaultApplyQueueSize = 256
+
+// applyConcurrency returns the number of workers writing incremental rows; 1 writes them
+// on the canal goroutine
+func (s *MariaDBSyncer) applyConcurrency() (int, error) {
+	switch {
+	case s.cfg.ApplyConcurrency < 0:
+		return 0, fmt.Errorf("invalid apply_concurrency %d for MariaDB: must not be negative", s.cfg.ApplyConcurrency)
+	case s.cfg.ApplyConcurrency > 1 && s.cfg.WriteBatchSize > 1:
+		return 0, fmt.Errorf("apply_concurrency and write_batch_size for MariaDB cannot be combined")
+	case s.cfg.ApplyConcurrency == 0:
+		return 1, nil
+	default:
+		return s.cfg.ApplyConcurrency, nil
+	}
+}
+
+// applyQueueSize returns the event parts each apply worker queues before OnRow blocks, which
+// holds back canal rather than buffering a target that falls behind
+func (s *MariaDBSyncer) applyQueueSize() (int, error) {
+	switch {
+	case s.cfg.ApplyQueueSize < 0:
+		return 0, fmt.Errorf("invalid apply_queue_size %d for MariaDB: must not be negative", s.cfg.ApplyQueueSize)
+	case s.cfg.ApplyQueueSize == 0:
+		return defaultApplyQueueSize, nil
+	default:
+		return s.cfg.ApplyQueueSize, nil
+	}
+}
+
+// applierPool writes the rows of incremental events on concurrent workers. Each row goes to
+// the worker its key hashes to, and a worker writes its rows in binlog order, so the writes of
+// one row never overtake each other while different rows are written in parallel.
+type applierPool struct {
+	h      *MariaDBEventHandler
+	queues []chan applyJob
+	wg     sync.WaitGroup // dispatched parts not yet written
+	depth  atomic.Int64   // parts queued or being written, for Status and metrics
+
+	mu     sync.Mutex
+	events []*dispatchedEvent // dispatched since the last drain, in binlog order
+	failed error              // first error of a worker since the last drain
+}
+
+// dispatchedEvent collects the outcome of the parts an event was split into
+type dispatchedEvent struct {
+	event   *canal.RowsEvent
+	rows    int
+	skipped bool // a part was dropped by the error policy
+	err     error
+}
+
+// applyJob is the part of an event written by one worker
+type applyJob struct {
+	target *rowTarget
+	event  *canal.RowsEvent
+	result *dispatchedEvent
+}
+
+// newApplierPool starts n workers writing for h, each queueing up to size parts
+func newApplierPool(h *MariaDBEventHandler, n, size int) *applierPool {
+	p := &applierPool{h: h, queues: make([]chan applyJob, n)}
+	for i := range p.queues {
+		p.queues[i] = make(chan applyJob, size)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+func (p *applierPool) work(queue <-chan applyJob) {
+	for job := range queue {
+		rows, skipped, err := p.h.applyPart(job.target, job.event)
+		p.mu.Lock()
+		job.result.rows += rows
+		job.result.skipped = job.result.skipped || skipped
+		if err != nil {
+			if job.result.err == nil {
+				job.result.err = err
+			}
+			if p.failed == nil {
+				p.failed = err
+			}
+		}
+		p.mu.Unlock()
+		p.h.reportQueueDepth(p.depth.Add(-1))
+		p.wg.Done()
+	}
+}
+
+// worker returns the worker owning row of t: by primary key, by key_columns without one, or
+// a single worker for the whole table when neither exists
+func (p *applierPool) worker(t *rowTarget, row []interface{}) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(t.qualifiedName()))
+	if t.tableMap.SourceTag != "" {
+		// Rows of each source are distinct rows of a merged target
+		fmt.Fprintf(hash, "\x00%s", t.sourceTagValue())
+	}
+	keys := t.table.PKColumns
+	if len(keys) == 0 {
+		for _, name := range t.tableMap.KeyColumns {
+			if idx := t.table.FindColumn(name); idx >= 0 {
+				keys = append(keys, idx)
+			}
+		}
+	}
+	for _, idx := range keys {
+		if idx < len(row) {
+			fmt.Fprintf(hash, "\x00%v", row[idx])
+		}
+	}
+	return int(hash.Sum32() % uint32(len(p.queues)))
+}
+
+// dispatch splits e by the workers owning its rows and queues the parts. It reports false
+// when an update moves a row to a key owned by another worker; such an event must be written
+// once every worker is drained, ordered after the writes of both keys.
+func (p *applierPool) dispatch(t *rowTarget, e *canal.RowsEvent) bool {
+	step := 1
+	if e.Action == canal.UpdateAction {
+		step = 2
+	}
+	parts := make(map[int][][]interface{})
+	var order []int
+	for i := 0; i+step <= len(e.Rows); i += step {
+		w := p.worker(t, e.Rows[i])
+		if step == 2 && p.worker(t, e.Rows[i+1]) != w {
+			return false
+		}
+		if _, ok := parts[w]; !ok {
+			order = append(order, w)
+		}
+		parts[w] = append(parts[w], e.Rows[i:i+step]...)
+	}
+
+	result := &dispatchedEvent{event: e}
+	p.mu.Lock()
+	p.events = append(p.events, result)
+	p.mu.Unlock()
+	for _, w := range order {
+		part := *e
+		part.Rows = parts[w]
+		// Each part collects its own audit records and change events
+		target := *t
+		target.audit, target.changes = nil, nil
+		p.wg.Add(1)
+		p.h.reportQueueDepth(p.depth.Add(1))
+		p.queues[w] <- applyJob{target: &target, event: &part, result: result}
+	}
+	return true
+}
+
+// failure returns the first error of a worker since the last drain
+func (p *applierPool) failure() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.failed
+}
+
+// drain waits until the workers have written every dispatched part, then records the events
+// applied or dropped by the error policy in binlog order up to the first one that failed,
+// whose error it returns. Events written meanwhile after a failed one are not recorded, so
+// they are written again when they are read again.
+func (p *applierPool) drain() error {
+	if p == nil {
+		return nil
+	}
+	p.wg.Wait()
+	p.mu.Lock()
+	events, failed := p.events, p.failed
+	p.events, p.failed = nil, nil
+	p.mu.Unlock()
+	for _, ev := range events {
+		if ev.err != nil {
+			return ev.err
+		}
+		if ev.skipped && ev.rows == 0 {
+			p.h.markApplied(ev.event.Header)
+			continue
+		}
+		p.h.eventApplied(ev.event, ev.rows)
+	}
+	return failed
+}
+
+// close drains the workers and stops them
+func (p *applierPool) close() {
+	if p == nil {
+		return
+	}
+	if err := p.drain(); err != nil {
+		p.h.logger.Errorf("[MariaDB] Failed to apply events still queued at shutdown: %v", err)
+	}
+	for _, queue := range p.queues {
+		close(queue)
+	}
+}
+
+// applyConcurrently hands the rows of e to the workers owning them
+func (h *MariaDBEventHandler) applyConcurrently(t *rowTarget, e *canal.RowsEvent) error {
+	if h.appliers.failure() != nil {
+		// Stop reading; the applied position stays before the failed event, so canal reads it
+		// again once it reconnects
+		return h.flush()
+	}
+	if h.appliers.dispatch(t, e) {
+		return nil
+	}
+	if err := h.flush(); err != nil {
+		return err
+	}
+	return h.applyEvent(t, e)
+}
+
+// applyPart writes part of an event on a worker like applyEvent, reporting whether the error
+// policy dropped it and leaving the event's bookkeeping to drain
+func (h *MariaDBEventHandler) applyPart(t *rowTarget, e *canal.RowsEvent) (int, bool, error) {
+	var rowCount int
+	err := h.withRetry(fmt.Sprintf("%s on %s", e.Action, t.qualifiedName()), func() error {
+		var applyErr error
+		rowCount, applyErr = h.applyRows(t, e)
+		return applyErr
+	})
+	if err != nil {
+		if err := h.applyErrorPolicy(t, e, err); err != nil {
+			return 0, false, err
+		}
+		return 0, true, nil
+	}
+	return rowCount, false, nil
+}
+
+// reportQueueDepth publishes the number of events waiting to be written
+func (h *MariaDBEventHandler) reportQueueDepth(n int64) {
+	h.status.setQueueDepth(n)
+	metrics.SetApplyQueueDepth(metricsType, n)
+}
@@ -0,0 +1,57 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// runApplySQL executes the pre_apply_sql or post_apply_sql statements of target table on db,
+// in order, stopping at the first that fails
+func runApplySQL(ctx context.Context, db execer, hook, table string, statements []string) error {
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s of %s failed on %q: %w", hook, table, stmt, err)
+		}
+	}
+	return nil
+}
+
+// applySQL runs the pre_apply_sql, or with post the post_apply_sql, of t within tx when the
+// table runs them around its incremental writes
+func (h *MariaDBEventHandler) applySQL(tx execer, t *rowTarget, post bool) error {
+	if !t.tableMap.ApplySQLIncremental {
+		return nil
+	}
+	hook, statements := "pre_apply_sql", t.tableMap.PreApplySQL
+	if post {
+		hook, statements = "post_apply_sql", t.tableMap.PostApplySQL
+	}
+	ctx, cancel := h.writeContext()
+	defer cancel()
+	return runApplySQL(ctx, tx, hook, t.qualifiedName(), statements)
+}
+
+// applySQLTargets returns the targets of a write batch that run apply SQL, each once in the
+// order they first appear
+func applySQLTargets(batch []pendingEvent) []*rowTarget {
+	var targets []*rowTarget
+	seen := make(map[string]bool)
+	for _, p := range batch {
+		name := p.target.qualifiedName()
+		if !p.target.tableMap.ApplySQLIncremental || seen[name] {
+			continue
+		}
+		seen[name] = true
+		targets = append(targets, p.target)
+	}
+	return targets
+}
+
+// discardConn closes a connection without returning it to the pool, so session settings
+// changed by pre_apply_sql do not outlive a failed copy
+func discardConn(conn *sql.Conn) {
+	_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	conn.Close()
+}
@@ -0,0 +1,172 @@
+package mariadb
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/retail-ai-inc/sync/pkg/metrics"
+)
+
+// auditFlushInterval bounds how long an audit record may sit in the write buffer
+const auditFlushInterval = time.Second
+
+// auditRecord is one JSON line of the audit log, describing a change applied to the target
+type auditRecord struct {
+	Time       time.Time              `json:"time"`
+	Source     string                 `json:"source"`
+	Target     string                 `json:"target"`
+	Action     string                 `json:"action"`
+	Phase      string                 `json:"phase"`
+	PrimaryKey map[string]interface{} `json:"primary_key,omitempty"`
+}
+
+// auditLog appends audit records to a file. Writes are buffered and flushed periodically
+// rather than synced per row; a nil *auditLog discards records.
+type auditLog struct {
+	mu   sync.Mutex
+	f    *os.File
+	w    *bufio.Writer
+	stop chan struct{}
+	done chan struct{}
+}
+
+// openAuditLog opens path for appending and starts the periodic flush
+func openAuditLog(path string) (*auditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create directory for audit log %s: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	a := &auditLog{
+		f:    f,
+		w:    bufio.NewWriter(f),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go a.flushLoop()
+	return a, nil
+}
+
+func (a *auditLog) flushLoop() {
+	defer close(a.done)
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			a.mu.Lock()
+			a.w.Flush()
+			a.mu.Unlock()
+		}
+	}
+}
+
+// write appends records as JSON lines
+func (a *auditLog) write(records ...auditRecord) error {
+	if a == nil || len(records) == 0 {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	enc := json.NewEncoder(a.w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("failed to write audit record: %w", err)
+		}
+	}
+	return nil
+}
+
+// close stops the flush loop and flushes, syncs and closes the file
+func (a *auditLog) close() error {
+	if a == nil {
+		return nil
+	}
+	close(a.stop)
+	<-a.done
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.w.Flush(); err != nil {
+		a.f.Close()
+		return fmt.Errorf("failed to flush audit log: %w", err)
+	}
+	if err := a.f.Sync(); err != nil {
+		a.f.Close()
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	return a.f.Close()
+}
+
+// auditValue makes a key value readable in JSON; raw bytes would otherwise be base64 encoded
+func auditValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// auditKeyValues returns the primary key of a binlog row keyed by target column name
+func (t *rowTarget) auditKeyValues(row []interface{}) map[string]interface{} {
+	if len(t.table.PKColumns) == 0 {
+		return nil
+	}
+	key := make(map[string]interface{}, len(t.table.PKColumns))
+	for _, pkIndex := range t.table.PKColumns {
+		if pkIndex >= len(row) {
+			continue
+		}
+		name := t.sourceColumns[pkIndex]
+		if target := t.targetColumns[pkIndex]; target != "" {
+			name = target
+		}
+		key[name] = auditValue(row[pkIndex])
+	}
+	return key
+}
+
+// recordAudit queues an audit record for the event; it is written once the transaction commits
+func (t *rowTarget) recordAudit(action string, row []interface{}) {
+	t.audit = append(t.audit, auditRecord{
+		Time:       time.Now().UTC(),
+		Source:     t.table.Schema + "." + t.table.Name,
+		Target:     t.qualifiedName(),
+		Action:     action,
+		Phase:      metrics.PhaseIncremental,
+		PrimaryKey: t.auditKeyValues(row),
+	})
+}
+
+// initialAuditRecords builds the audit records of one initial sync batch
+func initialAuditRecords(source, target string, cols, keyCols []string, rows [][]interface{}) []auditRecord {
+	now := time.Now().UTC()
+	records := make([]auditRecord, len(rows))
+	for i, row := range rows {
+		key := make(map[string]interface{}, len(keyCols))
+		for _, keyCol := range keyCols {
+			if idx := indexOf(cols, keyCol); idx >= 0 && idx < len(row) {
+				key[keyCol] = auditValue(row[idx])
+			}
+		}
+		records[i] = auditRecord{
+			Time:       now,
+			Source:     source,
+			Target:     target,
+			Action:     canal.InsertAction,
+			Phase:      metrics.PhaseInitial,
+			PrimaryKey: key,
+		}
+	}
+	return records
+}
@@ -0,0 +1,95 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// erDBAccessDenied is ER_DBACCESS_DENIED_ERROR, sent when the user lacks a privilege on a database
+const erDBAccessDenied = 1044
+
+// charsetName matches the character set and collation names accepted for created databases
+var charsetName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// checkTargetCharset validates target_charset and target_collation, which are written into
+// CREATE DATABASE statements as they are
+func (s *MariaDBSyncer) checkTargetCharset() error {
+	if s.cfg.TargetCharset != "" && !charsetName.MatchString(s.cfg.TargetCharset) {
+		return fmt.Errorf("invalid target_charset %q for MariaDB", s.cfg.TargetCharset)
+	}
+	if s.cfg.TargetCollation != "" && !charsetName.MatchString(s.cfg.TargetCollation) {
+		return fmt.Errorf("invalid target_collation %q for MariaDB", s.cfg.TargetCollation)
+	}
+	if (s.cfg.TargetCharset != "" || s.cfg.TargetCollation != "") && !s.cfg.AutoCreateTarget {
+		return fmt.Errorf("target_charset and target_collation for MariaDB require auto_create_target")
+	}
+	return nil
+}
+
+// prefixTargetDatabases returns a copy of mappings whose target databases carry
+// target_database_prefix; a mapping without target_database is named after its source
+// database. Extra targets keep their databases.
+func prefixTargetDatabases(mappings []config.DatabaseMapping, prefix string) []config.DatabaseMapping {
+	if prefix == "" {
+		return mappings
+	}
+	prefixed := make([]config.DatabaseMapping, len(mappings))
+	for i, mapping := range mappings {
+		name := mapping.TargetDatabase
+		if name == "" {
+			name = mapping.SourceDatabase
+		}
+		mapping.TargetDatabase = prefix + name
+		prefixed[i] = mapping
+	}
+	return prefixed
+}
+
+// createTargetDatabases creates the target databases of mappings missing on db when
+// auto_create_target is set. Only missing databases need the CREATE privilege, so an
+// existing target works with a user that lacks it.
+func (s *MariaDBSyncer) createTargetDatabases(ctx context.Context, db *sql.DB, mappings []config.DatabaseMapping) error {
+	if !s.cfg.AutoCreateTarget {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, mapping := range mappings {
+		name := mapping.TargetDatabase
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		var existing string
+		err := db.QueryRowContext(ctx, "SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", name).Scan(&existing)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to check whether target database %s exists: %w", name, err)
+		}
+
+		stmt := "CREATE DATABASE IF NOT EXISTS " + quoteIdent(name)
+		if s.cfg.TargetCharset != "" {
+			stmt += " CHARACTER SET " + s.cfg.TargetCharset
+		}
+		if s.cfg.TargetCollation != "" {
+			stmt += " COLLATE " + s.cfg.TargetCollation
+		}
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			var myErr *mysqldriver.MySQLError
+			if errors.As(err, &myErr) && myErr.Number == erDBAccessDenied {
+				return fmt.Errorf("target database %s does not exist and the target user lacks the CREATE privilege to create it: %w", name, err)
+			}
+			return fmt.Errorf("failed to create target database %s: %w", name, err)
+		}
+		s.logger.Infof("[MariaDB] Created target database %s", name)
+	}
+	return nil
+}
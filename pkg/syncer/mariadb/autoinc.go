@@ -0,0 +1,45 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// resetAutoIncrement moves the AUTO_INCREMENT counter of a target table past its largest key
+// for reset_auto_increment. The initial sync writes the source's auto-increment values
+// explicitly, so rows inserted on the target itself would otherwise collide with them.
+// Tables without an auto-increment column and empty tables are left alone.
+func (s *MariaDBSyncer) resetAutoIncrement(ctx context.Context, db *sql.DB, database, table string) error {
+	var col string
+	err := db.QueryRowContext(ctx,
+		"SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND EXTRA LIKE '%auto_increment%'",
+		database, table).Scan(&col)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up auto-increment column: %w", err)
+	}
+
+	// Read as text, since an unsigned BIGINT key may exceed the int64 range
+	var max sql.NullString
+	if err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT MAX(%s) FROM %s", quoteIdent(col), quoteTable(database, table))).Scan(&max); err != nil {
+		return fmt.Errorf("failed to read largest %s: %w", col, err)
+	}
+	if !max.Valid || max.String == strconv.FormatUint(math.MaxUint64, 10) {
+		return nil
+	}
+	last, err := strconv.ParseUint(max.String, 10, 64)
+	if err != nil {
+		return fmt.Errorf("unexpected %s value %q: %w", col, max.String, err)
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = %d", quoteTable(database, table), last+1)); err != nil {
+		return fmt.Errorf("failed to set AUTO_INCREMENT: %w", err)
+	}
+	s.logger.Infof("[MariaDB] Set AUTO_INCREMENT of %s.%s to %d", database, table, last+1)
+	return nil
+}
@@ -0,0 +1,222 @@
+package mariadb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+)
+
+// pendingEvent is a row event waiting in the write batch
+type pendingEvent struct {
+	target *rowTarget
+	event  *canal.RowsEvent
+}
+
+// enqueue adds an event to the write batch and flushes once the batch is full or old enough.
+// Canal reports the end of each source transaction through OnPosSynced, which flushes too,
+// so a batch collects the row events of a source transaction.
+func (h *MariaDBEventHandler) enqueue(t *rowTarget, e *canal.RowsEvent) error {
+	if len(h.pending) == 0 {
+		h.pendingSince = time.Now()
+	}
+	h.pending = append(h.pending, pendingEvent{target: t, event: e})
+	h.pendingRows += len(e.Rows)
+	h.reportQueueDepth(int64(len(h.pending)))
+	if h.pendingRows >= h.batchSize || time.Since(h.pendingSince) >= h.batchDelay {
+		return h.flush()
+	}
+	return nil
+}
+
+// discardPending drops the batch of a canal that stopped mid-transaction, and the failure of
+// its last flush; their rows are read again from the applied position. Rows already handed to
+// the appliers are written, and the events applied are not read again.
+func (h *MariaDBEventHandler) discardPending() {
+	// A failed write was logged by its worker and is read again
+	_ = h.appliers.drain()
+	h.pending = nil
+	h.pendingRows = 0
+	h.flushErr = nil
+	h.reportQueueDepth(0)
+}
+
+// flush writes the pending events in a single target transaction, or waits until the
+// appliers have written theirs. Once a flush failed, later ones fail with its error until
+// discardPending, so the sync canal runs on closing is not mistaken for the lost rows being
+// written.
+func (h *MariaDBEventHandler) flush() error {
+	if h.flushErr != nil {
+		return h.flushErr
+	}
+	if err := h.writePending(); err != nil {
+		h.flushErr = err
+		return err
+	}
+	return nil
+}
+
+// writePending writes the events of flush
+func (h *MariaDBEventHandler) writePending() error {
+	if err := h.appliers.drain(); err != nil {
+		return err
+	}
+	if len(h.pending) == 0 {
+		return nil
+	}
+	batch := h.pending
+	h.pending = nil
+	h.pendingRows = 0
+	h.reportQueueDepth(0)
+
+	var counts []int
+	err := h.withRetry(fmt.Sprintf("batch of %d events", len(batch)), func() error {
+		var applyErr error
+		counts, applyErr = h.applyBatch(batch)
+		return applyErr
+	})
+	// A strict_apply mismatch is applied one by one even when it stops the sync, so its error
+	// names the row, and so is an ignored error, so only the events failing with it are dropped
+	var rowsErr *rowsAffectedError
+	_, ignored := h.ignoredErrorCode(err)
+	if err != nil && (h.errorPolicy == "" || h.errorPolicy == errorPolicyStop || stopsSync(err)) && !errors.As(err, &rowsErr) && !ignored {
+		h.logger.Errorf("[MariaDB] Failed to apply batch of %d events: %v", len(batch), err)
+		err = &ApplyError{Err: fmt.Errorf("failed to apply batch of %d events: %w", len(batch), err)}
+		h.status.setError(err)
+		return err
+	}
+	if err != nil {
+		// Write the events one at a time so the policy only applies to those the target rejects
+		h.logger.Warnf("[MariaDB] Failed to apply batch of %d events, applying them one by one: %v", len(batch), err)
+		for _, p := range batch {
+			if err := h.applyEvent(p.target, p.event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i, p := range batch {
+		h.eventApplied(p.event, counts[i])
+	}
+	return nil
+}
+
+// applyBatch writes the events in order within one transaction, merging runs of inserts into
+// the same target into multi-row INSERTs, and returns the rows applied per event
+func (h *MariaDBEventHandler) applyBatch(batch []pendingEvent) ([]int, error) {
+	tx, err := h.targetDB.BeginTx(h.context(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin target transaction: %w", err)
+	}
+	for _, p := range batch {
+		p.target.resetRecords()
+	}
+
+	hooked := applySQLTargets(batch)
+	for _, t := range hooked {
+		if err = h.applySQL(tx, t, false); err != nil {
+			break
+		}
+	}
+	counts := make([]int, len(batch))
+	for i := 0; i < len(batch) && err == nil; {
+		j := i + 1
+		for j < len(batch) && sameInsertTarget(batch[i], batch[j]) {
+			j++
+		}
+		// Resolving a conflict reads the existing row, so such inserts are written one by one
+		if batch[i].event.Action == canal.InsertAction && (j-i > 1 || len(batch[i].event.Rows) > 1) && h.conflictResolver(batch[i].target) == nil {
+			err = h.handleInsertBatch(tx, batch[i:j], counts[i:j])
+		} else {
+			counts[i], err = h.applyEventRows(tx, batch[i].target, batch[i].event)
+		}
+		i = j
+	}
+	for _, t := range hooked {
+		if err != nil {
+			break
+		}
+		err = h.applySQL(tx, t, true)
+	}
+
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			h.logger.Errorf("[MariaDB] Failed to roll back target transaction for batch: %v", rbErr)
+		}
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit target transaction: %w", err)
+	}
+	for _, p := range batch {
+		h.publishRecords(p.target)
+	}
+	return counts, nil
+}
+
+// sameInsertTarget reports whether two inserts write the same columns of the same target
+func sameInsertTarget(a, b pendingEvent) bool {
+	return a.event.Action == canal.InsertAction && b.event.Action == canal.InsertAction &&
+		a.event.Table.Schema == b.event.Table.Schema && a.event.Table.Name == b.event.Table.Name &&
+		a.target.qualifiedName() == b.target.qualifiedName()
+}
+
+// handleInsertBatch inserts the matching rows of a run of insert events with one statement,
+// or several when the rows would exceed the statement size limit
+func (h *MariaDBEventHandler) handleInsertBatch(tx execer, group []pendingEvent, counts []int) error {
+	var columnNames []string
+	var rows [][]interface{}
+	for i, p := range group {
+		for _, row := range p.event.Rows {
+			if !p.target.matches(row) {
+				continue
+			}
+			cols, values := p.target.insertValues(row)
+			if columnNames == nil {
+				columnNames = cols
+			}
+			args, err := insertArgs(columnNames, cols, values)
+			if err != nil {
+				return fmt.Errorf("failed to batch inserts into %s: %w", p.target.qualifiedName(), err)
+			}
+			rows = append(rows, args)
+			counts[i]++
+			h.recordApplied(p.target, canal.InsertAction, nil, row)
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	t := group[0].target
+	keyCols := targetKeyColumns(t.table, t.targetColumns)
+	baseSQL, err := buildInsertSQL(t.tableMap.InsertMode, t.dbName, t.tableMap.TargetTable, columnNames, keyCols, 0)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range insertChunks(rows, len(baseSQL), h.statementLimit) {
+		query, err := buildInsertSQL(t.tableMap.InsertMode, t.dbName, t.tableMap.TargetTable, columnNames, keyCols, len(chunk))
+		if err != nil {
+			return err
+		}
+		var args []interface{}
+		for _, values := range chunk {
+			args = append(args, values...)
+		}
+		// Statements vary with the row count, so they are not worth caching
+		start := time.Now()
+		ctx, cancel := h.writeContext()
+		res, err := tx.ExecContext(ctx, query, args...)
+		cancel()
+		h.slowWrites.observe(start, canal.InsertAction, t.qualifiedName(), len(chunk))
+		if err != nil {
+			return fmt.Errorf("failed to insert batch into target database: %w", &statementError{query: query, err: h.writeError(ctx, err)})
+		}
+		lo, hi := insertAffected(t.tableMap.InsertMode, int64(len(chunk)))
+		if err := h.checkAffected(t, canal.InsertAction, res, nil, lo, hi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package mariadb
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// canalLogger passes the log lines of canal, its binlog syncer and its dump to the syncer's
+// logger, tagged with component=canal. Fatal lines are logged as errors, since canal must
+// not exit the process Start runs in.
+type canalLogger struct {
+	*logrus.Entry
+}
+
+func newCanalLogger(logger *logrus.Logger) *canalLogger {
+	return &canalLogger{Entry: logger.WithField("component", "canal")}
+}
+
+func (l *canalLogger) Fatal(args ...interface{}) { l.Error(args...) }
+
+func (l *canalLogger) Fatalf(format string, args ...interface{}) { l.Errorf(format, args...) }
+
+func (l *canalLogger) Fatalln(args ...interface{}) { l.Errorln(args...) }
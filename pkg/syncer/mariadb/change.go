@@ -0,0 +1,112 @@
+package mariadb
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultChangeBufferSize is the number of change events queued for OnChange callbacks
+const defaultChangeBufferSize = 1024
+
+// ChangeEvent describes a change the incremental sync applied to the target
+type ChangeEvent struct {
+	Source string                 // source db.table
+	Target string                 // target db.table
+	Action string                 // canal.InsertAction, canal.UpdateAction or canal.DeleteAction
+	Row    map[string]interface{} // inserted, updated or deleted row by source column, after value conversion
+	OldRow map[string]interface{} // row before an update; nil for inserts and deletes
+}
+
+// OnChange registers fn to be called after each change committed to the target. Callbacks
+// run on a single goroutine in commit order, fed by a buffer of change_buffer_size events;
+// when a slow callback lets the buffer fill, further events are dropped and counted rather
+// than stalling replication. OnChange must be called before Start.
+func (s *MariaDBSyncer) OnChange(fn func(ChangeEvent)) {
+	s.changeCallbacks = append(s.changeCallbacks, fn)
+}
+
+// changeNotifier delivers change events to callbacks; a nil *changeNotifier discards them
+type changeNotifier struct {
+	callbacks []func(ChangeEvent)
+	events    chan ChangeEvent
+	done      chan struct{}
+	dropped   atomic.Int64
+	logger    *logrus.Logger
+	closeOnce sync.Once
+}
+
+// newChangeNotifier starts delivering to callbacks, or returns nil when there are none
+func newChangeNotifier(callbacks []func(ChangeEvent), bufferSize int, logger *logrus.Logger) *changeNotifier {
+	if len(callbacks) == 0 {
+		return nil
+	}
+	n := &changeNotifier{
+		callbacks: callbacks,
+		events:    make(chan ChangeEvent, bufferSize),
+		done:      make(chan struct{}),
+		logger:    logger,
+	}
+	go n.deliver()
+	return n
+}
+
+func (n *changeNotifier) deliver() {
+	defer close(n.done)
+	for e := range n.events {
+		for _, fn := range n.callbacks {
+			fn(e)
+		}
+	}
+}
+
+// publish queues events without blocking, dropping those that do not fit in the buffer
+func (n *changeNotifier) publish(events ...ChangeEvent) {
+	if n == nil {
+		return
+	}
+	for _, e := range events {
+		select {
+		case n.events <- e:
+		default:
+			if dropped := n.dropped.Add(1); dropped == 1 || dropped%1000 == 0 {
+				n.logger.Warnf("[MariaDB] Change callback buffer is full; %d change event(s) dropped so far", dropped)
+			}
+		}
+	}
+}
+
+// close waits for the queued events to be delivered
+func (n *changeNotifier) close() {
+	if n == nil {
+		return
+	}
+	n.closeOnce.Do(func() { close(n.events) })
+	<-n.done
+}
+
+// rowValues maps a binlog row by source column name
+func (t *rowTarget) rowValues(row []interface{}) map[string]interface{} {
+	values := make(map[string]interface{}, len(row))
+	for i, v := range row {
+		if i < len(t.sourceColumns) {
+			values[t.sourceColumns[i]] = v
+		}
+	}
+	return values
+}
+
+// recordChange queues a change event; it is published once the transaction commits
+func (t *rowTarget) recordChange(action string, oldRow, row []interface{}) {
+	e := ChangeEvent{
+		Source: t.table.Schema + "." + t.table.Name,
+		Target: t.qualifiedName(),
+		Action: action,
+		Row:    t.rowValues(row),
+	}
+	if oldRow != nil {
+		e.OldRow = t.rowValues(oldRow)
+	}
+	t.changes = append(t.changes, e)
+}
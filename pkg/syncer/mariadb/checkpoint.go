@@ -0,0 +1,178 @@
+package mariadb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// tableCheckpoint is the initial sync progress of one source table
+type tableCheckpoint struct {
+	// LastKey holds the primary key values of the last copied row, as strings
+	LastKey []string `json:"last_key,omitempty"`
+	// KeyColumns names the columns of LastKey when initial_sync_order_by replaced the primary key
+	KeyColumns []string `json:"key_columns,omitempty"`
+	Done       bool     `json:"done,omitempty"`
+}
+
+// checkpointStore persists initial sync checkpoints keyed by "db.table" in a JSON file
+type checkpointStore struct {
+	path   string
+	mu     sync.Mutex
+	tables map[string]tableCheckpoint
+}
+
+// initialSyncCheckpointPath returns the configured checkpoint file or one next to the position file
+func (s *MariaDBSyncer) initialSyncCheckpointPath() string {
+	if s.cfg.InitialSyncCheckpointPath != "" {
+		return s.cfg.InitialSyncCheckpointPath
+	}
+	if s.cfg.MySQLPositionPath != "" {
+		return s.cfg.MySQLPositionPath + ".initial_sync"
+	}
+	return ""
+}
+
+// loadCheckpointStore reads the checkpoint file; a missing file starts with no checkpoints
+func loadCheckpointStore(path string) (*checkpointStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("resumable initial sync for MariaDB requires initial_sync_checkpoint_path or mysql_position_path")
+	}
+	store := &checkpointStore{path: path, tables: map[string]tableCheckpoint{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read initial sync checkpoint file %s: %w", path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &store.tables); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal initial sync checkpoint file %s: %w", path, err)
+		}
+	}
+	return store, nil
+}
+
+// get returns the checkpoint of a table and whether one was recorded
+func (c *checkpointStore) get(table string) (tableCheckpoint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cp, ok := c.tables[table]
+	return cp, ok
+}
+
+// set records the checkpoint of a table and persists the whole store atomically
+func (c *checkpointStore) set(table string, cp tableCheckpoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tables[table] = cp
+	data, err := json.Marshal(c.tables)
+	if err != nil {
+		return fmt.Errorf("failed to marshal initial sync checkpoints: %w", err)
+	}
+	return writeFileAtomic(c.path, data)
+}
+
+// reset forgets the checkpoints of a source table, including those of its extra targets,
+// so that its next copy starts over
+func (c *checkpointStore) reset(table string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.tables {
+		if key == table || strings.HasPrefix(key, table+" -> ") {
+			delete(c.tables, key)
+		}
+	}
+	data, err := json.Marshal(c.tables)
+	if err != nil {
+		return fmt.Errorf("failed to marshal initial sync checkpoints: %w", err)
+	}
+	return writeFileAtomic(c.path, data)
+}
+
+// keyString converts a scanned key value into the string stored in a checkpoint
+func keyString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(val)
+	case string:
+		return val
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case uint64:
+		return strconv.FormatUint(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case time.Time:
+		return val.Format("2006-01-02 15:04:05.999999")
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// keyAfter builds the condition selecting rows ordered after the key values last in
+// lexicographic primary key order. The expanded form (a > ? OR (a = ? AND b > ?)) is used
+// instead of a row comparison, which MariaDB does not turn into an index range scan.
+func keyAfter(pkCols []string, last []string) (string, []interface{}) {
+	var terms []string
+	var args []interface{}
+	for i := range pkCols {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, fmt.Sprintf("%s = ?", quoteIdent(pkCols[j])))
+			args = append(args, last[j])
+		}
+		parts = append(parts, fmt.Sprintf("%s > ?", quoteIdent(pkCols[i])))
+		args = append(args, last[i])
+		terms = append(terms, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", args
+}
+
+// initialSyncOrder returns the columns the initial sync of a table orders its rows by: its
+// initial_sync_order_by followed by the primary key columns it leaves out, so the order is
+// total and can key a checkpoint. keyCols is nil when that is just the primary key.
+func initialSyncOrder(tableMap config.TableMapping, pkCols []string) (orderCols, keyCols []string) {
+	if len(tableMap.InitialSyncOrderBy) == 0 {
+		return pkCols, nil
+	}
+	orderCols = append([]string(nil), tableMap.InitialSyncOrderBy...)
+	for _, pk := range pkCols {
+		if indexOf(orderCols, pk) < 0 {
+			orderCols = append(orderCols, pk)
+		}
+	}
+	if slices.Equal(orderCols, pkCols) {
+		return pkCols, nil
+	}
+	return orderCols, orderCols
+}
+
+// keyColumnsOrPK describes the key columns of a checkpoint, nil being the primary key
+func keyColumnsOrPK(keyCols []string) string {
+	if len(keyCols) == 0 {
+		return "primary key"
+	}
+	return strings.Join(keyCols, ", ")
+}
+
+// indexOf returns the position of name in list, or -1
+func indexOf(list []string, name string) int {
+	for i, v := range list {
+		if v == name {
+			return i
+		}
+	}
+	return -1
+}
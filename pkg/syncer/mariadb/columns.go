@@ -0,0 +1,123 @@
+package mariadb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// resolveTargetColumns returns the target column name for each source column, in source
+// order. Columns absent from the ColumnMap keep their name; an empty string marks a
+// column that must not be written to the target, either mapped to "" or listed in
+// ExcludeColumns.
+func resolveTargetColumns(tableMap config.TableMapping, sourceCols []string) []string {
+	targetCols := make([]string, len(sourceCols))
+	for i, col := range sourceCols {
+		targetCols[i] = col
+		if mapped, ok := tableMap.ColumnMap[col]; ok {
+			targetCols[i] = mapped
+		}
+		for _, excluded := range tableMap.ExcludeColumns {
+			if strings.EqualFold(col, excluded) {
+				targetCols[i] = ""
+				break
+			}
+		}
+	}
+	return targetCols
+}
+
+// excludeGenerated blanks target columns that are generated on the target, since MariaDB
+// rejects writes to them; targetCols is modified in place and returned
+func excludeGenerated(targetCols []string, generated map[string]bool) []string {
+	if len(generated) == 0 {
+		return targetCols
+	}
+	for i, col := range targetCols {
+		if generated[strings.ToLower(col)] {
+			targetCols[i] = ""
+		}
+	}
+	return targetCols
+}
+
+// writableColumns returns the source and target names of the columns that are written
+func writableColumns(sourceCols, targetCols []string) ([]string, []string) {
+	var src, tgt []string
+	for i, col := range targetCols {
+		if col == "" {
+			continue
+		}
+		src = append(src, sourceCols[i])
+		tgt = append(tgt, col)
+	}
+	return src, tgt
+}
+
+// writableValues picks the row values for the columns that are written
+func writableValues(targetCols []string, row []interface{}) ([]string, []interface{}) {
+	cols := make([]string, 0, len(targetCols))
+	values := make([]interface{}, 0, len(targetCols))
+	for i, col := range targetCols {
+		if col == "" || i >= len(row) {
+			continue
+		}
+		cols = append(cols, col)
+		values = append(values, row[i])
+	}
+	return cols, values
+}
+
+// changedColumns returns targetCols with "" for the columns an update leaves unchanged and
+// for the primary key, so writableValues only sets the changed columns
+func changedColumns(table *schema.Table, targetCols []string, oldRow, newRow []interface{}) []string {
+	cols := make([]string, len(targetCols))
+	for i, col := range targetCols {
+		if i < len(oldRow) && i < len(newRow) && !sameValue(oldRow[i], newRow[i]) && !table.IsPrimaryKey(i) {
+			cols[i] = col
+		}
+	}
+	return cols
+}
+
+// sameValue reports whether two row values are equal; NULL only equals NULL
+func sameValue(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return keyString(a) == keyString(b)
+}
+
+// keyColumn returns the target name of a primary key column, which must not be excluded
+func keyColumn(targetCols, sourceCols []string, pkIndex int) (string, error) {
+	if targetCols[pkIndex] == "" {
+		return "", fmt.Errorf("primary key column %s is excluded from the target", sourceCols[pkIndex])
+	}
+	return targetCols[pkIndex], nil
+}
+
+// targetKeyColumns returns the target names of the table's primary key columns
+func targetKeyColumns(table *schema.Table, targetCols []string) []string {
+	var keyCols []string
+	for _, pkIndex := range table.PKColumns {
+		if targetCols[pkIndex] != "" {
+			keyCols = append(keyCols, targetCols[pkIndex])
+		}
+	}
+	return keyCols
+}
+
+// primaryKeyChanged reports whether any primary key value differs between the old and new row
+func primaryKeyChanged(table *schema.Table, oldRow, newRow []interface{}) bool {
+	for _, pkIndex := range table.PKColumns {
+		if pkIndex >= len(oldRow) || pkIndex >= len(newRow) {
+			continue
+		}
+		if keyString(oldRow[pkIndex]) != keyString(newRow[pkIndex]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package mariadb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/retail-ai-inc/sync/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+// generatedColumnType is the exclude_column_types entry matching generated source columns
+const generatedColumnType = "generated"
+
+// maxTypeBytes is the largest value of the string types whose size their type name implies
+var maxTypeBytes = map[string]uint64{
+	"tinytext": 1<<8 - 1, "tinyblob": 1<<8 - 1,
+	"text": 1<<16 - 1, "blob": 1<<16 - 1,
+	"mediumtext": 1<<24 - 1, "mediumblob": 1<<24 - 1,
+	"longtext": 1<<32 - 1, "longblob": 1<<32 - 1, "json": 1<<32 - 1,
+}
+
+// typeExclusions drops source columns by type or size for every table, as if they were
+// listed in its exclude_columns. Its methods are no-ops on nil exclusions.
+type typeExclusions struct {
+	types  map[string]bool // lower-cased type names, such as longblob or generated
+	larger uint64          // columns above this declared length, 0 for no limit
+	logger *logrus.Logger
+
+	mu     sync.Mutex
+	logged map[string]string // columns last logged as excluded, by source db.table
+}
+
+// newTypeExclusions validates exclude_column_types and exclude_columns_larger_than; it
+// returns nil when neither is set
+func (s *MariaDBSyncer) newTypeExclusions() (*typeExclusions, error) {
+	if s.cfg.ExcludeColumnsLargerThan < 0 {
+		return nil, fmt.Errorf("invalid exclude_columns_larger_than %d for MariaDB: must not be negative", s.cfg.ExcludeColumnsLargerThan)
+	}
+	if len(s.cfg.ExcludeColumnTypes) == 0 && s.cfg.ExcludeColumnsLargerThan == 0 {
+		return nil, nil
+	}
+	x := &typeExclusions{
+		types:  make(map[string]bool, len(s.cfg.ExcludeColumnTypes)),
+		larger: uint64(s.cfg.ExcludeColumnsLargerThan),
+		logger: s.logger,
+		logged: make(map[string]string),
+	}
+	for _, name := range s.cfg.ExcludeColumnTypes {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || strings.ContainsAny(name, "( ") {
+			return nil, fmt.Errorf("invalid exclude_column_types entry %q for MariaDB: must be a bare type name such as longblob or %s",
+				name, generatedColumnType)
+		}
+		x.types[name] = true
+	}
+	return x, nil
+}
+
+// apply returns tableMap with the columns of table excluded by type or size added to its
+// exclude_columns. Primary key columns are kept, since rows are matched by them. The
+// excluded columns are logged once per table, and again when its schema changes them.
+func (x *typeExclusions) apply(table *schema.Table, tableMap config.TableMapping) config.TableMapping {
+	if x == nil || table == nil {
+		return tableMap
+	}
+	var excluded []string
+	for i := range table.Columns {
+		if !table.IsPrimaryKey(i) && x.excludes(&table.Columns[i]) {
+			excluded = append(excluded, table.Columns[i].Name)
+		}
+	}
+
+	key := table.Schema + "." + table.Name
+	list := strings.Join(excluded, ", ")
+	x.mu.Lock()
+	if prev, ok := x.logged[key]; !ok || prev != list {
+		x.logged[key] = list
+		if list != "" {
+			x.logger.Infof("[MariaDB] Excluding columns %s of %s by exclude_column_types and exclude_columns_larger_than", list, key)
+		}
+	}
+	x.mu.Unlock()
+
+	if len(excluded) == 0 {
+		return tableMap
+	}
+	// The table mapping is shared, so the list is extended on a copy
+	tableMap.ExcludeColumns = append(append([]string(nil), tableMap.ExcludeColumns...), excluded...)
+	return tableMap
+}
+
+// excludes reports whether col is dropped by its type or declared length
+func (x *typeExclusions) excludes(col *schema.TableColumn) bool {
+	typeName := baseTypeName(col.RawType)
+	if x.types[typeName] || (x.types[generatedColumnType] && (col.IsVirtual || col.IsStored)) {
+		return true
+	}
+	if x.larger == 0 {
+		return false
+	}
+	size := uint64(col.MaxSize)
+	if limit, ok := maxTypeBytes[typeName]; ok {
+		size = limit
+	}
+	return size > x.larger
+}
+
+// baseTypeName returns the lower-cased type of a column definition without its length or
+// attributes, e.g. varchar for "varchar(255)"
+func baseTypeName(rawType string) string {
+	name := strings.ToLower(strings.TrimSpace(rawType))
+	if i := strings.IndexAny(name, "( "); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
@@ -0,0 +1,281 @@
+package mariadb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// ConflictResolver decides what an upsert writes when the inserted row already exists on the
+// target. existing holds the target row as the driver reads it and incoming the row being
+// written, both keyed by target column. The returned columns are written to the existing
+// row, leaving its primary key and the columns not returned untouched; nil keeps the
+// existing row as it is.
+type ConflictResolver func(existing, incoming map[string]interface{}) map[string]interface{}
+
+// conflictResolvers holds the resolvers registered with RegisterConflictResolver by source
+// db.table
+type conflictResolvers map[string]ConflictResolver
+
+// Values of conflict_resolution
+const (
+	conflictSourceWins      = "source-wins"
+	conflictNewestTimestamp = "newest-timestamp"
+	conflictSkip            = "skip"
+)
+
+// conflictActionUpdate names the UPDATE of resolved rows apart from ordinary updates
+const conflictActionUpdate = "conflict_update"
+
+// RegisterConflictResolver installs fn for the incremental inserts of one source table in
+// insert_mode upsert, in place of its conflict_resolution. It must be called before Start.
+func (s *MariaDBSyncer) RegisterConflictResolver(database, table string, fn ConflictResolver) {
+	if s.resolvers == nil {
+		s.resolvers = make(conflictResolvers)
+	}
+	s.resolvers[database+"."+table] = fn
+}
+
+// validateConflictResolution checks conflict_resolution and its timestamp column on a table
+// mapping of source
+func validateConflictResolution(source string, tableMap config.TableMapping) error {
+	switch tableMap.ConflictResolution {
+	case "":
+		if tableMap.ConflictTimestampColumn != "" {
+			return fmt.Errorf("conflict_timestamp_column of %s requires conflict_resolution %s", source, conflictNewestTimestamp)
+		}
+		return nil
+	case conflictSourceWins, conflictSkip:
+	case conflictNewestTimestamp:
+		if tableMap.ConflictTimestampColumn == "" {
+			return fmt.Errorf("conflict_resolution %s of %s requires conflict_timestamp_column", conflictNewestTimestamp, source)
+		}
+	default:
+		return fmt.Errorf("invalid conflict_resolution %q of %s: must be %s, %s or %s",
+			tableMap.ConflictResolution, source, conflictSourceWins, conflictNewestTimestamp, conflictSkip)
+	}
+	if tableMap.InsertMode != insertModeUpsert {
+		return fmt.Errorf("conflict_resolution of %s requires insert_mode %s", source, insertModeUpsert)
+	}
+	return nil
+}
+
+// conflictResolver returns the resolver of t's inserts, nil when they are written as plain
+// upserts. Only tables with a primary key are resolved, since it finds the existing row.
+func (h *MariaDBEventHandler) conflictResolver(t *rowTarget) ConflictResolver {
+	if t.tableMap.InsertMode != insertModeUpsert || len(t.table.PKColumns) == 0 {
+		return nil
+	}
+	if fn := h.resolvers[t.table.Schema+"."+t.table.Name]; fn != nil {
+		return fn
+	}
+	switch t.tableMap.ConflictResolution {
+	case conflictNewestTimestamp:
+		return newestTimestampResolver(t.tableMap.ConflictTimestampColumn)
+	case conflictSkip:
+		return skipResolver
+	}
+	// source-wins is what the upsert itself does
+	return nil
+}
+
+// skipResolver keeps every existing row
+func skipResolver(existing, incoming map[string]interface{}) map[string]interface{} {
+	return nil
+}
+
+// newestTimestampResolver writes the incoming row unless the existing row has a newer value
+// in column; a NULL is older than any value
+func newestTimestampResolver(column string) ConflictResolver {
+	return func(existing, incoming map[string]interface{}) map[string]interface{} {
+		if compareTimestamps(incoming[column], existing[column]) < 0 {
+			return nil
+		}
+		return incoming
+	}
+}
+
+// compareTimestamps orders two DATETIME, TIMESTAMP or numeric values, whether they come from
+// the driver as bytes, text or typed values. Values that are neither compare as text.
+func compareTimestamps(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	ta, aTime := timestampValue(a)
+	tb, bTime := timestampValue(b)
+	if aTime && bTime {
+		return ta.Compare(tb)
+	}
+	na, aNum := numericValue(a)
+	nb, bNum := numericValue(b)
+	if aNum && bNum {
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(textValue(a), textValue(b))
+}
+
+func timestampValue(v interface{}) (time.Time, bool) {
+	if t, ok := v.(time.Time); ok {
+		return t, true
+	}
+	t, err := time.Parse(datetimeLayout, textValue(v))
+	return t, err == nil
+}
+
+func numericValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+	if n, ok := toInt64(v); ok {
+		return float64(n), true
+	}
+	f, err := strconv.ParseFloat(textValue(v), 64)
+	return f, err == nil
+}
+
+func textValue(v interface{}) string {
+	switch s := v.(type) {
+	case []byte:
+		return string(s)
+	case string:
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// handleConflictingInsert inserts row unless its primary key exists on the target, in which
+// case resolve decides what is written to the existing row. The existing row is locked
+// until the transaction ends, so it cannot change between reading and resolving it.
+func (h *MariaDBEventHandler) handleConflictingInsert(tx execer, t *rowTarget, row []interface{}, resolve ConflictResolver) error {
+	q, ok := tx.(querier)
+	if !ok {
+		return fmt.Errorf("conflict resolution on %s needs a target transaction", t.qualifiedName())
+	}
+	columnNames, values := t.insertValues(row)
+	// Unlike rowCondition this ignores source_tag, so a row merged from another source conflicts
+	var whereClauses []string
+	var whereValues []interface{}
+	for _, pkIndex := range t.table.PKColumns {
+		keyCol, err := keyColumn(t.targetColumns, t.sourceColumns, pkIndex)
+		if err != nil {
+			return err
+		}
+		whereClauses = append(whereClauses, fmt.Sprintf("%s = ?", quoteIdent(keyCol)))
+		whereValues = append(whereValues, row[pkIndex])
+	}
+	existing, err := h.selectExisting(q, t, columnNames, whereClauses, whereValues)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		query, err := buildInsertSQL(insertModeInsert, t.dbName, t.tableMap.TargetTable, columnNames, nil, 1)
+		if err != nil {
+			return err
+		}
+		key := stmtKey{table: t.qualifiedName(), action: canal.InsertAction}
+		res, err := h.exec(tx, t, key, query, values...)
+		if err != nil {
+			return fmt.Errorf("failed to insert into target database: %w", err)
+		}
+		if err := h.checkAffected(t, canal.InsertAction, res, row, 1, 1); err != nil {
+			return err
+		}
+		h.recordApplied(t, canal.InsertAction, nil, row)
+		return nil
+	}
+
+	incoming := make(map[string]interface{}, len(columnNames))
+	for i, col := range columnNames {
+		incoming[col] = values[i]
+	}
+	resolved := resolve(existing, incoming)
+	keyCols := targetKeyColumns(t.table, t.targetColumns)
+	var setColumns []string
+	for col := range resolved {
+		if indexOf(keyCols, col) < 0 {
+			setColumns = append(setColumns, col)
+		}
+	}
+	if len(setColumns) == 0 {
+		h.logger.Debugf("[MariaDB] Kept the existing row %s of %s on an insert conflict", formatRowKey(t, row), t.qualifiedName())
+		return nil
+	}
+	sort.Strings(setColumns)
+	setClauses := make([]string, len(setColumns))
+	args := make([]interface{}, 0, len(setColumns)+len(whereValues))
+	for i, col := range setColumns {
+		setClauses[i] = fmt.Sprintf("%s = ?", quoteIdent(col))
+		args = append(args, resolved[col])
+	}
+	args = append(args, whereValues...)
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		quoteTable(t.dbName, t.tableMap.TargetTable),
+		strings.Join(setClauses, ", "),
+		strings.Join(whereClauses, " AND "))
+	key := stmtKey{table: t.qualifiedName(), action: conflictActionUpdate}
+	res, err := h.exec(tx, t, key, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to write resolved row to target database: %w", err)
+	}
+	// Without found rows an UPDATE writing the values the row already has affects none
+	if err := h.checkAffected(t, canal.InsertAction, res, row, 0, 1); err != nil {
+		return err
+	}
+	h.logger.Debugf("[MariaDB] Resolved an insert conflict on row %s of %s", formatRowKey(t, row), t.qualifiedName())
+	h.recordApplied(t, canal.InsertAction, nil, row)
+	return nil
+}
+
+// selectExisting reads and locks the columns of the target row matching the where clauses,
+// returning nil when there is none
+func (h *MariaDBEventHandler) selectExisting(q querier, t *rowTarget, columns, whereClauses []string, whereValues []interface{}) (map[string]interface{}, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s FOR UPDATE",
+		strings.Join(quoteIdents(columns), ", "),
+		quoteTable(t.dbName, t.tableMap.TargetTable),
+		strings.Join(whereClauses, " AND "))
+	ctx, cancel := h.writeContext()
+	defer cancel()
+	rows, err := q.QueryContext(ctx, query, whereValues...)
+	if err != nil {
+		return nil, &statementError{query: query, err: h.writeError(ctx, err)}
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, &statementError{query: query, err: h.writeError(ctx, err)}
+		}
+		return nil, nil
+	}
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to read existing row of %s: %w", t.qualifiedName(), err)
+	}
+	existing := make(map[string]interface{}, len(columns))
+	for i, col := range columns {
+		existing[col] = values[i]
+	}
+	return existing, nil
+}
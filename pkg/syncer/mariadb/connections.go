@@ -0,0 +1,90 @@
+package mariadb
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+// connections are the settings Start and Preflight connect to the source and target with
+type connections struct {
+	targetDSN  string
+	tlsCfg     *tls.Config // nil without tls_config
+	tlsName    string      // registered name of tlsCfg
+	sourceDial DialFunc    // nil connects directly
+	release    func()      // deregisters the TLS config and dialers and closes the SSH tunnel
+}
+
+// prepareConnections registers tls_config and the dialers with the mysql driver and derives
+// the target DSN, also pointing the source DSN of direct queries at them. Its errors are
+// ConfigErrors; on success the caller calls release once done.
+func (s *MariaDBSyncer) prepareConnections() (_ *connections, err error) {
+	c := &connections{targetDSN: s.cfg.TargetConnection}
+	var releases []func()
+	c.release = func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+	defer func() {
+		if err != nil {
+			c.release()
+			err = &ConfigError{Err: err}
+		}
+	}()
+
+	if s.cfg.TLSConfig != nil {
+		if c.tlsCfg, c.tlsName, err = s.registerTLS(); err != nil {
+			return nil, err
+		}
+		name := c.tlsName
+		releases = append(releases, func() { mysqldriver.DeregisterTLSConfig(name) })
+		if c.targetDSN, err = dsnWithTLSConfig(c.targetDSN, name); err != nil {
+			return nil, err
+		}
+	}
+
+	// Route the source, and optionally the target, through a custom dialer or the SSH tunnel
+	sourceDial, targetDial, closeTunnel, err := s.dialers()
+	if err != nil {
+		return nil, err
+	}
+	releases = append(releases, closeTunnel)
+	if sourceDial != nil {
+		name := registerDialer(sourceDial)
+		releases = append(releases, func() { mysqldriver.DeregisterDialContext(name) })
+		dsn := s.cfg.SourceConnection
+		if c.tlsName != "" {
+			dsn = s.sourceDSN
+		}
+		if s.sourceDSN, err = dsnWithNet(dsn, name); err != nil {
+			return nil, err
+		}
+		c.sourceDial = sourceDial
+	}
+	if targetDial != nil {
+		name := registerDialer(targetDial)
+		releases = append(releases, func() { mysqldriver.DeregisterDialContext(name) })
+		if c.targetDSN, err = dsnWithNet(c.targetDSN, name); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.cfg.StrictApply {
+		if c.targetDSN, err = dsnWithFoundRows(c.targetDSN); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.cfg.IgnoreOwnWrites {
+		// A derived ID differs per direction, so both syncers must be given the same one
+		if s.cfg.ServerID == 0 {
+			return nil, fmt.Errorf("ignore_own_writes for MariaDB requires server_id, set to the same value for both directions")
+		}
+		if c.targetDSN, err = dsnWithSessionServerID(c.targetDSN, s.serverID()); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
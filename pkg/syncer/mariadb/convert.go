@@ -0,0 +1,320 @@
+package mariadb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// ValueConverter converts a non-NULL column value before it is written to the target.
+// NULL values are always written as NULL and never passed to a converter.
+type ValueConverter func(col *schema.TableColumn, value interface{}) (interface{}, error)
+
+// datetimeFormat is the literal format MariaDB accepts for DATETIME and TIMESTAMP values
+const datetimeFormat = "2006-01-02 15:04:05.999999"
+
+// datetimeLayout parses DATETIME and TIMESTAMP text; Go accepts an optional fraction after
+// the seconds
+const datetimeLayout = "2006-01-02 15:04:05"
+
+// converterSet turns raw row values into values the target stores as intended: unsigned
+// integers lose their signed wrap-around, ENUM and SET ordinals become labels, JSON documents
+// and DECIMAL values become text, time values are rendered in the target timezone, BIT values
+// become unsigned integers and binary strings bytes, and user converters registered for a
+// column run last.
+type converterSet struct {
+	loc    *time.Location            // target timezone; nil keeps time values as delivered
+	srcLoc *time.Location            // source timezone time values are read in; nil takes them as delivered
+	custom map[string]ValueConverter // keyed by source db.table.column
+}
+
+// register adds a custom converter for a source column
+func (c *converterSet) register(database, table, column string, fn ValueConverter) {
+	if c.custom == nil {
+		c.custom = make(map[string]ValueConverter)
+	}
+	c.custom[database+"."+table+"."+column] = fn
+}
+
+// convertRow converts row in place; cols names the source column of each value
+func (c *converterSet) convertRow(table *schema.Table, cols []string, row []interface{}) error {
+	if c == nil || table == nil {
+		return nil
+	}
+	for i, name := range cols {
+		if i >= len(row) || row[i] == nil {
+			continue
+		}
+		idx := table.FindColumn(name)
+		if idx < 0 {
+			continue
+		}
+		col := &table.Columns[idx]
+		v, err := c.convertValue(col, row[i])
+		if err != nil {
+			return fmt.Errorf("failed to convert column %s of %s.%s: %w", name, table.Schema, table.Name, err)
+		}
+		if fn, ok := c.custom[table.Schema+"."+table.Name+"."+name]; ok {
+			if v, err = fn(col, v); err != nil {
+				return fmt.Errorf("custom converter for column %s of %s.%s failed: %w", name, table.Schema, table.Name, err)
+			}
+		}
+		row[i] = v
+	}
+	return nil
+}
+
+// convertValue applies the built-in conversion for the column type
+func (c *converterSet) convertValue(col *schema.TableColumn, v interface{}) (interface{}, error) {
+	if col.IsUnsigned {
+		v = unsignedValue(col, v)
+	}
+	switch col.Type {
+	case schema.TYPE_ENUM:
+		if n, ok := toInt64(v); ok {
+			return enumLabel(col, n)
+		}
+	case schema.TYPE_SET:
+		if n, ok := toInt64(v); ok {
+			return setLabels(col, n)
+		}
+	case schema.TYPE_JSON:
+		return jsonText(col, v)
+	case schema.TYPE_DECIMAL:
+		return decimalText(col, v), nil
+	case schema.TYPE_DATETIME, schema.TYPE_TIMESTAMP:
+		return c.timeValue(v), nil
+	case schema.TYPE_BIT:
+		return bitValue(col, v), nil
+	case schema.TYPE_BINARY:
+		return binaryValue(col, v), nil
+	}
+	return v, nil
+}
+
+// bitValue binds a BIT value as an unsigned integer no wider than the column. Canal decodes
+// it to an int64, negative for a BIT(64) with the top bit set, and the initial sync reads its
+// big-endian bytes.
+func bitValue(col *schema.TableColumn, v interface{}) interface{} {
+	var n uint64
+	if b, ok := v.([]byte); ok {
+		if len(b) > 8 {
+			return v
+		}
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+	} else if i, ok := toInt64(v); ok {
+		n = uint64(i)
+	} else {
+		return v
+	}
+	var width uint
+	if _, err := fmt.Sscanf(col.RawType, "bit(%d)", &width); err == nil && width < 64 {
+		n &= 1<<width - 1
+	}
+	return n
+}
+
+// binaryValue binds a BINARY or VARBINARY value as bytes, which the driver sends without a
+// character set to convert them in; canal decodes them to strings. A value shorter than a
+// BINARY column is padded with the zero bytes the column stores, so it matches as a key.
+func binaryValue(col *schema.TableColumn, v interface{}) interface{} {
+	var b []byte
+	switch s := v.(type) {
+	case string:
+		b = []byte(s)
+	case []byte:
+		b = s
+	default:
+		return v
+	}
+	if col.FixedSize > uint(len(b)) {
+		b = append(append(make([]byte, 0, col.FixedSize), b...), make([]byte, col.FixedSize-uint(len(b)))...)
+	}
+	return b
+}
+
+// timeValue renders a DATETIME or TIMESTAMP value in the target timezone. With a source
+// timezone, values are wall clock times there: text is parsed in it, and a time.Time, which
+// the source driver parsed in its DSN location, keeps its wall clock and takes it over.
+// Zero and other unparsable dates are written as delivered.
+func (c *converterSet) timeValue(v interface{}) interface{} {
+	if c.loc == nil {
+		return v
+	}
+	switch t := v.(type) {
+	case time.Time:
+		// The target driver would otherwise convert time.Time to its own DSN location
+		if c.srcLoc != nil {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), c.srcLoc)
+		}
+		return t.In(c.loc).Format(datetimeFormat)
+	case string, []byte:
+		if c.srcLoc == nil {
+			return v
+		}
+		text := keyString(t)
+		parsed, err := time.ParseInLocation(datetimeLayout, text, c.srcLoc)
+		if err != nil {
+			return text
+		}
+		return parsed.In(c.loc).Format(datetimeFormat)
+	}
+	return v
+}
+
+// jsonText returns a JSON value as text. The driver sends []byte with the binary charset,
+// which a JSON column rejects, so the decoded document is always written as a string.
+func jsonText(col *schema.TableColumn, v interface{}) (interface{}, error) {
+	var text string
+	switch j := v.(type) {
+	case []byte:
+		text = string(j)
+	case string:
+		text = j
+	default:
+		return v, nil
+	}
+	if !json.Valid([]byte(text)) {
+		return nil, fmt.Errorf("JSON column %s holds invalid JSON %q", col.Name, text)
+	}
+	return text, nil
+}
+
+// decimalText returns a DECIMAL value as its exact decimal string. Canal decodes binlog
+// decimals to strings, as UseDecimal is left off, and the initial sync reads them as bytes;
+// both are bound as strings, so the target parses the exact value rather than a float64.
+func decimalText(col *schema.TableColumn, v interface{}) interface{} {
+	switch d := v.(type) {
+	case string:
+		return d
+	case []byte:
+		return string(d)
+	case float64:
+		// Already rounded; render it at the column scale rather than in exponent form
+		return strconv.FormatFloat(d, 'f', decimalScale(col), 64)
+	case float32:
+		return strconv.FormatFloat(float64(d), 'f', decimalScale(col), 32)
+	case fmt.Stringer:
+		// decimal.Decimal, when canal decodes with UseDecimal
+		return d.String()
+	}
+	return v
+}
+
+// decimalScale returns the scale of a decimal(M,D) column, or -1 when the type has none
+func decimalScale(col *schema.TableColumn) int {
+	_, args, ok := strings.Cut(col.RawType, "(")
+	if !ok {
+		return -1
+	}
+	args, _, _ = strings.Cut(args, ")")
+	_, scale, ok := strings.Cut(args, ",")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(scale))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// enumLabel maps a 1-based ENUM ordinal to its label; 0 is the empty error value
+func enumLabel(col *schema.TableColumn, n int64) (interface{}, error) {
+	if n == 0 {
+		return "", nil
+	}
+	if n < 0 || int(n) > len(col.EnumValues) {
+		return nil, fmt.Errorf("ENUM ordinal %d out of range for %s", n, col.Name)
+	}
+	return col.EnumValues[n-1], nil
+}
+
+// setLabels maps a SET bitmask to its comma separated labels
+func setLabels(col *schema.TableColumn, mask int64) (interface{}, error) {
+	if len(col.SetValues) < 64 && uint64(mask)>>uint(len(col.SetValues)) != 0 {
+		return nil, fmt.Errorf("SET bitmask %d has bits outside the %d members of %s", mask, len(col.SetValues), col.Name)
+	}
+	var labels []string
+	for i, label := range col.SetValues {
+		if uint64(mask)&(1<<uint(i)) != 0 {
+			labels = append(labels, label)
+		}
+	}
+	return strings.Join(labels, ","), nil
+}
+
+// maxMediumintUnsigned is the largest UNSIGNED MEDIUMINT; the binlog delivers the 3-byte
+// type sign extended into an int32
+const maxMediumintUnsigned = 1<<24 - 1
+
+// unsignedValue reinterprets a signed integer of an UNSIGNED column. The binlog carries no
+// signedness, so values above the signed range arrive negative. Canal converts the columns it
+// knows to be unsigned, which leaves values already unsigned and any other type unchanged.
+func unsignedValue(col *schema.TableColumn, v interface{}) interface{} {
+	switch n := v.(type) {
+	case int8:
+		return uint8(n)
+	case int16:
+		return uint16(n)
+	case int32:
+		if n < 0 && col.Type == schema.TYPE_MEDIUM_INT {
+			return uint32(n) & maxMediumintUnsigned
+		}
+		return uint32(n)
+	case int64:
+		return uint64(n)
+	case int:
+		return uint(n)
+	}
+	return v
+}
+
+// toInt64 returns integer row values as int64
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// timezones loads source_timezone and target_timezone; a source timezone needs a target one
+func (s *MariaDBSyncer) timezones() (source, target *time.Location, err error) {
+	if s.cfg.TargetTimezone != "" {
+		if target, err = time.LoadLocation(s.cfg.TargetTimezone); err != nil {
+			return nil, nil, fmt.Errorf("invalid target_timezone %q for MariaDB: %w", s.cfg.TargetTimezone, err)
+		}
+	}
+	if s.cfg.SourceTimezone != "" {
+		if target == nil {
+			return nil, nil, fmt.Errorf("source_timezone for MariaDB requires target_timezone")
+		}
+		if source, err = time.LoadLocation(s.cfg.SourceTimezone); err != nil {
+			return nil, nil, fmt.Errorf("invalid source_timezone %q for MariaDB: %w", s.cfg.SourceTimezone, err)
+		}
+	}
+	return source, target, nil
+}
@@ -0,0 +1,206 @@
+package mariadb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultCutoverHold is how long the lag must stay within cutover_lag by default
+const defaultCutoverHold = 30 * time.Second
+
+// cutoverPolicy returns cutover_lag and cutover_hold with defaults applied; a zero lag
+// leaves ReadyToCutover open
+func (s *MariaDBSyncer) cutoverPolicy() (lag, hold time.Duration, err error) {
+	lag, hold = s.cfg.CutoverLag, s.cfg.CutoverHold
+	if lag < 0 {
+		return 0, 0, fmt.Errorf("invalid cutover_lag %v for MariaDB: must not be negative", lag)
+	}
+	if hold < 0 {
+		return 0, 0, fmt.Errorf("invalid cutover_hold %v for MariaDB: must not be negative", hold)
+	}
+	if hold == 0 {
+		hold = defaultCutoverHold
+	}
+	return lag, hold, nil
+}
+
+// cutoverState tracks a catch-up migration: the readiness ReadyToCutover reports and the
+// position a Cutover stops at. Its methods are no-ops on a nil state.
+type cutoverState struct {
+	mu      sync.Mutex
+	ready   chan struct{}       // closed once ready; created on first use
+	closed  bool                // ready is closed
+	synced  mysql.Position      // last position whose events were all written to the target
+	stopAt  *mysql.Position     // set while a Cutover waits; nil otherwise
+	stopped chan mysql.Position // receives the position the syncer paused at for stopAt
+}
+
+// ReadyToCutover returns a channel closed once the replication lag has stayed at or below
+// cutover_lag for cutover_hold, so writes can move to the target with a short pause; see
+// Cutover. It stays open without cutover_lag. Since the lag counts from the last event, it
+// is only closed after the source wrote to the binlog, and it stays closed afterwards.
+func (s *MariaDBSyncer) ReadyToCutover() <-chan struct{} {
+	return s.cutover.readyCh()
+}
+
+// Cutover finishes a catch-up migration: it reads the current binlog position of the
+// source, waits until every event up to it has been written to the target, and pauses the
+// syncer there, returning the position the target is synced to. Writes to the synced
+// tables should have stopped on the source first, so none follows that position; resume
+// with Resume, e.g. to abort the cutover. It fails when ctx ends first or the incremental
+// sync is not running.
+func (s *MariaDBSyncer) Cutover(ctx context.Context) (mysql.Position, error) {
+	s.reloadMu.Lock()
+	live := s.live
+	s.reloadMu.Unlock()
+	if live == nil {
+		return mysql.Position{}, fmt.Errorf("MariaDB incremental sync is not running")
+	}
+
+	sourceDB, err := s.openSource()
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("failed to open source DB for MariaDB cutover: %w", err)
+	}
+	defer sourceDB.Close()
+	target, err := masterPosition(ctx, sourceDB)
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("failed to read the source position for MariaDB cutover: %w", err)
+	}
+	s.logger.Infof("[MariaDB] Cutover waits for binlog position %s", target)
+
+	stopped, err := s.cutover.stopAtPosition(target, &s.pause)
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	select {
+	case pos := <-stopped:
+		s.logger.Infof("[MariaDB] Cutover paused synchronization at binlog position %s", pos)
+		return pos, nil
+	case <-ctx.Done():
+		s.cutover.cancelStop(stopped)
+		return mysql.Position{}, ctx.Err()
+	case <-live.ctx.Done():
+		s.cutover.cancelStop(stopped)
+		return mysql.Position{}, fmt.Errorf("MariaDB incremental sync stopped before cutover")
+	}
+}
+
+// readyCh returns the channel ReadyToCutover reports readiness on
+func (c *cutoverState) readyCh() chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ready == nil {
+		c.ready = make(chan struct{})
+	}
+	return c.ready
+}
+
+// markReady closes the ready channel once
+func (c *cutoverState) markReady() {
+	ready := c.readyCh()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		close(ready)
+		c.closed = true
+	}
+}
+
+// stopAtPosition makes the syncer pause at the first synced position at or after target,
+// pausing at once when the target already reached it. The returned channel receives that
+// position.
+func (c *cutoverState) stopAtPosition(target mysql.Position, gate *pauseGate) (<-chan mysql.Position, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopAt != nil {
+		return nil, fmt.Errorf("a MariaDB cutover is already in progress")
+	}
+	stopped := make(chan mysql.Position, 1)
+	if c.synced.Name != "" && c.synced.Compare(target) >= 0 {
+		gate.pause()
+		stopped <- c.synced
+		return stopped, nil
+	}
+	c.stopAt, c.stopped = &target, stopped
+	return stopped, nil
+}
+
+// cancelStop gives up the stop of an abandoned Cutover unless it was already reached
+func (c *cutoverState) cancelStop(stopped <-chan mysql.Position) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped == stopped {
+		c.stopAt, c.stopped = nil, nil
+	}
+}
+
+// positionSynced records that every event up to pos was written to the target, pausing
+// before the next event when a Cutover waits for pos. It runs on the canal goroutine, so
+// no further event is applied once it paused.
+func (c *cutoverState) positionSynced(pos mysql.Position, gate *pauseGate) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.synced = pos
+	if c.stopAt == nil || pos.Compare(*c.stopAt) < 0 {
+		return
+	}
+	gate.pause()
+	c.stopped <- pos
+	c.stopAt, c.stopped = nil, nil
+}
+
+// cutoverWatch reports readiness once the lag has stayed within the threshold for hold
+type cutoverWatch struct {
+	threshold time.Duration
+	hold      time.Duration
+	logger    *logrus.Logger
+	since     time.Time // since when the lag is within the threshold; zero when it is not
+}
+
+// check compares lag with the threshold and reports whether it stayed within it for hold
+func (w *cutoverWatch) check(now time.Time, lag time.Duration) bool {
+	if lag > w.threshold {
+		w.since = time.Time{}
+		return false
+	}
+	if w.since.IsZero() {
+		w.since = now
+	}
+	if now.Sub(w.since) < w.hold {
+		return false
+	}
+	w.logger.Infof("[MariaDB] Replication lag %v stayed within cutover_lag %v for %v; ready to cut over",
+		lag.Round(time.Millisecond), w.threshold, w.hold)
+	return true
+}
+
+// watchCutover closes ReadyToCutover once the lag stayed within cutover_lag for
+// cutover_hold, or returns when ctx is done
+func (s *MariaDBSyncer) watchCutover(ctx context.Context, threshold, hold time.Duration) {
+	watch := &cutoverWatch{threshold: threshold, hold: hold, logger: s.logger}
+	ticker := time.NewTicker(lagCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			// The lag reads 0 before the first event, which says nothing about catching up
+			if !s.lag.observed() {
+				continue
+			}
+			if watch.check(now, s.lag.current(now)) {
+				s.cutover.markReady()
+				return
+			}
+		}
+	}
+}
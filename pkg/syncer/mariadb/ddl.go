@@ -0,0 +1,189 @@
+package mariadb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/format"
+	"github.com/pingcap/tidb/pkg/parser/model"
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// OnDDL logs schema changes on mapped tables and, when PropagateDDL is set, applies
+// compatible ALTER TABLE ... ADD COLUMN statements to the target table. With
+// PropagateTruncate a TRUNCATE TABLE empties the target table.
+func (h *MariaDBEventHandler) OnDDL(header *replication.EventHeader, nextPos mysql.Position, queryEvent *replication.QueryEvent) error {
+	if err := h.waitWhilePaused(); err != nil {
+		return err
+	}
+	// Rows batched before the statement are written against the schema they were read with
+	if err := h.flush(); err != nil {
+		return err
+	}
+	if h.isOwnWrite(header) {
+		return nil
+	}
+	query := string(queryEvent.Query)
+	if h.ddlParser == nil {
+		h.ddlParser = parser.New()
+	}
+	stmts, _, err := h.ddlParser.Parse(query, "", "")
+	if err != nil {
+		h.logger.Warnf("[MariaDB] Failed to parse DDL statement %q: %v", query, err)
+		return nil
+	}
+
+	for _, stmt := range stmts {
+		for _, ref := range ddlTables(stmt) {
+			sourceDB := ref.Schema.O
+			if sourceDB == "" {
+				sourceDB = string(queryEvent.Schema)
+			}
+			dbMap, tableMap, ok := h.findTableMapping(sourceDB, ref.Name.O)
+			if !ok {
+				continue
+			}
+			h.logger.Warnf("[MariaDB] DDL on mapped table %s.%s: %s", sourceDB, ref.Name.O, stmt.Text())
+			if h.stmts != nil {
+				// Cached statements may reference columns that no longer exist
+				h.stmts.invalidate(dbMap.TargetDatabase + "." + tableMap.TargetTable)
+			}
+			if h.targetColumns != nil {
+				h.targetColumns.invalidate(dbMap.TargetDatabase + "." + tableMap.TargetTable)
+			}
+			h.invalidateExtraTargets(dbMap, tableMap)
+
+			if _, ok := stmt.(*ast.TruncateTableStmt); ok && h.propagateTruncate {
+				if err := h.truncateTarget(header, sourceDB, ref.Name.O, dbMap, tableMap); err != nil {
+					return err
+				}
+				continue
+			}
+			alter, ok := stmt.(*ast.AlterTableStmt)
+			if !ok || !h.propagateDDL {
+				continue
+			}
+			ddl, compatible, err := buildAddColumnsDDL(alter, dbMap.TargetDatabase, tableMap)
+			if err != nil {
+				h.logger.Errorf("[MariaDB] Failed to build DDL for target table %s.%s: %v",
+					dbMap.TargetDatabase, tableMap.TargetTable, err)
+				continue
+			}
+			if !compatible {
+				h.logger.Warnf("[MariaDB] DDL on %s.%s is not a plain ADD COLUMN; apply it to target %s.%s manually",
+					sourceDB, ref.Name.O, dbMap.TargetDatabase, tableMap.TargetTable)
+				continue
+			}
+			if ddl == "" {
+				continue
+			}
+			ctx, cancel := h.writeContext()
+			_, err = h.targetDB.ExecContext(ctx, ddl)
+			cancel()
+			if err != nil {
+				h.logger.Errorf("[MariaDB] Failed to propagate DDL to target: %s: %v", ddl, h.writeError(ctx, err))
+				continue
+			}
+			h.logger.Infof("[MariaDB] Propagated DDL to target: %s", ddl)
+		}
+	}
+	return nil
+}
+
+// invalidateExtraTargets drops the cached statements and columns of the extra targets of a
+// table after a DDL on it and looks up their generated columns again
+func (h *MariaDBEventHandler) invalidateExtraTargets(dbMap config.DatabaseMapping, tableMap config.TableMapping) {
+	for _, et := range tableMap.ExtraTargets {
+		d := h.destinations[et.TargetConnection]
+		if d == nil {
+			continue
+		}
+		mapping := extraMapping(dbMap, tableMap, et)
+		target := mapping.TargetDatabase + "." + mapping.Tables[0].TargetTable
+		if d.stmts != nil {
+			d.stmts.invalidate(target)
+		}
+		if h.targetColumns != nil {
+			h.targetColumns.invalidate(target)
+		}
+		ctx, cancel := h.writeContext()
+		err := d.reloadGenerated(ctx, []config.DatabaseMapping{mapping})
+		cancel()
+		if err != nil {
+			h.logger.Errorf("[MariaDB] Failed to reload generated columns of extra target %s on %s: %v", target, d.name, err)
+		}
+	}
+}
+
+// ddlTables returns the tables a schema-changing statement refers to
+func ddlTables(stmt ast.StmtNode) []*ast.TableName {
+	switch t := stmt.(type) {
+	case *ast.AlterTableStmt:
+		return []*ast.TableName{t.Table}
+	case *ast.CreateTableStmt:
+		return []*ast.TableName{t.Table}
+	case *ast.TruncateTableStmt:
+		return []*ast.TableName{t.Table}
+	case *ast.DropTableStmt:
+		return t.Tables
+	case *ast.RenameTableStmt:
+		tables := make([]*ast.TableName, len(t.TableToTables))
+		for i, tt := range t.TableToTables {
+			tables[i] = tt.OldTable
+		}
+		return tables
+	}
+	return nil
+}
+
+// buildAddColumnsDDL rewrites an ALTER TABLE that only adds columns into the equivalent
+// statement for the target table, applying the mapping's column renames and exclusions.
+// Only NULL/NOT NULL column options are considered compatible, because the binlog parser
+// does not retain literal values such as defaults. It returns compatible=false for any
+// other kind of ALTER, and an empty statement when every added column is excluded.
+func buildAddColumnsDDL(alter *ast.AlterTableStmt, targetDB string, tableMap config.TableMapping) (string, bool, error) {
+	var clauses []string
+	for _, spec := range alter.Specs {
+		if spec.Tp != ast.AlterTableAddColumns || len(spec.NewConstraints) > 0 {
+			return "", false, nil
+		}
+		for _, col := range spec.NewColumns {
+			for _, opt := range col.Options {
+				if opt.Tp != ast.ColumnOptionNull && opt.Tp != ast.ColumnOptionNotNull {
+					return "", false, nil
+				}
+			}
+
+			name := col.Name.Name.O
+			if mapped, ok := tableMap.ColumnMap[name]; ok {
+				if mapped == "" {
+					continue
+				}
+				name = mapped
+			}
+			def := &ast.ColumnDef{
+				Name:    &ast.ColumnName{Name: model.NewCIStr(name)},
+				Tp:      col.Tp,
+				Options: col.Options,
+			}
+
+			var sb strings.Builder
+			if err := def.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+				return "", false, fmt.Errorf("failed to restore column %s: %w", name, err)
+			}
+			clause := "ADD COLUMN "
+			if spec.IfNotExists {
+				clause += "IF NOT EXISTS "
+			}
+			clauses = append(clauses, clause+sb.String())
+		}
+	}
+	if len(clauses) == 0 {
+		return "", true, nil
+	}
+	return fmt.Sprintf("ALTER TABLE %s %s", quoteTable(targetDB, tableMap.TargetTable), strings.Join(clauses, ", ")), true, nil
+}
@@ -0,0 +1,285 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/retail-ai-inc/sync/pkg/metrics"
+)
+
+// Error policies for row events the target rejects
+const (
+	errorPolicyStop       = "stop"
+	errorPolicySkip       = "skip"
+	errorPolicyDeadLetter = "deadletter"
+)
+
+// errorPolicy returns the configured error policy, defaulting to stop, and checks that a
+// dead-letter sink is configured exactly when it is used
+func (s *MariaDBSyncer) errorPolicy() (string, error) {
+	policy := s.cfg.ErrorPolicy
+	if policy == "" {
+		policy = errorPolicyStop
+	}
+	sinks := 0
+	if s.cfg.DeadLetterPath != "" {
+		sinks++
+	}
+	if s.cfg.DeadLetterTable != "" {
+		sinks++
+	}
+	switch policy {
+	case errorPolicyStop, errorPolicySkip:
+		if sinks > 0 {
+			return "", fmt.Errorf("dead_letter_path and dead_letter_table for MariaDB require error_policy %s", errorPolicyDeadLetter)
+		}
+	case errorPolicyDeadLetter:
+		if sinks != 1 {
+			return "", fmt.Errorf("error_policy %s for MariaDB requires one of dead_letter_path or dead_letter_table", errorPolicyDeadLetter)
+		}
+		if s.cfg.DeadLetterTable != "" && strings.Count(s.cfg.DeadLetterTable, ".") != 1 {
+			return "", fmt.Errorf("invalid dead_letter_table %q for MariaDB: must be db.table", s.cfg.DeadLetterTable)
+		}
+	default:
+		return "", fmt.Errorf("invalid error_policy %q for MariaDB: must be %s, %s or %s",
+			s.cfg.ErrorPolicy, errorPolicyStop, errorPolicySkip, errorPolicyDeadLetter)
+	}
+	return policy, nil
+}
+
+// ignoreErrorCodes returns the MySQL error numbers of ignore_error_codes, nil when unset.
+// Transient errors are retried and then stop the sync, so they cannot be ignored.
+func (s *MariaDBSyncer) ignoreErrorCodes() (map[uint16]bool, error) {
+	if len(s.cfg.IgnoreErrorCodes) == 0 {
+		return nil, nil
+	}
+	codes := make(map[uint16]bool, len(s.cfg.IgnoreErrorCodes))
+	for _, code := range s.cfg.IgnoreErrorCodes {
+		if code == 0 || retriableErrorNumbers[code] {
+			return nil, fmt.Errorf("invalid ignore_error_codes entry %d for MariaDB: must be a non-transient MySQL error number", code)
+		}
+		codes[code] = true
+	}
+	return codes, nil
+}
+
+// ignoredErrorCode returns the MySQL error number of a failed write that ignore_error_codes
+// lists, and whether it does
+func (h *MariaDBEventHandler) ignoredErrorCode(err error) (uint16, bool) {
+	var myErr *mysqldriver.MySQLError
+	if len(h.ignoreErrorCodes) == 0 || !errors.As(err, &myErr) || !h.ignoreErrorCodes[myErr.Number] {
+		return 0, false
+	}
+	return myErr.Number, true
+}
+
+// deadLetter is a row of an event the target rejected, kept for later reprocessing
+type deadLetter struct {
+	Time      time.Time              `json:"time"`
+	Source    string                 `json:"source"`
+	Target    string                 `json:"target"`
+	Action    string                 `json:"action"`
+	Position  string                 `json:"position"` // binlog file:offset of the event
+	Row       map[string]interface{} `json:"row"`
+	OldRow    map[string]interface{} `json:"old_row,omitempty"` // row before an update
+	Statement string                 `json:"statement,omitempty"`
+	Error     string                 `json:"error"`
+}
+
+// deadLetterSink stores dead letters; write must not return before they are durable
+type deadLetterSink interface {
+	write(ctx context.Context, letters []deadLetter) error
+	close() error
+}
+
+// openDeadLetterSink opens the configured sink; targetDB holds a dead-letter table
+func (s *MariaDBSyncer) openDeadLetterSink(targetDB *sql.DB) (deadLetterSink, error) {
+	if s.cfg.DeadLetterTable != "" {
+		db, table, _ := strings.Cut(s.cfg.DeadLetterTable, ".")
+		return &deadLetterTable{db: targetDB, table: quoteTable(db, table)}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.cfg.DeadLetterPath), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create directory for dead-letter file %s: %w", s.cfg.DeadLetterPath, err)
+	}
+	f, err := os.OpenFile(s.cfg.DeadLetterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file %s: %w", s.cfg.DeadLetterPath, err)
+	}
+	return &deadLetterFile{f: f}, nil
+}
+
+// deadLetterFile appends dead letters to a file as JSON lines, synced on every write
+type deadLetterFile struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (d *deadLetterFile) write(_ context.Context, letters []deadLetter) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	enc := json.NewEncoder(d.f)
+	for _, l := range letters {
+		if err := enc.Encode(l); err != nil {
+			return fmt.Errorf("failed to write dead letter: %w", err)
+		}
+	}
+	return d.f.Sync()
+}
+
+func (d *deadLetterFile) close() error {
+	return d.f.Close()
+}
+
+// deadLetterTable inserts dead letters into a target table, outside the failed transaction
+type deadLetterTable struct {
+	db    *sql.DB
+	table string // quoted db.table
+}
+
+func (d *deadLetterTable) write(ctx context.Context, letters []deadLetter) error {
+	query := fmt.Sprintf("INSERT INTO %s (`failed_at`, `source_table`, `target_table`, `action`, `binlog_position`, "+
+		"`row_data`, `old_row_data`, `statement`, `error`) VALUES (?,?,?,?,?,?,?,?,?)", d.table)
+	for _, l := range letters {
+		row, err := json.Marshal(l.Row)
+		if err != nil {
+			return fmt.Errorf("failed to marshal dead letter row: %w", err)
+		}
+		var oldRow interface{}
+		if l.OldRow != nil {
+			b, err := json.Marshal(l.OldRow)
+			if err != nil {
+				return fmt.Errorf("failed to marshal dead letter row: %w", err)
+			}
+			oldRow = string(b)
+		}
+		if _, err := d.db.ExecContext(ctx, query, l.Time.Format(datetimeFormat), l.Source, l.Target, l.Action, l.Position,
+			string(row), oldRow, l.Statement, l.Error); err != nil {
+			return fmt.Errorf("failed to insert dead letter: %w", err)
+		}
+	}
+	return nil
+}
+
+func (d *deadLetterTable) close() error {
+	return nil
+}
+
+// statementError carries the statement a target write failed on
+type statementError struct {
+	query string
+	err   error
+}
+
+func (e *statementError) Error() string { return e.err.Error() }
+func (e *statementError) Unwrap() error { return e.err }
+
+// deadLetters builds the dead letters of an event that failed with err
+func (t *rowTarget) deadLetters(e *canal.RowsEvent, binlogFile string, err error) []deadLetter {
+	base := deadLetter{
+		Time:   time.Now().UTC(),
+		Source: t.table.Schema + "." + t.table.Name,
+		Target: t.qualifiedName(),
+		Action: e.Action,
+		Error:  err.Error(),
+	}
+	if e.Header != nil {
+		base.Position = fmt.Sprintf("%s:%d", binlogFile, e.Header.LogPos)
+	}
+	var stmtErr *statementError
+	if errors.As(err, &stmtErr) {
+		base.Statement = stmtErr.query
+	}
+
+	var letters []deadLetter
+	step := 1
+	if e.Action == canal.UpdateAction {
+		// Update events hold before and after images in pairs
+		step = 2
+	}
+	for i := 0; i+step-1 < len(e.Rows); i += step {
+		l := base
+		l.Row = deadLetterValues(t.rowValues(e.Rows[i+step-1]))
+		if step == 2 {
+			l.OldRow = deadLetterValues(t.rowValues(e.Rows[i]))
+		}
+		letters = append(letters, l)
+	}
+	return letters
+}
+
+// deadLetterValues makes row values readable in JSON; raw bytes would otherwise be base64 encoded
+func deadLetterValues(values map[string]interface{}) map[string]interface{} {
+	for col, v := range values {
+		values[col] = auditValue(v)
+	}
+	return values
+}
+
+// stopsSync reports whether a failed write stops the sync under every error policy: a
+// transient failure that outlasted the retries says nothing about the row itself, and a
+// write cancelled by shutdown is applied again after the restart
+func stopsSync(err error) bool {
+	return isRetriableError(err) || errors.Is(err, context.Canceled)
+}
+
+// eventFailed applies the error policy to an event the target rejected. It returns nil when
+// the event was skipped or dead-lettered and replication may go on.
+func (h *MariaDBEventHandler) eventFailed(t *rowTarget, e *canal.RowsEvent, err error) error {
+	if err := h.applyErrorPolicy(t, e, err); err != nil {
+		return err
+	}
+	if t.dest == nil {
+		h.markApplied(e.Header)
+	}
+	return nil
+}
+
+// applyErrorPolicy is eventFailed without recording the event in the replay guard, which the
+// apply workers leave to drain so positions are recorded in binlog order
+func (h *MariaDBEventHandler) applyErrorPolicy(t *rowTarget, e *canal.RowsEvent, err error) error {
+	rows := len(e.Rows)
+	if e.Action == canal.UpdateAction {
+		rows /= 2
+	}
+	sourceTable := t.table.Schema + "." + t.table.Name
+	// Listed errors are expected by the operator, so they are neither logged as failures
+	// nor reported by Status
+	if code, ok := h.ignoredErrorCode(err); ok {
+		h.logger.Debugf("[MariaDB] Ignoring error %d of %s event on %s by ignore_error_codes: %v", code, e.Action, t.qualifiedName(), err)
+		metrics.AddDroppedRows(metricsType, sourceTable, e.Action, rows)
+		return nil
+	}
+
+	h.logger.Errorf("[MariaDB] Failed to apply %s event to %s: %v", e.Action, t.qualifiedName(), err)
+	err = &ApplyError{Table: t.qualifiedName(), Action: e.Action, Err: err}
+	h.status.setError(err)
+	if stopsSync(err) {
+		return err
+	}
+
+	switch h.errorPolicy {
+	case errorPolicySkip:
+		metrics.AddDroppedRows(metricsType, sourceTable, e.Action, rows)
+	case errorPolicyDeadLetter:
+		ctx, cancel := h.writeContext()
+		sinkErr := h.deadLetters.write(ctx, t.deadLetters(e, h.binlogFile, err))
+		cancel()
+		if sinkErr != nil {
+			return fmt.Errorf("failed to dead-letter %s event on %s: %w (apply error: %v)", e.Action, t.qualifiedName(), sinkErr, err)
+		}
+		metrics.AddDeadLetteredRows(metricsType, sourceTable, e.Action, rows)
+	default:
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package mariadb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// defaultLargeColumnThreshold defers MEDIUMTEXT, LONGTEXT, MEDIUMBLOB and LONGBLOB columns;
+// TEXT and BLOB hold at most 65535 bytes
+const defaultLargeColumnThreshold = 65535
+
+// largeColumnThreshold returns the size above which a column is deferred
+func (s *MariaDBSyncer) largeColumnThreshold() (int64, error) {
+	switch {
+	case s.cfg.LargeColumnThreshold == 0:
+		return defaultLargeColumnThreshold, nil
+	case s.cfg.LargeColumnThreshold < 0:
+		return 0, fmt.Errorf("invalid large_column_threshold %d for MariaDB: must be positive", s.cfg.LargeColumnThreshold)
+	default:
+		return s.cfg.LargeColumnThreshold, nil
+	}
+}
+
+// largeColumns returns the TEXT and BLOB columns of a table whose maximum size in bytes,
+// as declared in the schema, exceeds threshold
+func largeColumns(ctx context.Context, db querier, database, table string, threshold int64) ([]string, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? "+
+			"AND DATA_TYPE IN ('tinytext', 'text', 'mediumtext', 'longtext', 'tinyblob', 'blob', 'mediumblob', 'longblob') "+
+			"AND CHARACTER_OCTET_LENGTH > ? ORDER BY ORDINAL_POSITION",
+		database, table, threshold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	return cols, rows.Err()
+}
+
+// deferredColumns returns the written columns of a source table that defer_large_columns
+// leaves out of the row copy. They are filled in by key afterwards, so a table without a
+// primary key copies them inline.
+func (s *MariaDBSyncer) deferredColumns(
+	ctx context.Context,
+	source querier,
+	dest *destination,
+	mapping config.DatabaseMapping,
+	tableMap config.TableMapping,
+	pkCols []string,
+) ([]string, error) {
+	threshold, err := s.largeColumnThreshold()
+	if err != nil {
+		return nil, err
+	}
+	large, err := largeColumns(ctx, source, mapping.SourceDatabase, tableMap.SourceTable, threshold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up large columns of %s.%s: %w", mapping.SourceDatabase, tableMap.SourceTable, err)
+	}
+	generated := dest.generatedOf(mapping.TargetDatabase + "." + tableMap.TargetTable)
+	var deferred []string
+	for i, target := range excludeGenerated(resolveTargetColumns(tableMap, large), generated) {
+		if target != "" && indexOf(pkCols, large[i]) < 0 {
+			deferred = append(deferred, large[i])
+		}
+	}
+	if len(deferred) == 0 {
+		return nil, nil
+	}
+	if len(pkCols) == 0 || indexOf(resolveTargetColumns(tableMap, pkCols), "") >= 0 {
+		s.logger.Warnf("[MariaDB] %s.%s has no primary key on the target; copying its large columns %s with the rows",
+			mapping.SourceDatabase, tableMap.SourceTable, strings.Join(deferred, ", "))
+		return nil, nil
+	}
+	s.logger.Infof("[MariaDB] Deferring large columns %s of %s.%s until its rows are copied",
+		strings.Join(deferred, ", "), mapping.SourceDatabase, tableMap.SourceTable)
+	return deferred, nil
+}
+
+// withoutColumns returns cols without the columns in omit
+func withoutColumns(cols, omit []string) []string {
+	var kept []string
+	for _, col := range cols {
+		if indexOf(omit, col) < 0 {
+			kept = append(kept, col)
+		}
+	}
+	return kept
+}
+
+// copyDeferredColumns fills the deferred columns of rows already copied to dest, one row
+// per UPDATE, so only a single large value is held in memory at a time. tag is the
+// source_tag value the rows were copied with.
+func (s *MariaDBSyncer) copyDeferredColumns(
+	ctx context.Context,
+	source querier,
+	dest *destination,
+	srcTable *schema.Table,
+	mapping config.DatabaseMapping,
+	tableMap config.TableMapping,
+	pkCols, deferred []string,
+	tag string,
+) error {
+	table := mapping.SourceDatabase + "." + tableMap.SourceTable
+	cols := append(append([]string(nil), deferred...), pkCols...)
+	targetCols := resolveTargetColumns(tableMap, cols)
+	var setClauses, whereClauses []string
+	for i, col := range targetCols {
+		if i < len(deferred) {
+			setClauses = append(setClauses, fmt.Sprintf("%s = ?", quoteIdent(col)))
+			continue
+		}
+		whereClauses = append(whereClauses, fmt.Sprintf("%s = ?", quoteIdent(col)))
+	}
+	if tableMap.SourceTag != "" {
+		whereClauses = append(whereClauses, fmt.Sprintf("%s = ?", quoteIdent(tableMap.SourceTag)))
+	}
+	targetTable := mapping.TargetDatabase + "." + tableMap.TargetTable
+	updateSQL := fmt.Sprintf("UPDATE %s SET %s WHERE %s", quoteTable(mapping.TargetDatabase, tableMap.TargetTable),
+		strings.Join(setClauses, ", "), strings.Join(whereClauses, " AND "))
+	stmt, err := dest.db.PrepareContext(ctx, updateSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare update of deferred columns of %s: %w", targetTable, err)
+	}
+	defer stmt.Close()
+
+	selectSQL := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoteIdents(cols), ","), quoteTable(mapping.SourceDatabase, tableMap.SourceTable))
+	if tableMap.SourceFilter != "" {
+		selectSQL += " WHERE (" + tableMap.SourceFilter + ")"
+	}
+	rows, err := source.QueryContext(ctx, selectSQL)
+	if err != nil {
+		return fmt.Errorf("failed to query deferred columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	updated := 0
+	err = s.streamBatches(rows, len(cols), 1, table, func(batch [][]interface{}) error {
+		row := batch[0]
+		if err := s.converters.convertRow(srcTable, cols, row); err != nil {
+			return err
+		}
+		args := applyTransforms(tableMap, cols, row)
+		if tableMap.SourceTag != "" {
+			args = append(args, tag)
+		}
+		start := time.Now()
+		_, err := stmt.ExecContext(ctx, args...)
+		s.slowWrites.observe(start, canal.UpdateAction, targetTable, 1)
+		if err != nil {
+			return fmt.Errorf("failed to copy deferred columns of %s: %w", targetTable, err)
+		}
+		updated++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("[MariaDB] Copied deferred columns %s of %d rows of %s to %s",
+		strings.Join(deferred, ", "), updated, table, targetTable)
+	return nil
+}
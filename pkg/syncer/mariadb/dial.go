@@ -0,0 +1,76 @@
+package mariadb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+// DialFunc opens a connection to a database at addr, e.g. through a proxy or a bastion host
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dialerSeq makes the network name each syncer registers with the mysql driver unique
+var dialerSeq atomic.Int64
+
+// SetSourceDialer makes the binlog stream and every direct source query dial through dial
+// instead of connecting to the source address directly. It cannot be combined with
+// ssh_tunnel and must be called before Start.
+func (s *MariaDBSyncer) SetSourceDialer(dial DialFunc) {
+	s.sourceDial = dial
+}
+
+// SetTargetDialer makes the target connections of target_connection dial through dial. It
+// cannot be combined with ssh_tunnel's target and must be called before Start.
+func (s *MariaDBSyncer) SetTargetDialer(dial DialFunc) {
+	s.targetDial = dial
+}
+
+// dialers returns the dialers of the source and the target, nil for direct connections,
+// opening the ssh_tunnel when configured. The caller closes the tunnel with closeFn.
+func (s *MariaDBSyncer) dialers() (source, target DialFunc, closeFn func(), err error) {
+	source, target, closeFn = s.sourceDial, s.targetDial, func() {}
+	c := s.cfg.SSHTunnel
+	if c == nil {
+		return source, target, closeFn, nil
+	}
+	if source != nil || (c.Target && target != nil) {
+		return nil, nil, nil, fmt.Errorf("ssh_tunnel for MariaDB cannot be combined with a dialer set with SetSourceDialer or SetTargetDialer")
+	}
+	tunnel, err := newSSHTunnel(c)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	source = tunnel.dial
+	if c.Target {
+		target = tunnel.dial
+	}
+	closeFn = func() {
+		if err := tunnel.close(); err != nil {
+			s.logger.Errorf("Failed to close MariaDB SSH tunnel to %s: %v", tunnel.addr, err)
+		}
+	}
+	return source, target, closeFn, nil
+}
+
+// registerDialer registers dial with the mysql driver under a new network name for use in
+// DSNs; the caller deregisters it with mysqldriver.DeregisterDialContext
+func registerDialer(dial DialFunc) string {
+	name := fmt.Sprintf("sync-mariadb-dial-%d", dialerSeq.Add(1))
+	mysqldriver.RegisterDialContext(name, func(ctx context.Context, addr string) (net.Conn, error) {
+		return dial(ctx, "tcp", addr)
+	})
+	return name
+}
+
+// dsnWithNet points a DSN at a registered network, keeping its address
+func dsnWithNet(dsn, name string) (string, error) {
+	dsnCfg, err := parseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	dsnCfg.Net = name
+	return dsnCfg.FormatDSN(), nil
+}
@@ -0,0 +1,123 @@
+package mariadb
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	"github.com/retail-ai-inc/sync/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Values of initial_sync_method
+const (
+	initialSyncMethodCopy      = "copy"       // the batched copy of the initial sync; canal never dumps
+	initialSyncMethodCanalDump = "canal_dump" // canal's mysqldump; the initial sync does not run
+)
+
+// initialSyncMethod returns initial_sync_method, checking that it fits mode and the dump
+// settings. Unset, full+incremental mode copies the tables with the initial sync alone, so
+// only one copy runs; other modes return "".
+func (s *MariaDBSyncer) initialSyncMethod(mode string) (string, error) {
+	method := s.cfg.InitialSyncMethod
+	switch method {
+	case "":
+		if mode == config.ModeFullIncremental {
+			return initialSyncMethodCopy, nil
+		}
+		return "", nil
+	case initialSyncMethodCopy:
+		return method, nil
+	case initialSyncMethodCanalDump:
+	default:
+		return "", fmt.Errorf("invalid initial_sync_method %q for MariaDB: must be %s or %s",
+			method, initialSyncMethodCopy, initialSyncMethodCanalDump)
+	}
+	switch {
+	case mode == config.ModeFull:
+		return "", fmt.Errorf("initial_sync_method %s for MariaDB cannot be used in %s mode, which never starts canal", method, config.ModeFull)
+	case s.cfg.DisableCanalDump:
+		return "", fmt.Errorf("initial_sync_method %s for MariaDB cannot be combined with disable_canal_dump", method)
+	case s.cfg.DumpExecutionPath == "":
+		return "", fmt.Errorf("initial_sync_method %s for MariaDB requires dump_execution_path", method)
+	}
+	return method, nil
+}
+
+// canalDumpDisabled reports whether canal must never dump in mode, leaving the copy to the
+// initial sync
+func (s *MariaDBSyncer) canalDumpDisabled(mode string) bool {
+	method := s.cfg.InitialSyncMethod
+	return s.cfg.DisableCanalDump || method == initialSyncMethodCopy || (method == "" && mode == config.ModeFullIncremental)
+}
+
+// dumpExecutionPath returns the mysqldump canal runs when it starts without a binlog position,
+// or "" when canal must not dump. A configured path is looked up at startup, since canal only
+// reports a missing binary once it tries to dump.
+func (s *MariaDBSyncer) dumpExecutionPath(mode string) (string, error) {
+	path := s.cfg.DumpExecutionPath
+	switch {
+	case s.canalDumpDisabled(mode):
+		if path != "" {
+			s.logger.Infof("[MariaDB] Canal dump is disabled; ignoring dump_execution_path %s", path)
+		}
+		return "", nil
+	case path == "" || mode == config.ModeFull:
+		// Full mode never starts canal
+		return "", nil
+	}
+	if _, err := exec.LookPath(path); err != nil {
+		return "", fmt.Errorf("invalid dump_execution_path %q for MariaDB: %w; set disable_canal_dump to rely on the initial sync alone", path, err)
+	}
+	return path, nil
+}
+
+// dumpProgress counts the rows of canal's dump written to the target. Its methods are
+// no-ops on a nil counter.
+type dumpProgress struct {
+	rows atomic.Int64
+}
+
+// add counts rows applied from the dump
+func (p *dumpProgress) add(rows int) {
+	if p != nil {
+		p.rows.Add(int64(rows))
+	}
+}
+
+// watchDump logs the progress of canal's dump with path every interval until done is
+// closed, then whether it finished, which succeeded reports. It closes InitialSyncDone
+// after a successful dump.
+func (s *MariaDBSyncer) watchDump(ctx context.Context, path string, done <-chan struct{}, succeeded func() bool, interval time.Duration) {
+	started := time.Now()
+	s.logger.Infof("[MariaDB] Canal dump of the source with %s started", path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logDumpProgress(s.logger, s.dump.rows.Load(), time.Since(started), "in progress")
+		case <-done:
+			if !succeeded() {
+				s.logger.Errorf("[MariaDB] Canal dump with %s failed after %v", path, time.Since(started).Round(time.Second))
+				return
+			}
+			logDumpProgress(s.logger, s.dump.rows.Load(), time.Since(started), "finished")
+			s.initialSync.finish(ctx)
+			return
+		}
+	}
+}
+
+// logDumpProgress logs the rows the dump applied within elapsed
+func logDumpProgress(logger *logrus.Logger, rows int64, elapsed time.Duration, state string) {
+	var rate float64
+	if secs := elapsed.Seconds(); secs > 0 {
+		rate = float64(rows) / secs
+	}
+	logger.Infof("[MariaDB] Canal dump %s: %d rows applied in %v (%.0f rows/s)", state, rows, elapsed.Round(time.Second), rate)
+}
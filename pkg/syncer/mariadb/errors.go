@@ -0,0 +1,49 @@
+package mariadb
+
+import "fmt"
+
+// Start and SyncStatus.LastError report the failures embedders react to as the types below,
+// which errors.As tells apart; each wraps the underlying driver or canal error, which
+// errors.Is and errors.As still reach. An ApplyError that stopped replication is wrapped in
+// the ReplicationError Start returns, so check for it first.
+
+// ConfigError reports a setting or mapping that is invalid; restarting does not help
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string { return e.Err.Error() }
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+// ConnectionError reports that the source or the target did not accept connections
+type ConnectionError struct {
+	Database string // "source" or "target"
+	Err      error
+}
+
+func (e *ConnectionError) Error() string { return e.Err.Error() }
+func (e *ConnectionError) Unwrap() error { return e.Err }
+
+// ReplicationError reports that the binlog stream could not be started or stopped with an error
+type ReplicationError struct {
+	Err error
+}
+
+func (e *ReplicationError) Error() string { return e.Err.Error() }
+func (e *ReplicationError) Unwrap() error { return e.Err }
+
+// ApplyError reports a row event the target rejected. Table and Action are empty when a write
+// batch of several events failed.
+type ApplyError struct {
+	Table  string // target db.table
+	Action string // insert, update, delete or truncate
+	Err    error
+}
+
+func (e *ApplyError) Error() string {
+	if e.Table == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("failed to apply %s event to %s: %v", e.Action, e.Table, e.Err)
+}
+func (e *ApplyError) Unwrap() error { return e.Err }
@@ -0,0 +1,210 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// destination is a target connection tables are written to besides target_connection, with
+// its own pool and statement cache
+type destination struct {
+	name      string // host:port of the connection, for logs and checkpoint keys
+	db        *sql.DB
+	stmts     *stmtCache
+	mu        sync.Mutex                 // guards generated, reloaded by OnDDL while copies read it
+	generated map[string]map[string]bool // generated target columns by target db.table
+}
+
+// generatedOf returns the generated columns of a target db.table
+func (d *destination) generatedOf(table string) map[string]bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.generated[table]
+}
+
+// reloadGenerated looks up the generated columns of the target tables of mappings again,
+// after a schema change
+func (d *destination) reloadGenerated(ctx context.Context, mappings []config.DatabaseMapping) error {
+	reloaded, err := loadGeneratedColumns(ctx, d.db, mappings)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	generated := make(map[string]map[string]bool, len(d.generated)+len(reloaded))
+	for table, cols := range d.generated {
+		generated[table] = cols
+	}
+	for table, cols := range reloaded {
+		generated[table] = cols
+	}
+	d.generated = generated
+	return nil
+}
+
+// extraTargetsTo returns the mappings as written to one extra target connection: each table
+// with an extra target on conn, with its target database and table replaced
+func extraTargetsTo(mappings []config.DatabaseMapping, conn string) []config.DatabaseMapping {
+	var extra []config.DatabaseMapping
+	for _, mapping := range mappings {
+		for _, tableMap := range mapping.Tables {
+			for _, et := range tableMap.ExtraTargets {
+				if et.TargetConnection == conn {
+					extra = append(extra, extraMapping(mapping, tableMap, et))
+				}
+			}
+		}
+	}
+	return extra
+}
+
+// extraMapping returns a single table mapping that writes to an extra target
+func extraMapping(mapping config.DatabaseMapping, tableMap config.TableMapping, et config.TableTarget) config.DatabaseMapping {
+	tableMap.ExtraTargets = nil
+	if et.TargetTable != "" {
+		tableMap.TargetTable = et.TargetTable
+	}
+	mapping.TargetDatabase = et.TargetDatabase
+	mapping.Tables = []config.TableMapping{tableMap}
+	return mapping
+}
+
+// openDestinations opens a pool per distinct extra target connection, keyed by the connection
+// as configured. tlsName is the registered TLS config, if any; own writes are stamped with the
+// syncer's server ID like those to target_connection.
+func (s *MariaDBSyncer) openDestinations(ctx context.Context, tlsName string) (map[string]*destination, error) {
+	destinations := make(map[string]*destination)
+	fail := func(err error) (map[string]*destination, error) {
+		closeDestinations(destinations)
+		return nil, err
+	}
+	for _, mapping := range s.cfg.Mappings {
+		for _, tableMap := range mapping.Tables {
+			for _, et := range tableMap.ExtraTargets {
+				if et.TargetConnection == "" || et.TargetDatabase == "" {
+					return fail(fmt.Errorf("extra target of %s.%s for MariaDB needs target_connection and target_database",
+						mapping.SourceDatabase, tableMap.SourceTable))
+				}
+				if _, ok := destinations[et.TargetConnection]; ok {
+					continue
+				}
+				d, err := s.openDestination(ctx, et.TargetConnection, tlsName)
+				if err != nil {
+					return fail(err)
+				}
+				destinations[et.TargetConnection] = d
+			}
+		}
+	}
+	return destinations, nil
+}
+
+func (s *MariaDBSyncer) openDestination(ctx context.Context, conn, tlsName string) (*destination, error) {
+	dsnCfg, err := parseDSN(conn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extra target connection: %w", err)
+	}
+	dsn := conn
+	if tlsName != "" {
+		if dsn, err = dsnWithTLSConfig(dsn, tlsName); err != nil {
+			return nil, err
+		}
+	}
+	if s.cfg.StrictApply {
+		if dsn, err = dsnWithFoundRows(dsn); err != nil {
+			return nil, err
+		}
+	}
+	if s.cfg.IgnoreOwnWrites {
+		if dsn, err = dsnWithSessionServerID(dsn, s.serverID()); err != nil {
+			return nil, err
+		}
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to extra target %s: %w", dsnCfg.Addr, err)
+	}
+	d := &destination{name: dsnCfg.Addr, db: db, stmts: newStmtCache(db)}
+	if err := s.configureTargetPool(db); err != nil {
+		d.close()
+		return nil, err
+	}
+	mappings := extraTargetsTo(s.cfg.Mappings, conn)
+	if err := s.createTargetDatabases(ctx, db, mappings); err != nil {
+		d.close()
+		return nil, fmt.Errorf("extra target %s: %w", d.name, err)
+	}
+	if err := checkSoftDeleteColumns(ctx, db, mappings); err != nil {
+		d.close()
+		return nil, fmt.Errorf("extra target %s: %w", d.name, err)
+	}
+	if d.generated, err = loadGeneratedColumns(ctx, db, mappings); err != nil {
+		d.close()
+		return nil, fmt.Errorf("extra target %s: %w", d.name, err)
+	}
+	return d, nil
+}
+
+func (d *destination) close() {
+	d.stmts.close()
+	d.db.Close()
+}
+
+func closeDestinations(destinations map[string]*destination) {
+	for _, d := range destinations {
+		d.close()
+	}
+}
+
+// primaryDestination is target_connection as a destination of the initial sync
+func (s *MariaDBSyncer) primaryDestination(targetDB *sql.DB) *destination {
+	return &destination{db: targetDB, generated: s.generatedColumns}
+}
+
+// extraTargets returns the rowTargets the rows of target are also written to
+func (h *MariaDBEventHandler) extraTargets(target *rowTarget) []*rowTarget {
+	var targets []*rowTarget
+	for _, et := range target.tableMap.ExtraTargets {
+		d := h.destinations[et.TargetConnection]
+		if d == nil {
+			continue
+		}
+		tableMap := target.tableMap
+		tableMap.ExtraTargets = nil
+		if et.TargetTable != "" {
+			tableMap.TargetTable = et.TargetTable
+		}
+		targets = append(targets, &rowTarget{
+			dbName:        et.TargetDatabase,
+			tableMap:      tableMap,
+			table:         target.table,
+			sourceColumns: target.sourceColumns,
+			targetColumns: excludeGenerated(resolveTargetColumns(tableMap, target.sourceColumns),
+				d.generatedOf(et.TargetDatabase+"."+tableMap.TargetTable)),
+			filter: target.filter,
+			dest:   d,
+			replay: target.replay,
+		})
+	}
+	return targets
+}
+
+// targetDBOf returns the pool the rows of t are written with
+func (h *MariaDBEventHandler) targetDBOf(t *rowTarget) *sql.DB {
+	if t.dest != nil {
+		return t.dest.db
+	}
+	return h.targetDB
+}
+
+// stmtsOf returns the statement cache of the connection t is written with
+func (h *MariaDBEventHandler) stmtsOf(t *rowTarget) *stmtCache {
+	if t.dest != nil {
+		return t.dest.stmts
+	}
+	return h.stmts
+}
@@ -0,0 +1,233 @@
+package mariadb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// rowFilter is the incremental form of a table's source_filter: column = value or column IN (...)
+type rowFilter struct {
+	column string
+	values []string
+}
+
+// matches reports whether a binlog row satisfies the filter; rows without the column never match
+func (f *rowFilter) matches(table *schema.Table, row []interface{}) bool {
+	// Column names are case-insensitive in MariaDB
+	idx := -1
+	for i, col := range table.Columns {
+		if strings.EqualFold(col.Name, f.column) {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 || idx >= len(row) || row[idx] == nil {
+		return false
+	}
+	v := keyString(row[idx])
+	for _, want := range f.values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// systemDatabases hold server metadata and are never replicated
+var systemDatabases = []string{"mysql", "information_schema", "performance_schema", "sys"}
+
+// canalTableFilters returns the canal include regexes for the mapped tables and exclude
+// regexes for the system databases, excludeDatabases and the db.table of skipTables. Include
+// regexes match one table exactly, once per table even when several mappings read it. Mapping
+// an excluded database is an error rather than a silently idle table.
+func canalTableFilters(mappings []config.DatabaseMapping, excludeDatabases, skipTables []string) ([]string, []string, error) {
+	excluded := append(append([]string{}, systemDatabases...), excludeDatabases...)
+	var include, exclude []string
+	seen := make(map[string]bool)
+	for _, db := range excluded {
+		// Database names are case-insensitive with lower_case_table_names set
+		exclude = append(exclude, fmt.Sprintf("(?i)^%s\\.", regexp.QuoteMeta(db)))
+	}
+	for _, table := range skipTables {
+		db, name, ok := strings.Cut(table, ".")
+		if !ok || db == "" || name == "" {
+			return nil, nil, fmt.Errorf("invalid skip_tables entry %q for MariaDB: must be db.table", table)
+		}
+		exclude = append(exclude, fmt.Sprintf("(?i)^%s\\.%s$", regexp.QuoteMeta(db), regexp.QuoteMeta(name)))
+	}
+	for _, mapping := range mappings {
+		for _, db := range excluded {
+			if strings.EqualFold(mapping.SourceDatabase, db) {
+				return nil, nil, fmt.Errorf("source database %s is a system database or listed in exclude_databases and cannot be mapped", mapping.SourceDatabase)
+			}
+		}
+		for _, table := range mapping.Tables {
+			// Canal matches unanchored, so orders would otherwise also stream orders_archive
+			expr := fmt.Sprintf("^%s\\.%s$", regexp.QuoteMeta(mapping.SourceDatabase), regexp.QuoteMeta(table.SourceTable))
+			if !seen[expr] {
+				seen[expr] = true
+				include = append(include, expr)
+			}
+		}
+	}
+	return include, exclude, nil
+}
+
+// skippedTables returns the lower-cased db.table of skip_tables, whose events OnRow drops
+func skippedTables(skipTables []string) map[string]bool {
+	if len(skipTables) == 0 {
+		return nil
+	}
+	skipped := make(map[string]bool, len(skipTables))
+	for _, table := range skipTables {
+		skipped[strings.ToLower(table)] = true
+	}
+	return skipped
+}
+
+// buildSourceFilters parses the source_filter of every mapped table, keyed by source db.table
+func buildSourceFilters(mappings []config.DatabaseMapping) (map[string]*rowFilter, error) {
+	filters := make(map[string]*rowFilter)
+	for _, mapping := range mappings {
+		for _, tableMap := range mapping.Tables {
+			if strings.TrimSpace(tableMap.SourceFilter) == "" {
+				continue
+			}
+			f, err := parseSourceFilter(tableMap.SourceFilter)
+			if err != nil {
+				return nil, fmt.Errorf("invalid source_filter for %s.%s: %w", mapping.SourceDatabase, tableMap.SourceTable, err)
+			}
+			filters[mapping.SourceDatabase+"."+tableMap.SourceTable] = f
+		}
+	}
+	return filters, nil
+}
+
+// parseSourceFilter parses `column = value` or `column IN (v1, v2, ...)`.
+// Values are quoted strings or bare numbers; anything else is rejected so the initial
+// and incremental sync never disagree on which rows belong to the target.
+func parseSourceFilter(expr string) (*rowFilter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) < 3 || tokens[0].kind != tokenIdent {
+		return nil, fmt.Errorf("unsupported filter %q: expected column = value or column IN (...)", expr)
+	}
+	f := &rowFilter{column: tokens[0].text}
+
+	switch {
+	case tokens[1].kind == tokenSymbol && tokens[1].text == "=":
+		if len(tokens) != 3 || tokens[2].kind != tokenLiteral {
+			return nil, fmt.Errorf("unsupported filter %q: expected a single literal after =", expr)
+		}
+		f.values = []string{tokens[2].text}
+	case tokens[1].kind == tokenIdent && strings.EqualFold(tokens[1].text, "IN"):
+		rest := tokens[2:]
+		if len(rest) < 3 || rest[0].text != "(" || rest[len(rest)-1].text != ")" {
+			return nil, fmt.Errorf("unsupported filter %q: expected a parenthesized list after IN", expr)
+		}
+		list := rest[1 : len(rest)-1]
+		for i, tok := range list {
+			if i%2 == 1 {
+				if tok.kind != tokenSymbol || tok.text != "," {
+					return nil, fmt.Errorf("unsupported filter %q: expected , between values", expr)
+				}
+				continue
+			}
+			if tok.kind != tokenLiteral {
+				return nil, fmt.Errorf("unsupported filter %q: IN list must contain literals", expr)
+			}
+			f.values = append(f.values, tok.text)
+		}
+		if len(list)%2 == 0 {
+			return nil, fmt.Errorf("unsupported filter %q: trailing , in IN list", expr)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported filter %q: only = and IN are supported", expr)
+	}
+	return f, nil
+}
+
+type filterTokenKind int
+
+const (
+	tokenIdent filterTokenKind = iota
+	tokenLiteral
+	tokenSymbol
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+}
+
+// tokenizeFilter splits a filter into identifiers, literals and the symbols = ( ,
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '=' || r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, filterToken{tokenSymbol, string(r)})
+			i++
+		case r == '\'' || r == '"' || r == '`':
+			text, next, err := readQuoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			kind := tokenLiteral
+			if r == '`' {
+				kind = tokenIdent
+			}
+			tokens = append(tokens, filterToken{kind, text})
+			i = next
+		case r == '-' || r == '+' || r == '.' || unicode.IsDigit(r):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokenLiteral, strings.TrimPrefix(string(runes[start:i]), "+")})
+		case r == '_' || r == '$' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || runes[i] == '$' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokenIdent, string(runes[start:i])})
+		default:
+			return nil, fmt.Errorf("unexpected character %q in filter", r)
+		}
+	}
+	return tokens, nil
+}
+
+// readQuoted reads a quoted string starting at runes[start]; doubled or backslash-escaped quotes are unescaped
+func readQuoted(runes []rune, start int) (string, int, error) {
+	quote := runes[start]
+	var b strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && quote != '`' && i+1 < len(runes):
+			i++
+			b.WriteRune(runes[i])
+		case r == quote && i+1 < len(runes) && runes[i+1] == quote:
+			i++
+			b.WriteRune(quote)
+		case r == quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted string in filter")
+}
@@ -0,0 +1,173 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+// Insert modes supported on a table mapping
+const (
+	insertModeInsert  = "insert"
+	insertModeUpsert  = "upsert"
+	insertModeIgnore  = "ignore"
+	insertModeReplace = "replace"
+)
+
+// buildInsertSQL generates a multi-row INSERT for the given insert mode. It is shared by the
+// initial batch copy and the incremental insert path so both resolve duplicates the same way.
+// keyCols are the target primary key columns, which upsert leaves untouched.
+func buildInsertSQL(mode, dbName, tableName string, cols, keyCols []string, rowCount int) (string, error) {
+	var verb string
+	switch mode {
+	case "", insertModeInsert, insertModeUpsert:
+		verb = "INSERT INTO"
+	case insertModeIgnore:
+		verb = "INSERT IGNORE INTO"
+	case insertModeReplace:
+		// REPLACE deletes a colliding row before inserting, unlike upsert
+		verb = "REPLACE INTO"
+	default:
+		return "", fmt.Errorf("unknown insert mode %q for %s.%s", mode, dbName, tableName)
+	}
+
+	singleRowPlaceholder := fmt.Sprintf("(%s)", strings.Join(makeQuestionMarks(len(cols)), ","))
+	allPlaceholder := make([]string, rowCount)
+	for i := range allPlaceholder {
+		allPlaceholder[i] = singleRowPlaceholder
+	}
+
+	query := fmt.Sprintf("%s %s (%s) VALUES %s",
+		verb,
+		quoteTable(dbName, tableName),
+		strings.Join(quoteIdents(cols), ", "),
+		strings.Join(allPlaceholder, ", "))
+
+	if mode == insertModeUpsert {
+		query += " ON DUPLICATE KEY UPDATE " + strings.Join(upsertAssignments(cols, keyCols), ", ")
+	}
+	return query, nil
+}
+
+// insertArgs orders the values of a row, named by rowCols, by the INSERT column list, so a
+// value always lands in its own column even when rows of a batch list columns differently.
+// A row lacking a column of the statement, or carrying one it does not have, is an error.
+func insertArgs(columns, rowCols []string, values []interface{}) ([]interface{}, error) {
+	args := make([]interface{}, len(columns))
+	for i, col := range columns {
+		j := indexOf(rowCols, col)
+		if j < 0 || len(rowCols) != len(columns) {
+			return nil, fmt.Errorf("row has columns (%s), statement inserts (%s)", strings.Join(rowCols, ", "), strings.Join(columns, ", "))
+		}
+		args[i] = values[j]
+	}
+	return args, nil
+}
+
+// upsertAssignments builds the ON DUPLICATE KEY UPDATE list for all non-key columns
+func upsertAssignments(cols, keyCols []string) []string {
+	isKey := make(map[string]bool, len(keyCols))
+	for _, col := range keyCols {
+		isKey[col] = true
+	}
+	var assignments []string
+	for _, col := range cols {
+		if isKey[col] {
+			continue
+		}
+		assignments = append(assignments, fmt.Sprintf("%s = VALUES(%s)", quoteIdent(col), quoteIdent(col)))
+	}
+	if len(assignments) == 0 {
+		// Every column is part of the key; a self-assignment keeps the statement valid
+		assignments = append(assignments, fmt.Sprintf("%s = %s", quoteIdent(cols[0]), quoteIdent(cols[0])))
+	}
+	return assignments
+}
+
+// defaultMaxStatementBytes is used when the target max_allowed_packet cannot be read
+const defaultMaxStatementBytes = 4 << 20
+
+// erNetPacketTooLarge is ER_NET_PACKET_TOO_LARGE, sent when a statement exceeds max_allowed_packet
+const erNetPacketTooLarge = 1153
+
+// maxStatementBytes returns the configured statement size limit, or three quarters of the
+// target max_allowed_packet, leaving room for the estimate in insertChunks to fall short
+func (s *MariaDBSyncer) maxStatementBytes(ctx context.Context, db *sql.DB) (int, error) {
+	switch {
+	case s.cfg.MaxStatementBytes > 0:
+		return s.cfg.MaxStatementBytes, nil
+	case s.cfg.MaxStatementBytes < 0:
+		return 0, fmt.Errorf("invalid max_statement_bytes %d for MariaDB: must be positive", s.cfg.MaxStatementBytes)
+	}
+	var maxPacket int
+	if err := db.QueryRowContext(ctx, "SELECT @@max_allowed_packet").Scan(&maxPacket); err != nil {
+		s.logger.Warnf("[MariaDB] Could not read max_allowed_packet of the target, limiting inserts to %d bytes: %v",
+			defaultMaxStatementBytes, err)
+		return defaultMaxStatementBytes, nil
+	}
+	return maxPacket / 4 * 3, nil
+}
+
+// insertChunks splits rows into runs whose multi-row INSERT stays within limit bytes,
+// estimated from the placeholders and the encoded size of each value. base is the size of
+// the statement without its rows; a limit of 0 keeps all rows together. A row too large
+// on its own still gets a chunk, for the server to accept or reject.
+func insertChunks(rows [][]interface{}, base, limit int) [][][]interface{} {
+	if limit <= 0 {
+		return [][][]interface{}{rows}
+	}
+	var chunks [][][]interface{}
+	start, size := 0, base
+	for i, row := range rows {
+		rowSize := 2 * (len(row) + 1) // "(?,?)" and the separating ", "
+		for _, v := range row {
+			rowSize += valueSize(v)
+		}
+		if i > start && size+rowSize > limit {
+			chunks = append(chunks, rows[start:i])
+			start, size = i, base
+		}
+		size += rowSize
+	}
+	return append(chunks, rows[start:])
+}
+
+// valueSize estimates the bytes a value takes in a statement: its length plus the length
+// prefix of the binary protocol, or the escaping of an interpolated literal
+func valueSize(v interface{}) int {
+	switch val := v.(type) {
+	case nil:
+		return 4
+	case string:
+		return len(val) + 9
+	case []byte:
+		return len(val) + 9
+	case time.Time:
+		return 28
+	default:
+		return 20
+	}
+}
+
+// isPacketTooLarge reports whether a statement was rejected for exceeding max_allowed_packet,
+// either by the server or by the driver before sending it
+func isPacketTooLarge(err error) bool {
+	var myErr *mysqldriver.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == erNetPacketTooLarge
+	}
+	return errors.Is(err, mysqldriver.ErrPktTooLarge)
+}
+
+func makeQuestionMarks(n int) []string {
+	res := make([]string, n)
+	for i := 0; i < n; i++ {
+		res[i] = "?"
+	}
+	return res
+}
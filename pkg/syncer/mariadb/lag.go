@@ -0,0 +1,122 @@
+package mariadb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/sirupsen/logrus"
+)
+
+// lagCheckInterval is how often the replication lag is compared with max_lag
+const lagCheckInterval = time.Second
+
+// lagDebounce is how long the lag must stay on the other side of max_lag before the
+// crossing is reported
+const lagDebounce = 5 * time.Second
+
+// OnLagExceeded registers fn to be called with the current replication lag when it rises
+// above max_lag, and again when it falls back to max_lag or below. A crossing is reported
+// once the lag has stayed on its side of max_lag for 5s, so brief spikes do not fire.
+// Callbacks run on a single goroutine. OnLagExceeded must be called before Start.
+func (s *MariaDBSyncer) OnLagExceeded(fn func(lag time.Duration)) {
+	s.lagCallbacks = append(s.lagCallbacks, fn)
+}
+
+// lagTracker estimates the replication lag: the age of the last binlog event when it was
+// applied, growing with the time since while no newer event arrives. Its methods are no-ops
+// on a nil tracker.
+type lagTracker struct {
+	mu       sync.Mutex
+	eventLag time.Duration // age of the last event when it was observed
+	seen     time.Time     // when the last event was observed; zero before the first
+}
+
+// observe records an applied or synced binlog event
+func (l *lagTracker) observe(header *replication.EventHeader) {
+	if l == nil || header == nil || header.Timestamp == 0 {
+		return
+	}
+	now := time.Now()
+	lag := now.Sub(time.Unix(int64(header.Timestamp), 0))
+	if lag < 0 {
+		// Clock skew between the source and the syncer
+		lag = 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.eventLag = lag
+	l.seen = now
+}
+
+// current returns the lag at now; it is 0 until the first event
+func (l *lagTracker) current(now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen.IsZero() {
+		return 0
+	}
+	return l.eventLag + now.Sub(l.seen)
+}
+
+// observed reports whether an event has been observed
+func (l *lagTracker) observed() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.seen.IsZero()
+}
+
+// lagAlarm reports debounced crossings of max_lag
+type lagAlarm struct {
+	threshold time.Duration
+	callbacks []func(time.Duration)
+	logger    *logrus.Logger
+	exceeded  bool      // the last reported state
+	flipSince time.Time // since when the lag is on the other side of the threshold; zero when it is not
+}
+
+// check compares lag with the threshold and reports a crossing that has lasted lagDebounce
+func (a *lagAlarm) check(now time.Time, lag time.Duration) {
+	over := lag > a.threshold
+	if over == a.exceeded {
+		a.flipSince = time.Time{}
+		return
+	}
+	if a.flipSince.IsZero() {
+		a.flipSince = now
+	}
+	if now.Sub(a.flipSince) < lagDebounce {
+		return
+	}
+	a.exceeded, a.flipSince = over, time.Time{}
+	if over {
+		a.logger.Warnf("[MariaDB] Replication lag %v exceeds max_lag %v", lag.Round(time.Millisecond), a.threshold)
+	} else {
+		a.logger.Infof("[MariaDB] Replication lag %v is back within max_lag %v", lag.Round(time.Millisecond), a.threshold)
+	}
+	for _, fn := range a.callbacks {
+		fn(lag)
+	}
+}
+
+// watchLag checks the lag against max_lag until ctx is done
+func (s *MariaDBSyncer) watchLag(ctx context.Context) {
+	alarm := &lagAlarm{threshold: s.cfg.MaxLag, callbacks: s.lagCallbacks, logger: s.logger}
+	ticker := time.NewTicker(lagCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			alarm.check(now, s.lag.current(now))
+		}
+	}
+}
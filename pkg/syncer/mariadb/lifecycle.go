@@ -0,0 +1,103 @@
+package mariadb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// initialSyncHooks holds the callbacks of the initial sync lifecycle and signals when the
+// initial sync run by Start is done
+type initialSyncHooks struct {
+	start    []func(table string)
+	progress []func(table string, copied, total int64)
+	complete []func(table string)
+	failures atomic.Int64 // tables whose copy failed
+
+	mu     sync.Mutex
+	done   chan struct{}
+	closed bool
+}
+
+// OnInitialSyncStart registers fn to be called with the source db.table when the initial sync
+// starts copying it. A table with extra targets is reported once per destination. Callbacks
+// run on the goroutine copying the table, so with initial_sync_concurrency they may run
+// concurrently for different tables. OnInitialSyncStart must be called before Start.
+func (s *MariaDBSyncer) OnInitialSyncStart(fn func(table string)) {
+	s.initialSync.start = append(s.initialSync.start, fn)
+}
+
+// OnInitialSyncProgress registers fn to be called after each batch the initial sync copies
+// with the rows copied so far and the estimated total from information_schema, which is 0
+// when unknown and may be lower than the rows copied. It runs like OnInitialSyncStart.
+func (s *MariaDBSyncer) OnInitialSyncProgress(fn func(table string, copied, total int64)) {
+	s.initialSync.progress = append(s.initialSync.progress, fn)
+}
+
+// OnInitialSyncComplete registers fn to be called when the initial sync has copied a table.
+// Tables it skips, such as target tables that already have rows, are not reported. It runs
+// like OnInitialSyncStart.
+func (s *MariaDBSyncer) OnInitialSyncComplete(fn func(table string)) {
+	s.initialSync.complete = append(s.initialSync.complete, fn)
+}
+
+// InitialSyncDone returns a channel closed once Start has copied every table that needs an
+// initial sync, or has found none does, and before it streams binlog events. It stays open
+// when the copy of any table fails.
+func (s *MariaDBSyncer) InitialSyncDone() <-chan struct{} {
+	return s.initialSync.doneChan()
+}
+
+func (h *initialSyncHooks) doneChan() chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.done == nil {
+		h.done = make(chan struct{})
+	}
+	return h.done
+}
+
+// finish closes the done channel unless the copy of a table failed or was cancelled
+func (h *initialSyncHooks) finish(ctx context.Context) {
+	if h.failures.Load() > 0 || ctx.Err() != nil {
+		return
+	}
+	done := h.doneChan()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.closed {
+		h.closed = true
+		close(done)
+	}
+}
+
+func (h *initialSyncHooks) started(table string) {
+	for _, fn := range h.start {
+		fn(table)
+	}
+}
+
+func (h *initialSyncHooks) progressed(table string, copied, total int64) {
+	for _, fn := range h.progress {
+		fn(table, copied, total)
+	}
+}
+
+func (h *initialSyncHooks) completed(table string) {
+	for _, fn := range h.complete {
+		fn(table)
+	}
+}
+
+// estimateRows returns the row count information_schema estimates for a source table, or 0
+// when it is unknown
+func estimateRows(ctx context.Context, db querier, database, table string) int64 {
+	var rows *int64
+	err := db.QueryRowContext(ctx,
+		"SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+		database, table).Scan(&rows)
+	if err != nil || rows == nil {
+		return 0
+	}
+	return *rows
+}
@@ -3,76 +3,442 @@ package mariadb
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/client"
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/go-mysql-org/go-mysql/schema"
-	_ "github.com/go-sql-driver/mysql"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/tidb/pkg/parser"
 	"github.com/retail-ai-inc/sync/pkg/config"
+	"github.com/retail-ai-inc/sync/pkg/metrics"
 	"github.com/sirupsen/logrus"
 )
 
+// metricsType is the "type" label value for MariaDB metrics
+const metricsType = "mariadb"
+
+// defaultInitialSyncBatchSize is used when InitialSyncBatchSize is not configured
+const defaultInitialSyncBatchSize = 100
+
+// minDerivedServerID is the lowest server ID derived when ServerID is not configured
+const minDerivedServerID = 1001
+
+// Target pool defaults. Binlog events are applied one transaction at a time, so incremental
+// sync holds a single connection; the headroom covers the initial sync and retries.
+const (
+	defaultTargetMaxOpenConns    = 10
+	defaultTargetMaxIdleConns    = 2
+	defaultTargetConnMaxLifetime = 30 * time.Minute
+	defaultPositionSaveInterval  = 3 * time.Second
+	defaultPositionSaveThrottle  = time.Second
+	defaultWriteBatchDelay       = 100 * time.Millisecond
+	defaultWriteTimeout          = 30 * time.Second
+)
+
 // MariaDBSyncer is the structure for MariaDB synchronization
 type MariaDBSyncer struct {
-	cfg    config.SyncConfig
-	logger *logrus.Logger
+	cfg        config.SyncConfig
+	audit      *auditLog // nil unless AuditLogPath is set
+	converters converterSet
+	status     statusTracker
+	logger     *logrus.Logger
+
+	sourceDSN        string                     // source DSN for queries outside canal; empty uses SourceConnection
+	sourceDial       DialFunc                   // set by SetSourceDialer; nil connects directly
+	targetDial       DialFunc                   // set by SetTargetDialer; nil connects directly
+	generatedColumns map[string]map[string]bool // generated target columns by target db.table
+	statementLimit   int                        // bytes a multi-row INSERT may take; 0 is unlimited
+	slowWrites       *slowWriteLogger           // nil unless SlowWriteThreshold is set
+	debugRows        *rowLogger                 // nil unless DebugRows is set
+	typeExclusions   *typeExclusions            // nil unless columns are excluded by type or size
+	positions        positionStore              // nil unless the binlog position is persisted
+	saveMu           sync.Mutex                 // serializes position saves from the ticker and OnPosSynced
+	savesHeld        bool                       // ResyncTable holds back events; guarded by saveMu
+	changeCallbacks  []func(ChangeEvent)        // registered through OnChange
+	lagCallbacks     []func(time.Duration)      // registered through OnLagExceeded
+	resolvers        conflictResolvers          // registered through RegisterConflictResolver
+	initialSync      initialSyncHooks
+	progressRows     int           // rows of a table between initial sync progress logs, 0 for no limit
+	progressInterval time.Duration // most time between initial sync progress logs of a table
+	lag              lagTracker
+	cutover          cutoverState
+	dump             dumpProgress
+	pause            pauseGate
+	tables           tableToggles
+	destinations     map[string]*destination // extra target pools by configured connection
+	reloadMu         sync.Mutex              // serializes Reload calls and guards live
+	live             *liveSync               // the running incremental sync; nil when not running
 }
 
 func NewMariaDBSyncer(cfg config.SyncConfig, logger *logrus.Logger) *MariaDBSyncer {
+	// Every later use of the mappings, including auto_create_target, sees the prefixed names
+	cfg.Mappings = prefixTargetDatabases(cfg.Mappings, cfg.TargetDatabasePrefix)
 	return &MariaDBSyncer{
 		cfg:    cfg,
 		logger: logger,
 	}
 }
 
-// Start function: start the synchronization process
-func (s *MariaDBSyncer) Start(ctx context.Context) {
-	// 1. Create canal configuration
+// RegisterConverter installs a converter for one source column, applied in the initial and
+// incremental sync after the built-in conversions. It must be called before Start.
+func (s *MariaDBSyncer) RegisterConverter(database, table, column string, fn ValueConverter) {
+	s.converters.register(database, table, column, fn)
+}
+
+// Start function: start the synchronization process.
+// It blocks until ctx is done or canal stops with an error, and never exits the process.
+// Cancelling ctx aborts the target write in flight; its event is read again on restart.
+// Before returning it waits for canal, saves the final binlog position and closes the
+// target connection.
+// Invalid settings fail it with a ConfigError, an unreachable database with a ConnectionError
+// and the binlog stream with a ReplicationError.
+func (s *MariaDBSyncer) Start(ctx context.Context) error {
+	// Cancelling on return stops the position saver when canal fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if problems := ValidateConfig(s.cfg); len(problems) > 0 {
+		return &ConfigError{Err: fmt.Errorf("invalid MariaDB configuration:\n%w", errors.Join(problems...))}
+	}
+
+	// 1. Create canal configuration from the parsed source DSN
+	dsnCfg, err := parseDSN(s.cfg.SourceConnection)
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+
+	// Load TLS settings first so missing certificate files fail before any connection
+	conns, err := s.prepareConnections()
+	if err != nil {
+		return err
+	}
+	defer conns.release()
+	targetDSN, tlsCfg, tlsName, sourceDial := conns.targetDSN, conns.tlsCfg, conns.tlsName, conns.sourceDial
+
+	// Databases started alongside the syncer may not accept connections yet
+	if err := s.preflight(ctx, targetDSN); err != nil {
+		return err
+	}
+
+	// Fail fast on mappings that do not match the source schema
+	if err := s.validateMappings(ctx, s.cfg.Mappings); err != nil {
+		return err
+	}
+
+	if s.cfg.AuditLogPath != "" {
+		if s.audit, err = openAuditLog(s.cfg.AuditLogPath); err != nil {
+			return err
+		}
+		// Runs after the shutdown sequence, so every applied change is flushed
+		defer func() {
+			if err := s.audit.close(); err != nil {
+				s.logger.Errorf("Failed to close MariaDB audit log: %v", err)
+			}
+		}()
+	}
+
 	cfg := canal.NewDefaultConfig()
-	cfg.Addr = s.parseAddr(s.cfg.SourceConnection)
-	cfg.User, cfg.Password = s.parseUserPassword(s.cfg.SourceConnection)
-	cfg.Dump.ExecutionPath = s.cfg.DumpExecutionPath
+	// Canal otherwise logs to stdout on its own, including its dump and its binlog syncer
+	cfg.Logger = newCanalLogger(s.logger)
+	if err := applyDSNConfig(cfg, dsnCfg); err != nil {
+		return &ConfigError{Err: err}
+	}
+	if s.converters.srcLoc, s.converters.loc, err = s.timezones(); err != nil {
+		return &ConfigError{Err: err}
+	}
+	if s.converters.loc != nil {
+		// Canal renders binlog TIMESTAMP values as strings in this location; with a source
+		// timezone they are converted from it like the values the initial sync reads
+		cfg.TimestampStringLocation = s.converters.loc
+		if s.converters.srcLoc != nil {
+			cfg.TimestampStringLocation = s.converters.srcLoc
+		}
+	}
+	if tlsCfg != nil {
+		cfg.TLSConfig = withTLSServerName(tlsCfg, dsnCfg.Addr)
+	}
+	if sourceDial != nil {
+		cfg.Dialer = client.Dialer(sourceDial)
+	}
+	cfg.ServerID = s.serverID()
+	// Binlog DECIMAL values are decoded to exact strings rather than decimal.Decimal
+	cfg.UseDecimal = false
+	if s.cfg.UseGTID {
+		// MariaDB GTIDs (domain-server-sequence) are only understood by the MariaDB flavor
+		cfg.Flavor = mysql.MariaDBFlavor
+	}
 
-	// 2. Only include the tables we need
-	includeTables := []string{}
+	// Parse the row filters up front so an unsupported filter fails fast
+	filters, err := buildSourceFilters(s.cfg.Mappings)
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	if err := validateTransforms(s.cfg.Mappings); err != nil {
+		return &ConfigError{Err: err}
+	}
 	for _, mapping := range s.cfg.Mappings {
-		for _, table := range mapping.Tables {
-			includeTables = append(includeTables, fmt.Sprintf("%s\\.%s", mapping.SourceDatabase, table.SourceTable))
+		for _, tableMap := range mapping.Tables {
+			s.logger.Infof("[MariaDB] Replicating %s on %s.%s", strings.Join(tableMap.EnabledActions(), ", "),
+				mapping.SourceDatabase, tableMap.SourceTable)
 		}
 	}
-	cfg.IncludeTableRegex = includeTables
-
-	// 3. Create canal instance
-	c, err := canal.NewCanal(cfg)
+	saveInterval, err := s.positionSaveInterval()
 	if err != nil {
-		s.logger.Fatalf("Failed to create canal for MariaDB: %v", err)
+		return &ConfigError{Err: err}
+	}
+	saveThrottle, err := s.positionSaveThrottle()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	changeBufferSize, err := s.changeBufferSize()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	batchDelay, err := s.writeBatchDelay()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	applyConcurrency, err := s.applyConcurrency()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	applyQueueSize, err := s.applyQueueSize()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	if s.cfg.ApplyQueueSize > 0 && applyConcurrency == 1 {
+		s.logger.Infof("[MariaDB] apply_queue_size only applies with apply_concurrency above 1; events are written as they are read")
+	}
+	writeTimeout, err := s.writeTimeout()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	reconnectAttempts, reconnectBaseDelay, err := s.reconnectPolicy()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	if s.slowWrites, err = s.newSlowWriteLogger(); err != nil {
+		return &ConfigError{Err: err}
+	}
+	if s.debugRows, err = s.newRowLogger(); err != nil {
+		return &ConfigError{Err: err}
+	}
+	if s.typeExclusions, err = s.newTypeExclusions(); err != nil {
+		return &ConfigError{Err: err}
+	}
+	if s.cfg.PositionSaveEvents < 0 {
+		return &ConfigError{Err: fmt.Errorf("invalid position_save_events %d for MariaDB: must not be negative", s.cfg.PositionSaveEvents)}
+	}
+	if s.cfg.MaxLag < 0 {
+		return &ConfigError{Err: fmt.Errorf("invalid max_lag %v for MariaDB: must not be negative", s.cfg.MaxLag)}
+	}
+	cutoverLag, cutoverHold, err := s.cutoverPolicy()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	if err := s.checkTargetCharset(); err != nil {
+		return &ConfigError{Err: err}
+	}
+	if _, err := s.largeColumnThreshold(); err != nil {
+		return &ConfigError{Err: err}
+	}
+	if s.progressRows, s.progressInterval, err = s.initialSyncProgressPolicy(); err != nil {
+		return &ConfigError{Err: err}
+	}
+	mode, err := s.mode()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	errorPolicy, err := s.errorPolicy()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	ignoreErrorCodes, err := s.ignoreErrorCodes()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	initialSyncMethod, err := s.initialSyncMethod(mode)
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	if cfg.Dump.ExecutionPath, err = s.dumpExecutionPath(mode); err != nil {
+		return &ConfigError{Err: err}
+	}
+	overridePos, overrideGTID, err := s.startOverride(cfg.Flavor)
+	if err != nil {
+		return &ConfigError{Err: err}
 	}
 
-	// 4. Initialize target database connection
-	targetDB, err := sql.Open("mysql", s.cfg.TargetConnection)
+	// 2. Only include the enabled tables we need, and never the system or excluded databases
+	if cfg.IncludeTableRegex, cfg.ExcludeTableRegex, err = canalTableFilters(s.tables.start(s.cfg.Mappings), s.cfg.ExcludeDatabases, s.cfg.SkipTables); err != nil {
+		return &ConfigError{Err: err}
+	}
+	if len(cfg.IncludeTableRegex) == 0 {
+		// Canal would stream every table without an include regex
+		return &ConfigError{Err: fmt.Errorf("every mapped MariaDB table is disabled")}
+	}
+	skipped := skippedTables(s.cfg.SkipTables)
+	for _, mapping := range s.cfg.Mappings {
+		for _, tableMap := range mapping.Tables {
+			if skipped[strings.ToLower(mapping.SourceDatabase+"."+tableMap.SourceTable)] {
+				s.logger.Warnf("[MariaDB] %s.%s is listed in skip_tables; its binlog events are dropped",
+					mapping.SourceDatabase, tableMap.SourceTable)
+			}
+		}
+	}
+
+	// 3. Initialize target database connection
+	targetDB, err := sql.Open("mysql", targetDSN)
 	if err != nil {
-		s.logger.Fatalf("Failed to connect to target MariaDB database: %v", err)
+		return fmt.Errorf("failed to connect to target MariaDB database: %w", err)
+	}
+	if err := s.configureTargetPool(targetDB); err != nil {
+		targetDB.Close()
+		return err
+	}
+	if err := s.createTargetDatabases(ctx, targetDB, s.cfg.Mappings); err != nil {
+		targetDB.Close()
+		return err
+	}
+	if err := checkSoftDeleteColumns(ctx, targetDB, s.cfg.Mappings); err != nil {
+		targetDB.Close()
+		return err
+	}
+	if s.generatedColumns, err = loadGeneratedColumns(ctx, targetDB, s.cfg.Mappings); err != nil {
+		targetDB.Close()
+		return err
+	}
+	if s.statementLimit, err = s.maxStatementBytes(ctx, targetDB); err != nil {
+		targetDB.Close()
+		return err
+	}
+	if s.destinations, err = s.openDestinations(ctx, tlsName); err != nil {
+		targetDB.Close()
+		return err
+	}
+	defer closeDestinations(s.destinations)
+	var deadLetters deadLetterSink
+	if errorPolicy == errorPolicyDeadLetter {
+		if deadLetters, err = s.openDeadLetterSink(targetDB); err != nil {
+			targetDB.Close()
+			return err
+		}
+		defer func() {
+			if err := deadLetters.close(); err != nil {
+				s.logger.Errorf("Failed to close MariaDB dead-letter sink: %v", err)
+			}
+		}()
+	}
+
+	// 4. A one-shot copy reads the source over plain SQL and never starts canal
+	if mode == config.ModeFull {
+		defer targetDB.Close()
+		if _, err := s.doInitialFullSyncIfNeeded(ctx, nil, s.primaryDestination(targetDB), s.destinations, s.cfg.Mappings); err != nil {
+			return err
+		}
+		s.initialSync.finish(ctx)
+		s.logger.Info("MariaDB full copy completed.")
+		return nil
 	}
-	// Decide if you need defer targetDB.Close() based on your usage
 
-	// 5. Perform initial full sync if the target table is empty
-	s.doInitialFullSyncIfNeeded(ctx, c, targetDB)
+	// The binlog position is kept in a file or in a table on the target
+	if s.positions, err = s.openPositionStore(ctx, targetDB, dsnCfg.Addr); err != nil {
+		targetDB.Close()
+		return err
+	}
+
+	// 5. Create canal instance and perform the initial full sync if the target table is empty
+	c, err := canal.NewCanal(cfg)
+	if err != nil {
+		targetDB.Close()
+		return &ReplicationError{Err: fmt.Errorf("failed to create canal for MariaDB: %w", err)}
+	}
+	// Without canal's dump, a canal without a saved position starts where the source binlog
+	// stood before the initial sync rather than at its oldest binlog
+	var startupPos *mysql.Position
+	if s.canalDumpDisabled(mode) {
+		pos, err := c.GetMasterPos()
+		if err != nil {
+			targetDB.Close()
+			c.Close()
+			return fmt.Errorf("failed to read MariaDB source binlog position: %w", err)
+		}
+		startupPos = &pos
+	}
+	var snapshotPos *mysql.Position
+	if mode == config.ModeFullIncremental && initialSyncMethod != initialSyncMethodCanalDump {
+		if snapshotPos, err = s.doInitialFullSyncIfNeeded(ctx, c, s.primaryDestination(targetDB), s.destinations, s.cfg.Mappings); err != nil {
+			targetDB.Close()
+			c.Close()
+			return err
+		}
+	}
+	if initialSyncMethod != initialSyncMethodCanalDump {
+		// Also closed without an initial sync, before any event is streamed
+		s.initialSync.finish(ctx)
+	}
 
 	// 6. Set EventHandler for incremental sync
 	h := &MariaDBEventHandler{
 		targetDB:          targetDB,
 		mappings:          s.cfg.Mappings,
 		logger:            s.logger,
-		positionSaverPath: s.cfg.MySQLPositionPath,
 		canal:             c,
+		propagateDDL:      s.cfg.PropagateDDL,
+		propagateTruncate: s.cfg.PropagateTruncate,
+		retryMaxAttempts:  s.cfg.WriteRetryMaxAttempts,
+		retryBaseDelay:    s.cfg.WriteRetryBaseDelay,
+		ctx:               ctx,
+		writeTimeout:      writeTimeout,
+		filters:           filters,
+		stmts:             newStmtCache(targetDB),
+		audit:             s.audit,
+		converters:        &s.converters,
+		resolvers:         s.resolvers,
+		status:            &s.status,
+		generatedColumns:  s.generatedColumns,
+		saveEvery:         s.cfg.PositionSaveEvents,
+		saveThrottle:      saveThrottle,
+		batchSize:         s.cfg.WriteBatchSize,
+		batchDelay:        batchDelay,
+		statementLimit:    s.statementLimit,
+		slowWrites:        s.slowWrites,
+		debugRows:         s.debugRows,
+		typeExclusions:    s.typeExclusions,
+		ownServerID:       s.ownServerID(),
+		allowNoPrimaryKey: s.cfg.AllowNoPrimaryKey,
+		skipTables:        skipped,
+		targetColumns:     newTargetColumnCache(),
+		strictSchema:      s.cfg.StrictSchema,
+		strictApply:       s.cfg.StrictApply,
+		minimalUpdates:    s.cfg.MinimalUpdates,
+		errorPolicy:       errorPolicy,
+		ignoreErrorCodes:  ignoreErrorCodes,
+		deadLetters:       deadLetters,
+		pause:             &s.pause,
+		tables:            &s.tables,
+		destinations:      s.destinations,
+		lag:               &s.lag,
+		cutover:           &s.cutover,
+		dump:              &s.dump,
+	}
+	if s.positions != nil {
+		h.savePosition = s.saveSyncedPosition
 	}
 	c.SetEventHandler(h)
 
@@ -80,278 +446,1073 @@ func (s *MariaDBSyncer) Start(ctx context.Context) {
 	if s.cfg.MySQLPositionPath != "" {
 		positionDir := filepath.Dir(s.cfg.MySQLPositionPath)
 		if err := os.MkdirAll(positionDir, os.ModePerm); err != nil {
-			s.logger.Fatalf("Failed to create directory for MariaDB position file %s: %v", s.cfg.MySQLPositionPath, err)
+			targetDB.Close()
+			c.Close()
+			return fmt.Errorf("failed to create directory for MariaDB position file %s: %w", s.cfg.MySQLPositionPath, err)
 		}
 	}
 
-	// 8. If binlog position was previously saved, load it
+	// 8. Start from a confirmed override, or else load the saved binlog position, preferring
+	// the GTID set in GTID mode
 	var startPos *mysql.Position
-	if s.cfg.MySQLPositionPath != "" {
-		startPos = s.loadBinlogPosition(s.cfg.MySQLPositionPath)
-		if startPos != nil {
-			s.logger.Infof("Starting MariaDB canal from saved position: %v", *startPos)
+	var startGTID mysql.GTIDSet
+	if overridePos != nil || overrideGTID != nil {
+		// Events before the override are not read, and those after it are applied again
+		startPos, startGTID = overridePos, overrideGTID
+		if startGTID != nil {
+			s.logger.Warnf("[MariaDB] Start position override in effect: starting canal from GTID set %s instead of the saved position", startGTID)
+		} else {
+			s.logger.Warnf("[MariaDB] Start position override in effect: starting canal from %v instead of the saved position", *startPos)
+			if s.positions != nil {
+				if err := s.saveSyncedPosition(*startPos, nil); err != nil {
+					s.logger.Errorf("Failed to save MariaDB binlog position: %v", err)
+				}
+			}
+		}
+		s.logger.Warnf("[MariaDB] Remove start_position_file, start_position_offset and start_gtid once recovered; every restart starts from them again")
+	} else if s.positions != nil {
+		saved, err := s.positions.load(ctx)
+		if err != nil {
+			targetDB.Close()
+			c.Close()
+			return err
+		}
+		if saved != nil {
+			if s.cfg.UseGTID && saved.GTIDSet != "" {
+				gset, err := mysql.ParseGTIDSet(cfg.Flavor, saved.GTIDSet)
+				if err != nil {
+					s.logger.Warnf("Failed to parse saved GTID set %q, falling back to binlog file/offset: %v", saved.GTIDSet, err)
+				} else {
+					startGTID = gset
+					s.logger.Infof("Starting MariaDB canal from saved GTID set: %s", gset)
+				}
+			}
+			if startGTID == nil {
+				startPos = &saved.Position
+				// Everything up to the saved position has been applied already
+				h.lastApplied = saved.Position
+				s.logger.Infof("Starting MariaDB canal from saved position: %v", *startPos)
+			}
+		}
+	}
+	// Without one, the stream starts exactly where the consistent snapshot of the initial sync
+	// was taken. The position is saved right away, so a restart does not lose it.
+	if startPos == nil && startGTID == nil && (snapshotPos != nil || startupPos != nil) {
+		if startPos = snapshotPos; startPos != nil {
+			s.logger.Infof("Starting MariaDB canal from initial sync snapshot position: %v", *startPos)
+		} else {
+			startPos = startupPos
+			s.logger.Infof("Starting MariaDB canal from the source binlog position at startup: %v", *startPos)
+		}
+		if s.positions != nil {
+			if err := s.saveSyncedPosition(*startPos, nil); err != nil {
+				s.logger.Errorf("Failed to save MariaDB binlog position: %v", err)
+			}
 		}
 	}
 
-	// 9. Start a goroutine to periodically save the binlog position
+	switch {
+	case startGTID != nil:
+		h.applied.set(mysql.Position{}, startGTID)
+	case startPos != nil:
+		h.applied.set(*startPos, nil)
+	}
+
+	// 9. Start delivering change events and periodically saving the applied binlog position
+	// until shutdown. Reload follows the canal instance currently running, which changes on
+	// reconnect.
+	var current atomic.Pointer[canal.Canal]
+	current.Store(c)
+	h.changes = newChangeNotifier(s.changeCallbacks, changeBufferSize, s.logger)
+	if applyConcurrency > 1 {
+		h.appliers = newApplierPool(h, applyConcurrency, applyQueueSize)
+	}
+	var wg sync.WaitGroup
+	if cfg.Dump.ExecutionPath != "" && startPos == nil && startGTID == nil {
+		// Canal dumps the source before streaming when it starts without a position; it
+		// only records the position of a dump that completed
+		first := c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.watchDump(ctx, cfg.Dump.ExecutionPath, first.WaitDumpDone(), func() bool { return first.SyncedPosition().Name != "" }, s.progressInterval)
+		}()
+	} else if initialSyncMethod == initialSyncMethodCanalDump {
+		// A saved position leaves nothing to dump
+		s.initialSync.finish(ctx)
+	}
+	if s.cfg.MaxLag > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.watchLag(ctx)
+		}()
+	}
+	if cutoverLag > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.watchCutover(ctx, cutoverLag, cutoverHold)
+		}()
+	}
+	wg.Add(1)
 	go func() {
-		ticker := time.NewTicker(3 * time.Second)
+		defer wg.Done()
+		ticker := time.NewTicker(saveInterval)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				pos := c.SyncedPosition()
-				data, err := json.Marshal(pos)
+				if s.positions != nil {
+					if err := s.savePosition(h); err != nil {
+						s.logger.Errorf("Failed to save MariaDB binlog position: %v", err)
+					}
+				}
+			}
+		}
+	}()
+
+	// 10. Run canal for incremental sync until the context ends, reconnecting after
+	// recoverable failures from where the failed canal left off, and restarting it with
+	// the mappings of a Reload
+	reloads := make(chan *reloadRequest)
+	s.setLive(&liveSync{ctx: ctx, targetDB: targetDB, mode: mode, canal: &current, reloads: reloads})
+	var runErr error
+run:
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+		errCh := runCanal(c, startPos, startGTID)
+		s.status.setRunning(true)
+
+		// 11. Wait for context to end, canal to fail or a reload
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Stopping MariaDB synchronization...")
+			c.Close()
+			// Canal returns once the event in flight has been applied or its write cancelled; its context error is expected
+			<-errCh
+		case runErr = <-errCh:
+			c.Close()
+		case req := <-reloads:
+			c.Close()
+			<-errCh
+			s.status.setRunning(false)
+			next, pos, gset, err := s.restartForReload(h, c, cfg, req)
+			req.done <- err
+			if err != nil {
+				runErr = err
+				break run
+			}
+			c, startPos, startGTID = next, pos, gset
+			current.Store(c)
+			attempt = 0
+			continue
+		}
+		s.status.setRunning(false)
+		if ctx.Err() != nil {
+			runErr = nil
+		}
+		if runErr == nil || !isRecoverableCanalError(runErr) {
+			break
+		}
+
+		// A canal that ran for a while before failing starts a fresh series of attempts
+		if time.Since(started) >= reconnectResetAfter {
+			attempt = 1
+		}
+		if attempt > reconnectAttempts {
+			runErr = fmt.Errorf("giving up after %d reconnect attempts: %w", reconnectAttempts, runErr)
+			break
+		}
+		s.status.setError(runErr)
+		delay := reconnectDelay(reconnectBaseDelay, attempt)
+		s.logger.Warnf("[MariaDB] Canal stopped with a recoverable error, reconnecting in %v (attempt %d/%d): %v",
+			delay, attempt, reconnectAttempts, runErr)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			runErr = nil
+			break
+		}
+
+		// Resume from the last applied position, not canal's synced one, which already moved
+		// past a transaction whose rows failed to write; rows of a partly read or failed
+		// transaction are read again
+		h.discardPending()
+		if s.positions != nil {
+			if err := s.savePosition(h); err != nil {
+				s.logger.Errorf("Failed to save MariaDB binlog position: %v", err)
+			}
+		}
+		startPos, startGTID = s.resumeFrom(h, startPos, startGTID)
+		next, err := canal.NewCanal(cfg)
+		if err != nil {
+			runErr = fmt.Errorf("failed to recreate canal for MariaDB: %w", err)
+			break
+		}
+		c = next
+		c.SetEventHandler(h)
+		h.canal = c
+		current.Store(c)
+	}
+
+	// 12. Stop the position saver, then persist the final position and release the target
+	cancel()
+	s.setLive(nil)
+	wg.Wait()
+	h.appliers.close()
+	if s.positions != nil {
+		if err := s.savePosition(h); err != nil {
+			s.logger.Errorf("Failed to save final MariaDB binlog position: %v", err)
+		}
+	}
+	h.stmts.close()
+	if err := targetDB.Close(); err != nil {
+		s.logger.Errorf("Failed to close MariaDB target connection: %v", err)
+	}
+	h.changes.close()
+
+	if runErr != nil {
+		s.status.setError(runErr)
+		return &ReplicationError{Err: fmt.Errorf("failed to run canal for MariaDB: %w", runErr)}
+	}
+	s.logger.Info("MariaDB synchronization stopped.")
+	return nil
+}
+
+// MetricsHandler serves the sync metrics so callers can mount it on their own mux
+func (s *MariaDBSyncer) MetricsHandler() http.Handler {
+	return metrics.Handler()
+}
+
+// Perform initial full sync if needed (batch insertion) of mappings into primary, the
+// target_connection, and the extra targets. Without a canal, as in full mode or on Reload,
+// table schemas are read from the source directly. With consistent_snapshot it returns the
+// binlog position the copied rows correspond to.
+func (s *MariaDBSyncer) doInitialFullSyncIfNeeded(
+	ctx context.Context,
+	c *canal.Canal,
+	primary *destination,
+	extras map[string]*destination,
+	mappings []config.DatabaseMapping,
+) (*mysql.Position, error) {
+	// Reconnect to the source DB with the same DSN and TLS config to manually query
+	sourceDB, err := s.openSource()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source DB for initial sync in MariaDB: %w", err)
+	}
+	defer sourceDB.Close()
+
+	batchSize, err := s.initialSyncBatchSize()
+	if err != nil {
+		return nil, err
+	}
+
+	// A forced resync copies whole tables, so checkpoints of an earlier copy do not apply
+	var checkpoints *checkpointStore
+	if s.cfg.ResumableInitialSync && !s.cfg.ForceFullResync {
+		if checkpoints, err = loadCheckpointStore(s.initialSyncCheckpointPath()); err != nil {
+			return nil, err
+		}
+	}
+
+	concurrency, err := s.initialSyncConcurrency()
+	if err != nil {
+		return nil, err
+	}
+
+	// A consistent snapshot copies every table as of one binlog position, which incremental
+	// sync starts from, so no write is missed or applied twice. Its reads share one connection.
+	var source querier = sourceDB
+	var snap *sourceSnapshot
+	if s.cfg.ConsistentSnapshot {
+		if snap, err = openSnapshot(ctx, sourceDB); err != nil {
+			return nil, fmt.Errorf("failed to start consistent snapshot for MariaDB initial sync: %w", err)
+		}
+		defer func() {
+			if err := snap.close(); err != nil {
+				s.logger.Errorf("Failed to end MariaDB initial sync snapshot: %v", err)
+			}
+		}()
+		source = snap.conn
+		s.logger.Infof("[MariaDB] Initial sync reads a consistent snapshot at binlog position %v", snap.pos)
+		if concurrency > 1 {
+			s.logger.Warnf("[MariaDB] consistent_snapshot copies tables one at a time; ignoring initial_sync_concurrency %d", concurrency)
+			concurrency = 1
+		}
+	}
+
+	// Every enabled table is copied to its target and to each of its extra targets
+	type tableJob struct {
+		mapping  config.DatabaseMapping
+		tableMap config.TableMapping
+		dest     *destination
+	}
+	var tableJobs []tableJob
+	for _, mapping := range mappings {
+		for _, tableMap := range mapping.Tables {
+			if !s.tables.enabled(mapping.SourceDatabase, tableMap) {
+				s.logger.Infof("[MariaDB] Skipping initial sync of %s.%s, table disabled", mapping.SourceDatabase, tableMap.SourceTable)
+				continue
+			}
+			tableJobs = append(tableJobs, tableJob{mapping: mapping, tableMap: tableMap, dest: primary})
+			for _, et := range tableMap.ExtraTargets {
+				extra := extraMapping(mapping, tableMap, et)
+				tableJobs = append(tableJobs, tableJob{mapping: extra, tableMap: extra.Tables[0], dest: extras[et.TargetConnection]})
+			}
+		}
+	}
+	emptyKey := func(job tableJob) string {
+		return job.dest.name + "/" + job.mapping.TargetDatabase + "." + job.tableMap.TargetTable
+	}
+
+	// Emptiness is checked once per target table before copying, so several source tables
+	// merged into one target are all copied instead of only the first. A forced resync
+	// copies regardless, optionally into a freshly truncated target.
+	targetEmpty := make(map[string]bool)
+	for _, job := range tableJobs {
+		key := emptyKey(job)
+		if _, ok := targetEmpty[key]; ok {
+			continue
+		}
+		target := job.mapping.TargetDatabase + "." + job.tableMap.TargetTable
+		if s.cfg.ForceFullResync {
+			if s.cfg.TruncateBeforeResync {
+				truncateSQL := fmt.Sprintf("TRUNCATE TABLE %s", quoteTable(job.mapping.TargetDatabase, job.tableMap.TargetTable))
+				if _, err := job.dest.db.ExecContext(ctx, truncateSQL); err != nil {
+					return nil, fmt.Errorf("failed to truncate target table %s before full resync: %w", target, err)
+				}
+				s.logger.Infof("[MariaDB] Truncated target table %s before full resync", target)
+			}
+			targetEmpty[key] = true
+			continue
+		}
+		var count int
+		countSQL := fmt.Sprintf("SELECT COUNT(1) FROM %s", quoteTable(job.mapping.TargetDatabase, job.tableMap.TargetTable))
+		if err := job.dest.db.QueryRowContext(ctx, countSQL).Scan(&count); err != nil {
+			// Copying into a table in an unknown state could duplicate or overwrite its rows
+			s.logger.Errorf("[MariaDB] Could not check if target table %s is empty, skipping its initial sync: %v", target, err)
+			targetEmpty[key] = false
+			continue
+		}
+		targetEmpty[key] = count == 0
+	}
+
+	loadTable := func(database, table string) (*schema.Table, error) {
+		if c != nil {
+			return c.GetTable(database, table)
+		}
+		return schema.NewTableFromSqlDB(sourceDB, database, table)
+	}
+
+	// Tables are copied by a pool of workers; each copy draws its own connections from the
+	// source and target pools, and a failed table does not stop the others
+	jobs := make(chan tableJob)
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		failures   []error
+		mismatches []error
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				table := job.mapping.SourceDatabase + "." + job.tableMap.SourceTable
+				// The canal schema drives value conversion; without it values are copied as read
+				srcTable, err := loadTable(job.mapping.SourceDatabase, job.tableMap.SourceTable)
+				if err != nil {
+					s.logger.Warnf("[MariaDB] Failed to load schema of %s, copying values unconverted: %v", table, err)
+					srcTable = nil
+				}
+				copied, err := s.copyTable(ctx, source, job.dest, srcTable, job.mapping, job.tableMap, batchSize, checkpoints, targetEmpty[emptyKey(job)])
 				if err != nil {
-					s.logger.Errorf("Failed to marshal binlog position: %v", err)
+					s.initialSync.failures.Add(1)
+					s.logger.Errorf("[MariaDB] Initial sync of %s failed: %v", table, err)
+					mu.Lock()
+					failures = append(failures, fmt.Errorf("%s: %w", table, err))
+					mu.Unlock()
 					continue
 				}
-				if h.positionSaverPath != "" {
-					positionDir := filepath.Dir(h.positionSaverPath)
-					if err := os.MkdirAll(positionDir, os.ModePerm); err != nil {
-						s.logger.Errorf("Failed to create directory for MariaDB position file %s: %v", h.positionSaverPath, err)
-						continue
+				if copied && s.cfg.ResetAutoIncrement {
+					if err := s.resetAutoIncrement(ctx, job.dest.db, job.mapping.TargetDatabase, job.tableMap.TargetTable); err != nil {
+						s.logger.Errorf("[MariaDB] Failed to reset AUTO_INCREMENT of %s.%s: %v",
+							job.mapping.TargetDatabase, job.tableMap.TargetTable, err)
 					}
-					if err := ioutil.WriteFile(h.positionSaverPath, data, 0644); err != nil {
-						s.logger.Errorf("Failed to write binlog position to %s: %v", h.positionSaverPath, err)
+				}
+				if copied && s.cfg.VerifyAfterInitialSync {
+					if err := s.verifyTable(ctx, source, job.dest.db, job.mapping, job.tableMap); err != nil {
+						s.logger.Errorf("[MariaDB] Verification of %s failed: %v", table, err)
+						mu.Lock()
+						mismatches = append(mismatches, fmt.Errorf("%s: %w", table, err))
+						mu.Unlock()
 					}
 				}
 			}
+		}()
+	}
+
+dispatch:
+	for _, job := range tableJobs {
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			break dispatch
 		}
-	}()
+	}
+	close(jobs)
+	wg.Wait()
 
-	// 10. Run canal for incremental sync
-	go func() {
-		if startPos != nil {
-			err = c.RunFrom(*startPos)
-		} else {
-			err = c.Run()
+	if len(failures) > 0 && c == nil {
+		return nil, fmt.Errorf("full copy failed for %d MariaDB table(s):\n%w", len(failures), errors.Join(failures...))
+	}
+	if len(failures) > 0 {
+		s.logger.Errorf("[MariaDB] Initial sync failed for %d table(s); incremental sync continues:\n%v",
+			len(failures), errors.Join(failures...))
+	}
+	// Unlike a failed copy, a copy that does not match its source stops the sync
+	if len(mismatches) > 0 {
+		return nil, fmt.Errorf("initial sync verification failed for %d MariaDB table(s):\n%w",
+			len(mismatches), errors.Join(mismatches...))
+	}
+	if snap == nil {
+		return nil, nil
+	}
+	return &snap.pos, nil
+}
+
+// mode returns the configured sync mode, defaulting to full+incremental
+func (s *MariaDBSyncer) mode() (string, error) {
+	if s.cfg.TruncateBeforeResync && !s.cfg.ForceFullResync {
+		return "", fmt.Errorf("truncate_before_resync for MariaDB requires force_full_resync")
+	}
+	if s.cfg.ConsistentSnapshot && s.cfg.ResumableInitialSync {
+		// A resumed copy would read a later snapshot than the rows copied before the restart
+		return "", fmt.Errorf("consistent_snapshot for MariaDB cannot be combined with resumable_initial_sync")
+	}
+	switch s.cfg.Mode {
+	case "":
+		return config.ModeFullIncremental, nil
+	case config.ModeFull, config.ModeFullIncremental:
+		return s.cfg.Mode, nil
+	case config.ModeIncremental:
+		if s.cfg.ForceFullResync {
+			return "", fmt.Errorf("force_full_resync for MariaDB needs mode %s or %s", config.ModeFull, config.ModeFullIncremental)
 		}
+		if s.cfg.ConsistentSnapshot {
+			return "", fmt.Errorf("consistent_snapshot for MariaDB needs mode %s or %s", config.ModeFull, config.ModeFullIncremental)
+		}
+		return s.cfg.Mode, nil
+	default:
+		return "", fmt.Errorf("invalid mode %q for MariaDB: must be %s, %s or %s",
+			s.cfg.Mode, config.ModeFull, config.ModeIncremental, config.ModeFullIncremental)
+	}
+}
+
+// initialSyncConcurrency returns the number of tables copied in parallel, defaulting to 1
+func (s *MariaDBSyncer) initialSyncConcurrency() (int, error) {
+	switch {
+	case s.cfg.InitialSyncConcurrency == 0:
+		return 1, nil
+	case s.cfg.InitialSyncConcurrency < 0:
+		return 0, fmt.Errorf("invalid initial_sync_concurrency %d for MariaDB: must be positive", s.cfg.InitialSyncConcurrency)
+	default:
+		return s.cfg.InitialSyncConcurrency, nil
+	}
+}
+
+// copyTable copies one source table into an empty table of dest in batches and reports
+// whether it copied. With a checkpoint store the copy is keyed by primary key and resumes
+// after the last copied key.
+func (s *MariaDBSyncer) copyTable(
+	ctx context.Context,
+	source querier,
+	dest *destination,
+	srcTable *schema.Table,
+	mapping config.DatabaseMapping,
+	tableMap config.TableMapping,
+	batchSize int,
+	checkpoints *checkpointStore,
+	targetEmpty bool,
+) (bool, error) {
+	sourceDBName := mapping.SourceDatabase
+	targetDBName := mapping.TargetDatabase
+	targetDB := dest.db
+	// sourceName is the source_tag value incremental writes use and the table metrics and
+	// audit records name; the checkpoint key only tracks the copy's progress
+	sourceName := sourceDBName + "." + tableMap.SourceTable
+	checkpointKey := sourceName
+	if dest.name != "" {
+		// Copies to extra targets progress independently of the main one
+		checkpointKey += " -> " + dest.name + "/" + targetDBName + "." + tableMap.TargetTable
+	}
+
+	var checkpoint tableCheckpoint
+	hasCheckpoint := false
+	if checkpoints != nil {
+		checkpoint, hasCheckpoint = checkpoints.get(checkpointKey)
+		if checkpoint.Done {
+			s.logger.Infof("[MariaDB] Initial sync of %s.%s already completed according to checkpoint. Skip initial sync.",
+				sourceDBName, tableMap.SourceTable)
+			return false, nil
+		}
+	}
+
+	// 1) Only copy into a target table that was empty before the initial sync started;
+	// a checkpointed table is resumed even when it is not
+	if !hasCheckpoint && !targetEmpty {
+		s.logger.Infof("[MariaDB] Target table %s.%s already has rows. Skip initial sync.",
+			targetDBName, tableMap.TargetTable)
+		return false, nil
+	}
+
+	s.logger.Infof("[MariaDB] Doing initial full sync from source %s.%s to target %s.%s with batch size %d...",
+		sourceDBName, tableMap.SourceTable, targetDBName, tableMap.TargetTable, batchSize)
+
+	s.initialSync.started(checkpointKey)
+	// A later estimate queries the pool, since the copy's own connection is busy streaming;
+	// a snapshot has no other connection, so without callbacks its copy logs no estimate
+	var estimatedRows int64
+	var estimate func() int64
+	if len(s.initialSync.progress) > 0 {
+		estimatedRows = estimateRows(ctx, source, sourceDBName, tableMap.SourceTable)
+	} else if pool, ok := source.(*sql.DB); ok {
+		estimate = func() int64 { return estimateRows(ctx, pool, sourceDBName, tableMap.SourceTable) }
+	}
+	progress := s.newCopyProgress(checkpointKey, estimatedRows, estimate)
+
+	// 2) Get source table columns, leaving out those excluded by type or size
+	if s.typeExclusions != nil && srcTable == nil {
+		s.logger.Warnf("[MariaDB] Without the schema of %s.%s, exclude_column_types and exclude_columns_larger_than do not apply to its copy",
+			sourceDBName, tableMap.SourceTable)
+	}
+	tableMap = s.typeExclusions.apply(srcTable, tableMap)
+	cols, pkCols, err := s.getColumnsOfTable(ctx, source, sourceDBName, tableMap.SourceTable)
+	if err != nil {
+		return false, fmt.Errorf("failed to get columns of source table %s.%s: %w", sourceDBName, tableMap.SourceTable, err)
+	}
+	// Large values are filled in by key once the rows are copied, keeping batches small
+	var deferred []string
+	if s.cfg.DeferLargeColumns {
+		if deferred, err = s.deferredColumns(ctx, source, dest, mapping, tableMap, pkCols); err != nil {
+			return false, err
+		}
+		cols = withoutColumns(cols, deferred)
+	}
+
+	// Apply the column mapping; only mapped columns are read and written
+	generated := dest.generatedOf(targetDBName + "." + tableMap.TargetTable)
+	resolved := excludeGenerated(resolveTargetColumns(tableMap, cols), generated)
+	present, err := loadTargetColumns(ctx, dest.db, targetDBName, tableMap.TargetTable)
+	if err != nil {
+		s.logger.Warnf("[MariaDB] Failed to look up columns of target table %s.%s, copying every mapped column: %v",
+			targetDBName, tableMap.TargetTable, err)
+	}
+	if dropped := dropMissingColumns(resolved, present); len(dropped) > 0 {
+		if s.cfg.StrictSchema {
+			return false, fmt.Errorf("target table %s.%s lacks columns %s written from %s.%s",
+				targetDBName, tableMap.TargetTable, strings.Join(dropped, ", "), sourceDBName, tableMap.SourceTable)
+		}
+		s.logger.Warnf("[MariaDB] Target table %s.%s lacks columns %s of source %s.%s; they are not copied",
+			targetDBName, tableMap.TargetTable, strings.Join(dropped, ", "), sourceDBName, tableMap.SourceTable)
+	}
+	cols, targetCols := writableColumns(cols, resolved)
+	targetKeyCols := resolveTargetColumns(tableMap, pkCols)
+	if tableMap.SourceTag != "" {
+		targetCols = append(targetCols, tableMap.SourceTag)
+	}
+	if len(cols) == 0 {
+		return false, fmt.Errorf("all columns of source table %s.%s are excluded by the column map", sourceDBName, tableMap.SourceTable)
+	}
+
+	// 3) Read data from source table, ordered by key when the copy is resumable or an order is
+	// configured
+	from := quoteTable(sourceDBName, tableMap.SourceTable)
+	if tableMap.InitialSyncIndexHint != "" {
+		from += " FORCE INDEX (" + quoteIdent(tableMap.InitialSyncIndexHint) + ")"
+	}
+	selectSQL := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoteIdents(cols), ","), from)
+	orderCols, orderKeyCols := initialSyncOrder(tableMap, pkCols)
+	var selectArgs []interface{}
+	var whereClauses []string
+	if tableMap.SourceFilter != "" {
+		whereClauses = append(whereClauses, "("+tableMap.SourceFilter+")")
+	}
+	var keyIndexes []int
+	if checkpoints != nil {
+		if len(pkCols) == 0 {
+			return false, fmt.Errorf("resumable initial sync requires a primary key on %s.%s", sourceDBName, tableMap.SourceTable)
+		}
+		for _, key := range orderCols {
+			idx := indexOf(cols, key)
+			if idx < 0 {
+				kind := "primary key"
+				if indexOf(pkCols, key) < 0 {
+					kind = "initial_sync_order_by column"
+				}
+				return false, fmt.Errorf("%s %s of %s.%s is excluded by the column map", kind, key, sourceDBName, tableMap.SourceTable)
+			}
+			keyIndexes = append(keyIndexes, idx)
+		}
+		if len(checkpoint.LastKey) > 0 {
+			// A key of another order would skip or repeat rows
+			if !slices.Equal(checkpoint.KeyColumns, orderKeyCols) {
+				return false, fmt.Errorf("checkpoint of %s.%s was taken in the order of (%s), not (%s); restore initial_sync_order_by or remove the checkpoint",
+					sourceDBName, tableMap.SourceTable, keyColumnsOrPK(checkpoint.KeyColumns), keyColumnsOrPK(orderKeyCols))
+			}
+			if len(checkpoint.LastKey) != len(orderCols) {
+				return false, fmt.Errorf("checkpoint of %s.%s has %d key values but the key has %d columns",
+					sourceDBName, tableMap.SourceTable, len(checkpoint.LastKey), len(orderCols))
+			}
+			cond, args := keyAfter(orderCols, checkpoint.LastKey)
+			whereClauses = append(whereClauses, cond)
+			selectArgs = append(selectArgs, args...)
+			s.logger.Infof("[MariaDB] Resuming initial sync of %s.%s after key (%s)", sourceDBName, tableMap.SourceTable,
+				strings.Join(checkpoint.LastKey, ", "))
+		}
+	}
+	if len(whereClauses) > 0 {
+		selectSQL += " WHERE " + strings.Join(whereClauses, " AND ")
+	}
+	if checkpoints != nil || len(tableMap.InitialSyncOrderBy) > 0 {
+		selectSQL += " ORDER BY " + strings.Join(quoteIdents(orderCols), ", ")
+	}
+	// A dedicated connection keeps the streamed result set on one socket for the whole copy;
+	// a snapshot already is one
+	if db, ok := source.(*sql.DB); ok {
+		conn, err := db.Conn(ctx)
 		if err != nil {
-			s.logger.Fatalf("Failed to run canal for MariaDB: %v", err)
+			return false, fmt.Errorf("failed to get source connection for %s.%s: %w", sourceDBName, tableMap.SourceTable, err)
+		}
+		defer conn.Close()
+		source = conn
+	}
+
+	// With apply SQL the copy writes on one target connection, so session settings of
+	// pre_apply_sql hold for every batch; it is discarded when the copy fails
+	var writer execer = targetDB
+	var pinned *sql.Conn
+	copied := false
+	if len(tableMap.PreApplySQL)+len(tableMap.PostApplySQL) > 0 {
+		if pinned, err = targetDB.Conn(ctx); err != nil {
+			return false, fmt.Errorf("failed to get target connection for %s.%s: %w", targetDBName, tableMap.TargetTable, err)
+		}
+		defer func() {
+			if !copied {
+				discardConn(pinned)
+				return
+			}
+			pinned.Close()
+		}()
+		writer = pinned
+		if err := runApplySQL(ctx, pinned, "pre_apply_sql", targetDBName+"."+tableMap.TargetTable, tableMap.PreApplySQL); err != nil {
+			return false, err
+		}
+	}
+
+	srcRows, err := source.QueryContext(ctx, selectSQL, selectArgs...)
+	if err != nil {
+		return false, fmt.Errorf("failed to query source table %s.%s: %w", sourceDBName, tableMap.SourceTable, err)
+	}
+	defer srcRows.Close()
+
+	insertedCount := 0
+	flush := func(batchRows [][]interface{}) error {
+		for _, row := range batchRows {
+			if err := s.converters.convertRow(srcTable, cols, row); err != nil {
+				return err
+			}
+		}
+		// Masked and tagged copies are written; the raw rows keep the checkpoint key intact
+		writeRows := batchRows
+		if len(tableMap.Transforms) > 0 || tableMap.SourceTag != "" {
+			writeRows = make([][]interface{}, len(batchRows))
+			for i, row := range batchRows {
+				writeRows[i] = applyTransforms(tableMap, cols, row)
+				if tableMap.SourceTag != "" {
+					writeRows[i] = append(append(make([]interface{}, 0, len(row)+1), writeRows[i]...), sourceName)
+				}
+			}
+		}
+		if err := s.batchInsert(ctx, writer, targetDBName, tableMap, targetCols, targetKeyCols, writeRows); err != nil {
+			if checkpoints != nil {
+				// Advancing past a failed batch would lose its rows on resume
+				return err
+			}
+			s.logger.Errorf("[MariaDB] Batch insert failed: %v", err)
+			return nil
+		}
+		insertedCount += len(batchRows)
+		s.initialSync.progressed(checkpointKey, int64(insertedCount), estimatedRows)
+		progress.observe(int64(insertedCount))
+		metrics.AddRows(metricsType, sourceName, canal.InsertAction, metrics.PhaseInitial, len(batchRows))
+		if s.debugRows != nil {
+			for _, row := range batchRows {
+				s.debugRows.log(metrics.PhaseInitial, canal.InsertAction, sourceDBName+"."+tableMap.SourceTable,
+					targetDBName+"."+tableMap.TargetTable, tableMap, cols, targetCols, row)
+			}
+		}
+		if s.audit != nil {
+			records := initialAuditRecords(sourceName, targetDBName+"."+tableMap.TargetTable, targetCols, targetKeyCols, batchRows)
+			if err := s.audit.write(records...); err != nil {
+				s.logger.Errorf("[MariaDB] Failed to write audit log for %s: %v", sourceName, err)
+			}
+		}
+		if checkpoints != nil {
+			lastRow := batchRows[len(batchRows)-1]
+			checkpoint.LastKey = make([]string, len(keyIndexes))
+			checkpoint.KeyColumns = orderKeyCols
+			for i, idx := range keyIndexes {
+				checkpoint.LastKey[i] = keyString(lastRow[idx])
+			}
+			if err := checkpoints.set(checkpointKey, checkpoint); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := s.streamBatches(srcRows, len(cols), batchSize, checkpointKey, flush); err != nil {
+		return false, err
+	}
+	if len(deferred) > 0 {
+		// The source connection reads one result set at a time
+		srcRows.Close()
+		if err := s.copyDeferredColumns(ctx, source, dest, srcTable, mapping, tableMap, pkCols, deferred, sourceName); err != nil {
+			return false, err
+		}
+	}
+	if pinned != nil {
+		if err := runApplySQL(ctx, pinned, "post_apply_sql", targetDBName+"."+tableMap.TargetTable, tableMap.PostApplySQL); err != nil {
+			return false, err
 		}
-	}()
-
-	// 11. Wait for context to end
-	<-ctx.Done()
-	s.logger.Info("MariaDB synchronization stopped.")
-}
+		copied = true
+	}
 
-// Perform initial full sync if needed (batch insertion)
-func (s *MariaDBSyncer) doInitialFullSyncIfNeeded(ctx context.Context, c *canal.Canal, targetDB *sql.DB) {
-	// Reconnect to the source DB with the same DSN to manually query
-	sourceDB, err := sql.Open("mysql", s.cfg.SourceConnection)
-	if err != nil {
-		s.logger.Fatalf("Failed to open source DB for initial sync in MariaDB: %v", err)
+	if checkpoints != nil {
+		checkpoint.Done = true
+		if err := checkpoints.set(checkpointKey, checkpoint); err != nil {
+			return false, err
+		}
 	}
-	defer sourceDB.Close()
 
-	const batchSize = 100
+	s.logger.Infof("[MariaDB] Initial sync for %s.%s -> %s.%s completed. Inserted %d rows.",
+		sourceDBName, tableMap.SourceTable, targetDBName, tableMap.TargetTable, insertedCount)
+	progress.done()
+	s.initialSync.completed(checkpointKey)
+	return true, nil
+}
 
-	for _, mapping := range s.cfg.Mappings {
-		sourceDBName := mapping.SourceDatabase
-		targetDBName := mapping.TargetDatabase
+// rowScanner is the subset of *sql.Rows used to stream a result set
+type rowScanner interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+}
 
-		for _, tableMap := range mapping.Tables {
-			// 1) Check if the target table is empty
-			targetCountQuery := fmt.Sprintf("SELECT COUNT(1) FROM %s.%s", targetDBName, tableMap.TargetTable)
-			var count int
-			if err := targetDB.QueryRow(targetCountQuery).Scan(&count); err != nil {
-				s.logger.Errorf("[MariaDB] Could not check if target table %s.%s is empty: %v",
-					targetDBName, tableMap.TargetTable, err)
-				continue
-			}
+// streamBatches scans rows one at a time and hands them to flush in batches of batchSize.
+// go-sql-driver/mysql does not buffer result sets: each Next reads the next row packet from
+// the socket, so memory use is bounded by one batch regardless of the table size. The
+// batch slice passed to flush is reused afterwards and must not be retained.
+func (s *MariaDBSyncer) streamBatches(
+	rows rowScanner,
+	numCols, batchSize int,
+	table string,
+	flush func(batch [][]interface{}) error,
+) error {
+	batchRows := make([][]interface{}, 0, batchSize)
+	for rows.Next() {
+		rowValues := make([]interface{}, numCols)
+		valuePtrs := make([]interface{}, numCols)
+		for i := range rowValues {
+			valuePtrs[i] = &rowValues[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			s.logger.Errorf("[MariaDB] Failed to scan row from %s: %v", table, err)
+			continue
+		}
 
-			if count > 0 {
-				s.logger.Infof("[MariaDB] Target table %s.%s already has %d rows. Skip initial sync.",
-					targetDBName, tableMap.TargetTable, count)
-				continue
+		batchRows = append(batchRows, rowValues)
+		if len(batchRows) == batchSize {
+			if err := flush(batchRows); err != nil {
+				return err
 			}
+			batchRows = batchRows[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read source table %s: %w", table, err)
+	}
 
-			s.logger.Infof("[MariaDB] Target table %s.%s is empty. Doing initial full sync from source %s.%s...",
-				targetDBName, tableMap.TargetTable, sourceDBName, tableMap.SourceTable)
+	// Process remaining rows
+	if len(batchRows) > 0 {
+		return flush(batchRows)
+	}
+	return nil
+}
 
-			// 2) Get source table columns
-			cols, err := s.getColumnsOfTable(ctx, sourceDB, sourceDBName, tableMap.SourceTable)
-			if err != nil {
-				s.logger.Errorf("[MariaDB] Failed to get columns of source table %s.%s: %v",
-					sourceDBName, tableMap.SourceTable, err)
-				continue
-			}
+// initialSyncBatchSize returns the configured batch size, defaulting to 100 when unset
+func (s *MariaDBSyncer) initialSyncBatchSize() (int, error) {
+	switch {
+	case s.cfg.InitialSyncBatchSize == 0:
+		return defaultInitialSyncBatchSize, nil
+	case s.cfg.InitialSyncBatchSize < 0:
+		return 0, fmt.Errorf("invalid initial_sync_batch_size %d for MariaDB: must be positive", s.cfg.InitialSyncBatchSize)
+	default:
+		return s.cfg.InitialSyncBatchSize, nil
+	}
+}
 
-			// 3) Read data from source table
-			selectSQL := fmt.Sprintf("SELECT %s FROM %s.%s", strings.Join(cols, ","), sourceDBName, tableMap.SourceTable)
-			srcRows, err := sourceDB.QueryContext(ctx, selectSQL)
-			if err != nil {
-				s.logger.Errorf("[MariaDB] Failed to query source table %s.%s: %v",
-					sourceDBName, tableMap.SourceTable, err)
-				continue
-			}
+// positionSaveInterval returns how often the binlog position is saved, defaulting when unset
+func (s *MariaDBSyncer) positionSaveInterval() (time.Duration, error) {
+	switch {
+	case s.cfg.PositionSaveInterval == 0:
+		return defaultPositionSaveInterval, nil
+	case s.cfg.PositionSaveInterval < 0:
+		return 0, fmt.Errorf("invalid position_save_interval %s for MariaDB: must be positive", s.cfg.PositionSaveInterval)
+	default:
+		return s.cfg.PositionSaveInterval, nil
+	}
+}
 
-			insertedCount := 0
-			batchRows := make([][]interface{}, 0, batchSize)
+// positionSaveThrottle returns the minimum time between position saves from OnPosSynced
+func (s *MariaDBSyncer) positionSaveThrottle() (time.Duration, error) {
+	switch {
+	case s.cfg.PositionSaveThrottle == 0:
+		return defaultPositionSaveThrottle, nil
+	case s.cfg.PositionSaveThrottle < 0:
+		return 0, fmt.Errorf("invalid position_save_throttle %s for MariaDB: must be positive", s.cfg.PositionSaveThrottle)
+	default:
+		return s.cfg.PositionSaveThrottle, nil
+	}
+}
 
-			// Batch read
-			for srcRows.Next() {
-				rowValues := make([]interface{}, len(cols))
-				valuePtrs := make([]interface{}, len(cols))
-				for i := range cols {
-					valuePtrs[i] = &rowValues[i]
-				}
-				if err := srcRows.Scan(valuePtrs...); err != nil {
-					s.logger.Errorf("[MariaDB] Failed to scan row from %s.%s: %v",
-						sourceDBName, tableMap.SourceTable, err)
-					continue
-				}
+// changeBufferSize returns the number of change events buffered for OnChange callbacks
+func (s *MariaDBSyncer) changeBufferSize() (int, error) {
+	switch {
+	case s.cfg.ChangeBufferSize == 0:
+		return defaultChangeBufferSize, nil
+	case s.cfg.ChangeBufferSize < 0:
+		return 0, fmt.Errorf("invalid change_buffer_size %d for MariaDB: must be positive", s.cfg.ChangeBufferSize)
+	default:
+		return s.cfg.ChangeBufferSize, nil
+	}
+}
 
-				batchRows = append(batchRows, rowValues)
-				if len(batchRows) == batchSize {
-					// Batch insert
-					err := s.batchInsert(ctx, targetDB, targetDBName, tableMap.TargetTable, cols, batchRows)
-					if err != nil {
-						s.logger.Errorf("[MariaDB] Batch insert failed: %v", err)
-					} else {
-						insertedCount += len(batchRows)
-					}
-					batchRows = batchRows[:0]
-				}
-			}
-			srcRows.Close()
+// writeTimeout returns the limit on a single target write, defaulting to defaultWriteTimeout
+func (s *MariaDBSyncer) writeTimeout() (time.Duration, error) {
+	switch {
+	case s.cfg.WriteTimeout == 0:
+		return defaultWriteTimeout, nil
+	case s.cfg.WriteTimeout < 0:
+		return 0, fmt.Errorf("invalid write_timeout %s for MariaDB: must be positive", s.cfg.WriteTimeout)
+	default:
+		return s.cfg.WriteTimeout, nil
+	}
+}
 
-			// Process remaining rows
-			if len(batchRows) > 0 {
-				err := s.batchInsert(ctx, targetDB, targetDBName, tableMap.TargetTable, cols, batchRows)
-				if err != nil {
-					s.logger.Errorf("[MariaDB] Last batch insert failed: %v", err)
-				} else {
-					insertedCount += len(batchRows)
-				}
-			}
+// writeBatchDelay returns the longest time a row waits in a write batch
+func (s *MariaDBSyncer) writeBatchDelay() (time.Duration, error) {
+	switch {
+	case s.cfg.WriteBatchSize < 0:
+		return 0, fmt.Errorf("invalid write_batch_size %d for MariaDB: must not be negative", s.cfg.WriteBatchSize)
+	case s.cfg.WriteBatchDelay == 0:
+		return defaultWriteBatchDelay, nil
+	case s.cfg.WriteBatchDelay < 0:
+		return 0, fmt.Errorf("invalid write_batch_delay %s for MariaDB: must be positive", s.cfg.WriteBatchDelay)
+	default:
+		return s.cfg.WriteBatchDelay, nil
+	}
+}
 
-			s.logger.Infof("[MariaDB] Initial sync for %s.%s -> %s.%s completed. Inserted %d rows.",
-				sourceDBName, tableMap.SourceTable, targetDBName, tableMap.TargetTable, insertedCount)
-		}
+// configureTargetPool applies the target pool settings, using the defaults for unset values
+func (s *MariaDBSyncer) configureTargetPool(db *sql.DB) error {
+	if s.cfg.TargetMaxOpenConns < 0 || s.cfg.TargetMaxIdleConns < 0 || s.cfg.TargetConnMaxLifetime < 0 {
+		return fmt.Errorf("invalid target pool settings for MariaDB: target_max_open_conns, target_max_idle_conns and target_conn_max_lifetime must not be negative")
+	}
+	maxOpen := s.cfg.TargetMaxOpenConns
+	if maxOpen == 0 {
+		maxOpen = defaultTargetMaxOpenConns
 	}
+	maxIdle := s.cfg.TargetMaxIdleConns
+	if maxIdle == 0 {
+		maxIdle = defaultTargetMaxIdleConns
+	}
+	if maxIdle > maxOpen {
+		maxIdle = maxOpen
+	}
+	lifetime := s.cfg.TargetConnMaxLifetime
+	if lifetime == 0 {
+		lifetime = defaultTargetConnMaxLifetime
+	}
+
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(lifetime)
+	return nil
 }
 
-// batchInsert: insert multiple rows at once
+// batchInsert: insert multiple rows at once using the mapping's insert mode
 func (s *MariaDBSyncer) batchInsert(
 	ctx context.Context,
-	db *sql.DB,
-	dbName, tableName string,
-	cols []string,
+	db execer,
+	dbName string,
+	tableMap config.TableMapping,
+	cols, keyCols []string,
 	rows [][]interface{},
 ) error {
 	if len(rows) == 0 {
 		return nil
 	}
 
-	insertSQL := fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES",
-		dbName,
-		tableName,
-		strings.Join(cols, ", "))
+	baseSQL, err := buildInsertSQL(tableMap.InsertMode, dbName, tableMap.TargetTable, cols, keyCols, 0)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range insertChunks(rows, len(baseSQL), s.statementLimit) {
+		if err := s.insertChunk(ctx, db, dbName, tableMap, cols, keyCols, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	singleRowPlaceholder := fmt.Sprintf("(%s)", strings.Join(makeQuestionMarks(len(cols)), ","))
-	var allPlaceholder []string
-	for range rows {
-		allPlaceholder = append(allPlaceholder, singleRowPlaceholder)
+// insertChunk writes rows with one INSERT, halving the chunk when the statement still
+// turns out to exceed max_allowed_packet
+func (s *MariaDBSyncer) insertChunk(
+	ctx context.Context,
+	db execer,
+	dbName string,
+	tableMap config.TableMapping,
+	cols, keyCols []string,
+	rows [][]interface{},
+) error {
+	insertSQL, err := buildInsertSQL(tableMap.InsertMode, dbName, tableMap.TargetTable, cols, keyCols, len(rows))
+	if err != nil {
+		return err
 	}
-	insertSQL = insertSQL + " " + strings.Join(allPlaceholder, ", ")
 
 	var args []interface{}
 	for _, rowData := range rows {
 		args = append(args, rowData...)
 	}
 
-	_, err := db.ExecContext(ctx, insertSQL, args...)
+	start := time.Now()
+	_, err = db.ExecContext(ctx, insertSQL, args...)
+	s.slowWrites.observe(start, canal.InsertAction, dbName+"."+tableMap.TargetTable, len(rows))
+	if err != nil && isPacketTooLarge(err) && len(rows) > 1 {
+		s.logger.Warnf("[MariaDB] Insert of %d rows into %s.%s exceeds max_allowed_packet, splitting it: %v",
+			len(rows), dbName, tableMap.TargetTable, err)
+		half := len(rows) / 2
+		if err := s.insertChunk(ctx, db, dbName, tableMap, cols, keyCols, rows[:half]); err != nil {
+			return err
+		}
+		return s.insertChunk(ctx, db, dbName, tableMap, cols, keyCols, rows[half:])
+	}
 	if err != nil {
 		return fmt.Errorf("batchInsert Exec failed: %w", err)
 	}
 	return nil
 }
 
-// getColumnsOfTable uses SHOW COLUMNS to get table columns (allowing default etc. to be NULL)
-func (s *MariaDBSyncer) getColumnsOfTable(ctx context.Context, db *sql.DB, database, table string) ([]string, error) {
-	query := fmt.Sprintf("SHOW COLUMNS FROM %s.%s", database, table)
-	rows, err := db.QueryContext(ctx, query)
+// getColumnsOfTable returns the columns of a table by ordinal position, the order of binlog
+// rows and of canal's schema.Table.Columns, and its primary key columns in key order
+func (s *MariaDBSyncer) getColumnsOfTable(ctx context.Context, db querier, database, table string) ([]string, []string, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION",
+		database, table)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	var cols []string
 	for rows.Next() {
-		var field, typeStr, nullStr, keyStr, defaultStr, extraStr sql.NullString
-
-		if err := rows.Scan(&field, &typeStr, &nullStr, &keyStr, &defaultStr, &extraStr); err != nil {
-			return nil, fmt.Errorf("failed to scan columns info from table %s.%s: %v", database, table, err)
-		}
-		if field.Valid {
-			cols = append(cols, field.String)
-		} else {
-			return nil, fmt.Errorf("invalid column name for table %s.%s", database, table)
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan columns info from table %s.%s: %v", database, table, err)
 		}
+		cols = append(cols, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(cols) == 0 {
+		return nil, nil, fmt.Errorf("table %s.%s has no columns or does not exist", database, table)
 	}
-	return cols, nil
-}
 
-func makeQuestionMarks(n int) []string {
-	res := make([]string, n)
-	for i := 0; i < n; i++ {
-		res[i] = "?"
+	pkCols, err := primaryKeyColumns(ctx, db, database, table)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up primary key of %s.%s: %w", database, table, err)
 	}
-	return res
+	return cols, pkCols, nil
 }
 
-// loadBinlogPosition reads the binlog position
-func (s *MariaDBSyncer) loadBinlogPosition(path string) *mysql.Position {
-	positionDir := filepath.Dir(path)
-	if err := os.MkdirAll(positionDir, os.ModePerm); err != nil {
-		s.logger.Errorf("Failed to create directory for MariaDB position file %s: %v", path, err)
-		return nil
+// parseDSN parses a go-sql-driver style DSN, keeping TLS and collation options
+func parseDSN(dsn string) (*mysqldriver.Config, error) {
+	dsnCfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN format for MariaDB: %w", err)
 	}
+	return dsnCfg, nil
+}
 
-	data, err := ioutil.ReadFile(path)
-	if err != nil {
-		s.logger.Infof("No previous binlog position file at %s: %v", path, err)
-		return nil
+// applyDSNConfig copies connection settings from the parsed DSN into the canal config.
+// Canal dials TCP for host:port addresses, including bracketed IPv6 literals, and a unix
+// socket for addresses containing a slash; any other transport cannot carry binlog replication.
+func applyDSNConfig(cfg *canal.Config, dsnCfg *mysqldriver.Config) error {
+	switch dsnCfg.Net {
+	case "tcp", "tcp4", "tcp6":
+		if _, _, err := net.SplitHostPort(dsnCfg.Addr); err != nil {
+			return fmt.Errorf("invalid MariaDB source address %q: %w", dsnCfg.Addr, err)
+		}
+	case "unix":
+		if !strings.Contains(dsnCfg.Addr, "/") {
+			return fmt.Errorf("MariaDB source socket %q must be given as a path containing /, which canal needs to dial a unix socket", dsnCfg.Addr)
+		}
+	default:
+		return fmt.Errorf("unsupported MariaDB source network %q: binlog replication needs a tcp(host:port) or unix(/path) address", dsnCfg.Net)
 	}
-	if len(data) <= 1 {
-		s.logger.Infof("Binlog position file for %s is empty", path)
-		return nil
+	cfg.Addr = dsnCfg.Addr
+	cfg.User = dsnCfg.User
+	cfg.Password = dsnCfg.Passwd
+	if dsnCfg.TLS != nil {
+		cfg.TLSConfig = dsnCfg.TLS
 	}
-	var pos mysql.Position
-	if err := json.Unmarshal(data, &pos); err != nil {
-		s.logger.Errorf("Failed to unmarshal binlog position from %s: %v", path, err)
-		return nil
+	if charset := dsnCharset(dsnCfg); charset != "" {
+		cfg.Charset = charset
 	}
-	return &pos
+	return nil
 }
 
-// parseAddr from DSN
-func (s *MariaDBSyncer) parseAddr(dsn string) string {
-	parts := strings.Split(dsn, "@tcp(")
-	if len(parts) < 2 {
-		s.logger.Fatalf("Invalid DSN format for MariaDB: %s", dsn)
+// serverID returns the configured replication server ID, or one derived from the target DSN.
+// Canal otherwise picks a random ID on every start, which may collide with another replica
+// of the same master; a stable ID also lets the master recognize a restarted syncer.
+func (s *MariaDBSyncer) serverID() uint32 {
+	if s.cfg.ServerID != 0 {
+		return s.cfg.ServerID
 	}
-	addr := strings.Split(parts[1], ")")[0]
-	return addr
+	h := fnv.New32a()
+	h.Write([]byte(s.cfg.TargetConnection))
+	// Keep clear of the low IDs masters and hand-configured replicas usually take
+	return minDerivedServerID + h.Sum32()%(math.MaxUint32-minDerivedServerID+1)
 }
 
-// parseUserPassword from DSN
-func (s *MariaDBSyncer) parseUserPassword(dsn string) (string, string) {
-	parts := strings.Split(dsn, "@")
-	if len(parts) < 2 {
-		s.logger.Fatalf("Invalid DSN format for MariaDB: %s", dsn)
+// dsnCharset returns the charset requested by the DSN, either directly or via its collation
+func dsnCharset(dsnCfg *mysqldriver.Config) string {
+	if charset, ok := dsnCfg.Params["charset"]; ok && charset != "" {
+		// The driver accepts a comma separated fallback list; canal takes a single charset
+		return strings.Split(charset, ",")[0]
 	}
-	userInfo := parts[0]
-	userParts := strings.Split(userInfo, ":")
-	if len(userParts) < 2 {
-		s.logger.Fatalf("Invalid DSN user info for MariaDB: %s", userInfo)
+	if dsnCfg.Collation != "" {
+		return strings.SplitN(dsnCfg.Collation, "_", 2)[0]
 	}
-	return userParts[0], userParts[1]
+	return ""
 }
 
 // ------------------ Incremental sync event handler ------------------
@@ -361,8 +1522,59 @@ type MariaDBEventHandler struct {
 	targetDB          *sql.DB
 	mappings          []config.DatabaseMapping
 	logger            *logrus.Logger
-	positionSaverPath string
 	canal             *canal.Canal
+	propagateDDL      bool
+	propagateTruncate bool // empty the target table when its source table is truncated
+	ddlParser         *parser.Parser
+	retryMaxAttempts  int
+	retryBaseDelay    time.Duration
+	ctx               context.Context       // cancelled on shutdown, which aborts writes in flight; nil never cancels
+	writeTimeout      time.Duration         // limit on each target statement; 0 is unlimited
+	filters           map[string]*rowFilter // parsed source filters keyed by source db.table
+	stmts             *stmtCache            // prepared write statements; nil executes unprepared
+	audit             *auditLog             // nil unless AuditLogPath is set
+	binlogFile        string                // current binlog file, from rotate events
+	lastApplied       mysql.Position        // end of the last applied event; events up to it are skipped
+	applied           appliedPosition       // last synced position written to the target, which is saved and resumed from
+	converters        *converterSet         // value conversions applied before writing
+	resolvers         conflictResolvers     // registered conflict resolvers
+	status            *statusTracker        // nil when not reporting to a syncer's Status
+	generatedColumns  map[string]map[string]bool
+	savePosition      func(mysql.Position, mysql.GTIDSet) error // persists a synced position; nil without a position path
+	changes           *changeNotifier                           // nil without OnChange callbacks
+	pause             *pauseGate                                // holds back writes while paused; nil never pauses
+	tables            *tableToggles                             // tables enabled for sync; nil follows the mappings
+	lag               *lagTracker                               // replication lag estimate; nil does not track it
+	dump              *dumpProgress                             // rows applied from canal's dump; nil does not count them
+	cutover           *cutoverState                             // synced position and stop of a Cutover; nil does not track it
+	destinations      map[string]*destination                   // extra target pools by configured connection
+	catchUp           map[string]bool                           // source db.table added by Reload or re-copied, applied even before lastApplied
+	saveThrottle      time.Duration                             // minimum time between saves from OnPosSynced
+	saveEvery         int                                       // synced events that force a save within the throttle; 0 never does
+	unsaved           int                                       // synced events since the last save
+	flushErr          error                                     // failure of the last flush, returned until discardPending
+	lastSave          time.Time                                 // time of the last save from OnPosSynced
+	batchSize         int                                       // rows written per batched transaction; 0 or 1 writes each event on its own
+	batchDelay        time.Duration                             // longest time a row waits in a batch
+	statementLimit    int                                       // bytes a merged multi-row INSERT may take; 0 is unlimited
+	slowWrites        *slowWriteLogger                          // nil unless SlowWriteThreshold is set
+	debugRows         *rowLogger                                // nil unless DebugRows is set
+	typeExclusions    *typeExclusions                           // nil unless columns are excluded by type or size
+	ownServerID       uint32                                    // events with this server ID are the syncer's own writes; 0 keeps all events
+	allowNoPrimaryKey bool                                      // match rows of tables without a primary key by rowCondition
+	minimalUpdates    bool                                      // updates only SET the columns that changed
+	skipTables        map[string]bool                           // lower-cased source db.table whose events are dropped
+	unmapped          unmappedTables                            // source tables found without a mapping
+	targetColumns     *targetColumnCache                        // columns of the target tables; nil writes every mapped column
+	strictSchema      bool                                      // fail rows whose columns the target table lacks instead of dropping them
+	strictApply       bool                                      // fail writes that affect an unexpected number of target rows
+	errorPolicy       string                                    // errorPolicyStop, errorPolicySkip or errorPolicyDeadLetter
+	ignoreErrorCodes  map[uint16]bool                           // MySQL error numbers of failed writes that are skipped under any policy
+	deadLetters       deadLetterSink                            // nil unless the error policy is deadletter
+	pending           []pendingEvent                            // batched events not yet written
+	pendingRows       int                                       // rows of the pending events
+	pendingSince      time.Time                                 // when the oldest pending event was queued
+	appliers          *applierPool                              // nil writes rows on the canal goroutine
 }
 
 // OnRow handles binlog row events
@@ -371,136 +1583,540 @@ func (h *MariaDBEventHandler) OnRow(e *canal.RowsEvent) error {
 	sourceDB := table.Schema
 	tableName := table.Name
 
-	var targetDBName, targetTableName string
-	found := false
+	// Checked before any other work; canal already drops most of them by its exclude regexes
+	if h.skipTables != nil && h.skipTables[strings.ToLower(sourceDB+"."+tableName)] {
+		return nil
+	}
+	// Tables already found without a mapping are skipped without formatting anything
+	if h.unmapped.skip(h.logger, sourceDB, tableName) {
+		return nil
+	}
 
-	for _, mapping := range h.mappings {
-		if mapping.SourceDatabase == sourceDB {
-			for _, tableMap := range mapping.Tables {
-				if tableMap.SourceTable == tableName {
-					targetDBName = mapping.TargetDatabase
-					targetTableName = tableMap.TargetTable
-					found = true
-					break
-				}
-			}
-		}
-		if found {
-			break
+	if err := h.waitWhilePaused(); err != nil {
+		return err
+	}
+
+	// Events of tables added by Reload or re-copied are read again from before the last
+	// applied event. Without a consistent snapshot their copy may already hold them.
+	replay := false
+	if h.alreadyApplied(e.Header) {
+		if !h.catchUp[sourceDB+"."+tableName] {
+			h.logger.Debugf("[MariaDB] Skipping %s event on %s.%s at %s:%d, already applied",
+				e.Action, sourceDB, tableName, h.binlogFile, e.Header.LogPos)
+			return nil
 		}
+		replay = true
+	} else if h.catchUp != nil {
+		h.catchUp = nil
+	}
+
+	if h.isOwnWrite(e.Header) {
+		h.logger.Debugf("[MariaDB] Skipping %s event on %s.%s written by a syncer with server ID %d",
+			e.Action, sourceDB, tableName, h.ownServerID)
+		return nil
 	}
 
+	dbMapping, tableMapping, found := h.findTableMapping(sourceDB, tableName)
 	if !found {
-		h.logger.Warnf("No mapping found for source table %s.%s (MariaDB)", sourceDB, tableName)
+		h.unmapped.add(h.logger, sourceDB, tableName)
+		return nil
+	}
+	if !h.tables.enabled(sourceDB, tableMapping) {
+		h.logger.Debugf("[MariaDB] Skipping %s event on %s.%s, table disabled", e.Action, sourceDB, tableName)
+		return nil
+	}
+	if h.tables.isResyncing(sourceDB + "." + tableName) {
+		// Read again once the copy is done
+		h.logger.Debugf("[MariaDB] Holding back %s event on %s.%s while the table is re-copied", e.Action, sourceDB, tableName)
+		return nil
+	}
+	if !tableMapping.ActionEnabled(e.Action) {
+		h.logger.Debugf("[MariaDB] Skipping %s event on %s.%s, action not replicated", e.Action, sourceDB, tableName)
 		return nil
 	}
+	tableMapping = h.typeExclusions.apply(table, tableMapping)
+	if replay && (tableMapping.InsertMode == "" || tableMapping.InsertMode == insertModeInsert) {
+		// An insert the copy already holds would fail on its key; upserting it converges
+		tableMapping.InsertMode = insertModeUpsert
+	}
 
 	columnNames := make([]string, len(table.Columns))
 	for i, col := range table.Columns {
 		columnNames[i] = col.Name
 	}
+	target := &rowTarget{
+		dbName:        dbMapping.TargetDatabase,
+		tableMap:      tableMapping,
+		table:         table,
+		sourceColumns: columnNames,
+		targetColumns: excludeGenerated(resolveTargetColumns(tableMapping, columnNames),
+			h.generatedColumns[dbMapping.TargetDatabase+"."+tableMapping.TargetTable]),
+		filter: h.filters[sourceDB+"."+tableName],
+		replay: replay,
+	}
+	if err := h.checkTargetColumns(target); err != nil {
+		return err
+	}
+	for _, row := range e.Rows {
+		if err := h.converters.convertRow(table, columnNames, row); err != nil {
+			h.logger.Errorf("[MariaDB] Failed to convert %s event for %s: %v", e.Action, target.qualifiedName(), err)
+			return err
+		}
+	}
+
+	// Tables without a primary key cannot be updated or deleted by key; skip before opening a transaction
+	if (e.Action == canal.UpdateAction || e.Action == canal.DeleteAction) && !h.hasPrimaryKey(target, e.Action) {
+		return nil
+	}
+
+	// Extra targets are written first, unbatched, so the event is only marked applied once
+	// every target has it
+	for _, extra := range h.extraTargets(target) {
+		if err := h.checkTargetColumns(extra); err != nil {
+			return err
+		}
+		if err := h.applyEvent(extra, e); err != nil {
+			return err
+		}
+	}
+
+	if h.appliers != nil {
+		return h.applyConcurrently(target, e)
+	}
+	if h.batchSize > 1 {
+		return h.enqueue(target, e)
+	}
+
+	return h.applyEvent(target, e)
+}
+
+// applyEvent writes one event in its own transaction, applying the error policy on failure
+func (h *MariaDBEventHandler) applyEvent(t *rowTarget, e *canal.RowsEvent) error {
+	var rowCount int
+	err := h.withRetry(fmt.Sprintf("%s on %s", e.Action, t.qualifiedName()), func() error {
+		var applyErr error
+		rowCount, applyErr = h.applyRows(t, e)
+		return applyErr
+	})
+	if err != nil {
+		return h.eventFailed(t, e, err)
+	}
+	// Metrics, status and the replay guard follow target_connection
+	if t.dest == nil {
+		h.eventApplied(e, rowCount)
+	}
+	return nil
+}
+
+// eventApplied records a committed event in the replay guard, metrics and status
+func (h *MariaDBEventHandler) eventApplied(e *canal.RowsEvent, rowCount int) {
+	h.markApplied(e.Header)
+
+	// Rows are counted once committed, so rolled back events are never reported as synced
+	sourceTable := e.Table.Schema + "." + e.Table.Name
+	metrics.AddRows(metricsType, sourceTable, e.Action, metrics.PhaseIncremental, rowCount)
+	h.status.eventApplied(e.Action, rowCount)
+	if e.Header == nil {
+		// Only rows of canal's dump come without a binlog event header
+		h.dump.add(rowCount)
+	}
+	h.lag.observe(e.Header)
+	if e.Header != nil && e.Header.Timestamp > 0 {
+		metrics.SetReplicationLag(metricsType, sourceTable, time.Since(time.Unix(int64(e.Header.Timestamp), 0)))
+	}
+}
+
+// rowTarget describes where the rows of one source table are written
+type rowTarget struct {
+	dbName        string
+	tableMap      config.TableMapping
+	table         *schema.Table
+	sourceColumns []string      // source column names in binlog order
+	targetColumns []string      // target name per source column, "" when excluded
+	filter        *rowFilter    // nil when every row is synced
+	audit         []auditRecord // audit records of the current transaction, written after commit
+	changes       []ChangeEvent // change events of the current transaction, published after commit
+	dest          *destination  // extra target connection; nil writes to target_connection
+	replay        bool          // event read again over a copy that may hold it already
+}
+
+// insertValues returns the target columns and values written for an inserted row
+func (t *rowTarget) insertValues(row []interface{}) ([]string, []interface{}) {
+	columnNames, values := writableValues(t.targetColumns, applyTransforms(t.tableMap, t.sourceColumns, row))
+	if tag := t.tableMap.SourceTag; tag != "" {
+		columnNames = append(columnNames, tag)
+		values = append(values, t.sourceTagValue())
+	}
+	return columnNames, values
+}
+
+// recordApplied queues the audit record and change event of a row written within the transaction
+func (h *MariaDBEventHandler) recordApplied(t *rowTarget, action string, oldRow, row []interface{}) {
+	h.debugRows.log(metrics.PhaseIncremental, action, t.sourceTagValue(), t.qualifiedName(), t.tableMap, t.sourceColumns, t.targetColumns, row)
+	if h.audit != nil {
+		t.recordAudit(action, row)
+	}
+	if h.changes != nil {
+		t.recordChange(action, oldRow, row)
+	}
+}
+
+// sourceTagValue identifies the source table of a row in a target merged from several tables
+func (t *rowTarget) sourceTagValue() string {
+	return t.table.Schema + "." + t.table.Name
+}
+
+// withSourceTag restricts a key match to rows written from this source table
+func (t *rowTarget) withSourceTag(clauses []string, values []interface{}) ([]string, []interface{}) {
+	if t.tableMap.SourceTag == "" {
+		return clauses, values
+	}
+	return append(clauses, fmt.Sprintf("%s = ?", quoteIdent(t.tableMap.SourceTag))), append(values, t.sourceTagValue())
+}
+
+// matches reports whether a row belongs on the target according to the source filter
+func (t *rowTarget) matches(row []interface{}) bool {
+	return t.filter == nil || t.filter.matches(t.table, row)
+}
+
+// qualifiedName returns the target table as db.table
+func (t *rowTarget) qualifiedName() string {
+	return t.dbName + "." + t.tableMap.TargetTable
+}
+
+// applyRows writes all rows of the event in a single target transaction and returns
+// how many source rows were applied; rows rejected by the source filter are skipped.
+func (h *MariaDBEventHandler) applyRows(t *rowTarget, e *canal.RowsEvent) (int, error) {
+	tx, err := h.targetDBOf(t).BeginTx(h.context(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin target transaction: %w", err)
+	}
+	// A retried transaction starts over, so drop records of the rolled back attempt
+	t.resetRecords()
 
+	var applied int
+	err = h.applySQL(tx, t, false)
+	if err == nil {
+		applied, err = h.applyEventRows(tx, t, e)
+	}
+	if err == nil {
+		err = h.applySQL(tx, t, true)
+	}
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			h.logger.Errorf("[MariaDB] Failed to roll back target transaction for %s: %v", t.qualifiedName(), rbErr)
+		}
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit target transaction: %w", err)
+	}
+	h.publishRecords(t)
+	return applied, nil
+}
+
+// resetRecords drops the audit records and change events of a previous attempt
+func (t *rowTarget) resetRecords() {
+	t.audit = t.audit[:0]
+	t.changes = t.changes[:0]
+}
+
+// publishRecords writes the audit records and publishes the change events of a committed transaction
+func (h *MariaDBEventHandler) publishRecords(t *rowTarget) {
+	if err := h.audit.write(t.audit...); err != nil {
+		h.logger.Errorf("[MariaDB] Failed to write audit log for %s: %v", t.qualifiedName(), err)
+	}
+	h.changes.publish(t.changes...)
+}
+
+// applyEventRows writes the rows of the event within tx and returns how many were applied
+func (h *MariaDBEventHandler) applyEventRows(tx execer, t *rowTarget, e *canal.RowsEvent) (int, error) {
+	var err error
+	applied := 0
 	switch e.Action {
 	case canal.InsertAction:
 		for _, row := range e.Rows {
-			h.handleInsert(targetDBName, targetTableName, columnNames, row)
+			if !t.matches(row) {
+				continue
+			}
+			if err = h.handleInsert(tx, t, row); err != nil {
+				break
+			}
+			applied++
 		}
 	case canal.UpdateAction:
-		for i := 0; i < len(e.Rows); i += 2 {
-			oldRow := e.Rows[i]
-			newRow := e.Rows[i+1]
-			h.handleUpdate(targetDBName, targetTableName, columnNames, table, oldRow, newRow)
+		for i := 0; i+1 < len(e.Rows); i += 2 {
+			oldRow, newRow := e.Rows[i], e.Rows[i+1]
+			oldMatch, newMatch := t.matches(oldRow), t.matches(newRow)
+			switch {
+			case oldMatch && newMatch:
+				err = h.handleUpdate(tx, t, oldRow, newRow)
+			case oldMatch:
+				// The row no longer matches the filter, so it leaves the target
+				err = h.handleDelete(tx, t, oldRow)
+			case newMatch:
+				// The row starts matching the filter and was never copied
+				err = h.handleInsert(tx, t, newRow)
+			default:
+				continue
+			}
+			if err != nil {
+				break
+			}
+			applied++
 		}
 	case canal.DeleteAction:
 		for _, row := range e.Rows {
-			h.handleDelete(targetDBName, targetTableName, columnNames, table, row)
+			if !t.matches(row) {
+				continue
+			}
+			if err = h.handleDelete(tx, t, row); err != nil {
+				break
+			}
+			applied++
 		}
 	}
-	return nil
+
+	if err != nil {
+		return 0, err
+	}
+	return applied, nil
+}
+
+// findTableMapping looks up the mapping of a source table
+func (h *MariaDBEventHandler) findTableMapping(sourceDB, sourceTable string) (config.DatabaseMapping, config.TableMapping, bool) {
+	for _, mapping := range h.mappings {
+		if mapping.SourceDatabase != sourceDB {
+			continue
+		}
+		for _, tableMap := range mapping.Tables {
+			if tableMap.SourceTable == sourceTable {
+				return mapping, tableMap, true
+			}
+		}
+	}
+	return config.DatabaseMapping{}, config.TableMapping{}, false
+}
+
+// hasPrimaryKey reports whether rows of t can be matched on the target, warning when they
+// cannot: by primary key, or by rowCondition with allow_no_primary_key
+func (h *MariaDBEventHandler) hasPrimaryKey(t *rowTarget, action string) bool {
+	if len(t.table.PKColumns) > 0 || h.allowNoPrimaryKey {
+		return true
+	}
+	h.logger.Warnf("[MariaDB] No primary key defined on table %s, cannot perform %s", t.qualifiedName(), action)
+	return false
 }
 
 // handleInsert for insert events
-func (h *MariaDBEventHandler) handleInsert(targetDBName, targetTableName string, columnNames []string, row []interface{}) {
-	placeholders := make([]string, len(columnNames))
-	for i := range placeholders {
-		placeholders[i] = "?"
+func (h *MariaDBEventHandler) handleInsert(tx execer, t *rowTarget, row []interface{}) error {
+	if resolve := h.conflictResolver(t); resolve != nil {
+		return h.handleConflictingInsert(tx, t, row, resolve)
+	}
+	columnNames, values := t.insertValues(row)
+	query, err := buildInsertSQL(t.tableMap.InsertMode, t.dbName, t.tableMap.TargetTable,
+		columnNames, targetKeyColumns(t.table, t.targetColumns), 1)
+	if err != nil {
+		return err
 	}
-	query := fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES (%s)",
-		targetDBName, targetTableName,
-		strings.Join(columnNames, ", "),
-		strings.Join(placeholders, ", "))
 
-	_, err := h.targetDB.Exec(query, row...)
+	key := stmtKey{table: t.qualifiedName(), action: canal.InsertAction}
+	res, err := h.exec(tx, t, key, query, values...)
 	if err != nil {
-		h.logger.Errorf("[MariaDB] Failed to insert into target database: %v", err)
+		return fmt.Errorf("failed to insert into target database: %w", err)
 	}
+	lo, hi := insertAffected(t.tableMap.InsertMode, 1)
+	if err := h.checkAffected(t, canal.InsertAction, res, row, lo, hi); err != nil {
+		return err
+	}
+	h.recordApplied(t, canal.InsertAction, nil, row)
+	return nil
 }
 
-// handleUpdate for update events
-func (h *MariaDBEventHandler) handleUpdate(
-	targetDBName, targetTableName string,
-	columnNames []string,
-	table *schema.Table,
-	oldRow, newRow []interface{},
-) {
-	setClauses := make([]string, len(columnNames))
-	for i, col := range columnNames {
-		setClauses[i] = fmt.Sprintf("%s = ?", col)
+// handleUpdate for update events; the caller guarantees its rows can be matched
+func (h *MariaDBEventHandler) handleUpdate(tx execer, t *rowTarget, oldRow, newRow []interface{}) error {
+	if !h.hasPrimaryKey(t, canal.UpdateAction) {
+		return nil
+	}
+	// A changed primary key is applied as delete + insert in the same transaction, so the new
+	// key is written as a fresh row and a collision fails loudly instead of updating in place
+	if primaryKeyChanged(t.table, oldRow, newRow) {
+		if err := h.handleDelete(tx, t, oldRow); err != nil {
+			return err
+		}
+		return h.handleInsert(tx, t, newRow)
 	}
-	var whereClauses []string
-	var whereValues []interface{}
 
-	// Use primary key as WHERE condition
-	for _, pkIndex := range table.PKColumns {
-		whereClauses = append(whereClauses, fmt.Sprintf("%s = ?", columnNames[pkIndex]))
-		whereValues = append(whereValues, oldRow[pkIndex])
+	targetColumns := t.targetColumns
+	if h.minimalUpdates {
+		targetColumns = changedColumns(t.table, t.targetColumns, oldRow, newRow)
+	}
+	setColumns, setValues := writableValues(targetColumns, applyTransforms(t.tableMap, t.sourceColumns, newRow))
+	if len(setColumns) == 0 {
+		h.logger.Debugf("[MariaDB] Skipping update of %s that changed no written column", t.qualifiedName())
+		h.recordApplied(t, canal.UpdateAction, oldRow, newRow)
+		return nil
 	}
-	if len(whereClauses) == 0 {
-		h.logger.Warnf("[MariaDB] No primary key defined on table %s.%s, cannot perform update",
-			targetDBName, targetTableName)
-		return
+	setClauses := make([]string, len(setColumns))
+	for i, col := range setColumns {
+		setClauses[i] = fmt.Sprintf("%s = ?", quoteIdent(col))
+	}
+	whereClauses, whereValues, byPrimaryKey, err := h.rowCondition(t, oldRow)
+	if err != nil {
+		return err
 	}
 
-	query := fmt.Sprintf("UPDATE %s.%s SET %s WHERE %s",
-		targetDBName, targetTableName,
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		quoteTable(t.dbName, t.tableMap.TargetTable),
 		strings.Join(setClauses, ", "),
 		strings.Join(whereClauses, " AND "))
 
-	args := append(newRow, whereValues...)
-	_, err := h.targetDB.Exec(query, args...)
+	args := make([]interface{}, 0, len(setValues)+len(whereValues))
+	args = append(args, setValues...)
+	args = append(args, whereValues...)
+	key := stmtKey{table: t.qualifiedName(), action: canal.UpdateAction}
+	res, err := h.exec(tx, t, key, query, args...)
 	if err != nil {
-		h.logger.Errorf("[MariaDB] Failed to update target database: %v", err)
+		return fmt.Errorf("failed to update target database: %w", err)
+	}
+	if !byPrimaryKey {
+		h.logMatchedRows(t, canal.UpdateAction, res)
+	}
+	// Without a primary key every duplicate of the row is updated
+	hi := int64(1)
+	if !byPrimaryKey {
+		hi = -1
 	}
+	if err := h.checkAffected(t, canal.UpdateAction, res, oldRow, 1, hi); err != nil {
+		return err
+	}
+	h.recordApplied(t, canal.UpdateAction, oldRow, newRow)
+	return nil
 }
 
-// handleDelete for delete events
-func (h *MariaDBEventHandler) handleDelete(
-	targetDBName, targetTableName string,
-	columnNames []string,
-	table *schema.Table,
-	row []interface{},
-) {
-	var whereClauses []string
-	var whereValues []interface{}
-
-	for _, pkIndex := range table.PKColumns {
-		whereClauses = append(whereClauses, fmt.Sprintf("%s = ?", columnNames[pkIndex]))
-		whereValues = append(whereValues, row[pkIndex])
+// handleDelete for delete events; the caller guarantees its rows can be matched
+func (h *MariaDBEventHandler) handleDelete(tx execer, t *rowTarget, row []interface{}) error {
+	if !h.hasPrimaryKey(t, canal.DeleteAction) {
+		return nil
 	}
-	if len(whereClauses) == 0 {
-		h.logger.Warnf("[MariaDB] No primary key defined on table %s.%s, cannot perform delete",
-			targetDBName, targetTableName)
-		return
+	whereClauses, whereValues, byPrimaryKey, err := h.rowCondition(t, row)
+	if err != nil {
+		return err
 	}
+	keyValues := whereValues
 
-	query := fmt.Sprintf("DELETE FROM %s.%s WHERE %s",
-		targetDBName,
-		targetTableName,
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s",
+		quoteTable(t.dbName, t.tableMap.TargetTable),
 		strings.Join(whereClauses, " AND "))
-	_, err := h.targetDB.Exec(query, whereValues...)
+	if sd := t.tableMap.SoftDelete; sd != nil {
+		// Keep the row for history and only mark it as deleted
+		marker := "?"
+		if strings.EqualFold(strings.TrimSpace(sd.Value), "NOW()") {
+			marker = "NOW()"
+		} else {
+			whereValues = append([]interface{}{sd.Value}, whereValues...)
+		}
+		query = fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s",
+			quoteTable(t.dbName, t.tableMap.TargetTable), quoteIdent(sd.Column), marker,
+			strings.Join(whereClauses, " AND "))
+	}
+	if !byPrimaryKey {
+		// Without a unique key, every duplicate of the row matches; each source delete
+		// removes one of them
+		query += " LIMIT 1"
+	}
+	key := stmtKey{table: t.qualifiedName(), action: canal.DeleteAction}
+	res, err := h.exec(tx, t, key, query, whereValues...)
+	if err != nil {
+		return fmt.Errorf("failed to delete from target database: %w", err)
+	}
+	// Replayed and out-of-order events may delete a row that is already gone, which is
+	// harmless; a soft delete also affects nothing when the marker already has its value
+	if !byPrimaryKey {
+		if affected, err := res.RowsAffected(); err == nil && affected > 1 {
+			return fmt.Errorf("delete from %s without a primary key affected %d rows despite LIMIT 1", t.qualifiedName(), affected)
+		}
+		h.logMatchedRows(t, canal.DeleteAction, res)
+	} else if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		h.logger.Debugf("[MariaDB] Delete from %s affected no rows; key %v is already absent or marked deleted",
+			t.qualifiedName(), keyValues)
+		if !h.strictApply {
+			metrics.AddDeleteNoop(metricsType, t.table.Schema+"."+t.table.Name)
+		}
+	}
+	if err := h.checkAffected(t, canal.DeleteAction, res, row, 1, 1); err != nil {
+		return err
+	}
+	h.recordApplied(t, canal.DeleteAction, nil, row)
+	return nil
+}
+
+// execer runs target statements. Writes go through a *sql.Tx; tests substitute a fake.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// exec runs query in tx through the statement cache of t's connection, or unprepared without
+// one or outside a *sql.Tx
+func (h *MariaDBEventHandler) exec(tx execer, t *rowTarget, key stmtKey, query string, args ...interface{}) (sql.Result, error) {
+	defer h.slowWrites.observe(time.Now(), key.action, key.table, 1)
+	ctx, cancel := h.writeContext()
+	defer cancel()
+	var res sql.Result
+	var err error
+	sqlTx, isTx := tx.(*sql.Tx)
+	if stmts := h.stmtsOf(t); stmts == nil || !isTx {
+		res, err = tx.ExecContext(ctx, query, args...)
+	} else {
+		stmt, release, getErr := stmts.get(ctx, key, query)
+		if getErr != nil {
+			return nil, h.writeError(ctx, getErr)
+		}
+		defer release()
+		if stmt == nil {
+			res, err = tx.ExecContext(ctx, query, args...)
+		} else {
+			// The transaction-bound copy is closed with the transaction; the cached statement stays open
+			res, err = sqlTx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+		}
+	}
 	if err != nil {
-		h.logger.Errorf("[MariaDB] Failed to delete from target database: %v", err)
+		return nil, &statementError{query: query, err: h.writeError(ctx, err)}
+	}
+	return res, nil
+}
+
+// context returns the context target transactions run in
+func (h *MariaDBEventHandler) context() context.Context {
+	if h.ctx == nil {
+		return context.Background()
 	}
+	return h.ctx
+}
+
+// writeContext returns the context of one target statement, bounded by writeTimeout
+func (h *MariaDBEventHandler) writeContext() (context.Context, context.CancelFunc) {
+	if h.writeTimeout <= 0 {
+		return context.WithCancel(h.context())
+	}
+	return context.WithTimeout(h.context(), h.writeTimeout)
+}
+
+// writeError names the write timeout when ctx ran out; the driver reports a bare deadline error
+func (h *MariaDBEventHandler) writeError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && h.context().Err() == nil {
+		return fmt.Errorf("target write timed out after %v: %w", h.writeTimeout, err)
+	}
+	return err
+}
+
+// waitWhilePaused blocks while the syncer is paused; it gives up when canal is closed
+func (h *MariaDBEventHandler) waitWhilePaused() error {
+	ctx := context.Background()
+	if h.canal != nil {
+		ctx = h.canal.Ctx()
+	}
+	return h.pause.wait(ctx)
 }
 
 // String identifies the event handler
@@ -508,7 +2124,34 @@ func (h *MariaDBEventHandler) String() string {
 	return "MariaDBEventHandler"
 }
 
-// OnPosSynced does not write positions here; modify if needed
+// OnPosSynced saves the position canal reports as synced. Saves are throttled to one per
+// saveThrottle unless canal forces the sync or saveEvery events are pending; the ticker in
+// Start saves whatever a throttled call skipped.
 func (h *MariaDBEventHandler) OnPosSynced(header *replication.EventHeader, pos mysql.Position, gs mysql.GTIDSet, force bool) error {
+	if err := h.waitWhilePaused(); err != nil {
+		return err
+	}
+	// Batched rows are written first so a saved position never runs ahead of the target
+	if err := h.flush(); err != nil {
+		return err
+	}
+	// Transactions on tables that are not synced keep the lag current too
+	h.applied.set(pos, gs)
+	h.lag.observe(header)
+	h.cutover.positionSynced(pos, h.pause)
+	if h.savePosition == nil {
+		return nil
+	}
+	h.unsaved++
+	due := force || time.Since(h.lastSave) >= h.saveThrottle || (h.saveEvery > 0 && h.unsaved >= h.saveEvery)
+	if !due {
+		return nil
+	}
+	h.unsaved = 0
+	h.lastSave = time.Now()
+	// A failed save is retried by a later sync or tick rather than stopping replication
+	if err := h.savePosition(pos, gs); err != nil {
+		h.logger.Errorf("Failed to save MariaDB binlog position %s: %v", pos, err)
+	}
 	return nil
 }
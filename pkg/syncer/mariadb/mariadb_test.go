@@ -0,0 +1,5551 @@
+package mariadb
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/sync/pkg/config"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		name     string
+		dsn      string
+		addr     string
+		user     string
+		password string
+		charset  string
+		tls      bool
+	}{
+		{
+			name:     "plain tcp",
+			dsn:      "root:secret@tcp(127.0.0.1:3306)/db",
+			addr:     "127.0.0.1:3306",
+			user:     "root",
+			password: "secret",
+		},
+		{
+			name:     "password with special characters",
+			dsn:      "root:p@ss:w/rd@tcp(db.example.com:3307)/db",
+			addr:     "db.example.com:3307",
+			user:     "root",
+			password: "p@ss:w/rd",
+		},
+		{
+			name:     "query parameters",
+			dsn:      "sync:pw@tcp(10.0.0.5:3306)/db?parseTime=true&tls=skip-verify&charset=utf8mb4,utf8",
+			addr:     "10.0.0.5:3306",
+			user:     "sync",
+			password: "pw",
+			charset:  "utf8mb4",
+			tls:      true,
+		},
+		{
+			name:     "collation",
+			dsn:      "sync:pw@tcp(10.0.0.5:3306)/db?collation=latin1_swedish_ci",
+			addr:     "10.0.0.5:3306",
+			user:     "sync",
+			password: "pw",
+			charset:  "latin1",
+		},
+		{
+			name:     "unix socket",
+			dsn:      "sync:pw@unix(/var/run/mysqld/mysqld.sock)/db",
+			addr:     "/var/run/mysqld/mysqld.sock",
+			user:     "sync",
+			password: "pw",
+		},
+		{
+			name:     "ipv6",
+			dsn:      "sync:pw@tcp([::1]:3306)/db",
+			addr:     "[::1]:3306",
+			user:     "sync",
+			password: "pw",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsnCfg, err := parseDSN(tt.dsn)
+			if err != nil {
+				t.Fatalf("parseDSN(%q) returned error: %v", tt.dsn, err)
+			}
+			cfg := canal.NewDefaultConfig()
+			defaultCharset := cfg.Charset
+			if err := applyDSNConfig(cfg, dsnCfg); err != nil {
+				t.Fatalf("applyDSNConfig(%q) returned error: %v", tt.dsn, err)
+			}
+
+			if cfg.Addr != tt.addr {
+				t.Errorf("Addr = %q, want %q", cfg.Addr, tt.addr)
+			}
+			if cfg.User != tt.user {
+				t.Errorf("User = %q, want %q", cfg.User, tt.user)
+			}
+			if cfg.Password != tt.password {
+				t.Errorf("Password = %q, want %q", cfg.Password, tt.password)
+			}
+			wantCharset := tt.charset
+			if wantCharset == "" {
+				wantCharset = defaultCharset
+			}
+			if cfg.Charset != wantCharset {
+				t.Errorf("Charset = %q, want %q", cfg.Charset, wantCharset)
+			}
+			if (cfg.TLSConfig != nil) != tt.tls {
+				t.Errorf("TLSConfig set = %v, want %v", cfg.TLSConfig != nil, tt.tls)
+			}
+		})
+	}
+}
+
+func TestParseDSNInvalid(t *testing.T) {
+	if _, err := parseDSN("root:secret@tcp(127.0.0.1:3306"); err == nil {
+		t.Fatal("expected error for malformed DSN")
+	}
+}
+
+func TestApplyDSNConfigUnsupportedTransport(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"sync:pw@unix(mysqld.sock)/db": "must be given as a path",
+		"sync:pw@tcp([fd00::5])/db":    "invalid MariaDB source address",
+		"sync:pw@pipe(mysql)/db":       "binlog replication needs a tcp(host:port) or unix(/path) address",
+	} {
+		dsnCfg, err := parseDSN(dsn)
+		if err != nil {
+			t.Fatalf("parseDSN(%q) returned error: %v", dsn, err)
+		}
+		err = applyDSNConfig(canal.NewDefaultConfig(), dsnCfg)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("applyDSNConfig(%q) error = %v, want it to mention %q", dsn, err, want)
+		}
+	}
+}
+
+func TestSaveBinlogPositionSurvivesPartialWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state", "mariadb_position")
+	s := NewMariaDBSyncer(config.SyncConfig{}, logrus.New())
+
+	good := binlogPosition{Position: mysql.Position{Name: "mysql-bin.000003", Pos: 1234}}
+	if err := saveBinlogPosition(path, good); err != nil {
+		t.Fatalf("saveBinlogPosition returned error: %v", err)
+	}
+
+	// A crash mid-write leaves a truncated temp file behind; the real file must be untouched
+	partial := filepath.Join(filepath.Dir(path), filepath.Base(path)+".tmp-crash")
+	if err := os.WriteFile(partial, []byte(`{"Name":"mysql-bin.0000`), 0644); err != nil {
+		t.Fatalf("failed to write partial temp file: %v", err)
+	}
+
+	got := loadBinlogPosition(path, s.logger)
+	if got == nil {
+		t.Fatal("loadBinlogPosition returned nil, want last good position")
+	}
+	if *got != good {
+		t.Errorf("loadBinlogPosition = %v, want %v", *got, good)
+	}
+
+	next := binlogPosition{
+		Position: mysql.Position{Name: "mysql-bin.000004", Pos: 4},
+		GTIDSet:  "0-1-42",
+	}
+	if err := saveBinlogPosition(path, next); err != nil {
+		t.Fatalf("saveBinlogPosition returned error: %v", err)
+	}
+	if got := loadBinlogPosition(path, s.logger); got == nil || *got != next {
+		t.Errorf("loadBinlogPosition = %v, want %v", got, next)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), filepath.Base(path)+".tmp-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("expected only the simulated crash leftover, found temp files %v", matches)
+	}
+}
+
+func TestLoadBinlogPositionLegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mariadb_position")
+	if err := os.WriteFile(path, []byte(`{"Name":"mysql-bin.000007","Pos":99}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewMariaDBSyncer(config.SyncConfig{}, logrus.New())
+
+	got := loadBinlogPosition(path, s.logger)
+	if got == nil {
+		t.Fatal("loadBinlogPosition returned nil for legacy position file")
+	}
+	want := mysql.Position{Name: "mysql-bin.000007", Pos: 99}
+	if got.Position != want || got.GTIDSet != "" {
+		t.Errorf("loadBinlogPosition = %+v, want %v without GTID set", *got, want)
+	}
+}
+
+func TestResolveTargetColumns(t *testing.T) {
+	tableMap := config.TableMapping{
+		SourceTable: "users",
+		TargetTable: "customers",
+		ColumnMap: map[string]string{
+			"name":     "full_name",
+			"password": "",
+		},
+	}
+	sourceCols := []string{"id", "name", "password", "email"}
+
+	targetCols := resolveTargetColumns(tableMap, sourceCols)
+	want := []string{"id", "full_name", "", "email"}
+	if !reflect.DeepEqual(targetCols, want) {
+		t.Fatalf("resolveTargetColumns = %v, want %v", targetCols, want)
+	}
+
+	cols, values := writableValues(targetCols, []interface{}{1, "Alice", "secret", "a@example.com"})
+	if !reflect.DeepEqual(cols, []string{"id", "full_name", "email"}) {
+		t.Errorf("writableValues columns = %v", cols)
+	}
+	if !reflect.DeepEqual(values, []interface{}{1, "Alice", "a@example.com"}) {
+		t.Errorf("writableValues values = %v", values)
+	}
+
+	src, tgt := writableColumns(sourceCols, targetCols)
+	if !reflect.DeepEqual(src, []string{"id", "name", "email"}) || !reflect.DeepEqual(tgt, []string{"id", "full_name", "email"}) {
+		t.Errorf("writableColumns = %v, %v", src, tgt)
+	}
+}
+
+func TestBuildInsertSQL(t *testing.T) {
+	cols := []string{"id", "name", "content"}
+	keyCols := []string{"id"}
+
+	tests := []struct {
+		mode string
+		rows int
+		want string
+	}{
+		{"", 1, "INSERT INTO `db`.`t` (`id`, `name`, `content`) VALUES (?,?,?)"},
+		{"insert", 2, "INSERT INTO `db`.`t` (`id`, `name`, `content`) VALUES (?,?,?), (?,?,?)"},
+		{"ignore", 1, "INSERT IGNORE INTO `db`.`t` (`id`, `name`, `content`) VALUES (?,?,?)"},
+		{"upsert", 1, "INSERT INTO `db`.`t` (`id`, `name`, `content`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `content` = VALUES(`content`)"},
+		{"replace", 2, "REPLACE INTO `db`.`t` (`id`, `name`, `content`) VALUES (?,?,?), (?,?,?)"},
+	}
+	for _, tt := range tests {
+		got, err := buildInsertSQL(tt.mode, "db", "t", cols, keyCols, tt.rows)
+		if err != nil {
+			t.Fatalf("buildInsertSQL(%q) returned error: %v", tt.mode, err)
+		}
+		if got != tt.want {
+			t.Errorf("buildInsertSQL(%q) =\n%s\nwant\n%s", tt.mode, got, tt.want)
+		}
+	}
+
+	if _, err := buildInsertSQL("merge", "db", "t", cols, keyCols, 1); err == nil {
+		t.Error("expected error for unknown insert mode")
+	}
+}
+
+func TestBuildAddColumnsDDL(t *testing.T) {
+	tableMap := config.TableMapping{
+		SourceTable: "users",
+		TargetTable: "customers",
+		ColumnMap:   map[string]string{"nick": "nickname", "secret": ""},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		want       string
+		compatible bool
+	}{
+		{
+			name:       "add columns with rename and exclusion",
+			query:      "ALTER TABLE users ADD COLUMN nick VARCHAR(64) NULL, ADD COLUMN secret TEXT, ADD COLUMN age INT NOT NULL",
+			want:       "ALTER TABLE `tgt`.`customers` ADD COLUMN `nickname` VARCHAR(64) NULL, ADD COLUMN `age` INT NOT NULL",
+			compatible: true,
+		},
+		{
+			name:       "only excluded columns",
+			query:      "ALTER TABLE users ADD COLUMN secret TEXT",
+			want:       "",
+			compatible: true,
+		},
+		{
+			name:  "drop column",
+			query: "ALTER TABLE users DROP COLUMN nick",
+		},
+		{
+			name:  "default value",
+			query: "ALTER TABLE users ADD COLUMN flag INT DEFAULT 1",
+		},
+	}
+
+	p := parser.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := p.ParseOneStmt(tt.query, "", "")
+			if err != nil {
+				t.Fatalf("failed to parse %q: %v", tt.query, err)
+			}
+			got, compatible, err := buildAddColumnsDDL(stmt.(*ast.AlterTableStmt), "tgt", tableMap)
+			if err != nil {
+				t.Fatalf("buildAddColumnsDDL returned error: %v", err)
+			}
+			if compatible != tt.compatible {
+				t.Fatalf("compatible = %v, want %v", compatible, tt.compatible)
+			}
+			if got != tt.want {
+				t.Errorf("buildAddColumnsDDL =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	h := &MariaDBEventHandler{logger: logrus.New(), retryMaxAttempts: 3, retryBaseDelay: time.Millisecond}
+
+	deadlock := &mysqldriver.MySQLError{Number: 1213, Message: "Deadlock found"}
+	calls := 0
+	err := h.withRetry("test", func() error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("wrapped: %w", deadlock)
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("withRetry on deadlock: err=%v calls=%d, want nil after 3 calls", err, calls)
+	}
+
+	calls = 0
+	err = h.withRetry("test", func() error {
+		calls++
+		return deadlock
+	})
+	if !errors.Is(err, deadlock) || calls != 3 {
+		t.Errorf("withRetry exhausted: err=%v calls=%d, want deadlock after 3 calls", err, calls)
+	}
+
+	duplicate := &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry"}
+	calls = 0
+	err = h.withRetry("test", func() error {
+		calls++
+		return duplicate
+	})
+	if !errors.Is(err, duplicate) || calls != 1 {
+		t.Errorf("withRetry on non-retriable error: err=%v calls=%d, want 1 call", err, calls)
+	}
+
+	if !isRetriableError(mysqldriver.ErrInvalidConn) {
+		t.Error("ErrInvalidConn should be retriable")
+	}
+}
+
+func TestCheckpointStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mariadb_position.initial_sync")
+
+	store, err := loadCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("loadCheckpointStore on missing file returned error: %v", err)
+	}
+	if _, ok := store.get("db.orders"); ok {
+		t.Fatal("expected no checkpoint in a new store")
+	}
+
+	if err := store.set("db.orders", tableCheckpoint{LastKey: []string{keyString(int64(9007199254740993))}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.set("db.users", tableCheckpoint{Done: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := loadCheckpointStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, ok := reloaded.get("db.orders")
+	if !ok || orders.Done || !reflect.DeepEqual(orders.LastKey, []string{"9007199254740993"}) {
+		t.Errorf("db.orders checkpoint = %+v, %v", orders, ok)
+	}
+	if users, ok := reloaded.get("db.users"); !ok || !users.Done {
+		t.Errorf("db.users checkpoint = %+v, %v", users, ok)
+	}
+
+	if _, err := loadCheckpointStore(""); err == nil {
+		t.Error("expected error without a checkpoint path")
+	}
+}
+
+// fakeRows produces a large result set lazily, like the MySQL driver reading packets from the socket
+type fakeRows struct {
+	remaining int
+	payload   []byte
+}
+
+func (r *fakeRows) Next() bool {
+	if r.remaining == 0 {
+		return false
+	}
+	r.remaining--
+	return true
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	for _, d := range dest {
+		// Copy like the driver does, so every row owns its own memory
+		*(d.(*interface{})) = append([]byte(nil), r.payload...)
+	}
+	return nil
+}
+
+func (r *fakeRows) Err() error { return nil }
+
+func TestStreamBatchesBoundedMemory(t *testing.T) {
+	const (
+		totalRows = 200000
+		numCols   = 4
+		batchSize = 100
+	)
+	// Buffering the whole result would hold totalRows*numCols*256 bytes (~200MB)
+	rows := &fakeRows{remaining: totalRows, payload: make([]byte, 256)}
+	s := &MariaDBSyncer{logger: logrus.New()}
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	var peak uint64
+	seen, batches := 0, 0
+	err := s.streamBatches(rows, numCols, batchSize, "db.big", func(batch [][]interface{}) error {
+		if len(batch) > batchSize {
+			t.Fatalf("batch of %d rows exceeds batch size %d", len(batch), batchSize)
+		}
+		seen += len(batch)
+		batches++
+		if batches%200 == 0 {
+			var m runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&m)
+			if m.HeapAlloc > peak {
+				peak = m.HeapAlloc
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != totalRows {
+		t.Fatalf("streamed %d rows, want %d", seen, totalRows)
+	}
+
+	const limit = 16 << 20
+	if peak > before.HeapAlloc && peak-before.HeapAlloc > limit {
+		t.Errorf("heap grew by %d bytes while streaming, want at most %d", peak-before.HeapAlloc, limit)
+	}
+}
+
+func TestParseSourceFilter(t *testing.T) {
+	tests := []struct {
+		expr    string
+		column  string
+		values  []string
+		wantErr bool
+	}{
+		{expr: "tenant_id = 42", column: "tenant_id", values: []string{"42"}},
+		{expr: "`region` = 'it''s'", column: "region", values: []string{"it's"}},
+		{expr: "status IN ('active', \"trial\", 3)", column: "status", values: []string{"active", "trial", "3"}},
+		{expr: "status in (1)", column: "status", values: []string{"1"}},
+		{expr: "tenant_id > 42", wantErr: true},
+		{expr: "a = 1 AND b = 2", wantErr: true},
+		{expr: "status IN (1,)", wantErr: true},
+		{expr: "name = 'unterminated", wantErr: true},
+	}
+	for _, tt := range tests {
+		f, err := parseSourceFilter(tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSourceFilter(%q) expected error, got %+v", tt.expr, f)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSourceFilter(%q) returned error: %v", tt.expr, err)
+			continue
+		}
+		if f.column != tt.column || !reflect.DeepEqual(f.values, tt.values) {
+			t.Errorf("parseSourceFilter(%q) = %s %v, want %s %v", tt.expr, f.column, f.values, tt.column, tt.values)
+		}
+	}
+}
+
+func TestRowFilterMatches(t *testing.T) {
+	table := &schema.Table{Columns: []schema.TableColumn{{Name: "id"}, {Name: "Tenant_ID"}}}
+	f, err := parseSourceFilter("tenant_id IN (7, 'x')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		row  []interface{}
+		want bool
+	}{
+		{row: []interface{}{int32(1), int32(7)}, want: true},
+		{row: []interface{}{int32(1), []byte("x")}, want: true},
+		{row: []interface{}{int32(1), int64(8)}, want: false},
+		{row: []interface{}{int32(1), nil}, want: false},
+	}
+	for _, tt := range tests {
+		if got := f.matches(table, tt.row); got != tt.want {
+			t.Errorf("matches(%v) = %v, want %v", tt.row, got, tt.want)
+		}
+	}
+}
+
+// recorder is a database/sql driver that records executed statements instead of running them
+type recorder struct {
+	mu       sync.Mutex // guards stmts and prepares for concurrent writers
+	stmts    []string
+	prepares int
+	query    func(query string, args []driver.Value) (driver.Rows, error) // answers Query calls when set
+	exec     func(query string, args []driver.Value) error                // when set, an error it returns fails the Exec call
+	noRows   bool                                                         // Exec reports no affected rows
+	hang     bool                                                         // Exec blocks until its context ends
+	prepare  func(query string)                                           // called on each Prepare when set
+}
+
+func (r *recorder) Connect(context.Context) (driver.Conn, error) { return &recorderConn{r}, nil }
+func (r *recorder) Driver() driver.Driver                        { return nil }
+
+type recorderConn struct{ r *recorder }
+
+func (c *recorderConn) Prepare(query string) (driver.Stmt, error) {
+	c.r.mu.Lock()
+	c.r.prepares++
+	c.r.mu.Unlock()
+	if c.r.prepare != nil {
+		c.r.prepare(query)
+	}
+	return &recorderStmt{r: c.r, query: query}, nil
+}
+func (c *recorderConn) Close() error              { return nil }
+func (c *recorderConn) Begin() (driver.Tx, error) { return &recorderTx{c.r}, nil }
+
+// CheckNamedValue accepts uint64 values above the int64 range, as the mysql driver does
+func (c *recorderConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if _, ok := nv.Value.(uint64); ok {
+		return nil
+	}
+	var err error
+	nv.Value, err = driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	return err
+}
+
+type recorderTx struct{ r *recorder }
+
+func (tx *recorderTx) Commit() error   { tx.r.record("COMMIT"); return nil }
+func (tx *recorderTx) Rollback() error { tx.r.record("ROLLBACK"); return nil }
+
+func (r *recorder) record(stmt string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stmts = append(r.stmts, stmt)
+}
+
+type recorderStmt struct {
+	r     *recorder
+	query string
+}
+
+func (s *recorderStmt) Close() error  { return nil }
+func (s *recorderStmt) NumInput() int { return -1 }
+func (s *recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.r.exec != nil {
+		if err := s.r.exec(s.query, args); err != nil {
+			return nil, err
+		}
+	}
+	s.r.record(fmt.Sprintf("%s %v", s.query, args))
+	if s.r.noRows {
+		return driver.RowsAffected(0), nil
+	}
+	return driver.RowsAffected(1), nil
+}
+func (s *recorderStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if s.r.hang {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return s.Exec(values)
+}
+func (s *recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.r.query == nil {
+		return nil, errors.New("recorder does not support queries")
+	}
+	return s.r.query(s.query, args)
+}
+
+// staticRows is a driver.Rows over fixed values
+type staticRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *staticRows) Columns() []string { return r.columns }
+func (r *staticRows) Close() error      { return nil }
+func (r *staticRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestHandleUpdatePrimaryKeyChange(t *testing.T) {
+	rec := &recorder{}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+
+	h := &MariaDBEventHandler{targetDB: db, logger: logrus.New()}
+	table := &schema.Table{
+		Schema:    "src",
+		Name:      "users",
+		Columns:   []schema.TableColumn{{Name: "id"}, {Name: "name"}},
+		PKColumns: []int{0},
+	}
+	target := &rowTarget{
+		dbName:        "dst",
+		tableMap:      config.TableMapping{SourceTable: "users", TargetTable: "users"},
+		table:         table,
+		sourceColumns: []string{"id", "name"},
+		targetColumns: []string{"id", "name"},
+	}
+
+	e := &canal.RowsEvent{Table: table, Action: canal.UpdateAction, Rows: [][]interface{}{
+		{int64(1), "alice"}, {int64(2), "alice"}, // key changes
+		{int64(3), "bob"}, {int64(3), "bobby"}, // key unchanged
+	}}
+	applied, err := h.applyRows(target, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 2 {
+		t.Errorf("applied = %d, want 2", applied)
+	}
+
+	want := []string{
+		"DELETE FROM `dst`.`users` WHERE `id` = ? [1]",
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [2 alice]",
+		"UPDATE `dst`.`users` SET `id` = ?, `name` = ? WHERE `id` = ? [3 bobby 3]",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements =\n%q\nwant\n%q", rec.stmts, want)
+	}
+}
+
+func TestConfigureTargetPool(t *testing.T) {
+	db := sql.OpenDB(&recorder{})
+	defer db.Close()
+
+	s := &MariaDBSyncer{cfg: config.SyncConfig{TargetMaxOpenConns: 4}}
+	if err := s.configureTargetPool(db); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.Stats().MaxOpenConnections; got != 4 {
+		t.Errorf("MaxOpenConnections = %d, want 4", got)
+	}
+
+	s.cfg = config.SyncConfig{}
+	if err := s.configureTargetPool(db); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.Stats().MaxOpenConnections; got != defaultTargetMaxOpenConns {
+		t.Errorf("default MaxOpenConnections = %d, want %d", got, defaultTargetMaxOpenConns)
+	}
+
+	s.cfg = config.SyncConfig{TargetMaxIdleConns: -1}
+	if err := s.configureTargetPool(db); err == nil {
+		t.Error("expected error for negative target_max_idle_conns")
+	}
+}
+
+func TestCheckMappings(t *testing.T) {
+	// src has orders (with a primary key) and logs (without one); other does not exist
+	rec := &recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		count := int64(0)
+		switch {
+		case strings.Contains(query, "SCHEMATA"):
+			if args[0] == "src" {
+				count = 1
+			}
+		case strings.Contains(query, "KEY_COLUMN_USAGE"):
+			pk := &staticRows{columns: []string{"COLUMN_NAME"}}
+			if args[1] == "orders" {
+				pk.values = [][]driver.Value{{"id"}}
+			}
+			return pk, nil
+		case strings.Contains(query, "TABLES"):
+			if args[1] == "orders" || args[1] == "logs" {
+				count = 1
+			}
+		}
+		return &staticRows{columns: []string{"COUNT(*)"}, values: [][]driver.Value{{count}}}, nil
+	}}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+
+	mappings := []config.DatabaseMapping{
+		{SourceDatabase: "src", Tables: []config.TableMapping{
+			{SourceTable: "orders"}, {SourceTable: "logs"}, {SourceTable: "missing"},
+		}},
+		{SourceDatabase: "other", Tables: []config.TableMapping{{SourceTable: "orders"}}},
+		{SourceDatabase: "src", TargetDatabase: "masked", Tables: []config.TableMapping{
+			{SourceTable: "orders", Transforms: map[string]string{"id": "hash"}},
+		}},
+	}
+	err := checkMappings(context.Background(), db, mappings, false, false)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{
+		"src.logs has no primary key",
+		"src.missing does not exist",
+		"source database other does not exist",
+		"primary key column id of src.orders cannot be transformed",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "src.orders does not exist") || strings.Contains(err.Error(), "src.orders has no primary key") {
+		t.Errorf("error %q reports the valid table src.orders", err)
+	}
+
+	if err := checkMappings(context.Background(), db, nil, false, false); err != nil {
+		t.Errorf("empty mappings returned error: %v", err)
+	}
+}
+
+// newUsersTarget returns a handler writing to the recorder and the target of src.users -> dst.users
+func newUsersTarget(rec *recorder, cached bool) (*MariaDBEventHandler, *rowTarget, func()) {
+	db := sql.OpenDB(rec)
+	h := &MariaDBEventHandler{targetDB: db, logger: logrus.New()}
+	if cached {
+		h.stmts = newStmtCache(db)
+	}
+	table := &schema.Table{
+		Schema:    "src",
+		Name:      "users",
+		Columns:   []schema.TableColumn{{Name: "id"}, {Name: "name"}},
+		PKColumns: []int{0},
+	}
+	target := &rowTarget{
+		dbName:        "dst",
+		tableMap:      config.TableMapping{SourceTable: "users", TargetTable: "users"},
+		table:         table,
+		sourceColumns: []string{"id", "name"},
+		targetColumns: []string{"id", "name"},
+	}
+	return h, target, func() { db.Close() }
+}
+
+func TestStmtCacheReuse(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, true)
+	defer done()
+
+	insert := &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{
+		{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"},
+	}}
+	if _, err := h.applyRows(target, insert); err != nil {
+		t.Fatal(err)
+	}
+	// database/sql prepares a statement once per pooled connection it runs on
+	warm := rec.prepares
+	for i := 0; i < 3; i++ {
+		if _, err := h.applyRows(target, insert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rec.prepares != warm {
+		t.Errorf("prepares grew from %d to %d on cached inserts", warm, rec.prepares)
+	}
+	if len(rec.stmts) != 16 {
+		t.Errorf("executed %d statements, want 12 inserts and 4 commits", len(rec.stmts))
+	}
+
+	h.stmts.invalidate("dst.users")
+	if _, err := h.applyRows(target, insert); err != nil {
+		t.Fatal(err)
+	}
+	if rec.prepares == warm {
+		t.Error("invalidate did not force a new prepare")
+	}
+
+	// A statement dropped while it is executed stays open until it is released
+	ctx := context.Background()
+	key := stmtKey{table: "dst.users", action: canal.DeleteAction}
+	stmt, release, err := h.stmts.get(ctx, key, "DELETE FROM `dst`.`users` WHERE `id` = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.stmts.invalidate("dst.users")
+	if _, err := stmt.ExecContext(ctx, 1); err != nil {
+		t.Errorf("statement in use was closed by invalidate: %v", err)
+	}
+	release()
+	if _, err := stmt.ExecContext(ctx, 1); err == nil {
+		t.Error("dropped statement still open after its release")
+	}
+
+	// Queries of the same table and action are cached side by side
+	other, releaseOther, err := h.stmts.get(ctx, key, "DELETE FROM `dst`.`users` WHERE `name` = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID, releaseByID, err := h.stmts.get(ctx, key, "DELETE FROM `dst`.`users` WHERE `id` = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseOther()
+	releaseByID()
+	if _, err := other.ExecContext(ctx, "a"); err != nil {
+		t.Errorf("statement of another query was closed: %v", err)
+	}
+	if again, releaseAgain, _ := h.stmts.get(ctx, key, "DELETE FROM `dst`.`users` WHERE `id` = ?"); again != byID {
+		t.Error("cached statement was prepared again")
+	} else {
+		releaseAgain()
+	}
+
+	// A slow prepare does not hold up cached statements; of two callers preparing the same
+	// query one statement is kept, and one prepared across an invalidate is not cached
+	slow := "DELETE FROM `dst`.`users` WHERE `id` = ? AND `name` = ?"
+	started, unblock := make(chan struct{}, 2), make(chan struct{})
+	rec.prepare = func(query string) {
+		if query == slow {
+			started <- struct{}{}
+			<-unblock
+		}
+	}
+	type result struct {
+		stmt    *sql.Stmt
+		release func()
+		err     error
+	}
+	results := make(chan result, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			stmt, release, err := h.stmts.get(ctx, key, slow)
+			results <- result{stmt, release, err}
+		}()
+	}
+	<-started
+	<-started
+	if again, releaseAgain, err := h.stmts.get(ctx, key, "DELETE FROM `dst`.`users` WHERE `id` = ?"); again != byID || err != nil {
+		t.Errorf("cached statement during a slow prepare = %v, %v", again, err)
+	} else {
+		releaseAgain()
+	}
+	close(unblock)
+	first, second := <-results, <-results
+	if first.err != nil || second.err != nil || first.stmt != second.stmt {
+		t.Errorf("concurrent prepares returned %v, %v and %v, %v", first.stmt, first.err, second.stmt, second.err)
+	}
+	first.release()
+	second.release()
+	if _, err := first.stmt.ExecContext(ctx, 1, "a"); err != nil {
+		t.Errorf("statement kept by concurrent prepares was closed: %v", err)
+	}
+	// Executing may prepare again on another pooled connection, so the signals start afresh,
+	// and the query is on another table, as closing statements waits for a prepare on their
+	// connection
+	started, unblock = make(chan struct{}, 2), make(chan struct{})
+	slow = "DELETE FROM `dst`.`orders` WHERE `id` = ?"
+	go func() {
+		stmt, release, err := h.stmts.get(ctx, stmtKey{table: "dst.orders", action: canal.DeleteAction}, slow)
+		results <- result{stmt, release, err}
+	}()
+	<-started
+	h.stmts.invalidate("dst.orders")
+	close(unblock)
+	stale := <-results
+	if stale.err != nil {
+		t.Fatal(stale.err)
+	}
+	if _, ok := h.stmts.stmts[cacheKey{table: "dst.orders", query: slow}]; ok {
+		t.Error("statement prepared across an invalidate was cached")
+	}
+	stale.release()
+	if _, err := stale.stmt.ExecContext(ctx, 1); err == nil {
+		t.Error("uncached statement still open after its release")
+	}
+	rec.prepare = nil
+
+	// A full cache executes further queries unprepared
+	for i := 0; len(h.stmts.stmts) < maxCachedStmts; i++ {
+		_, release, err := h.stmts.get(ctx, key, fmt.Sprintf("DELETE FROM `dst`.`users` WHERE `id` = %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if stmt, release, err := h.stmts.get(ctx, key, "DELETE FROM `dst`.`users`"); stmt != nil || err != nil {
+		t.Errorf("full cache returned %v, %v", stmt, err)
+	} else {
+		release()
+	}
+}
+
+// benchmarkHandleInsert measures one insert per iteration. The recorder prepares for free, so
+// this only shows client-side overhead; against a server without interpolateParams the
+// uncached path costs a prepare, execute and close round trip per row instead of one execute.
+func benchmarkHandleInsert(b *testing.B, cached bool) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, cached)
+	defer done()
+
+	row := []interface{}{int64(1), "alice"}
+	tx, err := h.targetDB.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := h.handleInsert(tx, target, row); err != nil {
+			b.Fatal(err)
+		}
+		rec.stmts = rec.stmts[:0]
+	}
+}
+
+func BenchmarkHandleInsertUncached(b *testing.B) { benchmarkHandleInsert(b, false) }
+func BenchmarkHandleInsertCached(b *testing.B)   { benchmarkHandleInsert(b, true) }
+
+// writeSelfSignedCert writes a self-signed certificate and its key as PEM files into dir
+func writeSelfSignedCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sync-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir)
+
+	tlsCfg, err := buildTLSConfig(&config.TLSConfig{CAFile: certFile, CertFile: certFile, KeyFile: keyFile, ServerName: "db.internal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsCfg.RootCAs == nil || len(tlsCfg.Certificates) != 1 || tlsCfg.ServerName != "db.internal" {
+		t.Errorf("unexpected TLS config: %+v", tlsCfg)
+	}
+
+	badCA := filepath.Join(dir, "bad.pem")
+	if err := os.WriteFile(badCA, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]*config.TLSConfig{
+		"missing ca":       {CAFile: filepath.Join(dir, "missing.pem")},
+		"cert without key": {CertFile: certFile},
+		"invalid ca":       {CAFile: badCA},
+	} {
+		if _, err := buildTLSConfig(c); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	if got := withTLSServerName(&tls.Config{}, "db.example.com:3306").ServerName; got != "db.example.com" {
+		t.Errorf("withTLSServerName = %q, want db.example.com", got)
+	}
+
+	dsn, err := dsnWithTLSConfig("user:pass@tcp(db.example.com:3306)/app", "sync-mariadb-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dsn, "tls=sync-mariadb-test") {
+		t.Errorf("dsnWithTLSConfig = %q, want tls=sync-mariadb-test", dsn)
+	}
+}
+
+func TestSourceQueriesUseTLSConfig(t *testing.T) {
+	certFile, keyFile := writeSelfSignedCert(t, t.TempDir())
+	s := &MariaDBSyncer{cfg: config.SyncConfig{
+		SourceConnection: "user:pass@tcp(source.example.com:3306)/app",
+		TLSConfig:        &config.TLSConfig{CAFile: certFile, CertFile: certFile, KeyFile: keyFile},
+	}}
+	_, name, err := s.registerTLS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mysqldriver.DeregisterTLSConfig(name)
+
+	dsnCfg, err := mysqldriver.ParseDSN(s.sourceDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsnCfg.TLSConfig != name || dsnCfg.TLS == nil {
+		t.Errorf("source DSN %q uses TLS config %q, want %q", s.sourceDSN, dsnCfg.TLSConfig, name)
+	}
+	if dsnCfg.TLS != nil && dsnCfg.TLS.ServerName != "source.example.com" {
+		t.Errorf("source TLS server name = %q, want source.example.com", dsnCfg.TLS.ServerName)
+	}
+	db, err := s.openSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+}
+
+func TestAuditLogRecordsCommittedChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "mariadb.jsonl")
+	audit, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.audit = audit
+
+	events := []*canal.RowsEvent{
+		{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}},
+		{Table: target.table, Action: canal.DeleteAction, Rows: [][]interface{}{{[]byte("2"), "b"}}},
+	}
+	for _, e := range events {
+		if _, err := h.applyRows(target, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := audit.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("audit log has %d lines, want 2:\n%s", len(lines), data)
+	}
+	var records []auditRecord
+	for _, line := range lines {
+		var r auditRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid audit line %q: %v", line, err)
+		}
+		records = append(records, r)
+	}
+	if r := records[0]; r.Action != canal.InsertAction || r.Source != "src.users" || r.Target != "dst.users" ||
+		!reflect.DeepEqual(r.PrimaryKey, map[string]interface{}{"id": float64(1)}) {
+		t.Errorf("unexpected insert record: %+v", r)
+	}
+	if r := records[1]; r.Action != canal.DeleteAction || !reflect.DeepEqual(r.PrimaryKey, map[string]interface{}{"id": "2"}) {
+		t.Errorf("unexpected delete record: %+v", r)
+	}
+}
+
+func TestOnChangeDeliversCommittedChanges(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+
+	s := &MariaDBSyncer{}
+	var got []ChangeEvent
+	s.OnChange(func(e ChangeEvent) { got = append(got, e) })
+	h.changes = newChangeNotifier(s.changeCallbacks, 10, logrus.New())
+
+	events := []*canal.RowsEvent{
+		{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}},
+		{Table: target.table, Action: canal.UpdateAction, Rows: [][]interface{}{{int64(1), "a"}, {int64(1), "b"}}},
+	}
+	for _, e := range events {
+		if _, err := h.applyRows(target, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.changes.close()
+
+	want := []ChangeEvent{
+		{Source: "src.users", Target: "dst.users", Action: canal.InsertAction, Row: map[string]interface{}{"id": int64(1), "name": "a"}},
+		{Source: "src.users", Target: "dst.users", Action: canal.UpdateAction,
+			Row: map[string]interface{}{"id": int64(1), "name": "b"}, OldRow: map[string]interface{}{"id": int64(1), "name": "a"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("change events = %+v, want %+v", got, want)
+	}
+
+	// A blocked callback fills the buffer; later events are dropped instead of blocking
+	release := make(chan struct{})
+	n := newChangeNotifier([]func(ChangeEvent){func(ChangeEvent) { <-release }}, 1, logrus.New())
+	published := make(chan struct{})
+	go func() {
+		n.publish(want[0], want[0], want[0], want[0])
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish blocked on a slow callback")
+	}
+	close(release)
+	n.close()
+	if dropped := n.dropped.Load(); dropped < 2 {
+		t.Errorf("dropped = %d, want at least 2", dropped)
+	}
+}
+
+func TestOnRowSkipsReplayedEvents(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.mappings = []config.DatabaseMapping{{
+		SourceDatabase: "src",
+		TargetDatabase: "dst",
+		Tables:         []config.TableMapping{target.tableMap},
+	}}
+	// Resuming from a saved position at the end of the event at offset 500
+	h.lastApplied = mysql.Position{Name: "mysql-bin.000002", Pos: 500}
+	if err := h.OnRotate(&replication.EventHeader{}, &replication.RotateEvent{NextLogName: []byte("mysql-bin.000002"), Position: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	event := func(logPos uint32, id int64) *canal.RowsEvent {
+		return &canal.RowsEvent{
+			Table:  target.table,
+			Action: canal.InsertAction,
+			Rows:   [][]interface{}{{id, "x"}},
+			Header: &replication.EventHeader{LogPos: logPos},
+		}
+	}
+	for _, e := range []*canal.RowsEvent{
+		event(500, 1), // redelivered at the resume point
+		event(600, 2),
+		event(600, 2), // duplicate at the new boundary
+		event(700, 3),
+	} {
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [2 x]",
+		"COMMIT",
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [3 x]",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements =\n%q\nwant\n%q", rec.stmts, want)
+	}
+
+	// A later binlog file is never a replay, whatever its offset
+	if err := h.OnRotate(&replication.EventHeader{}, &replication.RotateEvent{NextLogName: []byte("mysql-bin.000003")}); err != nil {
+		t.Fatal(err)
+	}
+	if h.alreadyApplied(&replication.EventHeader{LogPos: 200}) {
+		t.Error("event in a newer binlog file reported as already applied")
+	}
+}
+
+func TestReload(t *testing.T) {
+	s := &MariaDBSyncer{logger: logrus.New()}
+	if err := s.Reload(config.SyncConfig{}); err == nil {
+		t.Error("expected error reloading a syncer that is not running")
+	}
+
+	users := config.TableMapping{SourceTable: "users", TargetTable: "users"}
+	orders := config.TableMapping{SourceTable: "orders", TargetTable: "orders"}
+	audit := config.TableMapping{SourceTable: "audit", TargetTable: "audit"}
+	renamed := users
+	renamed.TargetTable = "members"
+	added, removed, changed := diffMappings(
+		[]config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{users, audit}}},
+		[]config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{renamed, orders}}},
+	)
+	if !reflect.DeepEqual(added, []string{"src.orders"}) || !reflect.DeepEqual(removed, []string{"src.audit"}) ||
+		!reflect.DeepEqual(changed, []string{"src.users"}) {
+		t.Errorf("diffMappings = added %v, removed %v, changed %v", added, removed, changed)
+	}
+
+	// After a reload canal reads again from offset 300; only the added table applies those
+	// events. The copy of orders already holds id 2, so a plain insert of it fails on its key.
+	rec := &recorder{exec: func(query string, args []driver.Value) error {
+		if strings.HasPrefix(query, "INSERT INTO `dst`.`orders`") && !strings.Contains(query, "ON DUPLICATE KEY UPDATE") {
+			return &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry '2' for key 'PRIMARY'"}
+		}
+		return nil
+	}}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.strictApply = true
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{users, orders}}}
+	h.lastApplied = mysql.Position{Name: "mysql-bin.000002", Pos: 500}
+	h.catchUp = map[string]bool{"src.orders": true}
+	if err := h.OnRotate(&replication.EventHeader{}, &replication.RotateEvent{NextLogName: []byte("mysql-bin.000002"), Position: 300}); err != nil {
+		t.Fatal(err)
+	}
+	ordersTable := &schema.Table{Schema: "src", Name: "orders", Columns: target.table.Columns, PKColumns: []int{0}}
+	event := func(table *schema.Table, logPos uint32, id int64) *canal.RowsEvent {
+		return &canal.RowsEvent{
+			Table:  table,
+			Action: canal.InsertAction,
+			Rows:   [][]interface{}{{id, "x"}},
+			Header: &replication.EventHeader{LogPos: logPos},
+		}
+	}
+	for _, e := range []*canal.RowsEvent{
+		event(target.table, 400, 1), // applied before the reload
+		event(ordersTable, 450, 2),
+		event(target.table, 500, 3), // applied before the reload
+		event(target.table, 600, 4),
+	} {
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"INSERT INTO `dst`.`orders` (`id`, `name`) VALUES (?,?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`) [2 x]",
+		"COMMIT",
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [4 x]",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements =\n%q\nwant\n%q", rec.stmts, want)
+	}
+	if h.catchUp != nil {
+		t.Errorf("catch-up tables %v still set after passing the last applied position", h.catchUp)
+	}
+	if want := (mysql.Position{Name: "mysql-bin.000002", Pos: 600}); h.lastApplied != want {
+		t.Errorf("last applied = %v, want %v", h.lastApplied, want)
+	}
+}
+
+func TestConverterSetConvertRow(t *testing.T) {
+	table := &schema.Table{
+		Schema: "src",
+		Name:   "orders",
+		Columns: []schema.TableColumn{
+			{Name: "id", Type: schema.TYPE_NUMBER},
+			{Name: "status", Type: schema.TYPE_ENUM, EnumValues: []string{"new", "paid", "shipped"}},
+			{Name: "flags", Type: schema.TYPE_SET, SetValues: []string{"gift", "express", "fragile"}},
+			{Name: "created_at", Type: schema.TYPE_TIMESTAMP},
+			{Name: "email", Type: schema.TYPE_STRING},
+			{Name: "note", Type: schema.TYPE_STRING},
+		},
+	}
+	tokyo := time.FixedZone("JST", 9*3600)
+	c := &converterSet{loc: tokyo}
+	c.register("src", "orders", "email", func(col *schema.TableColumn, v interface{}) (interface{}, error) {
+		return strings.ToLower(keyString(v)), nil
+	})
+	c.register("src", "orders", "note", func(col *schema.TableColumn, v interface{}) (interface{}, error) {
+		t.Error("custom converter called for a NULL value")
+		return v, nil
+	})
+
+	cols := []string{"id", "status", "flags", "created_at", "email", "note"}
+	row := []interface{}{
+		int64(1),
+		int64(2),
+		int64(5),
+		time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		[]byte("Alice@Example.COM"),
+		nil,
+	}
+	if err := c.convertRow(table, cols, row); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{int64(1), "paid", "gift,fragile", "2024-01-02 12:04:05", "alice@example.com", nil}
+	if !reflect.DeepEqual(row, want) {
+		t.Errorf("convertRow = %#v, want %#v", row, want)
+	}
+
+	if err := c.convertRow(table, []string{"status"}, []interface{}{int64(9)}); err == nil {
+		t.Error("expected error for an ENUM ordinal out of range")
+	}
+}
+
+func TestJSONColumnRoundTrip(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	target.table.Columns[1] = schema.TableColumn{Name: "name", Type: schema.TYPE_JSON}
+	h.converters = &converterSet{}
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+
+	// The binlog delivers the decoded document as bytes
+	doc := `{"tags":["a","b"],"nested":{"n":1.5,"ok":true},"none":null}`
+	e := &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), []byte(doc)}}}
+	if err := h.OnRow(e); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.stmts) == 0 || rec.stmts[0] != "INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [1 "+doc+"]" {
+		t.Fatalf("statements = %q", rec.stmts)
+	}
+	if _, ok := e.Rows[0][1].(string); !ok {
+		t.Fatalf("JSON value written as %T, want string", e.Rows[0][1])
+	}
+	var got, want interface{}
+	if err := json.Unmarshal([]byte(e.Rows[0][1].(string)), &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(doc), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("target JSON = %v, want %v", got, want)
+	}
+
+	if err := h.converters.convertRow(target.table, []string{"id", "name"}, []interface{}{int64(2), []byte("{broken")}); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestStatusTracksAppliedEvents(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	s := &MariaDBSyncer{}
+	h.status = &s.status
+	h.mappings = []config.DatabaseMapping{{
+		SourceDatabase: "src",
+		TargetDatabase: "dst",
+		Tables:         []config.TableMapping{target.tableMap},
+	}}
+
+	if st := s.Status(); st.Running || !st.LastEventTime.IsZero() || len(st.RowsApplied) != 0 {
+		t.Fatalf("unexpected initial status: %+v", st)
+	}
+	err := h.OnRow(&canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{
+		{int64(1), "a"}, {int64(2), "b"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.status.positionSaved(mysql.Position{Name: "mysql-bin.000001", Pos: 42})
+
+	st := s.Status()
+	if st.LastEventTime.IsZero() || st.RowsApplied[canal.InsertAction] != 2 || st.LastSavedPosition.Pos != 42 {
+		t.Errorf("unexpected status: %+v", st)
+	}
+	// The snapshot is a copy
+	st.RowsApplied[canal.InsertAction] = 100
+	if s.Status().RowsApplied[canal.InsertAction] != 2 {
+		t.Error("Status returned shared RowsApplied map")
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	for _, tt := range []struct {
+		softDelete config.SoftDeleteConfig
+		want       string
+	}{
+		{config.SoftDeleteConfig{Column: "deleted_at", Value: "now()"}, "UPDATE `dst`.`users` SET `deleted_at` = NOW() WHERE `id` = ? [7]"},
+		{config.SoftDeleteConfig{Column: "is_deleted", Value: "1"}, "UPDATE `dst`.`users` SET `is_deleted` = ? WHERE `id` = ? [1 7]"},
+	} {
+		rec := &recorder{}
+		h, target, done := newUsersTarget(rec, false)
+		sd := tt.softDelete
+		target.tableMap.SoftDelete = &sd
+
+		e := &canal.RowsEvent{Table: target.table, Action: canal.DeleteAction, Rows: [][]interface{}{{int64(7), "x"}}}
+		if _, err := h.applyRows(target, e); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{tt.want, "COMMIT"}; !reflect.DeepEqual(rec.stmts, want) {
+			t.Errorf("statements = %q, want %q", rec.stmts, want)
+		}
+		done()
+	}
+
+	rec := &recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		count := int64(0)
+		if args[2] == "deleted_at" {
+			count = 1
+		}
+		return &staticRows{columns: []string{"COUNT(*)"}, values: [][]driver.Value{{count}}}, nil
+	}}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+	mappings := []config.DatabaseMapping{{TargetDatabase: "dst", Tables: []config.TableMapping{
+		{TargetTable: "users", SoftDelete: &config.SoftDeleteConfig{Column: "deleted_at", Value: "NOW()"}},
+		{TargetTable: "orders", SoftDelete: &config.SoftDeleteConfig{Column: "removed", Value: "1"}},
+	}}}
+	err := checkSoftDeleteColumns(context.Background(), db, mappings)
+	if err == nil || !strings.Contains(err.Error(), "removed does not exist on target table dst.orders") {
+		t.Errorf("checkSoftDeleteColumns error = %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "dst.users") {
+		t.Errorf("checkSoftDeleteColumns reported the valid table dst.users: %v", err)
+	}
+}
+
+func TestTransforms(t *testing.T) {
+	tableMap := config.TableMapping{Transforms: map[string]string{
+		"email": "email-mask",
+		"name":  "redact",
+		"phone": "null-out",
+		"ssn":   "hash",
+	}}
+	cols := []string{"id", "email", "name", "phone", "ssn", "nick"}
+	row := []interface{}{int64(1), []byte("alice@example.com"), "Alice", "555-0100", "123-45-6789", nil}
+
+	masked := applyTransforms(tableMap, cols, row)
+	want := []interface{}{
+		int64(1),
+		"a***@example.com",
+		redactedValue,
+		nil,
+		"01a54629efb952287e554eb23ef69c52097a75aecc0e3a93ca0855ab6d7a31a0",
+		nil,
+	}
+	if !reflect.DeepEqual(masked, want) {
+		t.Errorf("applyTransforms = %#v, want %#v", masked, want)
+	}
+	if row[2] != "Alice" {
+		t.Error("applyTransforms modified the input row")
+	}
+
+	err := validateTransforms([]config.DatabaseMapping{{SourceDatabase: "src", Tables: []config.TableMapping{
+		{SourceTable: "users", Transforms: map[string]string{"email": "scramble"}},
+	}}})
+	if err == nil || !strings.Contains(err.Error(), `unknown transform "scramble"`) {
+		t.Errorf("validateTransforms error = %v", err)
+	}
+}
+
+func TestExcludeColumns(t *testing.T) {
+	tableMap := config.TableMapping{
+		ColumnMap:      map[string]string{"full_name": "name"},
+		ExcludeColumns: []string{"Avatar"},
+	}
+	sourceCols := []string{"id", "full_name", "avatar", "name_upper"}
+	targetCols := excludeGenerated(resolveTargetColumns(tableMap, sourceCols), map[string]bool{"name_upper": true})
+	if want := []string{"id", "name", "", ""}; !reflect.DeepEqual(targetCols, want) {
+		t.Fatalf("target columns = %q, want %q", targetCols, want)
+	}
+
+	src, tgt := writableColumns(sourceCols, targetCols)
+	if !reflect.DeepEqual(src, []string{"id", "full_name"}) || !reflect.DeepEqual(tgt, []string{"id", "name"}) {
+		t.Errorf("writableColumns = %q, %q", src, tgt)
+	}
+}
+
+func TestSourceTagMergesTables(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	target.tableMap.SourceTag = "shard"
+
+	e := &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}}
+	if _, err := h.applyRows(target, e); err != nil {
+		t.Fatal(err)
+	}
+	e = &canal.RowsEvent{Table: target.table, Action: canal.UpdateAction, Rows: [][]interface{}{{int64(1), "a"}, {int64(1), "b"}}}
+	if _, err := h.applyRows(target, e); err != nil {
+		t.Fatal(err)
+	}
+	e = &canal.RowsEvent{Table: target.table, Action: canal.DeleteAction, Rows: [][]interface{}{{int64(1), "b"}}}
+	if _, err := h.applyRows(target, e); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"INSERT INTO `dst`.`users` (`id`, `name`, `shard`) VALUES (?,?,?) [1 a src.users]", "COMMIT",
+		"UPDATE `dst`.`users` SET `id` = ?, `name` = ? WHERE `id` = ? AND `shard` = ? [1 b 1 src.users]", "COMMIT",
+		"DELETE FROM `dst`.`users` WHERE `id` = ? AND `shard` = ? [1 src.users]", "COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+}
+
+func TestOnPosSyncedSavesThrottled(t *testing.T) {
+	var saved []uint32
+	h := &MariaDBEventHandler{logger: logrus.New(), saveThrottle: time.Hour, saveEvery: 3,
+		savePosition: func(pos mysql.Position, gs mysql.GTIDSet) error {
+			saved = append(saved, pos.Pos)
+			return nil
+		}}
+	// The first sync saves; the hour-long throttle then holds saves until 3 events are pending
+	for i := uint32(1); i <= 7; i++ {
+		if err := h.OnPosSynced(nil, mysql.Position{Name: "bin.000001", Pos: i}, nil, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Canal forces a sync on rotate and DDL events
+	if err := h.OnPosSynced(nil, mysql.Position{Name: "bin.000002", Pos: 4}, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint32{1, 4, 7, 4}; !reflect.DeepEqual(saved, want) {
+		t.Errorf("saved positions = %v, want %v", saved, want)
+	}
+
+	s := &MariaDBSyncer{cfg: config.SyncConfig{PositionSaveInterval: -time.Second}}
+	if _, err := s.positionSaveInterval(); err == nil {
+		t.Error("negative position_save_interval accepted")
+	}
+}
+
+func TestVerifyTable(t *testing.T) {
+	var queries []string
+	digestDB := func(rows, checksum int64) *sql.DB {
+		return sql.OpenDB(&recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+			queries = append(queries, query)
+			if strings.Contains(query, "KEY_COLUMN_USAGE") {
+				return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}}}, nil
+			}
+			return &staticRows{columns: []string{"COUNT(*)", "SUM"}, values: [][]driver.Value{{rows, checksum}}}, nil
+		}})
+	}
+	s := &MariaDBSyncer{logger: logrus.New()}
+	mapping := config.DatabaseMapping{SourceDatabase: "src", TargetDatabase: "dst"}
+	tableMap := config.TableMapping{SourceTable: "users", TargetTable: "members", ColumnMap: map[string]string{"id": "member_id"}}
+
+	sourceDB := digestDB(3, 12345)
+	defer sourceDB.Close()
+	targetDB := digestDB(3, 12345)
+	defer targetDB.Close()
+	if err := s.verifyTable(context.Background(), sourceDB, targetDB, mapping, tableMap); err != nil {
+		t.Fatalf("matching tables: %v", err)
+	}
+	if want := "SELECT COUNT(*), COALESCE(SUM(CRC32(CONCAT_WS(',', `member_id`))), 0) FROM `dst`.`members`"; !strings.Contains(strings.Join(queries, "\n"), want) {
+		t.Errorf("queries %q do not contain %q", queries, want)
+	}
+
+	shortDB := digestDB(2, 999)
+	defer shortDB.Close()
+	err := s.verifyTable(context.Background(), sourceDB, shortDB, mapping, tableMap)
+	if err == nil || !strings.Contains(err.Error(), "3 rows with key checksum 12345 on the source, 2 rows") {
+		t.Errorf("mismatch error = %v", err)
+	}
+}
+
+func TestWriteBatching(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, true)
+	defer done()
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	h.batchSize = 100
+	h.batchDelay = time.Hour
+
+	events := []*canal.RowsEvent{
+		{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}, {int64(2), "b"}}},
+		{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(3), "c"}}},
+		{Table: target.table, Action: canal.UpdateAction, Rows: [][]interface{}{{int64(3), "c"}, {int64(3), "cc"}}},
+	}
+	for _, e := range events {
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(rec.stmts) != 0 {
+		t.Fatalf("rows written before the batch was flushed: %q", rec.stmts)
+	}
+	if err := h.OnPosSynced(nil, mysql.Position{}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?), (?,?), (?,?) [1 a 2 b 3 c]",
+		"UPDATE `dst`.`users` SET `id` = ?, `name` = ? WHERE `id` = ? [3 cc 3]",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+
+	// A full batch is written without waiting for the end of the source transaction
+	rec.stmts = nil
+	h.batchSize = 2
+	for _, e := range events[:1] {
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?), (?,?) [1 a 2 b]", "COMMIT"}; !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+}
+
+func TestFailedFlushHoldsAppliedPosition(t *testing.T) {
+	failing := true
+	rec := &recorder{exec: func(query string, args []driver.Value) error {
+		if failing && strings.HasPrefix(query, "INSERT") {
+			return errors.New("rejected")
+		}
+		return nil
+	}}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	h.batchSize = 100
+	h.batchDelay = time.Hour
+	var saved []mysql.Position
+	h.savePosition = func(pos mysql.Position, gs mysql.GTIDSet) error {
+		saved = append(saved, pos)
+		return nil
+	}
+	s := &MariaDBSyncer{}
+
+	first := mysql.Position{Name: "bin.000001", Pos: 100}
+	if err := h.OnPosSynced(nil, first, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	insert := &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}}
+	if err := h.OnRow(insert); err != nil {
+		t.Fatal(err)
+	}
+	// Canal has moved its synced position to the end of the transaction when the batch fails
+	if err := h.OnPosSynced(nil, mysql.Position{Name: "bin.000001", Pos: 200}, nil, true); err == nil {
+		t.Fatal("failed batch not reported")
+	}
+	// Closing canal syncs that position again, with nothing left to write
+	if err := h.OnPosSynced(nil, mysql.Position{Name: "bin.000001", Pos: 200}, nil, true); err == nil {
+		t.Error("sync after a failed flush succeeded")
+	}
+	if want := []mysql.Position{first}; !reflect.DeepEqual(saved, want) {
+		t.Errorf("saved positions = %v, want %v", saved, want)
+	}
+	h.discardPending()
+	if pos, _ := s.resumeFrom(h, nil, nil); pos == nil || *pos != first {
+		t.Errorf("resumes from %v, want %v", pos, first)
+	}
+
+	// The failed transaction is read again from there and written
+	failing = false
+	if err := h.OnRow(insert); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.OnPosSynced(nil, mysql.Position{Name: "bin.000001", Pos: 200}, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if pos, _ := h.applied.get(); pos.Pos != 200 {
+		t.Errorf("applied position = %v after the retried transaction", pos)
+	}
+
+	// A failure of an apply worker holds the position back the same way
+	failing = true
+	h.batchSize = 0
+	h.appliers = newApplierPool(h, 2, defaultApplyQueueSize)
+	defer h.appliers.close()
+	if err := h.OnRow(insert); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.OnPosSynced(nil, mysql.Position{Name: "bin.000001", Pos: 300}, nil, true); err == nil {
+		t.Fatal("failed worker write not reported")
+	}
+	if err := h.OnPosSynced(nil, mysql.Position{Name: "bin.000001", Pos: 300}, nil, true); err == nil {
+		t.Error("sync after a failed worker write succeeded")
+	}
+	if pos, _ := h.applied.get(); pos.Pos != 200 {
+		t.Errorf("applied position = %v after a failed worker write, want 200", pos)
+	}
+}
+
+func TestReservedIdentifiersAreQuoted(t *testing.T) {
+	rec := &recorder{}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+
+	h := &MariaDBEventHandler{targetDB: db, logger: logrus.New()}
+	table := &schema.Table{
+		Schema:    "shop",
+		Name:      "order",
+		Columns:   []schema.TableColumn{{Name: "order"}, {Name: "group"}, {Name: "odd`name"}},
+		PKColumns: []int{0},
+	}
+	target := &rowTarget{
+		dbName:        "dst",
+		tableMap:      config.TableMapping{SourceTable: "order", TargetTable: "order"},
+		table:         table,
+		sourceColumns: []string{"order", "group", "odd`name"},
+		targetColumns: []string{"order", "group", "odd`name"},
+	}
+	events := []*canal.RowsEvent{
+		{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a", "x"}}},
+		{Table: table, Action: canal.UpdateAction, Rows: [][]interface{}{{int64(1), "a", "x"}, {int64(1), "b", "x"}}},
+		{Table: table, Action: canal.DeleteAction, Rows: [][]interface{}{{int64(1), "b", "x"}}},
+	}
+	for _, e := range events {
+		if _, err := h.applyRows(target, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"INSERT INTO `dst`.`order` (`order`, `group`, `odd``name`) VALUES (?,?,?) [1 a x]", "COMMIT",
+		"UPDATE `dst`.`order` SET `order` = ?, `group` = ?, `odd``name` = ? WHERE `order` = ? [1 b x 1]", "COMMIT",
+		"DELETE FROM `dst`.`order` WHERE `order` = ? [1]", "COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+}
+
+func TestPauseHoldsBackWrites(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	s := NewMariaDBSyncer(config.SyncConfig{}, logrus.New())
+	h.pause = &s.pause
+
+	s.Pause()
+	if !s.Status().Paused {
+		t.Error("Status does not report the pause")
+	}
+	applied := make(chan error, 1)
+	go func() {
+		applied <- h.OnRow(&canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}})
+	}()
+	select {
+	case err := <-applied:
+		t.Fatalf("OnRow returned while paused: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.Resume()
+	select {
+	case err := <-applied:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnRow still blocked after Resume")
+	}
+	if len(rec.stmts) != 2 {
+		t.Errorf("statements = %q, want the insert and its commit", rec.stmts)
+	}
+
+	// A paused syncer still stops when its context ends
+	s.Pause()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.pause.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait on a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestActionsFilter(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	target.tableMap.Actions = []string{"insert", "Update"}
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+
+	events := []*canal.RowsEvent{
+		{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}},
+		{Table: target.table, Action: canal.DeleteAction, Rows: [][]interface{}{{int64(1), "a"}}},
+		{Table: target.table, Action: canal.UpdateAction, Rows: [][]interface{}{{int64(1), "a"}, {int64(1), "b"}}},
+	}
+	for _, e := range events {
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [1 a]", "COMMIT",
+		"UPDATE `dst`.`users` SET `id` = ?, `name` = ? WHERE `id` = ? [1 b 1]", "COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+	if !(config.TableMapping{}).ActionEnabled(canal.DeleteAction) {
+		t.Error("a table without actions should replicate deletes")
+	}
+}
+
+func TestIsRecoverableCanalError(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("read: %w", io.EOF), true},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{fmt.Errorf("sync: %w", mysql.ErrBadConn), true},
+		{&mysql.MyError{Code: 1053, Message: "Server shutdown in progress"}, true},
+		{&mysql.MyError{Code: 1045, Message: "Access denied"}, false},
+		{&mysql.MyError{Code: 1236, Message: "Could not find first log file name in binary log index file"}, false},
+		{fmt.Errorf("apply: %w", &mysqldriver.MySQLError{Number: 1213}), true},
+		{context.Canceled, false},
+		{errors.New("failed to convert column"), false},
+	} {
+		if got := isRecoverableCanalError(tt.err); got != tt.want {
+			t.Errorf("isRecoverableCanalError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 10: time.Minute} {
+		if got := reconnectDelay(time.Second, attempt); got != want {
+			t.Errorf("reconnectDelay(1s, %d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestServerID(t *testing.T) {
+	s := &MariaDBSyncer{cfg: config.SyncConfig{TargetConnection: "user:pass@tcp(target:3306)/"}}
+	id := s.serverID()
+	if id < minDerivedServerID {
+		t.Fatalf("derived server ID %d is below %d", id, minDerivedServerID)
+	}
+	if again := s.serverID(); again != id {
+		t.Fatalf("derived server ID changed from %d to %d", id, again)
+	}
+
+	other := &MariaDBSyncer{cfg: config.SyncConfig{TargetConnection: "user:pass@tcp(other:3306)/"}}
+	if other.serverID() == id {
+		t.Fatalf("different targets derived the same server ID %d", id)
+	}
+
+	s.cfg.ServerID = 42
+	if got := s.serverID(); got != 42 {
+		t.Fatalf("configured server ID: got %d, want 42", got)
+	}
+}
+
+func TestCompositePrimaryKeyRows(t *testing.T) {
+	rec := &recorder{}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+
+	h := &MariaDBEventHandler{targetDB: db, logger: logrus.New()}
+	table := &schema.Table{
+		Schema:    "src",
+		Name:      "order_items",
+		Columns:   []schema.TableColumn{{Name: "order_id"}, {Name: "sku"}, {Name: "qty"}},
+		PKColumns: []int{0, 1},
+	}
+	target := &rowTarget{
+		dbName:        "dst",
+		tableMap:      config.TableMapping{SourceTable: "order_items", TargetTable: "order_items"},
+		table:         table,
+		sourceColumns: []string{"order_id", "sku", "qty"},
+		targetColumns: []string{"order_id", "sku", "qty"},
+	}
+	events := []*canal.RowsEvent{
+		{Table: table, Action: canal.UpdateAction, Rows: [][]interface{}{
+			{int64(1), "a-1", int64(2)}, {int64(1), "a-1", int64(3)}, // key unchanged
+			{int64(1), "b-2", int64(1)}, {int64(1), "b-3", int64(1)}, // second key column changes
+		}},
+		{Table: table, Action: canal.DeleteAction, Rows: [][]interface{}{{int64(1), "a-1", int64(3)}}},
+	}
+	for _, e := range events {
+		if _, err := h.applyRows(target, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"UPDATE `dst`.`order_items` SET `order_id` = ?, `sku` = ?, `qty` = ? WHERE `order_id` = ? AND `sku` = ? [1 a-1 3 1 a-1]",
+		"DELETE FROM `dst`.`order_items` WHERE `order_id` = ? AND `sku` = ? [1 b-2]",
+		"INSERT INTO `dst`.`order_items` (`order_id`, `sku`, `qty`) VALUES (?,?,?) [1 b-3 1]",
+		"COMMIT",
+		"DELETE FROM `dst`.`order_items` WHERE `order_id` = ? AND `sku` = ? [1 a-1]",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements =\n%q\nwant\n%q", rec.stmts, want)
+	}
+}
+
+func TestKeyAfter(t *testing.T) {
+	cond, args := keyAfter([]string{"order_id", "sku"}, []string{"7", "b-2"})
+	if want := "((`order_id` > ?) OR (`order_id` = ? AND `sku` > ?))"; cond != want {
+		t.Errorf("condition = %q, want %q", cond, want)
+	}
+	if want := []interface{}{"7", "7", "b-2"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestResumeInitialSyncCompositeKey(t *testing.T) {
+	var selects []string
+	source := sql.OpenDB(&recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		switch {
+		case strings.Contains(query, "KEY_COLUMN_USAGE"):
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"order_id"}, {"sku"}}}, nil
+		case strings.Contains(query, "information_schema.COLUMNS"):
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"order_id"}, {"sku"}, {"qty"}}}, nil
+		}
+		selects = append(selects, fmt.Sprintf("%s %v", query, args))
+		return &staticRows{columns: []string{"order_id", "sku", "qty"}, values: [][]driver.Value{
+			{int64(7), "c-9", int64(1)},
+			{int64(8), "a-1", int64(4)},
+		}}, nil
+	}})
+	defer source.Close()
+	rec := &recorder{}
+	target := sql.OpenDB(rec)
+	defer target.Close()
+
+	store, err := loadCheckpointStore(filepath.Join(t.TempDir(), "initial_sync"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.set("src.order_items", tableCheckpoint{LastKey: []string{"7", "b-2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &MariaDBSyncer{logger: logrus.New()}
+	mapping := config.DatabaseMapping{SourceDatabase: "src", TargetDatabase: "dst"}
+	tableMap := config.TableMapping{SourceTable: "order_items", TargetTable: "order_items"}
+	if _, err := s.copyTable(context.Background(), source, &destination{db: target}, nil, mapping, tableMap, 10, store, false); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "SELECT `order_id`,`sku`,`qty` FROM `src`.`order_items` WHERE ((`order_id` > ?) OR (`order_id` = ? AND `sku` > ?)) " +
+		"ORDER BY `order_id`, `sku` [7 7 b-2]"
+	if len(selects) != 1 || selects[0] != want {
+		t.Errorf("select = %q, want %q", selects, want)
+	}
+	cp, _ := store.get("src.order_items")
+	if !cp.Done || !reflect.DeepEqual(cp.LastKey, []string{"8", "a-1"}) {
+		t.Errorf("checkpoint = %+v, want done after key [8 a-1]", cp)
+	}
+
+	if err := store.set("src.order_items", tableCheckpoint{LastKey: []string{"7"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.copyTable(context.Background(), source, &destination{db: target}, nil, mapping, tableMap, 10, store, false); err == nil {
+		t.Error("expected error for a checkpoint that does not match the primary key")
+	}
+}
+
+func TestMode(t *testing.T) {
+	tests := []struct {
+		cfg     config.SyncConfig
+		want    string
+		wantErr bool
+	}{
+		{cfg: config.SyncConfig{}, want: config.ModeFullIncremental},
+		{cfg: config.SyncConfig{Mode: "full", ForceFullResync: true, TruncateBeforeResync: true}, want: config.ModeFull},
+		{cfg: config.SyncConfig{Mode: "incremental"}, want: config.ModeIncremental},
+		{cfg: config.SyncConfig{Mode: "incremental", ForceFullResync: true}, wantErr: true},
+		{cfg: config.SyncConfig{TruncateBeforeResync: true}, wantErr: true},
+		{cfg: config.SyncConfig{Mode: "snapshot"}, wantErr: true},
+		{cfg: config.SyncConfig{ConsistentSnapshot: true}, want: config.ModeFullIncremental},
+		{cfg: config.SyncConfig{Mode: "incremental", ConsistentSnapshot: true}, wantErr: true},
+		{cfg: config.SyncConfig{ConsistentSnapshot: true, ResumableInitialSync: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		s := &MariaDBSyncer{cfg: tt.cfg}
+		got, err := s.mode()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("mode() for %+v = %q, %v; want %q, error %v", tt.cfg, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestOpenSnapshot(t *testing.T) {
+	tests := []struct {
+		name    string
+		mariadb bool // the server reports binlog_snapshot_file and binlog_snapshot_position
+		want    mysql.Position
+		stmts   []string
+	}{
+		{
+			name:    "mariadb",
+			mariadb: true,
+			want:    mysql.Position{Name: "mariadb-bin.000007", Pos: 4711},
+			stmts: []string{
+				"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ []",
+				"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY []",
+			},
+		},
+		{
+			name: "locked",
+			want: mysql.Position{Name: "mysql-bin.000003", Pos: 154},
+			stmts: []string{
+				"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ []",
+				"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY []",
+				"ROLLBACK []",
+				"FLUSH TABLES WITH READ LOCK []",
+				"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ []",
+				"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY []",
+				"UNLOCK TABLES []",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+				switch {
+				case strings.HasPrefix(query, "SHOW STATUS") && tt.mariadb:
+					return &staticRows{columns: []string{"Variable_name", "Value"}, values: [][]driver.Value{
+						{"binlog_snapshot_file", "mariadb-bin.000007"},
+						{"binlog_snapshot_position", "4711"},
+					}}, nil
+				case strings.HasPrefix(query, "SHOW STATUS"):
+					return &staticRows{columns: []string{"Variable_name", "Value"}}, nil
+				case query == "SHOW MASTER STATUS":
+					return &staticRows{
+						columns: []string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"},
+						values:  [][]driver.Value{{"mysql-bin.000003", int64(154), "", "", ""}},
+					}, nil
+				}
+				return nil, fmt.Errorf("unexpected query %q", query)
+			}}
+			db := sql.OpenDB(rec)
+			defer db.Close()
+
+			snap, err := openSnapshot(context.Background(), db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snap.pos != tt.want {
+				t.Errorf("position = %v, want %v", snap.pos, tt.want)
+			}
+			if !reflect.DeepEqual(rec.stmts, tt.stmts) {
+				t.Errorf("statements = %q, want %q", rec.stmts, tt.stmts)
+			}
+			if err := snap.close(); err != nil {
+				t.Fatal(err)
+			}
+			if last := rec.stmts[len(rec.stmts)-1]; last != "COMMIT []" {
+				t.Errorf("last statement = %q, want COMMIT", last)
+			}
+		})
+	}
+}
+
+func TestInsertChunks(t *testing.T) {
+	rows := [][]interface{}{
+		{int64(1), strings.Repeat("a", 100)},
+		{int64(2), strings.Repeat("b", 100)},
+		{int64(3), strings.Repeat("c", 300)},
+		{int64(4), "d"},
+	}
+	// Each of the first two rows is estimated at 135 bytes, the third at 335
+	chunks := insertChunks(rows, 50, 400)
+	var sizes []int
+	for _, chunk := range chunks {
+		sizes = append(sizes, len(chunk))
+	}
+	if want := []int{2, 1, 1}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("chunk sizes = %v, want %v", sizes, want)
+	}
+	if got := insertChunks(rows, 50, 0); len(got) != 1 || len(got[0]) != 4 {
+		t.Errorf("unlimited chunks = %v", got)
+	}
+	// A row larger than the limit still gets a chunk of its own
+	if got := insertChunks(rows[2:3], 50, 100); len(got) != 1 || len(got[0]) != 1 {
+		t.Errorf("oversized row chunks = %v", got)
+	}
+}
+
+func TestBatchInsertSplitsOnPacketTooLarge(t *testing.T) {
+	rec := &recorder{exec: func(query string, args []driver.Value) error {
+		if len(args) > 4 {
+			return &mysqldriver.MySQLError{Number: erNetPacketTooLarge, Message: "Got a packet bigger than 'max_allowed_packet' bytes"}
+		}
+		return nil
+	}}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+
+	s := &MariaDBSyncer{logger: logrus.New()}
+	tableMap := config.TableMapping{SourceTable: "users", TargetTable: "users"}
+	rows := [][]interface{}{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}, {int64(4), "d"}}
+	if err := s.batchInsert(context.Background(), db, "dst", tableMap, []string{"id", "name"}, []string{"id"}, rows); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?), (?,?) [1 a 2 b]",
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?), (?,?) [3 c 4 d]",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements =\n%q\nwant\n%q", rec.stmts, want)
+	}
+}
+
+func TestSlowWritesAreCounted(t *testing.T) {
+	rec := &recorder{exec: func(string, []driver.Value) error {
+		time.Sleep(2 * time.Millisecond)
+		return nil
+	}}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+
+	s := &MariaDBSyncer{cfg: config.SyncConfig{SlowWriteThreshold: time.Millisecond}, logger: logrus.New()}
+	slow, err := s.newSlowWriteLogger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &MariaDBEventHandler{targetDB: db, logger: s.logger, status: &s.status, slowWrites: slow}
+	table := &schema.Table{Schema: "src", Name: "users", Columns: []schema.TableColumn{{Name: "id"}}, PKColumns: []int{0}}
+	target := &rowTarget{
+		dbName:        "dst",
+		tableMap:      config.TableMapping{SourceTable: "users", TargetTable: "users"},
+		table:         table,
+		sourceColumns: []string{"id"},
+		targetColumns: []string{"id"},
+	}
+	e := &canal.RowsEvent{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1)}, {int64(2)}}}
+	if _, err := h.applyRows(target, e); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Status().SlowWrites; got != 2 {
+		t.Errorf("SlowWrites = %d, want 2", got)
+	}
+
+	s.cfg.SlowWriteThreshold = -time.Second
+	if _, err := s.newSlowWriteLogger(); err == nil {
+		t.Error("expected error for a negative slow_write_threshold")
+	}
+}
+
+func TestCanalTableFilters(t *testing.T) {
+	mappings := []config.DatabaseMapping{{
+		SourceDatabase: "shop",
+		Tables:         []config.TableMapping{{SourceTable: "orders"}, {SourceTable: "users"}},
+	}}
+	include, exclude, err := canalTableFilters(mappings, []string{"archive"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`^shop\.orders$`, `^shop\.users$`}; !reflect.DeepEqual(include, want) {
+		t.Errorf("include = %q, want %q", include, want)
+	}
+
+	excluded := func(key string) bool {
+		for _, expr := range exclude {
+			if regexp.MustCompile(expr).MatchString(key) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, key := range []string{"mysql.user", "INFORMATION_SCHEMA.TABLES", "performance_schema.threads", "sys.version", "archive.orders"} {
+		if !excluded(key) {
+			t.Errorf("%s is not excluded", key)
+		}
+	}
+	for _, key := range []string{"shop.orders", "mysqlx.orders", "my_sys.orders"} {
+		if excluded(key) {
+			t.Errorf("%s is excluded", key)
+		}
+	}
+
+	// Metacharacters in names are literal and a table read by two mappings is included once
+	special := []config.DatabaseMapping{
+		{SourceDatabase: "shop", Tables: []config.TableMapping{{SourceTable: "a.b"}}},
+		{SourceDatabase: "shop", Tables: []config.TableMapping{{SourceTable: "a.b"}}},
+	}
+	if include, _, err = canalTableFilters(special, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(include) != 1 {
+		t.Fatalf("include = %q, want a single regex", include)
+	}
+	re := regexp.MustCompile(include[0])
+	for key, want := range map[string]bool{"shop.a.b": true, "shop.aXb": false, "shop.a.b2": false, "xshop.a.b": false} {
+		if got := re.MatchString(key); got != want {
+			t.Errorf("include %q matches %s = %v, want %v", include[0], key, got, want)
+		}
+	}
+
+	for _, db := range []string{"mysql", "Sys", "archive"} {
+		bad := []config.DatabaseMapping{{SourceDatabase: db, Tables: []config.TableMapping{{SourceTable: "t"}}}}
+		if _, _, err := canalTableFilters(bad, []string{"archive"}, nil); err == nil {
+			t.Errorf("expected error mapping excluded database %s", db)
+		}
+	}
+}
+
+func TestSkipTables(t *testing.T) {
+	mappings := []config.DatabaseMapping{{
+		SourceDatabase: "shop",
+		Tables:         []config.TableMapping{{SourceTable: "orders"}, {SourceTable: "orders_tmp"}},
+	}}
+	_, exclude, err := canalTableFilters(mappings, nil, []string{"shop.orders_tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var skipped []string
+	for _, key := range []string{"shop.orders", "SHOP.ORDERS_TMP", "shop.orders_tmp2"} {
+		for _, expr := range exclude {
+			if regexp.MustCompile(expr).MatchString(key) {
+				skipped = append(skipped, key)
+			}
+		}
+	}
+	if want := []string{"SHOP.ORDERS_TMP"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("excluded %q, want %q", skipped, want)
+	}
+	if _, _, err := canalTableFilters(mappings, nil, []string{"orders_tmp"}); err == nil {
+		t.Error("skip_tables entry without a database accepted")
+	}
+
+	// The event is dropped before the pause gate, the mapping lookup or any write
+	logger, hook := logtest.NewNullLogger()
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.logger = logger
+	h.mappings = mappings
+	h.skipTables = skippedTables([]string{"Src.Users"})
+	e := &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}}
+	if err := h.OnRow(e); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.stmts) != 0 || len(hook.AllEntries()) != 0 {
+		t.Errorf("skipped event ran %q and logged %d entries", rec.stmts, len(hook.AllEntries()))
+	}
+}
+
+// deleteNoops reads the delete no-op counter of a source table from the default registry
+func deleteNoops(t *testing.T, table string) float64 {
+	return tableMetric(t, "sync_delete_noops_total", table)
+}
+
+// tableMetric reads the counter or gauge of a source table from the default registry
+func tableMetric(t *testing.T, name, table string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "table" && label.GetValue() == table {
+					if m.GetGauge() != nil {
+						return m.GetGauge().GetValue()
+					}
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestDeleteOfAbsentRowIsCounted(t *testing.T) {
+	rec := &recorder{}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+
+	h := &MariaDBEventHandler{targetDB: db, logger: logrus.New()}
+	table := &schema.Table{Schema: "src", Name: "noop_users", Columns: []schema.TableColumn{{Name: "id"}}, PKColumns: []int{0}}
+	target := &rowTarget{
+		dbName:        "dst",
+		tableMap:      config.TableMapping{SourceTable: "noop_users", TargetTable: "noop_users"},
+		table:         table,
+		sourceColumns: []string{"id"},
+		targetColumns: []string{"id"},
+	}
+	e := &canal.RowsEvent{Table: table, Action: canal.DeleteAction, Rows: [][]interface{}{{int64(1)}}}
+	if _, err := h.applyRows(target, e); err != nil {
+		t.Fatal(err)
+	}
+	if got := deleteNoops(t, "src.noop_users"); got != 0 {
+		t.Fatalf("delete no-ops after a delete that removed a row = %v, want 0", got)
+	}
+
+	rec.noRows = true
+	if _, err := h.applyRows(target, e); err != nil {
+		t.Fatalf("delete of an absent row failed: %v", err)
+	}
+	if got := deleteNoops(t, "src.noop_users"); got != 1 {
+		t.Errorf("delete no-ops = %v, want 1", got)
+	}
+}
+
+func TestIgnoreOwnWrites(t *testing.T) {
+	dsn, err := dsnWithSessionServerID("user:pass@tcp(target:3306)/app?charset=utf8mb4", 4242)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsnCfg, err := parseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dsnCfg.Params["server_id"]; got != "4242" {
+		t.Errorf("server_id param = %q, want 4242 (dsn %s)", got, dsn)
+	}
+
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.ownServerID = 4242
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	for _, serverID := range []uint32{4242, 1} {
+		e := &canal.RowsEvent{
+			Table:  target.table,
+			Action: canal.InsertAction,
+			Rows:   [][]interface{}{{int64(serverID), "alice"}},
+			Header: &replication.EventHeader{ServerID: serverID},
+		}
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [1 alice]", "COMMIT"}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+}
+
+func TestColumnOrderMatchesCanal(t *testing.T) {
+	// Columns in ordinal position order; the primary key lists sku before order_id
+	columns := []string{"qty", "order_id", "note", "sku"}
+	pk := []string{"sku", "order_id"}
+	db := sql.OpenDB(&recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		switch {
+		case strings.HasPrefix(query, "show full columns"):
+			rows := &staticRows{columns: []string{"Field", "Type", "Collation", "Null", "Key", "Default", "Extra", "Privileges", "Comment"}}
+			for _, col := range columns {
+				rows.values = append(rows.values, []driver.Value{col, "varchar(20)", nil, "NO", "", nil, "", "", ""})
+			}
+			return rows, nil
+		case strings.HasPrefix(query, "show index"):
+			rows := &staticRows{columns: []string{"Table", "Non_unique", "Key_name", "Seq_in_index", "Column_name", "Collation", "Cardinality"}}
+			for i, col := range pk {
+				rows.values = append(rows.values, []driver.Value{"order_items", int64(0), "PRIMARY", int64(i + 1), col, "A", int64(10)})
+			}
+			return rows, nil
+		case strings.Contains(query, "KEY_COLUMN_USAGE"):
+			rows := &staticRows{columns: []string{"COLUMN_NAME"}}
+			for _, col := range pk {
+				rows.values = append(rows.values, []driver.Value{col})
+			}
+			return rows, nil
+		case strings.Contains(query, "information_schema.COLUMNS"):
+			rows := &staticRows{columns: []string{"COLUMN_NAME"}}
+			for _, col := range columns {
+				rows.values = append(rows.values, []driver.Value{col})
+			}
+			return rows, nil
+		}
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}})
+	defer db.Close()
+
+	canalTable, err := schema.NewTableFromSqlDB(db, "src", "order_items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var canalCols, canalPK []string
+	for _, col := range canalTable.Columns {
+		canalCols = append(canalCols, col.Name)
+	}
+	for _, idx := range canalTable.PKColumns {
+		canalPK = append(canalPK, canalTable.Columns[idx].Name)
+	}
+
+	s := &MariaDBSyncer{logger: logrus.New()}
+	cols, pkCols, err := s.getColumnsOfTable(context.Background(), db, "src", "order_items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cols, canalCols) {
+		t.Errorf("columns = %q, canal reports %q", cols, canalCols)
+	}
+	if !reflect.DeepEqual(pkCols, canalPK) {
+		t.Errorf("primary key = %q, canal reports %q", pkCols, canalPK)
+	}
+}
+
+func TestInsertFollowsTargetColumnList(t *testing.T) {
+	rec := &recorder{}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+
+	// The target orders its columns email, full_name, user_id and has no secret column
+	h := &MariaDBEventHandler{targetDB: db, logger: logrus.New(), batchSize: 10, batchDelay: time.Hour}
+	table := &schema.Table{
+		Schema:    "src",
+		Name:      "users",
+		Columns:   []schema.TableColumn{{Name: "id"}, {Name: "secret"}, {Name: "name"}, {Name: "email"}},
+		PKColumns: []int{0},
+	}
+	tableMap := config.TableMapping{
+		SourceTable:    "users",
+		TargetTable:    "members",
+		ColumnMap:      map[string]string{"id": "user_id", "name": "full_name"},
+		ExcludeColumns: []string{"secret"},
+	}
+	sourceCols := []string{"id", "secret", "name", "email"}
+	target := &rowTarget{
+		dbName:        "dst",
+		tableMap:      tableMap,
+		table:         table,
+		sourceColumns: sourceCols,
+		targetColumns: resolveTargetColumns(tableMap, sourceCols),
+	}
+	for _, id := range []int64{1, 2} {
+		e := &canal.RowsEvent{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{
+			{id, "s3cret", fmt.Sprintf("user%d", id), fmt.Sprintf("u%d@example.com", id)},
+		}}
+		if err := h.enqueue(target, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"INSERT INTO `dst`.`members` (`user_id`, `full_name`, `email`) VALUES (?,?,?), (?,?,?) [1 user1 u1@example.com 2 user2 u2@example.com]",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements =\n%q\nwant\n%q", rec.stmts, want)
+	}
+
+	args, err := insertArgs([]string{"user_id", "full_name"}, []string{"full_name", "user_id"}, []interface{}{"bob", int64(3)})
+	if err != nil || !reflect.DeepEqual(args, []interface{}{int64(3), "bob"}) {
+		t.Errorf("insertArgs = %v, %v", args, err)
+	}
+	if _, err := insertArgs([]string{"user_id", "full_name"}, []string{"user_id"}, []interface{}{int64(3)}); err == nil {
+		t.Error("expected error for a row lacking a statement column")
+	}
+}
+
+func TestErrorPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		cfg     config.SyncConfig
+		want    string
+		wantErr bool
+	}{
+		{cfg: config.SyncConfig{}, want: errorPolicyStop},
+		{cfg: config.SyncConfig{ErrorPolicy: "skip"}, want: errorPolicySkip},
+		{cfg: config.SyncConfig{ErrorPolicy: "deadletter", DeadLetterPath: "/tmp/dl.jsonl"}, want: errorPolicyDeadLetter},
+		{cfg: config.SyncConfig{ErrorPolicy: "deadletter", DeadLetterTable: "ops.dead_letters"}, want: errorPolicyDeadLetter},
+		{cfg: config.SyncConfig{ErrorPolicy: "deadletter"}, wantErr: true},
+		{cfg: config.SyncConfig{ErrorPolicy: "deadletter", DeadLetterPath: "/tmp/dl.jsonl", DeadLetterTable: "ops.dead_letters"}, wantErr: true},
+		{cfg: config.SyncConfig{ErrorPolicy: "deadletter", DeadLetterTable: "dead_letters"}, wantErr: true},
+		{cfg: config.SyncConfig{ErrorPolicy: "skip", DeadLetterPath: "/tmp/dl.jsonl"}, wantErr: true},
+		{cfg: config.SyncConfig{ErrorPolicy: "ignore"}, wantErr: true},
+	} {
+		s := &MariaDBSyncer{cfg: tc.cfg}
+		got, err := s.errorPolicy()
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("errorPolicy(%+v) = %q, %v; want %q, error %v", tc.cfg, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestErrorPolicyOnRejectedRows(t *testing.T) {
+	duplicate := &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry '2' for key 'PRIMARY'"}
+	rejectID2 := func(query string, args []driver.Value) error {
+		for i, arg := range args {
+			// The batched insert holds both rows; the retried single insert holds only id 2
+			if i%2 == 0 && arg == int64(2) {
+				return duplicate
+			}
+		}
+		return nil
+	}
+	events := func(table *schema.Table) []*canal.RowsEvent {
+		return []*canal.RowsEvent{
+			{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}},
+			{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(2), "b"}}},
+			{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(3), "c"}}},
+		}
+	}
+
+	t.Run("stop", func(t *testing.T) {
+		rec := &recorder{exec: rejectID2}
+		h, target, done := newUsersTarget(rec, false)
+		defer done()
+		h.errorPolicy = errorPolicyStop
+		h.batchSize, h.batchDelay = 100, time.Hour
+		for _, e := range events(target.table) {
+			if err := h.enqueue(target, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := h.flush(); !errors.Is(err, duplicate) {
+			t.Fatalf("flush error = %v, want the duplicate key error", err)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		rec := &recorder{exec: rejectID2}
+		h, target, done := newUsersTarget(rec, false)
+		defer done()
+		h.errorPolicy = errorPolicySkip
+		h.batchSize, h.batchDelay = 100, time.Hour
+		for _, e := range events(target.table) {
+			if err := h.enqueue(target, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := h.flush(); err != nil {
+			t.Fatalf("flush with skip policy failed: %v", err)
+		}
+		var inserted []string
+		for _, stmt := range rec.stmts {
+			if strings.HasPrefix(stmt, "INSERT") {
+				inserted = append(inserted, stmt)
+			}
+		}
+		want := []string{
+			"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [1 a]",
+			"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [3 c]",
+		}
+		if !reflect.DeepEqual(inserted, want) {
+			t.Errorf("inserts =\n%q\nwant\n%q", inserted, want)
+		}
+	})
+
+	t.Run("deadletter", func(t *testing.T) {
+		rec := &recorder{exec: rejectID2}
+		h, target, done := newUsersTarget(rec, false)
+		defer done()
+		path := filepath.Join(t.TempDir(), "dead", "letters.jsonl")
+		s := &MariaDBSyncer{cfg: config.SyncConfig{ErrorPolicy: errorPolicyDeadLetter, DeadLetterPath: path}}
+		sink, err := s.openDeadLetterSink(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.errorPolicy, h.deadLetters = errorPolicyDeadLetter, sink
+		h.binlogFile = "mysql-bin.000003"
+		e := &canal.RowsEvent{
+			Table:  target.table,
+			Action: canal.InsertAction,
+			Rows:   [][]interface{}{{int64(2), "b"}},
+			Header: &replication.EventHeader{LogPos: 1234},
+		}
+		if err := h.applyEvent(target, e); err != nil {
+			t.Fatalf("applyEvent with deadletter policy failed: %v", err)
+		}
+		if err := sink.close(); err != nil {
+			t.Fatal(err)
+		}
+		if want := (mysql.Position{Name: "mysql-bin.000003", Pos: 1234}); h.lastApplied != want {
+			t.Errorf("last applied = %v, want %v", h.lastApplied, want)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var l deadLetter
+		if err := json.Unmarshal(data, &l); err != nil {
+			t.Fatalf("dead letter %q is not JSON: %v", data, err)
+		}
+		if l.Source != "src.users" || l.Target != "dst.users" || l.Action != canal.InsertAction || l.Position != "mysql-bin.000003:1234" {
+			t.Errorf("dead letter = %+v", l)
+		}
+		if l.Row["id"] != float64(2) || l.Row["name"] != "b" {
+			t.Errorf("dead letter row = %v, want id 2 and name b", l.Row)
+		}
+		if !strings.HasPrefix(l.Statement, "INSERT INTO `dst`.`users`") || !strings.Contains(l.Error, "Duplicate entry") {
+			t.Errorf("dead letter statement %q, error %q", l.Statement, l.Error)
+		}
+	})
+}
+
+func TestTableToggles(t *testing.T) {
+	disabled := false
+	mappings := []config.DatabaseMapping{{
+		SourceDatabase: "src",
+		TargetDatabase: "dst",
+		Tables: []config.TableMapping{
+			{SourceTable: "users", TargetTable: "users"},
+			{SourceTable: "orders", TargetTable: "orders", Enabled: &disabled},
+		},
+	}}
+	s := &MariaDBSyncer{cfg: config.SyncConfig{Mappings: mappings}, logger: logrus.New()}
+	include, _, err := canalTableFilters(s.tables.start(mappings), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`^src\.users$`}; !reflect.DeepEqual(include, want) {
+		t.Errorf("include = %q, want %q", include, want)
+	}
+	if err := s.SetTableEnabled("src", "orders", true); err == nil {
+		t.Error("expected error enabling a table canal does not stream")
+	}
+	if err := s.SetTableEnabled("src", "missing", false); err == nil {
+		t.Error("expected error for an unmapped table")
+	}
+
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.mappings = mappings
+	h.tables = &s.tables
+	insert := func(id int64) {
+		e := &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{id, "a"}}}
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert(1)
+	if err := s.SetTableEnabled("src", "users", false); err != nil {
+		t.Fatal(err)
+	}
+	insert(2)
+	if err := s.SetTableEnabled("src", "users", true); err != nil {
+		t.Fatal(err)
+	}
+	insert(3)
+	want := []string{
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [1 a]", "COMMIT",
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [3 a]", "COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	rec := &recorder{hang: true}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.writeTimeout = 10 * time.Millisecond
+	e := &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}}
+
+	err := h.applyEvent(target, e)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out after 10ms") {
+		t.Fatalf("applyEvent on a hung target = %v, want a write timeout", err)
+	}
+
+	// A timeout is a rejected write, so the error policy applies
+	h.errorPolicy = errorPolicySkip
+	if err := h.applyEvent(target, e); err != nil {
+		t.Fatalf("applyEvent with skip policy = %v, want the timed out event skipped", err)
+	}
+
+	// Shutdown cancels the write in flight, which stops the sync whatever the policy
+	ctx, cancel := context.WithCancel(context.Background())
+	h.ctx = ctx
+	h.writeTimeout = time.Minute
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := h.applyEvent(target, e); !errors.Is(err, context.Canceled) {
+		t.Fatalf("applyEvent during shutdown = %v, want context.Canceled", err)
+	}
+}
+
+func TestExtraTargets(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	extraRec := &recorder{}
+	extraDB := sql.OpenDB(extraRec)
+	defer extraDB.Close()
+	h.destinations = map[string]*destination{"analytics": {name: "analytics:3306", db: extraDB}}
+	h.binlogFile = "mysql-bin.000001"
+	target.tableMap.ExtraTargets = []config.TableTarget{{TargetConnection: "analytics", TargetDatabase: "reporting", TargetTable: "members"}}
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+
+	event := func(pos uint32, id int64) *canal.RowsEvent {
+		return &canal.RowsEvent{
+			Table:  target.table,
+			Action: canal.InsertAction,
+			Rows:   [][]interface{}{{id, "a"}},
+			Header: &replication.EventHeader{LogPos: pos},
+		}
+	}
+	if err := h.OnRow(event(100, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [1 a]", "COMMIT"}; !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("target statements = %q, want %q", rec.stmts, want)
+	}
+	if want := []string{"INSERT INTO `reporting`.`members` (`id`, `name`) VALUES (?,?) [1 a]", "COMMIT"}; !reflect.DeepEqual(extraRec.stmts, want) {
+		t.Errorf("extra target statements = %q, want %q", extraRec.stmts, want)
+	}
+
+	// A rejected write to an extra target stops the event before the main target has it
+	extraRec.exec = func(string, []driver.Value) error {
+		return &mysqldriver.MySQLError{Number: 1146, Message: "Table 'reporting.members' doesn't exist"}
+	}
+	if err := h.OnRow(event(200, 2)); err == nil {
+		t.Fatal("expected the extra target error")
+	}
+	if len(rec.stmts) != 2 || h.lastApplied.Pos != 100 {
+		t.Errorf("event applied to the main target after the extra target failed: %q, last applied %v", rec.stmts, h.lastApplied)
+	}
+
+	// Under the skip policy the other targets still get the event
+	h.errorPolicy = errorPolicySkip
+	if err := h.OnRow(event(200, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.stmts) != 4 || h.lastApplied.Pos != 200 {
+		t.Errorf("event not applied to the main target after a skipped extra target: %q, last applied %v", rec.stmts, h.lastApplied)
+	}
+
+	// A DDL on the table drops the statements prepared on the extra target and looks up its
+	// generated columns again
+	extraRec.exec = nil
+	d := h.destinations["analytics"]
+	d.stmts = newStmtCache(extraDB)
+	defer d.stmts.close()
+	if err := h.OnRow(event(300, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.stmts.stmts) != 1 {
+		t.Fatalf("extra target cached %d statements, want 1", len(d.stmts.stmts))
+	}
+	extraRec.query = func(query string, args []driver.Value) (driver.Rows, error) {
+		if want := []driver.Value{"reporting", "members"}; !reflect.DeepEqual(args, want) {
+			return nil, fmt.Errorf("generated columns looked up with %v, want %v", args, want)
+		}
+		return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"name"}}}, nil
+	}
+	ddl := &replication.QueryEvent{Schema: []byte("src"), Query: []byte("ALTER TABLE users ADD COLUMN age INT")}
+	if err := h.OnDDL(&replication.EventHeader{LogPos: 400}, mysql.Position{}, ddl); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.stmts.stmts) != 0 {
+		t.Errorf("extra target kept %d statements after the DDL", len(d.stmts.stmts))
+	}
+	extraRec.stmts = nil
+	if err := h.OnRow(event(500, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"INSERT INTO `reporting`.`members` (`id`) VALUES (?) [5]", "COMMIT"}; !reflect.DeepEqual(extraRec.stmts, want) {
+		t.Errorf("extra target statements after the DDL = %q, want %q", extraRec.stmts, want)
+	}
+
+	extra := extraTargetsTo(h.mappings, "analytics")
+	if len(extra) != 1 || extra[0].TargetDatabase != "reporting" || extra[0].Tables[0].TargetTable != "members" || extra[0].Tables[0].ExtraTargets != nil {
+		t.Errorf("extraTargetsTo = %+v", extra)
+	}
+}
+
+// fakeExecer records the statements a handler writes, without a database
+type fakeExecer struct {
+	queries []string
+	args    [][]interface{}
+}
+
+func (f *fakeExecer) ExecContext(_ context.Context, query string, args ...interface{}) (sql.Result, error) {
+	f.queries = append(f.queries, query)
+	f.args = append(f.args, args)
+	return driver.RowsAffected(1), nil
+}
+
+func TestHandlerSQL(t *testing.T) {
+	usersTable := &schema.Table{
+		Schema:    "src",
+		Name:      "users",
+		Columns:   []schema.TableColumn{{Name: "id"}, {Name: "name"}},
+		PKColumns: []int{0},
+	}
+	logsTable := &schema.Table{Schema: "src", Name: "logs", Columns: []schema.TableColumn{{Name: "id"}, {Name: "line"}}}
+	newTarget := func(table *schema.Table, tableMap config.TableMapping) *rowTarget {
+		cols := []string{table.Columns[0].Name, table.Columns[1].Name}
+		return &rowTarget{
+			dbName:        "dst",
+			tableMap:      tableMap,
+			table:         table,
+			sourceColumns: cols,
+			targetColumns: resolveTargetColumns(tableMap, cols),
+		}
+	}
+	users := config.TableMapping{SourceTable: "users", TargetTable: "users"}
+
+	for _, tt := range []struct {
+		name     string
+		table    *schema.Table
+		tableMap config.TableMapping
+		apply    func(h *MariaDBEventHandler, tx execer, t *rowTarget) error
+		want     []string
+		wantArgs [][]interface{}
+		warning  string
+	}{
+		{
+			name: "insert", table: usersTable, tableMap: users,
+			apply: func(h *MariaDBEventHandler, tx execer, t *rowTarget) error {
+				return h.handleInsert(tx, t, []interface{}{int64(1), "a"})
+			},
+			want:     []string{"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?)"},
+			wantArgs: [][]interface{}{{int64(1), "a"}},
+		},
+		{
+			name: "upsert", table: usersTable, tableMap: config.TableMapping{SourceTable: "users", TargetTable: "users", InsertMode: "upsert"},
+			apply: func(h *MariaDBEventHandler, tx execer, t *rowTarget) error {
+				return h.handleInsert(tx, t, []interface{}{int64(1), "a"})
+			},
+			want:     []string{"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)"},
+			wantArgs: [][]interface{}{{int64(1), "a"}},
+		},
+		{
+			name: "replace", table: usersTable, tableMap: config.TableMapping{SourceTable: "users", TargetTable: "users", InsertMode: "replace"},
+			apply: func(h *MariaDBEventHandler, tx execer, t *rowTarget) error {
+				return h.handleInsert(tx, t, []interface{}{int64(1), "a"})
+			},
+			want:     []string{"REPLACE INTO `dst`.`users` (`id`, `name`) VALUES (?,?)"},
+			wantArgs: [][]interface{}{{int64(1), "a"}},
+		},
+		{
+			name: "update", table: usersTable, tableMap: users,
+			apply: func(h *MariaDBEventHandler, tx execer, t *rowTarget) error {
+				return h.handleUpdate(tx, t, []interface{}{int64(1), "a"}, []interface{}{int64(1), "b"})
+			},
+			want:     []string{"UPDATE `dst`.`users` SET `id` = ?, `name` = ? WHERE `id` = ?"},
+			wantArgs: [][]interface{}{{int64(1), "b", int64(1)}},
+		},
+		{
+			name: "update of the primary key", table: usersTable, tableMap: users,
+			apply: func(h *MariaDBEventHandler, tx execer, t *rowTarget) error {
+				return h.handleUpdate(tx, t, []interface{}{int64(1), "a"}, []interface{}{int64(2), "a"})
+			},
+			want: []string{
+				"DELETE FROM `dst`.`users` WHERE `id` = ?",
+				"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?)",
+			},
+			wantArgs: [][]interface{}{{int64(1)}, {int64(2), "a"}},
+		},
+		{
+			name: "delete", table: usersTable, tableMap: users,
+			apply: func(h *MariaDBEventHandler, tx execer, t *rowTarget) error {
+				return h.handleDelete(tx, t, []interface{}{int64(1), "a"})
+			},
+			want:     []string{"DELETE FROM `dst`.`users` WHERE `id` = ?"},
+			wantArgs: [][]interface{}{{int64(1)}},
+		},
+		{
+			name:  "soft delete",
+			table: usersTable,
+			tableMap: config.TableMapping{SourceTable: "users", TargetTable: "users",
+				SoftDelete: &config.SoftDeleteConfig{Column: "deleted", Value: "1"}},
+			apply: func(h *MariaDBEventHandler, tx execer, t *rowTarget) error {
+				return h.handleDelete(tx, t, []interface{}{int64(1), "a"})
+			},
+			want:     []string{"UPDATE `dst`.`users` SET `deleted` = ? WHERE `id` = ?"},
+			wantArgs: [][]interface{}{{"1", int64(1)}},
+		},
+		{
+			name:  "delete with a source tag",
+			table: usersTable,
+			tableMap: config.TableMapping{SourceTable: "users", TargetTable: "members",
+				SourceTag: "origin"},
+			apply: func(h *MariaDBEventHandler, tx execer, t *rowTarget) error {
+				return h.handleDelete(tx, t, []interface{}{int64(1), "a"})
+			},
+			want:     []string{"DELETE FROM `dst`.`members` WHERE `id` = ? AND `origin` = ?"},
+			wantArgs: [][]interface{}{{int64(1), "src.users"}},
+		},
+		{
+			name: "insert without a primary key", table: logsTable, tableMap: config.TableMapping{SourceTable: "logs", TargetTable: "logs"},
+			apply: func(h *MariaDBEventHandler, tx execer, t *rowTarget) error {
+				return h.handleInsert(tx, t, []interface{}{int64(1), "started"})
+			},
+			want:     []string{"INSERT INTO `dst`.`logs` (`id`, `line`) VALUES (?,?)"},
+			wantArgs: [][]interface{}{{int64(1), "started"}},
+		},
+		{
+			name: "update without a primary key", table: logsTable, tableMap: config.TableMapping{SourceTable: "logs", TargetTable: "logs"},
+			apply: func(h *MariaDBEventHandler, tx execer, t *rowTarget) error {
+				return h.handleUpdate(tx, t, []interface{}{int64(1), "started"}, []interface{}{int64(1), "stopped"})
+			},
+			warning: "No primary key defined on table dst.logs, cannot perform update",
+		},
+		{
+			name: "delete without a primary key", table: logsTable, tableMap: config.TableMapping{SourceTable: "logs", TargetTable: "logs"},
+			apply: func(h *MariaDBEventHandler, tx execer, t *rowTarget) error {
+				return h.handleDelete(tx, t, []interface{}{int64(1), "started"})
+			},
+			warning: "No primary key defined on table dst.logs, cannot perform delete",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, hook := logtest.NewNullLogger()
+			h := &MariaDBEventHandler{logger: logger}
+			tx := &fakeExecer{}
+			if err := tt.apply(h, tx, newTarget(tt.table, tt.tableMap)); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tx.queries, tt.want) {
+				t.Errorf("queries = %q, want %q", tx.queries, tt.want)
+			}
+			if len(tt.wantArgs) > 0 && !reflect.DeepEqual(tx.args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", tx.args, tt.wantArgs)
+			}
+			var warning string
+			if e := hook.LastEntry(); e != nil && e.Level == logrus.WarnLevel {
+				warning = e.Message
+			}
+			if !strings.Contains(warning, tt.warning) || (tt.warning == "") != (warning == "") {
+				t.Errorf("warning = %q, want %q", warning, tt.warning)
+			}
+		})
+	}
+}
+
+// unreachable fails the first connects of a recorder, like a database still starting up
+type unreachable struct {
+	*recorder
+	failures int
+}
+
+func (u *unreachable) Connect(ctx context.Context) (driver.Conn, error) {
+	if u.failures > 0 {
+		u.failures--
+		return nil, syscall.ECONNREFUSED
+	}
+	return u.recorder.Connect(ctx)
+}
+
+func TestPingWithRetry(t *testing.T) {
+	s := NewMariaDBSyncer(config.SyncConfig{}, logrus.New())
+
+	db := sql.OpenDB(&unreachable{recorder: &recorder{}, failures: 2})
+	defer db.Close()
+	if err := s.pingWithRetry(context.Background(), db, "target", 3, time.Millisecond, time.Second); err != nil {
+		t.Errorf("pingWithRetry of a database reachable on the third attempt = %v", err)
+	}
+
+	down := sql.OpenDB(&unreachable{recorder: &recorder{}, failures: 100})
+	defer down.Close()
+	err := s.pingWithRetry(context.Background(), down, "target", 3, time.Millisecond, time.Second)
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("pingWithRetry of a database that stays down = %v, want failure after 3 attempts", err)
+	}
+	err = s.pingWithRetry(context.Background(), down, "target", 100, time.Second, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "within 50ms") {
+		t.Errorf("pingWithRetry past its timeout = %v, want timeout failure", err)
+	}
+
+	if _, _, err := NewMariaDBSyncer(config.SyncConfig{PreflightMaxAttempts: -1}, logrus.New()).preflightPolicy(); err == nil {
+		t.Error("negative preflight_max_attempts accepted")
+	}
+}
+
+func TestTargetColumnDrift(t *testing.T) {
+	var lookups int
+	rec := &recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		lookups++
+		return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}, {"NAME"}}}, nil
+	}}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	logger, hook := logtest.NewNullLogger()
+	h.logger = logger
+	h.converters = &converterSet{}
+	h.targetColumns = newTargetColumnCache()
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	table := &schema.Table{
+		Schema:    "src",
+		Name:      "users",
+		Columns:   []schema.TableColumn{{Name: "id"}, {Name: "name"}, {Name: "nickname"}},
+		PKColumns: []int{0},
+	}
+
+	for i := int64(1); i <= 2; i++ {
+		e := &canal.RowsEvent{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{{i, "a", "x"}}}
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [1 a]", "COMMIT",
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [2 a]", "COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+	var warnings int
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "lacks columns nickname") {
+			warnings++
+		}
+	}
+	if lookups != 1 || warnings != 1 {
+		t.Errorf("looked up target columns %d times and warned %d times, want once each", lookups, warnings)
+	}
+
+	h.strictSchema = true
+	e := &canal.RowsEvent{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(3), "a", "x"}}}
+	if err := h.OnRow(e); err == nil || !strings.Contains(err.Error(), "lacks columns nickname") {
+		t.Errorf("OnRow with strict_schema = %v, want missing column error", err)
+	}
+}
+
+func TestMinimalUpdates(t *testing.T) {
+	table := &schema.Table{
+		Schema:    "src",
+		Name:      "users",
+		Columns:   []schema.TableColumn{{Name: "id"}, {Name: "name"}, {Name: "email"}, {Name: "note"}},
+		PKColumns: []int{0},
+	}
+	cols := []string{"id", "name", "email", "note"}
+	target := &rowTarget{
+		dbName:        "dst",
+		tableMap:      config.TableMapping{SourceTable: "users", TargetTable: "users"},
+		table:         table,
+		sourceColumns: cols,
+		targetColumns: cols,
+	}
+	h := &MariaDBEventHandler{logger: logrus.New(), minimalUpdates: true}
+
+	tx := &fakeExecer{}
+	oldRow := []interface{}{int64(1), "a", "a@example.com", nil}
+	if err := h.handleUpdate(tx, target, oldRow, []interface{}{int64(1), "b", "a@example.com", ""}); err != nil {
+		t.Fatal(err)
+	}
+	// NULL to '' is a change; the unchanged email and the key are not set
+	if want := []string{"UPDATE `dst`.`users` SET `name` = ?, `note` = ? WHERE `id` = ?"}; !reflect.DeepEqual(tx.queries, want) {
+		t.Errorf("queries = %q, want %q", tx.queries, want)
+	}
+	if want := [][]interface{}{{"b", "", int64(1)}}; !reflect.DeepEqual(tx.args, want) {
+		t.Errorf("args = %v, want %v", tx.args, want)
+	}
+
+	tx = &fakeExecer{}
+	if err := h.handleUpdate(tx, target, oldRow, oldRow); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.queries) != 0 {
+		t.Errorf("update changing nothing ran %q", tx.queries)
+	}
+
+	// Alternating updates of as many different columns keep their prepared statements
+	rec := &recorder{}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+	h.targetDB, h.stmts = db, newStmtCache(db)
+	byName := &canal.RowsEvent{Table: table, Action: canal.UpdateAction, Rows: [][]interface{}{oldRow, {int64(1), "b", "a@example.com", nil}}}
+	byEmail := &canal.RowsEvent{Table: table, Action: canal.UpdateAction, Rows: [][]interface{}{oldRow, {int64(1), "a", "b@example.com", nil}}}
+	for _, e := range []*canal.RowsEvent{byName, byEmail} {
+		if _, err := h.applyRows(target, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	warm := rec.prepares
+	if warm < 2 {
+		t.Fatalf("%d statements prepared for two updates", warm)
+	}
+	for i := 0; i < 3; i++ {
+		for _, e := range []*canal.RowsEvent{byName, byEmail} {
+			if _, err := h.applyRows(target, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if rec.prepares != warm {
+		t.Errorf("prepares grew from %d to %d on alternating updates", warm, rec.prepares)
+	}
+	if want := "UPDATE `dst`.`users` SET `email` = ? WHERE `id` = ? [b@example.com 1]"; rec.stmts[len(rec.stmts)-2] != want {
+		t.Errorf("statements = %q, want %q last", rec.stmts, want)
+	}
+}
+
+func TestUnsignedColumns(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.converters = &converterSet{}
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	table := &schema.Table{
+		Schema: "src",
+		Name:   "users",
+		Columns: []schema.TableColumn{
+			{Name: "id", Type: schema.TYPE_NUMBER, IsUnsigned: true},
+			{Name: "name", Type: schema.TYPE_STRING},
+		},
+		PKColumns: []int{0},
+	}
+
+	// 18446744073709551615 arrives as int64 -1 when no unsigned conversion ran
+	e := &canal.RowsEvent{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(-1), "max"}}}
+	if err := h.OnRow(e); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [18446744073709551615 max]", "COMMIT"}; !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+
+	for _, tt := range []struct {
+		col  schema.TableColumn
+		in   interface{}
+		want interface{}
+	}{
+		{schema.TableColumn{Type: schema.TYPE_NUMBER, IsUnsigned: true}, int8(-1), uint8(255)},
+		{schema.TableColumn{Type: schema.TYPE_NUMBER, IsUnsigned: true}, int16(-2), uint16(65534)},
+		{schema.TableColumn{Type: schema.TYPE_MEDIUM_INT, IsUnsigned: true}, int32(-1), uint32(16777215)},
+		{schema.TableColumn{Type: schema.TYPE_NUMBER, IsUnsigned: true}, int32(-1), uint32(4294967295)},
+		{schema.TableColumn{Type: schema.TYPE_NUMBER, IsUnsigned: true}, uint64(math.MaxUint64), uint64(math.MaxUint64)},
+		{schema.TableColumn{Type: schema.TYPE_NUMBER, IsUnsigned: true}, int64(42), uint64(42)},
+		{schema.TableColumn{Type: schema.TYPE_NUMBER}, int64(-1), int64(-1)},
+	} {
+		got, err := (&converterSet{}).convertValue(&tt.col, tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("convertValue(%+v, %T %v) = %T %v, %v; want %T %v", tt.col, tt.in, tt.in, got, got, err, tt.want, tt.want)
+		}
+	}
+}
+
+func TestDecimalColumns(t *testing.T) {
+	const exact = "12345678901234567890.123456789012345678"
+	var bound []driver.Value
+	capture := func(query string, args []driver.Value) error {
+		if strings.HasPrefix(query, "INSERT") {
+			bound = append(bound, args[1])
+		}
+		return nil
+	}
+	table := &schema.Table{
+		Schema: "src",
+		Name:   "users",
+		Columns: []schema.TableColumn{
+			{Name: "id", Type: schema.TYPE_NUMBER},
+			{Name: "name", Type: schema.TYPE_DECIMAL, RawType: "decimal(38,18)"},
+		},
+		PKColumns: []int{0},
+	}
+
+	// Incremental: canal delivers the binlog decimal as a string
+	rec := &recorder{exec: capture}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.converters = &converterSet{}
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	if err := h.OnRow(&canal.RowsEvent{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), exact}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Initial sync: the source driver returns the decimal as bytes
+	source := sql.OpenDB(&recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		if strings.Contains(query, "KEY_COLUMN_USAGE") {
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}}}, nil
+		}
+		if strings.Contains(query, "information_schema.COLUMNS") {
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}, {"name"}}}, nil
+		}
+		return &staticRows{columns: []string{"id", "name"}, values: [][]driver.Value{{int64(2), []byte(exact)}}}, nil
+	}})
+	defer source.Close()
+	s := &MariaDBSyncer{logger: logrus.New()}
+	mapping := config.DatabaseMapping{SourceDatabase: "src", TargetDatabase: "dst"}
+	if _, err := s.copyTable(context.Background(), source, &destination{db: h.targetDB}, table, mapping, target.tableMap, 10, nil, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bound) != 2 {
+		t.Fatalf("bound decimals = %#v, want one per insert", bound)
+	}
+	for i, v := range bound {
+		if str, ok := v.(string); !ok || str != exact {
+			t.Errorf("insert %d bound %T %v, want string %s", i, v, v, exact)
+		}
+	}
+
+	for _, tt := range []struct {
+		rawType string
+		in      interface{}
+		want    interface{}
+	}{
+		{"decimal(10,2)", 1234.5, "1234.50"},
+		{"decimal(20,0)", float64(1e19), "10000000000000000000"},
+		{"decimal(10,2) unsigned", []byte("0.10"), "0.10"},
+	} {
+		col := schema.TableColumn{Type: schema.TYPE_DECIMAL, RawType: tt.rawType}
+		got, err := (&converterSet{}).convertValue(&col, tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("convertValue(%s, %T %v) = %T %v, %v; want %v", tt.rawType, tt.in, tt.in, got, got, err, tt.want)
+		}
+	}
+}
+
+func TestLagAlarm(t *testing.T) {
+	var nilTracker *lagTracker
+	nilTracker.observe(&replication.EventHeader{Timestamp: 1})
+	if lag := nilTracker.current(time.Now()); lag != 0 {
+		t.Errorf("nil tracker lag = %v, want 0", lag)
+	}
+
+	s := &MariaDBSyncer{logger: logrus.New()}
+	if lag := s.Status().Lag; lag != 0 {
+		t.Errorf("lag before the first event = %v, want 0", lag)
+	}
+	s.lag.observe(&replication.EventHeader{Timestamp: uint32(time.Now().Add(-10 * time.Second).Unix())})
+	if lag := s.Status().Lag; lag < 9*time.Second || lag > 12*time.Second {
+		t.Errorf("lag of a 10s old event = %v", lag)
+	}
+	// Without newer events the lag keeps growing
+	if lag := s.lag.current(time.Now().Add(time.Minute)); lag < 69*time.Second {
+		t.Errorf("lag a minute later = %v, want above 69s", lag)
+	}
+
+	var fired []time.Duration
+	alarm := &lagAlarm{threshold: time.Second, callbacks: []func(time.Duration){func(lag time.Duration) {
+		fired = append(fired, lag)
+	}}, logger: logrus.New()}
+	t0 := time.Now()
+	at := func(offset, lag time.Duration) { alarm.check(t0.Add(offset), lag) }
+	at(0, 2*time.Second)
+	at(4*time.Second, 3*time.Second)
+	if len(fired) != 0 {
+		t.Fatalf("fired %v before the lag stayed above max_lag for %v", fired, lagDebounce)
+	}
+	at(5*time.Second, 4*time.Second)
+	at(6*time.Second, 500*time.Millisecond)
+	at(8*time.Second, 2*time.Second) // back above: the recovery starts over
+	at(9*time.Second, 500*time.Millisecond)
+	at(13*time.Second, 400*time.Millisecond)
+	at(14*time.Second, 300*time.Millisecond)
+	at(20*time.Second, 200*time.Millisecond)
+	if want := []time.Duration{4 * time.Second, 300 * time.Millisecond}; !reflect.DeepEqual(fired, want) {
+		t.Errorf("fired %v, want %v", fired, want)
+	}
+}
+
+func TestCutover(t *testing.T) {
+	watch := &cutoverWatch{threshold: time.Second, hold: 10 * time.Second, logger: logrus.New()}
+	t0 := time.Now()
+	steps := []struct {
+		offset, lag time.Duration
+		ready       bool
+	}{
+		{0, 500 * time.Millisecond, false},
+		{8 * time.Second, 900 * time.Millisecond, false},
+		{9 * time.Second, 2 * time.Second, false}, // back above: the hold starts over
+		{10 * time.Second, time.Second, false},
+		{19 * time.Second, 100 * time.Millisecond, false},
+		{20 * time.Second, 100 * time.Millisecond, true},
+	}
+	for _, step := range steps {
+		if ready := watch.check(t0.Add(step.offset), step.lag); ready != step.ready {
+			t.Errorf("at %v with lag %v ready = %v, want %v", step.offset, step.lag, ready, step.ready)
+		}
+	}
+
+	s := NewMariaDBSyncer(config.SyncConfig{}, logrus.New())
+	ready := s.ReadyToCutover()
+	select {
+	case <-ready:
+		t.Fatal("ReadyToCutover closed before the lag was checked")
+	default:
+	}
+	s.cutover.markReady()
+	s.cutover.markReady()
+	select {
+	case <-s.ReadyToCutover():
+	default:
+		t.Fatal("ReadyToCutover still open once ready")
+	}
+	if _, err := s.Cutover(context.Background()); err == nil {
+		t.Error("Cutover succeeded without a running sync")
+	}
+
+	// The syncer pauses at the first synced position at or after the cutover position
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	h.pause, h.cutover = &s.pause, &s.cutover
+	synced := func(pos uint32) {
+		t.Helper()
+		if err := h.OnPosSynced(nil, mysql.Position{Name: "bin.000001", Pos: pos}, nil, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	synced(100)
+	stopped, err := s.cutover.stopAtPosition(mysql.Position{Name: "bin.000001", Pos: 150}, &s.pause)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.cutover.stopAtPosition(mysql.Position{Name: "bin.000001", Pos: 150}, &s.pause); err == nil {
+		t.Error("a second cutover was accepted while one waits")
+	}
+	synced(120)
+	if s.pause.paused() {
+		t.Fatal("paused before reaching the cutover position")
+	}
+	synced(200)
+	if pos := <-stopped; pos.Pos != 200 {
+		t.Errorf("paused at %v, want 200", pos)
+	}
+	if !s.pause.paused() {
+		t.Fatal("not paused at the cutover position")
+	}
+	applied := make(chan error, 1)
+	go func() {
+		applied <- h.OnRow(&canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}})
+	}()
+	select {
+	case err := <-applied:
+		t.Fatalf("OnRow returned after the cutover: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.Resume()
+	if err := <-applied; err != nil {
+		t.Fatal(err)
+	}
+
+	// A target already at the source position pauses at once
+	stopped, err = s.cutover.stopAtPosition(mysql.Position{Name: "bin.000001", Pos: 180}, &s.pause)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := <-stopped; pos.Pos != 200 || !s.pause.paused() {
+		t.Errorf("paused = %v at %v, want a pause at 200", s.pause.paused(), pos)
+	}
+	s.Resume()
+
+	// An abandoned cutover no longer pauses
+	stopped, _ = s.cutover.stopAtPosition(mysql.Position{Name: "bin.000002", Pos: 4}, &s.pause)
+	s.cutover.cancelStop(stopped)
+	synced(300)
+	if s.pause.paused() {
+		t.Error("an abandoned cutover paused the syncer")
+	}
+
+	for _, cfg := range []config.SyncConfig{{CutoverLag: -time.Second}, {CutoverHold: -time.Second}} {
+		if errs := ValidateConfig(cfg); !strings.Contains(fmt.Sprint(errs), "cutover_") {
+			t.Errorf("ValidateConfig(%+v) = %v, want a cutover error", cfg, errs)
+		}
+	}
+}
+
+func TestCreateTargetDatabases(t *testing.T) {
+	rec := &recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		if len(args) == 1 && args[0] == "existing" {
+			return &staticRows{columns: []string{"SCHEMA_NAME"}, values: [][]driver.Value{{"existing"}}}, nil
+		}
+		return &staticRows{columns: []string{"SCHEMA_NAME"}}, nil
+	}}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+	mappings := []config.DatabaseMapping{
+		{SourceDatabase: "a", TargetDatabase: "existing"},
+		{SourceDatabase: "b", TargetDatabase: "newdb"},
+		{SourceDatabase: "c", TargetDatabase: "newdb"},
+	}
+
+	s := NewMariaDBSyncer(config.SyncConfig{}, logrus.New())
+	if err := s.createTargetDatabases(context.Background(), db, mappings); err != nil || len(rec.stmts) != 0 {
+		t.Fatalf("without auto_create_target: err %v, statements %q", err, rec.stmts)
+	}
+
+	s = NewMariaDBSyncer(config.SyncConfig{AutoCreateTarget: true, TargetCharset: "utf8mb4", TargetCollation: "utf8mb4_bin"}, logrus.New())
+	if err := s.checkTargetCharset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.createTargetDatabases(context.Background(), db, mappings); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"CREATE DATABASE IF NOT EXISTS `newdb` CHARACTER SET utf8mb4 COLLATE utf8mb4_bin []"}; !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+
+	rec.exec = func(string, []driver.Value) error {
+		return &mysqldriver.MySQLError{Number: erDBAccessDenied, Message: "Access denied for user"}
+	}
+	err := s.createTargetDatabases(context.Background(), db, mappings)
+	if err == nil || !strings.Contains(err.Error(), "CREATE privilege") {
+		t.Errorf("error without the CREATE privilege = %v", err)
+	}
+
+	for _, cfg := range []config.SyncConfig{
+		{AutoCreateTarget: true, TargetCharset: "utf8mb4; DROP DATABASE x"},
+		{TargetCollation: "utf8mb4_bin"},
+	} {
+		if err := NewMariaDBSyncer(cfg, logrus.New()).checkTargetCharset(); err == nil {
+			t.Errorf("checkTargetCharset accepted %+v", cfg)
+		}
+	}
+}
+
+func TestTargetDatabasePrefix(t *testing.T) {
+	mappings := []config.DatabaseMapping{
+		{SourceDatabase: "shop", Tables: []config.TableMapping{{SourceTable: "orders", TargetTable: "orders"}}},
+		{SourceDatabase: "crm", TargetDatabase: "customers", Tables: []config.TableMapping{{SourceTable: "users", TargetTable: "users"}}},
+	}
+	s := NewMariaDBSyncer(config.SyncConfig{Mappings: mappings, TargetDatabasePrefix: "mirror_", AutoCreateTarget: true}, logrus.New())
+	var targets []string
+	for _, mapping := range s.cfg.Mappings {
+		targets = append(targets, mapping.TargetDatabase)
+	}
+	if want := []string{"mirror_shop", "mirror_customers"}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("target databases = %q, want %q", targets, want)
+	}
+	if mappings[0].TargetDatabase != "" {
+		t.Errorf("prefixing changed the configured mappings: %+v", mappings[0])
+	}
+
+	// Databases are created under their prefixed names
+	rec := &recorder{query: func(string, []driver.Value) (driver.Rows, error) {
+		return &staticRows{columns: []string{"SCHEMA_NAME"}}, nil
+	}}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+	if err := s.createTargetDatabases(context.Background(), db, s.cfg.Mappings); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"CREATE DATABASE IF NOT EXISTS `mirror_shop` []", "CREATE DATABASE IF NOT EXISTS `mirror_customers` []"}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+
+	long := config.SyncConfig{Mappings: mappings, TargetDatabasePrefix: strings.Repeat("x", 60)}
+	if problems := ValidateConfig(long); len(problems) == 0 || !strings.Contains(errors.Join(problems...).Error(), "longer than 64") {
+		t.Errorf("ValidateConfig of a prefix exceeding the name limit = %v", problems)
+	}
+}
+
+func TestResetAutoIncrement(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		column []driver.Value // auto-increment column row, nil without one
+		max    driver.Value
+		want   []string
+	}{
+		{name: "copied rows", column: []driver.Value{"id"}, max: "18446744073709551614",
+			want: []string{"ALTER TABLE `dst`.`users` AUTO_INCREMENT = 18446744073709551615 []"}},
+		{name: "no auto-increment column"},
+		{name: "empty table", column: []driver.Value{"id"}, max: nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := &recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+				if strings.Contains(query, "information_schema.COLUMNS") {
+					rows := &staticRows{columns: []string{"COLUMN_NAME"}}
+					if tc.column != nil {
+						rows.values = [][]driver.Value{tc.column}
+					}
+					return rows, nil
+				}
+				if want := "SELECT MAX(`id`) FROM `dst`.`users`"; query != want {
+					return nil, fmt.Errorf("query %q, want %q", query, want)
+				}
+				return &staticRows{columns: []string{"MAX(id)"}, values: [][]driver.Value{{tc.max}}}, nil
+			}}
+			db := sql.OpenDB(rec)
+			defer db.Close()
+			s := NewMariaDBSyncer(config.SyncConfig{ResetAutoIncrement: true}, logrus.New())
+			if err := s.resetAutoIncrement(context.Background(), db, "dst", "users"); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rec.stmts, tc.want) {
+				t.Errorf("statements = %q, want %q", rec.stmts, tc.want)
+			}
+		})
+	}
+}
+
+func TestDeferLargeColumns(t *testing.T) {
+	var selects []string
+	source := sql.OpenDB(&recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		switch {
+		case strings.Contains(query, "KEY_COLUMN_USAGE"):
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}}}, nil
+		case strings.Contains(query, "CHARACTER_OCTET_LENGTH"):
+			if want := []driver.Value{"src", "docs", int64(defaultLargeColumnThreshold)}; !reflect.DeepEqual(args, want) {
+				return nil, fmt.Errorf("large columns looked up with %v, want %v", args, want)
+			}
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"body"}, {"raw"}}}, nil
+		case strings.Contains(query, "information_schema.COLUMNS"):
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}, {"title"}, {"body"}, {"raw"}}}, nil
+		}
+		selects = append(selects, query)
+		if strings.Contains(query, "`body`") {
+			return &staticRows{columns: []string{"body", "id"}, values: [][]driver.Value{{"long text", int64(1)}, {nil, int64(2)}}}, nil
+		}
+		return &staticRows{columns: []string{"id", "title"}, values: [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}}}, nil
+	}})
+	defer source.Close()
+	rec := &recorder{}
+	target := sql.OpenDB(rec)
+	defer target.Close()
+
+	s := &MariaDBSyncer{cfg: config.SyncConfig{DeferLargeColumns: true}, logger: logrus.New()}
+	mapping := config.DatabaseMapping{SourceDatabase: "src", TargetDatabase: "dst"}
+	// raw is excluded, so it is neither copied nor deferred
+	tableMap := config.TableMapping{SourceTable: "docs", TargetTable: "docs", ExcludeColumns: []string{"raw"}}
+	if _, err := s.copyTable(context.Background(), source, &destination{db: target}, nil, mapping, tableMap, 10, nil, true); err != nil {
+		t.Fatal(err)
+	}
+
+	wantSelects := []string{
+		"SELECT `id`,`title` FROM `src`.`docs`",
+		"SELECT `body`,`id` FROM `src`.`docs`",
+	}
+	if !reflect.DeepEqual(selects, wantSelects) {
+		t.Errorf("selects = %q, want %q", selects, wantSelects)
+	}
+	want := []string{
+		"INSERT INTO `dst`.`docs` (`id`, `title`) VALUES (?,?), (?,?) [1 a 2 b]",
+		"UPDATE `dst`.`docs` SET `body` = ? WHERE `id` = ? [long text 1]",
+		"UPDATE `dst`.`docs` SET `body` = ? WHERE `id` = ? [<nil> 2]",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements =\n%q\nwant\n%q", rec.stmts, want)
+	}
+
+	s.cfg.LargeColumnThreshold = -1
+	if _, err := s.largeColumnThreshold(); err == nil {
+		t.Error("expected error for a negative large_column_threshold")
+	}
+}
+
+func TestInitialSyncHooks(t *testing.T) {
+	source := sql.OpenDB(&recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		switch {
+		case strings.Contains(query, "TABLE_ROWS"):
+			return &staticRows{columns: []string{"TABLE_ROWS"}, values: [][]driver.Value{{int64(3)}}}, nil
+		case strings.Contains(query, "KEY_COLUMN_USAGE"):
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}}}, nil
+		case strings.Contains(query, "information_schema.COLUMNS"):
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}, {"name"}}}, nil
+		}
+		return &staticRows{columns: []string{"id", "name"}, values: [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}}}, nil
+	}})
+	defer source.Close()
+	target := sql.OpenDB(&recorder{})
+	defer target.Close()
+
+	s := NewMariaDBSyncer(config.SyncConfig{}, logrus.New())
+	var events []string
+	s.OnInitialSyncStart(func(table string) { events = append(events, "start "+table) })
+	s.OnInitialSyncProgress(func(table string, copied, total int64) {
+		events = append(events, fmt.Sprintf("progress %s %d/%d", table, copied, total))
+	})
+	s.OnInitialSyncComplete(func(table string) { events = append(events, "complete "+table) })
+	mapping := config.DatabaseMapping{SourceDatabase: "src", TargetDatabase: "dst"}
+	tableMap := config.TableMapping{SourceTable: "users", TargetTable: "users"}
+	if _, err := s.copyTable(context.Background(), source, &destination{db: target}, nil, mapping, tableMap, 1, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start src.users", "progress src.users 1/3", "progress src.users 2/3", "complete src.users"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+
+	done := s.InitialSyncDone()
+	s.initialSync.failures.Add(1)
+	s.initialSync.finish(context.Background())
+	select {
+	case <-done:
+		t.Fatal("InitialSyncDone closed although a table failed")
+	default:
+	}
+	s.initialSync.failures.Store(0)
+	s.initialSync.finish(context.Background())
+	s.initialSync.finish(context.Background())
+	select {
+	case <-done:
+	default:
+		t.Fatal("InitialSyncDone not closed after the initial sync")
+	}
+}
+
+func TestTimezoneConversion(t *testing.T) {
+	s := NewMariaDBSyncer(config.SyncConfig{SourceTimezone: "UTC", TargetTimezone: "Asia/Tokyo"}, logrus.New())
+	source, target, err := s.timezones()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &converterSet{srcLoc: source, loc: target}
+	instant := time.Date(2024, 1, 2, 3, 4, 5, 500000000, time.UTC)
+
+	for _, tt := range []struct {
+		name string
+		typ  int
+		in   interface{}
+	}{
+		{"binlog timestamp", schema.TYPE_TIMESTAMP, "2024-01-02 03:04:05.500000"},
+		{"binlog datetime", schema.TYPE_DATETIME, "2024-01-02 03:04:05.5"},
+		{"initial sync bytes", schema.TYPE_TIMESTAMP, []byte("2024-01-02 03:04:05.5")},
+		// parseTime in an +09:00 DSN location still reads the UTC wall clock of the source
+		{"initial sync time", schema.TYPE_DATETIME, time.Date(2024, 1, 2, 3, 4, 5, 500000000, time.FixedZone("", 9*3600))},
+	} {
+		got, err := c.convertValue(&schema.TableColumn{Type: tt.typ}, tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The target session runs in +09:00 and reads the text back in it
+		stored, err := time.ParseInLocation(datetimeLayout, got.(string), target)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !stored.Equal(instant) {
+			t.Errorf("%s: wrote %v, stored instant %v, want %v", tt.name, got, stored.UTC(), instant)
+		}
+	}
+	if got, _ := c.convertValue(&schema.TableColumn{Type: schema.TYPE_DATETIME}, "0000-00-00 00:00:00"); got != "0000-00-00 00:00:00" {
+		t.Errorf("zero date written as %v", got)
+	}
+
+	for _, cfg := range []config.SyncConfig{
+		{SourceTimezone: "UTC"},
+		{SourceTimezone: "Nowhere/Else", TargetTimezone: "UTC"},
+	} {
+		if _, _, err := NewMariaDBSyncer(cfg, logrus.New()).timezones(); err == nil {
+			t.Errorf("timezones accepted %+v", cfg)
+		}
+	}
+}
+
+func TestCopySourceTagToExtraTarget(t *testing.T) {
+	source := sql.OpenDB(&recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		switch {
+		case strings.Contains(query, "KEY_COLUMN_USAGE"):
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}}}, nil
+		case strings.Contains(query, "information_schema.COLUMNS"):
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}, {"name"}}}, nil
+		}
+		return &staticRows{columns: []string{"id", "name"}, values: [][]driver.Value{{int64(1), "a"}}}, nil
+	}})
+	defer source.Close()
+	rec := &recorder{}
+	target := sql.OpenDB(rec)
+	defer target.Close()
+
+	// Rows copied to an extra target are tagged like its incremental writes, by source table
+	s := NewMariaDBSyncer(config.SyncConfig{}, logrus.New())
+	var started []string
+	s.OnInitialSyncStart(func(table string) { started = append(started, table) })
+	mapping := config.DatabaseMapping{SourceDatabase: "src", TargetDatabase: "archive"}
+	tableMap := config.TableMapping{SourceTable: "users", TargetTable: "members", SourceTag: "origin"}
+	if _, err := s.copyTable(context.Background(), source, &destination{name: "replica", db: target}, nil, mapping, tableMap, 10, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"INSERT INTO `archive`.`members` (`id`, `name`, `origin`) VALUES (?,?,?) [1 a src.users]"}; !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+	if want := []string{"src.users -> replica/archive.members"}; !reflect.DeepEqual(started, want) {
+		t.Errorf("started = %q, want %q", started, want)
+	}
+}
+
+func TestResyncTable(t *testing.T) {
+	s := &MariaDBSyncer{logger: logrus.New()}
+	if err := s.ResyncTable(context.Background(), "src", "users"); err == nil {
+		t.Error("expected error resyncing on a syncer that is not running")
+	}
+
+	// Events of a table being re-copied are held back
+	rec := &recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		// The truncated target is empty
+		return &staticRows{columns: []string{"COUNT(1)"}, values: [][]driver.Value{{int64(0)}}}, nil
+	}}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	h.tables = &s.tables
+	s.tables.setResyncing(map[string]bool{"src.users": true})
+	insert := &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}}
+	if err := h.OnRow(insert); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.stmts) != 0 {
+		t.Errorf("statements while re-copying = %q, want none", rec.stmts)
+	}
+	s.tables.setResyncing(nil)
+
+	// A stand-in for the sync loop records the requests; the copy fails as the source is unreachable
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.cfg.Mappings = h.mappings
+	s.sourceDSN = "root@tcp(127.0.0.1:1)/"
+	live := &liveSync{ctx: ctx, targetDB: h.targetDB, mode: config.ModeFullIncremental, reloads: make(chan *reloadRequest)}
+	s.live = live
+	var reqs []*reloadRequest
+	go func() {
+		for req := range live.reloads {
+			req.resumedAt = mysql.Position{Name: "mysql-bin.000004", Pos: 120}
+			reqs = append(reqs, req)
+			req.done <- nil
+		}
+	}()
+	if err := s.ResyncTable(context.Background(), "src", "orders"); err == nil {
+		t.Error("expected error resyncing a table that is not mapped")
+	}
+	err := s.ResyncTable(context.Background(), "src", "users")
+	close(live.reloads)
+	if err == nil || !strings.Contains(err.Error(), "re-copy of src.users failed") {
+		t.Fatalf("error = %v, want the failed re-copy", err)
+	}
+	if want := []string{"TRUNCATE TABLE `dst`.`users` []"}; !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+	if len(reqs) != 2 {
+		t.Fatalf("sync loop got %d requests, want 2", len(reqs))
+	}
+	if hold := reqs[0]; !hold.resync["src.users"] || hold.startPos != nil || hold.catchUp != nil {
+		t.Errorf("hold request = resync %v, start %v, catch-up %v", hold.resync, hold.startPos, hold.catchUp)
+	}
+	resume := reqs[1]
+	if resume.resync != nil || !resume.catchUp["src.users"] || resume.startPos == nil || *resume.startPos != reqs[0].resumedAt {
+		t.Errorf("resume request = resync %v, start %v, catch-up %v", resume.resync, resume.startPos, resume.catchUp)
+	}
+
+	// Events read again from the hold may already be in the copy: the insert is upserted and
+	// the delete of a row the copy no longer has passes strict_apply
+	rec.stmts = nil
+	rec.noRows = true
+	s.applyReload(h, resume)
+	h.strictApply = true
+	h.binlogFile, h.lastApplied = "mysql-bin.000004", mysql.Position{Name: "mysql-bin.000004", Pos: 900}
+	for _, e := range []*canal.RowsEvent{
+		{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}, Header: &replication.EventHeader{LogPos: 200}},
+		{Table: target.table, Action: canal.DeleteAction, Rows: [][]interface{}{{int64(2), "b"}}, Header: &replication.EventHeader{LogPos: 300}},
+	} {
+		if err := h.OnRow(e); err != nil {
+			t.Fatalf("replayed %s: %v", e.Action, err)
+		}
+	}
+	replayed := []string{
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`) [1 a]",
+		"COMMIT",
+		"DELETE FROM `dst`.`users` WHERE `id` = ? [2]",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, replayed) {
+		t.Errorf("replayed statements = %q, want %q", rec.stmts, replayed)
+	}
+
+	// A merged target keeps the rows of its other sources
+	rec.stmts = nil
+	tagged := []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	tagged[0].Tables[0].SourceTag = "origin"
+	if _, err := s.recopyTable(context.Background(), live, tagged); err == nil {
+		t.Error("expected the re-copy from an unreachable source to fail")
+	}
+	if want := []string{"DELETE FROM `dst`.`users` WHERE `origin` = ? [src.users]"}; !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+
+	store, err := loadCheckpointStore(filepath.Join(t.TempDir(), "initial_sync"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"src.users", "src.users -> replica/dst.users", "src.users_archive"} {
+		if err := store.set(key, tableCheckpoint{Done: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.reset("src.users"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.get("src.users -> replica/dst.users"); ok {
+		t.Error("checkpoint of the extra target kept after reset")
+	}
+	if _, ok := store.get("src.users_archive"); !ok {
+		t.Error("checkpoint of another table dropped by reset")
+	}
+}
+
+// savedPositions records the positions saved to it
+type savedPositions []binlogPosition
+
+func (p *savedPositions) load(context.Context) (*binlogPosition, error) { return nil, nil }
+
+func (p *savedPositions) save(_ context.Context, pos binlogPosition) error {
+	*p = append(*p, pos)
+	return nil
+}
+
+func TestResyncHoldsSaves(t *testing.T) {
+	h, _, done := newUsersTarget(&recorder{}, false)
+	defer done()
+	saved := &savedPositions{}
+	s := &MariaDBSyncer{logger: logrus.New(), positions: saved}
+	h.savePosition = s.saveSyncedPosition
+	cfg := canal.NewDefaultConfig()
+	// Canal cannot be recreated without a source, after the request was applied
+	cfg.Addr = "127.0.0.1:1"
+	held := mysql.Position{Name: "mysql-bin.000004", Pos: 120}
+	h.applied.set(held, nil)
+	if _, _, _, err := s.restartForReload(h, nil, cfg, &reloadRequest{resync: map[string]bool{"src.users": true}}); err == nil {
+		t.Fatal("expected canal to fail without a source")
+	}
+
+	// Positions past the held-back events are not saved during the copy, by OnPosSynced, the
+	// ticker or the final save
+	h.saveThrottle = 0
+	if err := h.OnPosSynced(nil, mysql.Position{Name: "mysql-bin.000004", Pos: 900}, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.savePosition(h); err != nil {
+		t.Fatal(err)
+	}
+	if want := (savedPositions{{Position: held}}); !reflect.DeepEqual(*saved, want) {
+		t.Errorf("saved during the copy = %v, want %v", *saved, want)
+	}
+
+	// Resuming saves the position the held-back events are read again from
+	*saved = nil
+	if _, _, _, err := s.restartForReload(h, nil, cfg, &reloadRequest{startPos: &held, catchUp: map[string]bool{"src.users": true}}); err == nil {
+		t.Fatal("expected canal to fail without a source")
+	}
+	next := mysql.Position{Name: "mysql-bin.000004", Pos: 1000}
+	if err := h.OnPosSynced(nil, next, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if want := (savedPositions{{Position: held}, {Position: next}}); !reflect.DeepEqual(*saved, want) {
+		t.Errorf("saved after resuming = %v, want %v", *saved, want)
+	}
+}
+
+// affectedExecer reports every statement as affecting the same number of rows
+type affectedExecer int64
+
+func (n affectedExecer) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return driver.RowsAffected(n), nil
+}
+
+func TestAllowNoPrimaryKey(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	target.table.PKColumns = nil
+	target.table.Columns = append(target.table.Columns, schema.TableColumn{Name: "meta", Type: schema.TYPE_JSON})
+	target.sourceColumns = append(target.sourceColumns, "meta")
+	target.targetColumns = append(target.targetColumns, "meta")
+	update := &canal.RowsEvent{Table: target.table, Action: canal.UpdateAction, Rows: [][]interface{}{
+		{int64(1), nil, "{}"}, {int64(1), "b", "{}"},
+	}}
+	del := &canal.RowsEvent{Table: target.table, Action: canal.DeleteAction, Rows: [][]interface{}{{int64(1), "b", "{}"}}}
+
+	// Without the option the events are dropped
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	for _, e := range []*canal.RowsEvent{update, del} {
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(rec.stmts) != 0 {
+		t.Fatalf("statements without allow_no_primary_key = %q, want none", rec.stmts)
+	}
+
+	h.allowNoPrimaryKey = true
+	for _, e := range []*canal.RowsEvent{update, del} {
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// With key_columns only they are matched
+	h.mappings[0].Tables[0].KeyColumns = []string{"id"}
+	if err := h.OnRow(del); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"UPDATE `dst`.`users` SET `id` = ?, `name` = ?, `meta` = ? WHERE `id` <=> ? AND `name` <=> ? [1 b {} 1 <nil>]",
+		"COMMIT",
+		"DELETE FROM `dst`.`users` WHERE `id` <=> ? AND `name` <=> ? LIMIT 1 [1 b]",
+		"COMMIT",
+		"DELETE FROM `dst`.`users` WHERE `id` <=> ? LIMIT 1 [1]",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements =\n%q\nwant\n%q", rec.stmts, want)
+	}
+	// A delete limited to one row cannot remove more
+	if err := h.handleDelete(affectedExecer(2), target, []interface{}{int64(1), "b", "{}"}); err == nil {
+		t.Error("expected error for a delete without a primary key affecting 2 rows")
+	}
+
+	h.mappings[0].Tables[0].KeyColumns = []string{"missing"}
+	if err := h.OnRow(del); err == nil {
+		t.Error("expected error for a key column the table does not have")
+	}
+
+	// Validation accepts the table and checks its key columns
+	db := sql.OpenDB(&recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		if strings.Contains(query, "KEY_COLUMN_USAGE") {
+			return &staticRows{columns: []string{"COLUMN_NAME"}}, nil
+		}
+		count := int64(1)
+		if strings.Contains(query, "COLUMN_NAME = ?") && args[2] == "missing" {
+			count = 0
+		}
+		return &staticRows{columns: []string{"COUNT(*)"}, values: [][]driver.Value{{count}}}, nil
+	}})
+	defer db.Close()
+	mappings := []config.DatabaseMapping{{SourceDatabase: "src", Tables: []config.TableMapping{{SourceTable: "logs", KeyColumns: []string{"id"}}}}}
+	if err := checkMappings(context.Background(), db, mappings, true, false); err != nil {
+		t.Errorf("checkMappings with allow_no_primary_key: %v", err)
+	}
+	mappings[0].Tables[0].KeyColumns = []string{"missing"}
+	if err := checkMappings(context.Background(), db, mappings, true, false); err == nil || !strings.Contains(err.Error(), "key column missing of src.logs does not exist") {
+		t.Errorf("checkMappings error = %v, want the missing key column", err)
+	}
+}
+
+func TestDBPositionStore(t *testing.T) {
+	var saved string
+	rec := &recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		if !strings.HasPrefix(query, "SELECT `position` FROM `ops`.`sync_state`") || len(args) != 1 || args[0] != "orders" {
+			return nil, fmt.Errorf("unexpected query %s %v", query, args)
+		}
+		rows := &staticRows{columns: []string{"position"}}
+		if saved != "" {
+			rows.values = [][]driver.Value{{saved}}
+		}
+		return rows, nil
+	}}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+	ctx := context.Background()
+
+	s := NewMariaDBSyncer(config.SyncConfig{PositionStore: "db", PositionTable: "ops.sync_state", PositionKey: "orders"}, logrus.New())
+	store, err := s.openPositionStore(ctx, db, "db1:3306")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.stmts) != 1 || !strings.HasPrefix(rec.stmts[0], "CREATE TABLE IF NOT EXISTS `ops`.`sync_state`") {
+		t.Fatalf("statements = %q, want the position table created", rec.stmts)
+	}
+	if got, err := store.load(ctx); err != nil || got != nil {
+		t.Fatalf("load without a row = %v, %v; want nil", got, err)
+	}
+
+	pos := binlogPosition{Position: mysql.Position{Name: "mysql-bin.000007", Pos: 4096}, GTIDSet: "0-1-42"}
+	if err := store.save(ctx, pos); err != nil {
+		t.Fatal(err)
+	}
+	want := "INSERT INTO `ops`.`sync_state` (`sync_key`, `position`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `position` = VALUES(`position`) " +
+		`[orders {"Name":"mysql-bin.000007","Pos":4096,"GTIDSet":"0-1-42"}]`
+	if rec.stmts[1] != want {
+		t.Errorf("save = %q, want %q", rec.stmts[1], want)
+	}
+	saved = `{"Name":"mysql-bin.000007","Pos":4096,"GTIDSet":"0-1-42"}`
+	if got, err := store.load(ctx); err != nil || got == nil || *got != pos {
+		t.Errorf("load = %v, %v; want %v", got, err, pos)
+	}
+
+	saved = "{"
+	if _, err := store.load(ctx); err == nil {
+		t.Error("load accepted a corrupt position row")
+	}
+
+	// The key defaults to the source address
+	s = NewMariaDBSyncer(config.SyncConfig{PositionStore: "db", PositionTable: "ops.sync_state"}, logrus.New())
+	if store, err := s.openPositionStore(ctx, db, "db1:3306"); err != nil || store.(*dbPositionStore).key != "db1:3306" {
+		t.Errorf("default key: store %v, err %v", store, err)
+	}
+
+	for _, cfg := range []config.SyncConfig{
+		{PositionStore: "etcd"},
+		{PositionStore: "db", PositionTable: "sync_state"},
+		{PositionTable: "ops.sync_state", MySQLPositionPath: "/tmp/pos"},
+	} {
+		if _, err := NewMariaDBSyncer(cfg, logrus.New()).openPositionStore(ctx, db, "db1:3306"); err == nil {
+			t.Errorf("openPositionStore accepted %+v", cfg)
+		}
+	}
+}
+
+func TestDumpExecutionPath(t *testing.T) {
+	dump := filepath.Join(t.TempDir(), "mysqldump")
+	if err := os.WriteFile(dump, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "mysqldump")
+
+	for _, tc := range []struct {
+		cfg     config.SyncConfig
+		mode    string
+		want    string
+		wantErr bool
+	}{
+		{cfg: config.SyncConfig{}, mode: config.ModeFullIncremental, want: ""},
+		{cfg: config.SyncConfig{DumpExecutionPath: dump}, mode: config.ModeIncremental, want: dump},
+		{cfg: config.SyncConfig{DumpExecutionPath: missing}, mode: config.ModeIncremental, wantErr: true},
+		// Unset, full+incremental mode leaves the copy to the initial sync
+		{cfg: config.SyncConfig{DumpExecutionPath: dump}, mode: config.ModeFullIncremental, want: ""},
+		{cfg: config.SyncConfig{DumpExecutionPath: missing}, mode: config.ModeFullIncremental, want: ""},
+		{cfg: config.SyncConfig{DumpExecutionPath: missing}, mode: config.ModeFull, want: ""},
+		{cfg: config.SyncConfig{DumpExecutionPath: missing, DisableCanalDump: true}, mode: config.ModeFullIncremental, want: ""},
+		{cfg: config.SyncConfig{DumpExecutionPath: missing, InitialSyncMethod: "copy"}, mode: config.ModeFullIncremental, want: ""},
+		{cfg: config.SyncConfig{DumpExecutionPath: dump, InitialSyncMethod: "canal_dump"}, mode: config.ModeFullIncremental, want: dump},
+	} {
+		got, err := NewMariaDBSyncer(tc.cfg, logrus.New()).dumpExecutionPath(tc.mode)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("dumpExecutionPath(%+v, %s) = %q, %v; want %q, error %v", tc.cfg, tc.mode, got, err, tc.want, tc.wantErr)
+		}
+	}
+
+	for _, tc := range []struct {
+		cfg     config.SyncConfig
+		mode    string
+		wantErr bool
+	}{
+		{cfg: config.SyncConfig{}, mode: config.ModeFullIncremental},
+		{cfg: config.SyncConfig{InitialSyncMethod: "copy"}, mode: config.ModeFull},
+		{cfg: config.SyncConfig{InitialSyncMethod: "canal_dump", DumpExecutionPath: dump}, mode: config.ModeIncremental},
+		{cfg: config.SyncConfig{InitialSyncMethod: "canal_dump"}, mode: config.ModeFullIncremental, wantErr: true},
+		{cfg: config.SyncConfig{InitialSyncMethod: "canal_dump", DumpExecutionPath: dump}, mode: config.ModeFull, wantErr: true},
+		{cfg: config.SyncConfig{InitialSyncMethod: "canal_dump", DumpExecutionPath: dump, DisableCanalDump: true}, mode: config.ModeFullIncremental, wantErr: true},
+		{cfg: config.SyncConfig{InitialSyncMethod: "mysqldump"}, mode: config.ModeFullIncremental, wantErr: true},
+	} {
+		if _, err := NewMariaDBSyncer(tc.cfg, logrus.New()).initialSyncMethod(tc.mode); (err != nil) != tc.wantErr {
+			t.Errorf("initialSyncMethod(%+v, %s) = %v, want error %v", tc.cfg, tc.mode, err, tc.wantErr)
+		}
+	}
+	if got, _ := NewMariaDBSyncer(config.SyncConfig{DumpExecutionPath: dump}, logrus.New()).initialSyncMethod(config.ModeFullIncremental); got != initialSyncMethodCopy {
+		t.Errorf("unset initial_sync_method in %s mode = %q, want %s", config.ModeFullIncremental, got, initialSyncMethodCopy)
+	}
+}
+
+func TestCanalDumpLogging(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	logger.ExitFunc = func(int) { t.Fatal("canal's Fatal exited the process") }
+	canalLog := newCanalLogger(logger)
+	canalLog.Fatalf("dump %s failed", "x")
+	if e := hook.LastEntry(); e == nil || e.Level != logrus.ErrorLevel || e.Message != "dump x failed" || e.Data["component"] != "canal" {
+		t.Errorf("canal Fatalf logged %+v, want an error tagged component=canal", e)
+	}
+
+	// Rows without a binlog header are counted as dumped
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	s := NewMariaDBSyncer(config.SyncConfig{}, logger)
+	h.dump = &s.dump
+	for _, e := range []*canal.RowsEvent{
+		{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}, {int64(2), "b"}}},
+		{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(3), "c"}}, Header: &replication.EventHeader{LogPos: 10}},
+	} {
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rows := s.dump.rows.Load(); rows != 2 {
+		t.Errorf("dumped rows = %d, want 2", rows)
+	}
+
+	dumpDone := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		s.watchDump(context.Background(), "/usr/bin/mysqldump", dumpDone, func() bool { return true }, 10*time.Millisecond)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	close(dumpDone)
+	<-watched
+	var started, progress, finished bool
+	for _, e := range hook.AllEntries() {
+		started = started || strings.Contains(e.Message, "Canal dump of the source with /usr/bin/mysqldump started")
+		progress = progress || strings.Contains(e.Message, "Canal dump in progress: 2 rows")
+		finished = finished || strings.Contains(e.Message, "Canal dump finished: 2 rows")
+	}
+	if !started || !progress || !finished {
+		t.Errorf("logged start %v, progress %v, finish %v; want all", started, progress, finished)
+	}
+	select {
+	case <-s.InitialSyncDone():
+	default:
+		t.Error("InitialSyncDone still open after the dump finished")
+	}
+
+	// A failed dump leaves InitialSyncDone open
+	s = NewMariaDBSyncer(config.SyncConfig{}, logger)
+	failed := make(chan struct{})
+	close(failed)
+	s.watchDump(context.Background(), "mysqldump", failed, func() bool { return false }, time.Minute)
+	if e := hook.LastEntry(); e.Level != logrus.ErrorLevel || !strings.Contains(e.Message, "failed") {
+		t.Errorf("failed dump logged %q", e.Message)
+	}
+	select {
+	case <-s.InitialSyncDone():
+		t.Error("InitialSyncDone closed after a failed dump")
+	default:
+	}
+}
+
+func TestStartOverride(t *testing.T) {
+	for _, tc := range []struct {
+		cfg      config.SyncConfig
+		wantPos  *mysql.Position
+		wantGTID string
+		wantErr  bool
+	}{
+		{cfg: config.SyncConfig{}},
+		{cfg: config.SyncConfig{StartPositionFile: "mysql-bin.000003"}, wantErr: true},
+		{
+			cfg:     config.SyncConfig{StartPositionFile: "mysql-bin.000003", ConfirmStartOverride: true},
+			wantPos: &mysql.Position{Name: "mysql-bin.000003", Pos: 4},
+		},
+		{
+			cfg:     config.SyncConfig{StartPositionFile: "mysql-bin.000003", StartPositionOffset: 1200, ConfirmStartOverride: true},
+			wantPos: &mysql.Position{Name: "mysql-bin.000003", Pos: 1200},
+		},
+		{cfg: config.SyncConfig{StartPositionOffset: 1200, ConfirmStartOverride: true}, wantErr: true},
+		{cfg: config.SyncConfig{StartGTID: "0-1-100", ConfirmStartOverride: true}, wantErr: true},
+		{cfg: config.SyncConfig{StartGTID: "0-1-100", UseGTID: true, ConfirmStartOverride: true}, wantGTID: "0-1-100"},
+		{cfg: config.SyncConfig{StartGTID: "0-1-100", StartPositionFile: "mysql-bin.000003", UseGTID: true, ConfirmStartOverride: true}, wantErr: true},
+		{cfg: config.SyncConfig{StartGTID: "bad", UseGTID: true, ConfirmStartOverride: true}, wantErr: true},
+	} {
+		pos, gset, err := NewMariaDBSyncer(tc.cfg, logrus.New()).startOverride(mysql.MariaDBFlavor)
+		if (err != nil) != tc.wantErr || !reflect.DeepEqual(pos, tc.wantPos) {
+			t.Errorf("startOverride(%+v) = %v, %v; want %v, error %v", tc.cfg, pos, err, tc.wantPos, tc.wantErr)
+		}
+		var gtid string
+		if gset != nil {
+			gtid = gset.String()
+		}
+		if gtid != tc.wantGTID {
+			t.Errorf("startOverride(%+v) GTID set = %q, want %q", tc.cfg, gtid, tc.wantGTID)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	valid := config.SyncConfig{
+		SourceConnection:  "root:root@tcp(localhost:3306)/",
+		TargetConnection:  "root:root@tcp(localhost:3307)/",
+		MySQLPositionPath: filepath.Join(dir, "state", "position.json"),
+		Mappings: []config.DatabaseMapping{{
+			SourceDatabase: "src", TargetDatabase: "dst",
+			Tables: []config.TableMapping{
+				{SourceTable: "users", TargetTable: "users", InsertMode: "upsert"},
+				{SourceTable: "orders", TargetTable: "orders"},
+			},
+		}},
+	}
+	if problems := ValidateConfig(valid); len(problems) > 0 {
+		t.Fatalf("ValidateConfig of a valid configuration = %v", problems)
+	}
+
+	invalid := valid
+	invalid.SourceConnection = "root:root@tcp(localhost:3306"
+	invalid.ErrorPolicy = "retry"
+	invalid.MySQLPositionPath = filepath.Join(file, "position.json")
+	// Incremental mode lets canal dump when it starts without a saved position
+	invalid.Mode = config.ModeIncremental
+	invalid.DumpExecutionPath = filepath.Join(dir, "missing", "mysqldump")
+	invalid.Mappings = []config.DatabaseMapping{{
+		SourceDatabase: "src", TargetDatabase: "dst",
+		Tables: []config.TableMapping{
+			{SourceTable: "users", TargetTable: "users", InsertMode: "merge"},
+			{SourceTable: "users", TargetTable: "people"},
+			{SourceTable: "admins", TargetTable: "users", SourceTag: "origin"},
+		},
+	}}
+	problems := ValidateConfig(invalid)
+	for _, want := range []string{"source_connection", "insert_mode", "mapped more than once", "source_tag", "error_policy",
+		"mysql_position_path", "dump_execution_path"} {
+		if !strings.Contains(errors.Join(problems...).Error(), want) {
+			t.Errorf("ValidateConfig problems %v do not mention %s", problems, want)
+		}
+	}
+	if len(problems) != 7 {
+		t.Errorf("ValidateConfig found %d problems, want 7: %v", len(problems), problems)
+	}
+
+	if problems := ValidateConfig(config.SyncConfig{SourceConnection: valid.SourceConnection, TargetConnection: valid.TargetConnection}); len(problems) != 1 {
+		t.Errorf("ValidateConfig without mappings = %v, want one problem", problems)
+	}
+}
+
+func TestApplyConcurrency(t *testing.T) {
+	// Writes of id 1 wait until another key is written, which needs a second worker
+	other := make(chan struct{})
+	var otherOnce sync.Once
+	var otherID int64
+	rec := &recorder{exec: func(query string, args []driver.Value) error {
+		if len(args) == 0 {
+			return nil
+		}
+		switch args[0] {
+		case otherID:
+			otherOnce.Do(func() { close(other) })
+		case int64(1):
+			select {
+			case <-other:
+			case <-time.After(5 * time.Second):
+				return errors.New("no other key was written meanwhile")
+			}
+		}
+		return nil
+	}}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	h.binlogFile = "mysql-bin.000001"
+	h.appliers = newApplierPool(h, 4, defaultApplyQueueSize)
+	defer h.appliers.close()
+	for id := int64(2); otherID == 0; id++ {
+		if h.appliers.worker(target, []interface{}{id}) != h.appliers.worker(target, []interface{}{int64(1)}) {
+			otherID = id
+		}
+	}
+
+	event := func(pos uint32, action string, rows ...[]interface{}) *canal.RowsEvent {
+		return &canal.RowsEvent{Table: target.table, Action: action, Rows: rows, Header: &replication.EventHeader{LogPos: pos}}
+	}
+	events := []*canal.RowsEvent{
+		event(100, canal.InsertAction, []interface{}{int64(1), "a"}, []interface{}{otherID, "x"}),
+		event(200, canal.UpdateAction, []interface{}{int64(1), "a"}, []interface{}{int64(1), "b"}),
+		event(300, canal.DeleteAction, []interface{}{int64(1), "b"}),
+		// The key moves to the worker of id 1, so it is written after both
+		event(400, canal.UpdateAction, []interface{}{otherID, "x"}, []interface{}{int64(1), "x"}),
+	}
+	for _, e := range events {
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.OnPosSynced(nil, mysql.Position{}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	sameKey := []string{
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [1 a]",
+		"UPDATE `dst`.`users` SET `id` = ?, `name` = ? WHERE `id` = ? [1 b 1]",
+		"DELETE FROM `dst`.`users` WHERE `id` = ? [1]",
+	}
+	var got []string
+	for _, stmt := range rec.stmts {
+		for _, want := range sameKey {
+			if stmt == want {
+				got = append(got, stmt)
+			}
+		}
+	}
+	if !reflect.DeepEqual(got, sameKey) {
+		t.Errorf("writes of id 1 = %q, want %q in order", got, sameKey)
+	}
+	moved := []string{fmt.Sprintf("DELETE FROM `dst`.`users` WHERE `id` = ? [%d]", otherID), "INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [1 x]", "COMMIT"}
+	if n := len(rec.stmts); n < 3 || !reflect.DeepEqual(rec.stmts[n-3:], moved) {
+		t.Errorf("statements = %q, want %q last", rec.stmts, moved)
+	}
+	if want := (mysql.Position{Name: "mysql-bin.000001", Pos: 400}); h.lastApplied != want {
+		t.Errorf("last applied = %v, want %v", h.lastApplied, want)
+	}
+
+	if _, err := NewMariaDBSyncer(config.SyncConfig{ApplyConcurrency: 4, WriteBatchSize: 100}, logrus.New()).applyConcurrency(); err == nil {
+		t.Error("apply_concurrency was accepted with write_batch_size")
+	}
+}
+
+func TestApplyConcurrencySkipAfterStop(t *testing.T) {
+	var otherID int64
+	rec := &recorder{exec: func(query string, args []driver.Value) error {
+		switch {
+		case len(args) == 0:
+			return nil
+		case args[0] == int64(1):
+			return &mysqldriver.MySQLError{Number: 1213, Message: "Deadlock found"}
+		case args[0] == otherID:
+			return &mysqldriver.MySQLError{Number: 1146, Message: "Table doesn't exist"}
+		}
+		return nil
+	}}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	h.binlogFile = "mysql-bin.000001"
+	h.lastApplied = mysql.Position{Name: "mysql-bin.000001", Pos: 50}
+	h.errorPolicy = errorPolicySkip
+	h.retryMaxAttempts = 1
+	h.appliers = newApplierPool(h, 4, defaultApplyQueueSize)
+	defer h.appliers.close()
+	for id := int64(2); otherID == 0; id++ {
+		if h.appliers.worker(target, []interface{}{id}) != h.appliers.worker(target, []interface{}{int64(1)}) {
+			otherID = id
+		}
+	}
+
+	// The deadlock of event 100 stops the sync; the skip of event 200 on another worker must
+	// not mark 100 applied, or it would be dropped once canal reads it again
+	for _, e := range []*canal.RowsEvent{
+		{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}, Header: &replication.EventHeader{LogPos: 100}},
+		{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{otherID, "b"}}, Header: &replication.EventHeader{LogPos: 200}},
+	} {
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.OnPosSynced(nil, mysql.Position{Name: "mysql-bin.000001", Pos: 300}, nil, false); err == nil {
+		t.Fatal("deadlock did not stop the sync")
+	}
+	if want := (mysql.Position{Name: "mysql-bin.000001", Pos: 50}); h.lastApplied != want {
+		t.Errorf("last applied = %v, want %v", h.lastApplied, want)
+	}
+	if h.alreadyApplied(&replication.EventHeader{LogPos: 100}) {
+		t.Error("failed event 100 reported as already applied")
+	}
+}
+
+func TestDebugRows(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	s := NewMariaDBSyncer(config.SyncConfig{DebugRows: true}, logger)
+	rows, err := s.newRowLogger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tableMap := config.TableMapping{SourceTable: "users", TargetTable: "members", Transforms: map[string]string{"email": "hash"}}
+	rows.log("incremental", canal.UpdateAction, "src.users", "dst.members", tableMap,
+		[]string{"id", "email", "secret"}, []string{"id", "email", ""}, []interface{}{int64(1), "a@example.com", "hidden"})
+	want := "[MariaDB] Writing incremental update row from src.users to dst.members: map[email:REDACTED id:1]"
+	if entry := hook.LastEntry(); entry == nil || entry.Message != want {
+		t.Errorf("logged %v, want %q", entry, want)
+	}
+
+	// Nothing is logged above the debug level, nor by a nil logger
+	hook.Reset()
+	logger.SetLevel(logrus.InfoLevel)
+	rows.log("initial", canal.InsertAction, "src.users", "dst.members", tableMap, []string{"id"}, []string{"id"}, []interface{}{int64(1)})
+	var disabled *rowLogger
+	disabled.log("initial", canal.InsertAction, "src.users", "dst.members", tableMap, []string{"id"}, []string{"id"}, []interface{}{int64(1)})
+	if len(hook.Entries) != 0 {
+		t.Errorf("logged %d entries, want none", len(hook.Entries))
+	}
+
+	if _, err := NewMariaDBSyncer(config.SyncConfig{DebugRows: true, DebugRowsSampleRate: 1.5}, logger).newRowLogger(); err == nil {
+		t.Error("debug_rows_sample_rate above 1 was accepted")
+	}
+}
+
+func TestBitAndBinaryColumns(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.converters = &converterSet{}
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	table := &schema.Table{
+		Schema: "src",
+		Name:   "users",
+		Columns: []schema.TableColumn{
+			{Name: "id", Type: schema.TYPE_BINARY, RawType: "varbinary(16)", MaxSize: 16},
+			{Name: "name", Type: schema.TYPE_BIT, RawType: "bit(8)"},
+		},
+		PKColumns: []int{0},
+	}
+
+	// Canal decodes VARBINARY to a string of raw bytes and BIT to an int64
+	id := string([]byte{0x00, 0xff, 0xfe, 0x80})
+	for _, e := range []*canal.RowsEvent{
+		{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{{id, int64(0xa5)}}},
+		{Table: table, Action: canal.UpdateAction, Rows: [][]interface{}{{id, int64(0xa5)}, {id, int64(0x0f)}}},
+	} {
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [[0 255 254 128] 165]", "COMMIT",
+		"UPDATE `dst`.`users` SET `id` = ?, `name` = ? WHERE `id` = ? [[0 255 254 128] 15 [0 255 254 128]]", "COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+
+	bit8 := schema.TableColumn{Type: schema.TYPE_BIT, RawType: "bit(8)"}
+	bit64 := schema.TableColumn{Type: schema.TYPE_BIT, RawType: "bit(64)"}
+	binary4 := schema.TableColumn{Type: schema.TYPE_BINARY, RawType: "binary(4)", FixedSize: 4, MaxSize: 4}
+	for _, tt := range []struct {
+		col  schema.TableColumn
+		in   interface{}
+		want interface{}
+	}{
+		// The initial sync reads BIT values as big-endian bytes
+		{bit8, []byte{0xa5}, uint64(0xa5)},
+		{bit8, int64(-1), uint64(0xff)},
+		{bit64, int64(-1), uint64(math.MaxUint64)},
+		{bit64, []byte{0x80, 0, 0, 0, 0, 0, 0, 1}, uint64(0x8000000000000001)},
+		{binary4, "ab", []byte{'a', 'b', 0, 0}},
+		{binary4, []byte{1, 2, 3, 4}, []byte{1, 2, 3, 4}},
+	} {
+		got, err := (&converterSet{}).convertValue(&tt.col, tt.in)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("convertValue(%s, %T %v) = %T %v, %v; want %T %v", tt.col.RawType, tt.in, tt.in, got, got, err, tt.want, tt.want)
+		}
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	err := NewMariaDBSyncer(config.SyncConfig{}, logrus.New()).Start(context.Background())
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Errorf("Start without mappings = %v, want a ConfigError", err)
+	}
+
+	s := NewMariaDBSyncer(config.SyncConfig{}, logrus.New())
+	down := sql.OpenDB(&unreachable{recorder: &recorder{}, failures: 100})
+	defer down.Close()
+	err = s.pingWithRetry(context.Background(), down, "source", 2, time.Millisecond, time.Second)
+	var connErr *ConnectionError
+	if !errors.As(err, &connErr) || connErr.Database != "source" || !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("pingWithRetry of an unreachable source = %v, want a ConnectionError wrapping ECONNREFUSED", err)
+	}
+
+	rejected := errors.New("rejected")
+	rec := &recorder{exec: func(string, []driver.Value) error { return rejected }}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.status = &s.status
+	err = h.applyEvent(target, &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}})
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) || applyErr.Table != "dst.users" || applyErr.Action != canal.InsertAction || !errors.Is(err, rejected) {
+		t.Errorf("applyEvent rejected by the target = %v, want an ApplyError for the insert on dst.users", err)
+	}
+	if last := s.Status().LastError; !errors.As(last, &applyErr) {
+		t.Errorf("Status().LastError = %v, want the ApplyError", last)
+	}
+}
+
+func TestApplySQL(t *testing.T) {
+	source := sql.OpenDB(&recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		switch {
+		case strings.Contains(query, "KEY_COLUMN_USAGE"):
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}}}, nil
+		case strings.Contains(query, "information_schema.COLUMNS"):
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}, {"name"}}}, nil
+		}
+		return &staticRows{columns: []string{"id", "name"}, values: [][]driver.Value{{int64(1), "a"}}}, nil
+	}})
+	defer source.Close()
+	rec := &recorder{}
+	target := sql.OpenDB(rec)
+	defer target.Close()
+
+	s := NewMariaDBSyncer(config.SyncConfig{}, logrus.New())
+	mapping := config.DatabaseMapping{SourceDatabase: "src", TargetDatabase: "dst"}
+	tableMap := config.TableMapping{
+		SourceTable:  "users",
+		TargetTable:  "users",
+		PreApplySQL:  []string{"SET FOREIGN_KEY_CHECKS = 0"},
+		PostApplySQL: []string{"SET FOREIGN_KEY_CHECKS = 1", "ANALYZE TABLE `dst`.`users`"},
+	}
+	if _, err := s.copyTable(context.Background(), source, &destination{db: target}, nil, mapping, tableMap, 10, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"SET FOREIGN_KEY_CHECKS = 0 []",
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [1 a]",
+		"SET FOREIGN_KEY_CHECKS = 1 []",
+		"ANALYZE TABLE `dst`.`users` []",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("initial sync statements =\n%q\nwant\n%q", rec.stmts, want)
+	}
+
+	// Incremental writes only run them with apply_sql_incremental, within their transaction
+	events := &recorder{}
+	h, rt, done := newUsersTarget(events, false)
+	defer done()
+	rt.tableMap.PreApplySQL, rt.tableMap.PostApplySQL = tableMap.PreApplySQL, tableMap.PostApplySQL[:1]
+	insert := &canal.RowsEvent{Table: rt.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(2), "b"}}}
+	if _, err := h.applyRows(rt, insert); err != nil {
+		t.Fatal(err)
+	}
+	rt.tableMap.ApplySQLIncremental = true
+	if _, err := h.applyRows(rt, insert); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [2 b]",
+		"COMMIT",
+		"SET FOREIGN_KEY_CHECKS = 0 []",
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [2 b]",
+		"SET FOREIGN_KEY_CHECKS = 1 []",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(events.stmts, want) {
+		t.Errorf("incremental statements =\n%q\nwant\n%q", events.stmts, want)
+	}
+
+	events.exec = func(query string, args []driver.Value) error {
+		if strings.HasPrefix(query, "SET") {
+			return errors.New("denied")
+		}
+		return nil
+	}
+	if _, err := h.applyRows(rt, insert); err == nil || !strings.Contains(err.Error(), "pre_apply_sql of dst.users") {
+		t.Errorf("applyRows with a failing pre_apply_sql = %v, want its error", err)
+	}
+
+	problems := ValidateConfig(config.SyncConfig{
+		SourceConnection: "u:p@tcp(src:3306)/",
+		TargetConnection: "u:p@tcp(dst:3306)/",
+		Mappings: []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{
+			{SourceTable: "a", TargetTable: "a", PreApplySQL: []string{" "}},
+			{SourceTable: "b", TargetTable: "b", ApplySQLIncremental: true},
+		}}},
+	})
+	if len(problems) != 2 {
+		t.Errorf("ValidateConfig of invalid apply SQL = %v, want 2 problems", problems)
+	}
+}
+
+func TestInitialSyncProgress(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	s := NewMariaDBSyncer(config.SyncConfig{}, logger)
+	s.progressRows, s.progressInterval = 2, time.Hour
+	estimates := 0
+	p := s.newCopyProgress("src.progress", 0, func() int64 {
+		estimates++
+		return 10
+	})
+
+	p.observe(1)
+	if len(hook.AllEntries()) != 0 || estimates != 0 {
+		t.Fatalf("progress logged before progress_rows rows: %d entries, %d estimates", len(hook.AllEntries()), estimates)
+	}
+	p.observe(2)
+	p.observe(3)
+	p.observe(4)
+	entries := hook.AllEntries()
+	if len(entries) != 2 || estimates != 1 {
+		t.Fatalf("logged %d entries with %d estimates, want 2 entries and 1 estimate", len(entries), estimates)
+	}
+	if msg := entries[1].Message; !strings.Contains(msg, "4 of about 10 rows copied (40.0%)") || !strings.Contains(msg, "ETA") {
+		t.Errorf("progress log = %q, want copied rows, share and ETA", msg)
+	}
+	if got := tableMetric(t, "sync_initial_sync_progress_ratio", "src.progress"); got != 0.4 {
+		t.Errorf("progress gauge = %v, want 0.4", got)
+	}
+	p.done()
+	if got := tableMetric(t, "sync_initial_sync_progress_ratio", "src.progress"); got != 1 {
+		t.Errorf("progress gauge after done = %v, want 1", got)
+	}
+
+	if _, interval, err := s.initialSyncProgressPolicy(); err != nil || interval != defaultInitialSyncProgressInterval {
+		t.Errorf("default progress interval = %v, %v", interval, err)
+	}
+	s.cfg.InitialSyncProgressRows = -1
+	if _, _, err := s.initialSyncProgressPolicy(); err == nil {
+		t.Error("negative initial_sync_progress_rows accepted")
+	}
+}
+
+func TestEnumAndSetWrittenByLabel(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.converters = &converterSet{}
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	// The target declares ENUM('shipped', 'new', 'paid') and SET('fragile', 'gift', 'express'),
+	// so writing the source ordinals would store other labels there
+	table := &schema.Table{
+		Schema: "src",
+		Name:   "users",
+		Columns: []schema.TableColumn{
+			{Name: "id"},
+			{Name: "status", Type: schema.TYPE_ENUM, EnumValues: []string{"new", "paid", "shipped"}},
+			{Name: "flags", Type: schema.TYPE_SET, SetValues: []string{"gift", "express", "fragile"}},
+		},
+		PKColumns: []int{0},
+	}
+
+	for _, e := range []*canal.RowsEvent{
+		{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), int64(1), int64(1)}}},
+		{Table: table, Action: canal.UpdateAction, Rows: [][]interface{}{{int64(1), int64(1), int64(1)}, {int64(1), int64(3), int64(6)}}},
+	} {
+		if err := h.OnRow(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"INSERT INTO `dst`.`users` (`id`, `status`, `flags`) VALUES (?,?,?) [1 new gift]",
+		"COMMIT",
+		"UPDATE `dst`.`users` SET `id` = ?, `status` = ?, `flags` = ? WHERE `id` = ? [1 shipped express,fragile 1]",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements =\n%q\nwant\n%q", rec.stmts, want)
+	}
+
+	// The initial sync reads labels, which stay labels even when they look like ordinals
+	v, err := h.converters.convertValue(&schema.TableColumn{Name: "size", Type: schema.TYPE_ENUM, EnumValues: []string{"2", "1"}}, []byte("1"))
+	if err != nil || !reflect.DeepEqual(v, []byte("1")) {
+		t.Errorf("ENUM label read by the initial sync converted to %#v, %v", v, err)
+	}
+}
+
+func TestApplyQueueBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	rec := &recorder{exec: func(string, []driver.Value) error {
+		<-release
+		return nil
+	}}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	s := &MariaDBSyncer{}
+	h.status = &s.status
+	h.appliers = newApplierPool(h, 1, 1)
+	defer h.appliers.close()
+
+	insert := func(id int64) *canal.RowsEvent {
+		return &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{id, "a"}}}
+	}
+	// The worker writes the first event and queues the second; the third waits for room
+	h.appliers.dispatch(target, insert(1))
+	h.appliers.dispatch(target, insert(2))
+	dispatched := make(chan struct{})
+	go func() {
+		h.appliers.dispatch(target, insert(3))
+		close(dispatched)
+	}()
+	select {
+	case <-dispatched:
+		t.Fatal("dispatch into a full queue did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if depth := s.Status().QueueDepth; depth != 3 {
+		t.Errorf("QueueDepth of a full queue = %d, want 3", depth)
+	}
+
+	close(release)
+	<-dispatched
+	if err := h.appliers.drain(); err != nil {
+		t.Fatal(err)
+	}
+	if depth := s.Status().QueueDepth; depth != 0 {
+		t.Errorf("QueueDepth after drain = %d, want 0", depth)
+	}
+	if _, err := (&MariaDBSyncer{cfg: config.SyncConfig{ApplyQueueSize: -1}}).applyQueueSize(); err == nil {
+		t.Error("negative apply_queue_size accepted")
+	}
+}
+
+func TestExcludeColumnTypes(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	s := NewMariaDBSyncer(config.SyncConfig{ExcludeColumnTypes: []string{"LONGBLOB", "generated"}, ExcludeColumnsLargerThan: 1000}, logger)
+	x, err := s.newTypeExclusions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := &schema.Table{
+		Schema: "src",
+		Name:   "users",
+		Columns: []schema.TableColumn{
+			{Name: "id", RawType: "bigint(20)"},
+			{Name: "name", RawType: "varchar(255)", MaxSize: 255},
+			{Name: "bio", RawType: "text"},
+			{Name: "photo", RawType: "longblob"},
+			{Name: "initials", RawType: "varchar(2)", MaxSize: 2, IsVirtual: true},
+			{Name: "notes", RawType: "varchar(2000)", MaxSize: 2000},
+		},
+		PKColumns: []int{0},
+	}
+	tableMap := config.TableMapping{SourceTable: "users", TargetTable: "users", ExcludeColumns: []string{"name"}}
+	got := x.apply(table, tableMap)
+	if want := []string{"name", "bio", "photo", "initials", "notes"}; !reflect.DeepEqual(got.ExcludeColumns, want) {
+		t.Errorf("exclude_columns = %q, want %q", got.ExcludeColumns, want)
+	}
+	if len(tableMap.ExcludeColumns) != 1 {
+		t.Errorf("apply changed the shared table mapping: %q", tableMap.ExcludeColumns)
+	}
+	x.apply(table, tableMap)
+	if n := len(hook.AllEntries()); n != 1 {
+		t.Errorf("excluded columns logged %d times, want once", n)
+	}
+
+	// Incremental events leave the excluded columns out of the statement
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.typeExclusions = x
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+	e := &canal.RowsEvent{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{
+		{int64(1), "a", "bio", []byte{0xff}, "A", "notes"},
+	}}
+	if err := h.OnRow(e); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [1 a]", "COMMIT"}; !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("statements = %q, want %q", rec.stmts, want)
+	}
+
+	s.cfg.ExcludeColumnTypes = []string{"varchar(255)"}
+	if _, err := s.newTypeExclusions(); err == nil {
+		t.Error("exclude_column_types entry with a length accepted")
+	}
+}
+
+// startSSHBastion runs an SSH server on a local port that accepts key and forwards
+// direct-tcpip channels, returning its address and host key
+func startSSHBastion(t *testing.T, key ssh.PublicKey) (string, ssh.PublicKey) {
+	t.Helper()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, k ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(k.Marshal(), key.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	serverCfg.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, serverCfg)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newCh := range chans {
+					var dest struct {
+						Host     string
+						Port     uint32
+						OrigHost string
+						OrigPort uint32
+					}
+					if newCh.ChannelType() != "direct-tcpip" || ssh.Unmarshal(newCh.ExtraData(), &dest) != nil {
+						newCh.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+					upstream, err := net.Dial("tcp", net.JoinHostPort(dest.Host, strconv.Itoa(int(dest.Port))))
+					if err != nil {
+						newCh.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					ch, chReqs, err := newCh.Accept()
+					if err != nil {
+						upstream.Close()
+						continue
+					}
+					go ssh.DiscardRequests(chReqs)
+					go func() { io.Copy(ch, upstream); ch.Close() }()
+					go func() { io.Copy(upstream, ch); upstream.Close() }()
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), hostSigner.PublicKey()
+}
+
+func TestSSHTunnel(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bastion, hostKey := startSSHBastion(t, clientKey)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{bastion}, hostKey)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The database behind the bastion echoes what it receives
+	db, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	go func() {
+		for {
+			conn, err := db.Accept()
+			if err != nil {
+				return
+			}
+			go func() { io.Copy(conn, conn); conn.Close() }()
+		}
+	}()
+
+	echo := func(t *testing.T, dial DialFunc) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		conn, err := dial(ctx, "tcp", db.Addr().String())
+		if err != nil {
+			t.Fatalf("dial through the bastion: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 4)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+			t.Fatalf("read %q, %v through the tunnel, want ping", buf, err)
+		}
+	}
+
+	t.Run("dials through the bastion and reconnects", func(t *testing.T) {
+		tunnel, err := newSSHTunnel(&config.SSHTunnelConfig{Host: bastion, User: "sync", KeyFile: keyFile, KnownHostsFile: knownHosts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tunnel.close()
+		echo(t, tunnel.dial)
+		// A lost SSH connection is replaced by the next dial
+		tunnel.mu.Lock()
+		tunnel.client.Close()
+		tunnel.mu.Unlock()
+		echo(t, tunnel.dial)
+	})
+
+	t.Run("rejects an unknown host key", func(t *testing.T) {
+		other := filepath.Join(dir, "other_known_hosts")
+		if err := os.WriteFile(other, []byte(knownhosts.Line([]string{bastion}, clientKey)+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		tunnel, err := newSSHTunnel(&config.SSHTunnelConfig{Host: bastion, User: "sync", KeyFile: keyFile, KnownHostsFile: other})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tunnel.close()
+		if _, err := tunnel.dial(context.Background(), "tcp", db.Addr().String()); err == nil || !strings.Contains(err.Error(), "handshake") {
+			t.Fatalf("dial with a mismatched host key = %v, want a handshake error", err)
+		}
+	})
+
+	t.Run("validates its settings", func(t *testing.T) {
+		tests := []struct {
+			name string
+			cfg  config.SSHTunnelConfig
+			want string
+		}{
+			{"missing user", config.SSHTunnelConfig{Host: bastion, KeyFile: keyFile, InsecureIgnoreHostKey: true}, "are required"},
+			{"missing key file", config.SSHTunnelConfig{Host: bastion, User: "sync", KeyFile: filepath.Join(dir, "missing"), InsecureIgnoreHostKey: true}, "key_file"},
+			{"no host key policy", config.SSHTunnelConfig{Host: bastion, User: "sync", KeyFile: keyFile}, "known_hosts_file"},
+			{"both host key policies", config.SSHTunnelConfig{Host: bastion, User: "sync", KeyFile: keyFile, KnownHostsFile: knownHosts, InsecureIgnoreHostKey: true}, "cannot be combined"},
+		}
+		for _, tt := range tests {
+			if _, err := newSSHTunnel(&tt.cfg); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("%s: newSSHTunnel() = %v, want an error containing %q", tt.name, err, tt.want)
+			}
+		}
+		tunnel, err := newSSHTunnel(&config.SSHTunnelConfig{Host: "bastion.internal", User: "sync", KeyFile: keyFile, InsecureIgnoreHostKey: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tunnel.addr != "bastion.internal:22" {
+			t.Errorf("bastion address = %s, want the default port 22", tunnel.addr)
+		}
+	})
+
+	t.Run("cannot be combined with a custom dialer", func(t *testing.T) {
+		logger, _ := logtest.NewNullLogger()
+		s := NewMariaDBSyncer(config.SyncConfig{SSHTunnel: &config.SSHTunnelConfig{Host: bastion}}, logger)
+		s.SetSourceDialer(tunnelFree)
+		if _, _, _, err := s.dialers(); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+			t.Fatalf("dialers() = %v, want an error for ssh_tunnel with SetSourceDialer", err)
+		}
+	})
+}
+
+// tunnelFree dials directly
+func tunnelFree(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+func TestCustomDialer(t *testing.T) {
+	var dialed []string
+	var mu sync.Mutex
+	name := registerDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		dialed = append(dialed, network+" "+addr)
+		mu.Unlock()
+		return nil, errors.New("no route")
+	})
+	defer mysqldriver.DeregisterDialContext(name)
+
+	dsn, err := dsnWithNet("user:pass@tcp(db.internal:3306)/app?parseTime=true", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "user:pass@" + name + "(db.internal:3306)/app?parseTime=true"; dsn != want {
+		t.Fatalf("dsnWithNet() = %s, want %s", dsn, want)
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err == nil {
+		t.Fatal("ping through a failing dialer succeeded")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dialed) == 0 || dialed[0] != "tcp db.internal:3306" {
+		t.Fatalf("dialer calls = %v, want tcp db.internal:3306", dialed)
+	}
+}
+
+func TestUnmappedTableWarnings(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	logger, hook := logtest.NewNullLogger()
+	h.logger = logger
+	h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{target.tableMap}}}
+
+	archive := &schema.Table{Schema: "src", Name: "users_archive", Columns: target.table.Columns, PKColumns: []int{0}}
+	event := &canal.RowsEvent{Table: archive, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "a"}}}
+	warnings := func() []string {
+		var msgs []string
+		for _, entry := range hook.AllEntries() {
+			if entry.Level == logrus.WarnLevel {
+				msgs = append(msgs, entry.Message)
+			}
+		}
+		return msgs
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := h.OnRow(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if msgs := warnings(); len(msgs) != 1 || !strings.Contains(msgs[0], "No mapping found for source table src.users_archive") {
+		t.Fatalf("warnings after 3 unmapped events = %q, want a single no mapping warning", msgs)
+	}
+
+	// Once the interval passed, the next event logs how many were skipped
+	h.unmapped.tables[sourceTable{"src", "users_archive"}].since = time.Now().Add(-unmappedSummaryInterval)
+	if err := h.OnRow(event); err != nil {
+		t.Fatal(err)
+	}
+	msgs := warnings()
+	if len(msgs) != 2 || !strings.Contains(msgs[1], "Skipped 3 event(s) of source table src.users_archive") {
+		t.Fatalf("warnings after the interval = %q, want a summary of 3 skipped events", msgs)
+	}
+	if err := h.OnRow(event); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(warnings()); got != 2 {
+		t.Errorf("%d warnings right after a summary, want no new one", got)
+	}
+
+	// Matching is exact, so a table differing only in case is looked up and warned about too
+	upper := &canal.RowsEvent{Table: &schema.Table{Schema: "src", Name: "USERS_ARCHIVE", Columns: archive.Columns, PKColumns: []int{0}},
+		Action: canal.InsertAction, Rows: event.Rows}
+	if err := h.OnRow(upper); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(warnings()); got != 3 {
+		t.Errorf("%d warnings after an event of another table, want 3", got)
+	}
+
+	// A reload may map the table, so it is warned about again if it is still unmapped
+	h.unmapped.reset()
+	if err := h.OnRow(event); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(warnings()); got != 4 {
+		t.Errorf("%d warnings after a reset, want the table warned about again", got)
+	}
+	if len(rec.stmts) != 0 {
+		t.Errorf("unmapped events wrote %q to the target", rec.stmts)
+	}
+}
+
+func TestStrictApply(t *testing.T) {
+	h, target, done := newUsersTarget(&recorder{}, false)
+	defer done()
+	row := []interface{}{int64(7), "a"}
+	newRow := []interface{}{int64(7), "b"}
+
+	// Without strict_apply the counts are not checked
+	if err := h.handleUpdate(affectedExecer(0), target, row, newRow); err != nil {
+		t.Fatalf("update matching no row without strict_apply: %v", err)
+	}
+
+	h.strictApply = true
+	mismatch := func(t *testing.T, err error, want string) {
+		t.Helper()
+		var rowsErr *rowsAffectedError
+		if !errors.As(err, &rowsErr) || !strings.Contains(err.Error(), want) {
+			t.Fatalf("error = %v, want a rows affected error containing %q", err, want)
+		}
+	}
+
+	if err := h.handleInsert(affectedExecer(1), target, row); err != nil {
+		t.Fatalf("insert affecting 1 row: %v", err)
+	}
+	mismatch(t, h.handleInsert(affectedExecer(0), target, row), "insert on dst.users of row id=7 affected 0 rows, expected 1")
+	if err := h.handleUpdate(affectedExecer(1), target, row, newRow); err != nil {
+		t.Fatalf("update affecting 1 row: %v", err)
+	}
+	mismatch(t, h.handleUpdate(affectedExecer(0), target, row, newRow), "update on dst.users of row id=7 affected 0 rows")
+	if err := h.handleDelete(affectedExecer(1), target, row); err != nil {
+		t.Fatalf("delete affecting 1 row: %v", err)
+	}
+	mismatch(t, h.handleDelete(affectedExecer(0), target, row), "delete on dst.users of row id=7 affected 0 rows")
+
+	// Each insert mode allows the counts it can report
+	modes := []struct {
+		mode     string
+		ok, fail int64
+		want     string
+	}{
+		{insertModeIgnore, 0, 2, "expected 0 to 1"},
+		{insertModeUpsert, 2, 0, "expected 1 to 2"},
+		{insertModeReplace, 3, 0, "expected at least 1"},
+	}
+	for _, m := range modes {
+		target.tableMap.InsertMode = m.mode
+		if err := h.handleInsert(affectedExecer(m.ok), target, row); err != nil {
+			t.Errorf("%s affecting %d rows: %v", m.mode, m.ok, err)
+		}
+		mismatch(t, h.handleInsert(affectedExecer(m.fail), target, row), m.want)
+	}
+	target.tableMap.InsertMode = ""
+
+	// A multi-row INSERT expects every row
+	group := []pendingEvent{{target: target, event: &canal.RowsEvent{Table: target.table, Action: canal.InsertAction,
+		Rows: [][]interface{}{row, {int64(8), "c"}}}}}
+	mismatch(t, h.handleInsertBatch(affectedExecer(1), group, make([]int, 1)), "insert on dst.users affected 1 rows, expected 2")
+
+	// The error policy gets it as an ApplyError
+	var applyErr *ApplyError
+	if err := h.eventFailed(target, group[0].event, h.handleDelete(affectedExecer(0), target, row)); !errors.As(err, &applyErr) {
+		t.Errorf("eventFailed() = %v, want an ApplyError", err)
+	}
+
+	dsn, err := dsnWithFoundRows("user:pass@tcp(db:3306)/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dsn, "clientFoundRows=true") {
+		t.Errorf("dsnWithFoundRows() = %s, want clientFoundRows=true", dsn)
+	}
+}
+
+func TestInitialSyncOrderBy(t *testing.T) {
+	var selects []string
+	source := sql.OpenDB(&recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		switch {
+		case strings.Contains(query, "KEY_COLUMN_USAGE"):
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}}}, nil
+		case strings.Contains(query, "information_schema.COLUMNS"):
+			return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}, {"created_at"}, {"note"}}}, nil
+		}
+		selects = append(selects, fmt.Sprintf("%s %v", query, args))
+		return &staticRows{columns: []string{"id", "created_at", "note"}, values: [][]driver.Value{
+			{int64(9), "2026-01-02", "a"},
+			{int64(3), "2026-01-03", "b"},
+		}}, nil
+	}})
+	defer source.Close()
+	target := sql.OpenDB(&recorder{})
+	defer target.Close()
+
+	s := &MariaDBSyncer{logger: logrus.New()}
+	mapping := config.DatabaseMapping{SourceDatabase: "src", TargetDatabase: "dst"}
+	tableMap := config.TableMapping{SourceTable: "orders", TargetTable: "orders",
+		InitialSyncIndexHint: "idx_created", InitialSyncOrderBy: []string{"created_at"}}
+
+	// Without a checkpoint the configured order still applies, ended by the primary key
+	if _, err := s.copyTable(context.Background(), source, &destination{db: target}, nil, mapping, tableMap, 10, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	want := "SELECT `id`,`created_at`,`note` FROM `src`.`orders` FORCE INDEX (`idx_created`) ORDER BY `created_at`, `id` []"
+	if len(selects) != 1 || selects[0] != want {
+		t.Errorf("select = %q, want %q", selects, want)
+	}
+
+	// A resumed copy continues after the last key in that order and records its columns
+	store, err := loadCheckpointStore(filepath.Join(t.TempDir(), "initial_sync"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyCols := []string{"created_at", "id"}
+	if err := store.set("src.orders", tableCheckpoint{LastKey: []string{"2026-01-02", "5"}, KeyColumns: keyCols}); err != nil {
+		t.Fatal(err)
+	}
+	selects = nil
+	if _, err := s.copyTable(context.Background(), source, &destination{db: target}, nil, mapping, tableMap, 10, store, false); err != nil {
+		t.Fatal(err)
+	}
+	want = "SELECT `id`,`created_at`,`note` FROM `src`.`orders` FORCE INDEX (`idx_created`) " +
+		"WHERE ((`created_at` > ?) OR (`created_at` = ? AND `id` > ?)) ORDER BY `created_at`, `id` [2026-01-02 2026-01-02 5]"
+	if len(selects) != 1 || selects[0] != want {
+		t.Errorf("resumed select = %q, want %q", selects, want)
+	}
+	cp, _ := store.get("src.orders")
+	if !cp.Done || !reflect.DeepEqual(cp.LastKey, []string{"2026-01-03", "3"}) || !reflect.DeepEqual(cp.KeyColumns, keyCols) {
+		t.Errorf("checkpoint = %+v, want done after key [2026-01-03 3] of (created_at, id)", cp)
+	}
+
+	// A checkpoint keyed by the primary key cannot be resumed in another order
+	if err := store.set("src.orders", tableCheckpoint{LastKey: []string{"5"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.copyTable(context.Background(), source, &destination{db: target}, nil, mapping, tableMap, 10, store, false); err == nil ||
+		!strings.Contains(err.Error(), "taken in the order of (primary key), not (created_at, id)") {
+		t.Errorf("copy resumed from a primary key checkpoint: %v, want an order mismatch error", err)
+	}
+
+	// Startup validation checks the hint and the columns against the source schema
+	schemaDB := sql.OpenDB(&recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		if strings.Contains(query, "STATISTICS") {
+			count := int64(0)
+			if args[2] == "idx_created" {
+				count = 1
+			}
+			return &staticRows{columns: []string{"COUNT(*)"}, values: [][]driver.Value{{count}}}, nil
+		}
+		nullable := map[driver.Value]string{"created_at": "NO", "note": "YES"}[args[2]]
+		if nullable == "" {
+			return &staticRows{columns: []string{"IS_NULLABLE"}}, nil
+		}
+		return &staticRows{columns: []string{"IS_NULLABLE"}, values: [][]driver.Value{{nullable}}}, nil
+	}})
+	defer schemaDB.Close()
+	if problems, err := checkInitialSyncOrder(context.Background(), schemaDB, "src", tableMap, true); err != nil || len(problems) != 0 {
+		t.Errorf("checkInitialSyncOrder() = %v, %v; want no problems", problems, err)
+	}
+	bad := config.TableMapping{SourceTable: "orders", InitialSyncIndexHint: "idx_missing", InitialSyncOrderBy: []string{"note", "missing"}}
+	problems, err := checkInitialSyncOrder(context.Background(), schemaDB, "src", bad, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := errors.Join(problems...).Error()
+	for _, want := range []string{
+		"initial_sync_index_hint idx_missing of src.orders is not an index",
+		"initial_sync_order_by column note of src.orders is nullable",
+		"initial_sync_order_by column missing of src.orders does not exist",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("problems %q do not contain %q", got, want)
+		}
+	}
+	// A copy that cannot resume may order by a nullable column
+	if problems, _ := checkInitialSyncOrder(context.Background(), schemaDB, "src", config.TableMapping{SourceTable: "orders", InitialSyncOrderBy: []string{"note"}}, false); len(problems) != 0 {
+		t.Errorf("problems %v for a nullable order column without a resumable initial sync", problems)
+	}
+}
+
+func TestPreflightChecks(t *testing.T) {
+	newSource := func(format string, grants ...string) *recorder {
+		return &recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+			switch {
+			case strings.Contains(query, "'log_bin'"):
+				return &staticRows{columns: []string{"Variable_name", "Value"}, values: [][]driver.Value{{"log_bin", "ON"}}}, nil
+			case strings.Contains(query, "'binlog_format'"):
+				return &staticRows{columns: []string{"Variable_name", "Value"}, values: [][]driver.Value{{"binlog_format", format}}}, nil
+			case query == "SHOW GRANTS":
+				rows := &staticRows{columns: []string{"Grants"}}
+				for _, g := range grants {
+					rows.values = append(rows.values, []driver.Value{g})
+				}
+				return rows, nil
+			}
+			return nil, fmt.Errorf("unexpected query %s", query)
+		}}
+	}
+	newTarget := func(execErr error) *recorder {
+		return &recorder{
+			query: func(query string, args []driver.Value) (driver.Rows, error) {
+				if strings.Contains(query, "KEY_COLUMN_USAGE") {
+					return &staticRows{columns: []string{"COLUMN_NAME"}, values: [][]driver.Value{{"id"}}}, nil
+				}
+				return &staticRows{columns: []string{"ENGINE"}, values: [][]driver.Value{{"InnoDB"}}}, nil
+			},
+			exec: func(query string, args []driver.Value) error {
+				if strings.HasPrefix(query, "INSERT") {
+					return execErr
+				}
+				return nil
+			},
+		}
+	}
+
+	t.Run("all pass", func(t *testing.T) {
+		source := sql.OpenDB(newSource("ROW", "GRANT SELECT, REPLICATION SLAVE ON *.* TO `sync`@`%`"))
+		defer source.Close()
+		rec := newTarget(nil)
+		target := sql.OpenDB(rec)
+		defer target.Close()
+
+		checks := runPreflightChecks(context.Background(), source, target, "dst", "users")
+		if len(checks) != 5 {
+			t.Fatalf("checks = %+v, want 5", checks)
+		}
+		for _, c := range checks {
+			if c.Err != nil {
+				t.Errorf("check %s failed: %v", c.Name, c.Err)
+			}
+		}
+		want := []string{"INSERT INTO `dst`.`users` () VALUES () []", "DELETE FROM `dst`.`users` WHERE 1 = 0 []", "ROLLBACK"}
+		if !reflect.DeepEqual(rec.stmts, want) {
+			t.Errorf("target statements = %q, want %q", rec.stmts, want)
+		}
+	})
+
+	t.Run("reports every failure", func(t *testing.T) {
+		source := sql.OpenDB(newSource("STATEMENT", "GRANT SELECT ON `app`.* TO `sync`@`%`"))
+		defer source.Close()
+		rec := newTarget(&mysqldriver.MySQLError{Number: 1142, Message: "INSERT command denied"})
+		target := sql.OpenDB(rec)
+		defer target.Close()
+
+		err := error(&PreflightError{Checks: runPreflightChecks(context.Background(), source, target, "dst", "users")})
+		for _, want := range []string{
+			"failed 3 of 5 checks",
+			`source binlog: binlog_format is "STATEMENT"`,
+			"source replication privilege: the source user lacks REPLICATION SLAVE",
+			"target write access to dst.users: insert into dst.users was refused",
+		} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error %q does not contain %q", err, want)
+			}
+		}
+		if len(rec.stmts) != 1 || rec.stmts[0] != "ROLLBACK" {
+			t.Errorf("target statements = %q, want only the rollback", rec.stmts)
+		}
+	})
+
+	t.Run("unreachable databases", func(t *testing.T) {
+		logger, _ := logtest.NewNullLogger()
+		s := NewMariaDBSyncer(config.SyncConfig{
+			SourceConnection: "root@tcp(127.0.0.1:1)/",
+			TargetConnection: "root@tcp(127.0.0.1:1)/",
+			Mappings:         []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{{SourceTable: "users", TargetTable: "users"}}}},
+		}, logger)
+		err := s.Preflight(context.Background())
+		var report *PreflightError
+		var connErr *ConnectionError
+		if !errors.As(err, &report) || !errors.As(err, &connErr) || connErr.Database != "source" {
+			t.Fatalf("Preflight() = %v, want a report with a source ConnectionError", err)
+		}
+		if len(report.Checks) != 5 || !strings.Contains(err.Error(), "failed 2 of 5 checks") {
+			t.Errorf("report = %+v, want the connection checks failed and the others not run", report.Checks)
+		}
+	})
+}
+
+func TestIgnoreErrorCodes(t *testing.T) {
+	duplicate := &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry '2' for key 'PRIMARY'"}
+	missing := &mysqldriver.MySQLError{Number: 1146, Message: "Table 'dst.users' doesn't exist"}
+	rec := &recorder{exec: func(query string, args []driver.Value) error {
+		for i, arg := range args {
+			switch {
+			case i%2 == 0 && arg == int64(2):
+				return duplicate
+			case i%2 == 0 && arg == int64(3):
+				return missing
+			}
+		}
+		return nil
+	}}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	s := &MariaDBSyncer{cfg: config.SyncConfig{IgnoreErrorCodes: []uint16{1062}}}
+	codes, err := s.ignoreErrorCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.ignoreErrorCodes = codes
+	h.errorPolicy = errorPolicyStop
+	h.status = &statusTracker{}
+	h.batchSize, h.batchDelay = 100, time.Hour
+
+	// The duplicate is dropped despite the stop policy, and the rest of the batch is written
+	for _, row := range [][]interface{}{{int64(1), "a"}, {int64(2), "b"}} {
+		e := &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{row}}
+		if err := h.enqueue(target, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.flush(); err != nil {
+		t.Fatalf("flush with an ignored duplicate failed: %v", err)
+	}
+	var inserted []string
+	for _, stmt := range rec.stmts {
+		if strings.HasPrefix(stmt, "INSERT") {
+			inserted = append(inserted, stmt)
+		}
+	}
+	if want := []string{"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [1 a]"}; !reflect.DeepEqual(inserted, want) {
+		t.Errorf("inserted = %q, want %q", inserted, want)
+	}
+	if st := h.status.snapshot(); st.LastError != nil {
+		t.Errorf("status error %v after an ignored error, want none", st.LastError)
+	}
+
+	// An error that is not listed still stops the sync
+	e := &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(3), "c"}}}
+	if err := h.applyEvent(target, e); !errors.Is(err, missing) {
+		t.Fatalf("applyEvent error = %v, want the missing table error", err)
+	}
+
+	for _, code := range []uint16{0, 1213} {
+		s := &MariaDBSyncer{cfg: config.SyncConfig{IgnoreErrorCodes: []uint16{code}}}
+		if _, err := s.ignoreErrorCodes(); err == nil {
+			t.Errorf("ignore_error_codes %d accepted, want an error", code)
+		}
+	}
+}
+
+func TestConflictResolution(t *testing.T) {
+	rec := &recorder{query: func(query string, args []driver.Value) (driver.Rows, error) {
+		if !strings.Contains(query, "FOR UPDATE") {
+			return nil, fmt.Errorf("unexpected query %s", query)
+		}
+		if args[0] == int64(1) {
+			return &staticRows{columns: []string{"id", "name"}, values: [][]driver.Value{{int64(1), []byte("old")}}}, nil
+		}
+		return &staticRows{columns: []string{"id", "name"}}, nil
+	}}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	target.tableMap.InsertMode = insertModeUpsert
+	insert := &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{
+		{int64(1), "new"}, {int64(2), "b"},
+	}}
+
+	// skip keeps the existing row and inserts the other one
+	target.tableMap.ConflictResolution = conflictSkip
+	if _, err := h.applyRows(target, insert); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [2 b]", "COMMIT"}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("skip wrote %q, want %q", rec.stmts, want)
+	}
+
+	// A registered resolver wins over conflict_resolution; its result is written
+	var existing, incoming map[string]interface{}
+	h.resolvers = conflictResolvers{"src.users": func(e, i map[string]interface{}) map[string]interface{} {
+		existing, incoming = e, i
+		return map[string]interface{}{"id": int64(9), "name": string(e["name"].([]byte)) + "+" + i["name"].(string)}
+	}}
+	rec.stmts = nil
+	if _, err := h.applyRows(target, insert); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"UPDATE `dst`.`users` SET `name` = ? WHERE `id` = ? [old+new 1]",
+		"INSERT INTO `dst`.`users` (`id`, `name`) VALUES (?,?) [2 b]",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("resolver wrote %q, want %q", rec.stmts, want)
+	}
+	if incoming["name"] != "new" || existing["id"] != int64(1) {
+		t.Errorf("resolver got existing %v and incoming %v", existing, incoming)
+	}
+
+	// Resolving to the values the row already has affects no row, which strict_apply accepts
+	h.resolvers = conflictResolvers{"src.users": func(e, i map[string]interface{}) map[string]interface{} { return e }}
+	h.strictApply = true
+	rec.noRows = true
+	rec.stmts = nil
+	unchanged := &canal.RowsEvent{Table: target.table, Action: canal.InsertAction, Rows: [][]interface{}{{int64(1), "old"}}}
+	if _, err := h.applyRows(target, unchanged); err != nil {
+		t.Fatalf("unchanged conflict: %v", err)
+	}
+	want = []string{"UPDATE `dst`.`users` SET `name` = ? WHERE `id` = ? [[111 108 100] 1]", "COMMIT"}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("unchanged conflict wrote %q, want %q", rec.stmts, want)
+	}
+	h.strictApply, rec.noRows = false, false
+
+	// Other insert modes never resolve
+	target.tableMap.InsertMode = insertModeInsert
+	if h.conflictResolver(target) != nil {
+		t.Error("insert mode insert resolves conflicts")
+	}
+
+	newest := newestTimestampResolver("updated_at")
+	row := func(ts interface{}) map[string]interface{} { return map[string]interface{}{"updated_at": ts} }
+	for _, tc := range []struct {
+		existing, incoming interface{}
+		write              bool
+	}{
+		{[]byte("2024-05-01 10:00:00"), "2024-05-01 10:00:01", true},
+		{[]byte("2024-05-01 10:00:00.5"), "2024-05-01 10:00:00", false},
+		{time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), "2024-05-01 00:00:00", true}, // a tie goes to the source
+		{nil, "2024-05-01 00:00:00", true},
+		{[]byte("2024-05-01 00:00:00"), nil, false},
+		{[]byte("10"), int64(9), false},
+		{int64(9), uint64(10), true},
+	} {
+		if got := newest(row(tc.existing), row(tc.incoming)) != nil; got != tc.write {
+			t.Errorf("newest-timestamp with existing %v and incoming %v writes = %v, want %v", tc.existing, tc.incoming, got, tc.write)
+		}
+	}
+
+	for _, tc := range []struct {
+		tableMap config.TableMapping
+		wantErr  bool
+	}{
+		{tableMap: config.TableMapping{}},
+		{tableMap: config.TableMapping{InsertMode: "upsert", ConflictResolution: "skip"}},
+		{tableMap: config.TableMapping{InsertMode: "upsert", ConflictResolution: "newest-timestamp", ConflictTimestampColumn: "updated_at"}},
+		{tableMap: config.TableMapping{InsertMode: "upsert", ConflictResolution: "newest-timestamp"}, wantErr: true},
+		{tableMap: config.TableMapping{ConflictResolution: "source-wins"}, wantErr: true},
+		{tableMap: config.TableMapping{InsertMode: "upsert", ConflictResolution: "oldest"}, wantErr: true},
+		{tableMap: config.TableMapping{ConflictTimestampColumn: "updated_at"}, wantErr: true},
+	} {
+		if err := validateConflictResolution("src.users", tc.tableMap); (err != nil) != tc.wantErr {
+			t.Errorf("validateConflictResolution(%+v) = %v, want error %v", tc.tableMap, err, tc.wantErr)
+		}
+	}
+}
+
+func TestPropagateTruncate(t *testing.T) {
+	rec := &recorder{}
+	h, target, done := newUsersTarget(rec, false)
+	defer done()
+	h.binlogFile = "bin.000001"
+	truncate := func(pos uint32, query string) {
+		t.Helper()
+		event := &replication.QueryEvent{Schema: []byte("src"), Query: []byte(query)}
+		if err := h.OnDDL(&replication.EventHeader{LogPos: pos}, mysql.Position{}, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setMapping := func(tableMap config.TableMapping) {
+		h.mappings = []config.DatabaseMapping{{SourceDatabase: "src", TargetDatabase: "dst", Tables: []config.TableMapping{tableMap}}}
+	}
+	setMapping(target.tableMap)
+
+	// Off by default, since it is destructive
+	truncate(100, "TRUNCATE TABLE users")
+	if len(rec.stmts) != 0 {
+		t.Fatalf("TRUNCATE without propagate_truncate wrote %q", rec.stmts)
+	}
+
+	h.propagateTruncate = true
+	truncate(200, "TRUNCATE TABLE users")
+	truncate(300, "TRUNCATE TABLE src.orders") // not mapped
+	want := []string{"DELETE FROM `dst`.`users` []"}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("TRUNCATE wrote %q, want %q", rec.stmts, want)
+	}
+	// Read again after a restart, it would also delete the rows inserted after it
+	rec.stmts = nil
+	truncate(200, "TRUNCATE TABLE users")
+	if len(rec.stmts) != 0 {
+		t.Errorf("replayed TRUNCATE wrote %q", rec.stmts)
+	}
+
+	tagged := target.tableMap
+	tagged.SourceTag = "origin"
+	tagged.SoftDelete = &config.SoftDeleteConfig{Column: "deleted_at", Value: "NOW()"}
+	setMapping(tagged)
+	truncate(400, "TRUNCATE users")
+	marked := tagged
+	marked.SourceTag = ""
+	marked.SoftDelete = &config.SoftDeleteConfig{Column: "is_deleted", Value: "1"}
+	setMapping(marked)
+	truncate(500, "TRUNCATE users")
+	want = []string{
+		"UPDATE `dst`.`users` SET `deleted_at` = NOW() WHERE `deleted_at` IS NULL AND `origin` = ? [src.users]",
+		"UPDATE `dst`.`users` SET `is_deleted` = ? WHERE NOT (`is_deleted` <=> ?) [1 1]",
+	}
+	if !reflect.DeepEqual(rec.stmts, want) {
+		t.Errorf("soft TRUNCATE wrote %q, want %q", rec.stmts, want)
+	}
+
+	// Tables that do not replicate deletes keep their rows
+	rec.stmts = nil
+	noDeletes := target.tableMap
+	noDeletes.Actions = []string{"insert", "update"}
+	setMapping(noDeletes)
+	truncate(600, "TRUNCATE users")
+	if len(rec.stmts) != 0 {
+		t.Errorf("TRUNCATE of a table without deletes wrote %q", rec.stmts)
+	}
+
+	// A failed delete stops the sync rather than leaving stale rows behind
+	setMapping(target.tableMap)
+	h.retryMaxAttempts = 1
+	rec.exec = func(string, []driver.Value) error { return errors.New("lock wait timeout") }
+	event := &replication.QueryEvent{Schema: []byte("src"), Query: []byte("TRUNCATE users")}
+	var applyErr *ApplyError
+	if err := h.OnDDL(&replication.EventHeader{LogPos: 700}, mysql.Position{}, event); !errors.As(err, &applyErr) || applyErr.Action != "truncate" {
+		t.Errorf("failed TRUNCATE returned %v, want an ApplyError", err)
+	}
+}
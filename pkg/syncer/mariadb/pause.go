@@ -0,0 +1,72 @@
+package mariadb
+
+import (
+	"context"
+	"sync"
+)
+
+// pauseGate holds back target writes while the syncer is paused. The zero value is open.
+type pauseGate struct {
+	mu      sync.Mutex
+	resumed chan struct{} // closed by Resume; nil while not paused
+}
+
+// Pause stops writing to the target. The event being applied completes; the next one waits,
+// which also stops canal from reading further and from advancing the synced position, so
+// no event is dropped. Pausing an already paused syncer has no effect.
+func (s *MariaDBSyncer) Pause() {
+	if s.pause.pause() {
+		s.logger.Info("[MariaDB] Synchronization paused")
+	}
+}
+
+// Resume continues writing to the target after Pause
+func (s *MariaDBSyncer) Resume() {
+	s.pause.mu.Lock()
+	defer s.pause.mu.Unlock()
+	if s.pause.resumed != nil {
+		close(s.pause.resumed)
+		s.pause.resumed = nil
+		s.logger.Info("[MariaDB] Synchronization resumed")
+	}
+}
+
+// pause closes the gate, reporting whether it was open
+func (g *pauseGate) pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		return false
+	}
+	g.resumed = make(chan struct{})
+	return true
+}
+
+// paused reports whether Pause is in effect
+func (g *pauseGate) paused() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resumed != nil
+}
+
+// wait blocks while paused, returning early with the context error when ctx ends
+func (g *pauseGate) wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
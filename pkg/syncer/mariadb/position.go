@@ -0,0 +1,248 @@
+package mariadb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/sirupsen/logrus"
+)
+
+// binlogPosition is the persisted replication state. The embedded Position keeps the
+// file format compatible with position files written before GTID support.
+type binlogPosition struct {
+	mysql.Position
+	GTIDSet string `json:"GTIDSet,omitempty"`
+}
+
+// appliedPosition is the last position whose events were all written to the target. Canal
+// moves its synced position before OnPosSynced writes the rows batched or queued for the
+// workers, so that position can run ahead of rows that failed; saves and reconnects use this
+// one instead.
+type appliedPosition struct {
+	mu   sync.Mutex
+	pos  mysql.Position
+	gset mysql.GTIDSet
+}
+
+// set records that every event up to pos, or gset, was written to the target
+func (a *appliedPosition) set(pos mysql.Position, gset mysql.GTIDSet) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pos, a.gset = pos, gset
+}
+
+// get returns the applied position and GTID set; an empty position means none was recorded
+func (a *appliedPosition) get() (mysql.Position, mysql.GTIDSet) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.gset == nil {
+		return a.pos, nil
+	}
+	return a.pos, a.gset.Clone()
+}
+
+// resumeFrom returns where a restarted canal starts: the applied position, or GTID set in
+// GTID mode, and otherwise the start position and GTID set of the stopped canal
+func (s *MariaDBSyncer) resumeFrom(h *MariaDBEventHandler, startPos *mysql.Position, startGTID mysql.GTIDSet) (*mysql.Position, mysql.GTIDSet) {
+	pos, gset := h.applied.get()
+	switch {
+	case s.cfg.UseGTID && gset != nil:
+		return nil, gset
+	case pos.Name != "":
+		return &pos, nil
+	}
+	return startPos, startGTID
+}
+
+// positionState builds the persisted state for a position, keeping the GTID set only in GTID mode
+func (s *MariaDBSyncer) positionState(pos mysql.Position, gset mysql.GTIDSet) binlogPosition {
+	state := binlogPosition{Position: pos}
+	if s.cfg.UseGTID && gset != nil {
+		state.GTIDSet = gset.String()
+	}
+	return state
+}
+
+// savePosition persists the position h applied up to and records it in the status; it saves
+// nothing before the first one is recorded
+func (s *MariaDBSyncer) savePosition(h *MariaDBEventHandler) error {
+	// Holding the lock from read to write keeps a slower save from overwriting a newer position
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	pos, gset := h.applied.get()
+	if pos.Name == "" && gset == nil {
+		return nil
+	}
+	return s.persistPosition(s.positionState(pos, gset))
+}
+
+// saveSyncedPosition persists a position reported by OnPosSynced
+func (s *MariaDBSyncer) saveSyncedPosition(pos mysql.Position, gset mysql.GTIDSet) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	return s.persistPosition(s.positionState(pos, gset))
+}
+
+// holdSaves stops or resumes position saves. While ResyncTable holds back the events of a
+// table the applied position moves past them, and a restart from a saved one would lose them.
+func (s *MariaDBSyncer) holdSaves(held bool) {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.savesHeld = held
+}
+
+// persistPosition writes the position to the position store and records the save in the
+// status, unless saves are held; callers hold saveMu. The final save runs after the sync
+// context ended, so saves get a context of their own.
+func (s *MariaDBSyncer) persistPosition(state binlogPosition) error {
+	if s.savesHeld {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultWriteTimeout)
+	defer cancel()
+	if err := s.positions.save(ctx, state); err != nil {
+		return err
+	}
+	s.status.positionSaved(state.Position)
+	return nil
+}
+
+// startOverride returns the position or GTID set start_position_file, start_position_offset
+// and start_gtid force canal to start from, or neither when none is set. An override replaces
+// the saved position, so it must be confirmed with confirm_start_override.
+func (s *MariaDBSyncer) startOverride(flavor string) (*mysql.Position, mysql.GTIDSet, error) {
+	file, offset, gtid := s.cfg.StartPositionFile, s.cfg.StartPositionOffset, s.cfg.StartGTID
+	switch {
+	case file == "" && offset == 0 && gtid == "":
+		return nil, nil, nil
+	case !s.cfg.ConfirmStartOverride:
+		return nil, nil, fmt.Errorf("start_position_file, start_position_offset and start_gtid for MariaDB ignore the saved position; set confirm_start_override to use them")
+	case gtid != "" && (file != "" || offset != 0):
+		return nil, nil, fmt.Errorf("start_gtid for MariaDB cannot be combined with start_position_file or start_position_offset")
+	case gtid != "":
+		if !s.cfg.UseGTID {
+			return nil, nil, fmt.Errorf("start_gtid for MariaDB requires use_gtid")
+		}
+		gset, err := mysql.ParseGTIDSet(flavor, gtid)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid start_gtid %q for MariaDB: %w", gtid, err)
+		}
+		return nil, gset, nil
+	case file == "":
+		return nil, nil, fmt.Errorf("start_position_offset for MariaDB requires start_position_file")
+	}
+	if offset == 0 {
+		// The first event follows the 4-byte binlog header
+		offset = 4
+	}
+	return &mysql.Position{Name: file, Pos: offset}, nil, nil
+}
+
+// saveBinlogPosition writes the binlog position atomically so readers never see a partial file
+func saveBinlogPosition(path string, pos binlogPosition) error {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return fmt.Errorf("failed to marshal binlog position: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a temp file in the same directory and renames it over path
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory for MariaDB state file %s: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp state file in %s: %w", dir, err)
+	}
+	tmpPath := tmp.Name()
+	// Removing after a successful rename is a harmless no-op
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file %s: %w", tmpPath, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync state file %s: %w", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close state file %s: %w", tmpPath, err)
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return fmt.Errorf("failed to chmod state file %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace state file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadBinlogPosition reads the binlog position file
+func loadBinlogPosition(path string, logger *logrus.Logger) *binlogPosition {
+	positionDir := filepath.Dir(path)
+	if err := os.MkdirAll(positionDir, os.ModePerm); err != nil {
+		logger.Errorf("Failed to create directory for MariaDB position file %s: %v", path, err)
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Infof("No previous binlog position file at %s: %v", path, err)
+		return nil
+	}
+	if len(data) <= 1 {
+		logger.Infof("Binlog position file for %s is empty", path)
+		return nil
+	}
+	var pos binlogPosition
+	if err := json.Unmarshal(data, &pos); err != nil {
+		logger.Errorf("Failed to unmarshal binlog position from %s: %v", path, err)
+		return nil
+	}
+	return &pos
+}
+
+// OnRotate tracks the binlog file that the following events belong to
+func (h *MariaDBEventHandler) OnRotate(header *replication.EventHeader, rotateEvent *replication.RotateEvent) error {
+	// Events written before are recorded against the file they were read from
+	if err := h.flush(); err != nil {
+		return err
+	}
+	h.binlogFile = string(rotateEvent.NextLogName)
+	return nil
+}
+
+// alreadyApplied reports whether an event ends at or before the last applied position,
+// which happens when canal redelivers the event at the resume point
+func (h *MariaDBEventHandler) alreadyApplied(header *replication.EventHeader) bool {
+	if header == nil || header.LogPos == 0 || h.binlogFile == "" || h.lastApplied.Name == "" {
+		return false
+	}
+	pos := mysql.Position{Name: h.binlogFile, Pos: header.LogPos}
+	return pos.Compare(h.lastApplied) <= 0
+}
+
+// markApplied records the end position of an applied event
+func (h *MariaDBEventHandler) markApplied(header *replication.EventHeader) {
+	if header == nil || header.LogPos == 0 || h.binlogFile == "" {
+		return
+	}
+	pos := mysql.Position{Name: h.binlogFile, Pos: header.LogPos}
+	if h.catchUp != nil && pos.Compare(h.lastApplied) <= 0 {
+		// Catching up on added tables must not move back the point other tables skip to
+		return
+	}
+	h.lastApplied = pos
+}
@@ -0,0 +1,122 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Position stores selectable with position_store
+const (
+	positionStoreFile = "file"
+	positionStoreDB   = "db"
+)
+
+// positionStore persists the replication position between runs
+type positionStore interface {
+	// load returns the saved position, or nil when there is none
+	load(ctx context.Context) (*binlogPosition, error)
+	save(ctx context.Context, pos binlogPosition) error
+}
+
+// openPositionStore opens the configured position store; targetDB holds a position table.
+// It returns nil when positions are not persisted.
+func (s *MariaDBSyncer) openPositionStore(ctx context.Context, targetDB *sql.DB, sourceAddr string) (positionStore, error) {
+	switch s.cfg.PositionStore {
+	case "", positionStoreFile:
+		if s.cfg.PositionTable != "" || s.cfg.PositionKey != "" {
+			return nil, fmt.Errorf("position_table and position_key for MariaDB require position_store %s", positionStoreDB)
+		}
+		if s.cfg.MySQLPositionPath == "" {
+			return nil, nil
+		}
+		return &filePositionStore{path: s.cfg.MySQLPositionPath, logger: s.logger}, nil
+	case positionStoreDB:
+		if strings.Count(s.cfg.PositionTable, ".") != 1 {
+			return nil, fmt.Errorf("invalid position_table %q for MariaDB: must be db.table", s.cfg.PositionTable)
+		}
+		key := s.cfg.PositionKey
+		if key == "" {
+			key = sourceAddr
+		}
+		db, table, _ := strings.Cut(s.cfg.PositionTable, ".")
+		store := &dbPositionStore{db: targetDB, table: quoteTable(db, table), key: key}
+		if err := store.create(ctx); err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("invalid position_store %q for MariaDB: must be %s or %s",
+			s.cfg.PositionStore, positionStoreFile, positionStoreDB)
+	}
+}
+
+// filePositionStore keeps the position as JSON in mysql_position_path
+type filePositionStore struct {
+	path   string
+	logger *logrus.Logger
+}
+
+// load reads the position file. A missing, empty or unreadable file is logged and starts
+// without a saved position.
+func (f *filePositionStore) load(context.Context) (*binlogPosition, error) {
+	return loadBinlogPosition(f.path, f.logger), nil
+}
+
+func (f *filePositionStore) save(_ context.Context, pos binlogPosition) error {
+	return saveBinlogPosition(f.path, pos)
+}
+
+// dbPositionStore keeps the position as JSON in a row of a target table, keyed by source,
+// so a syncer restarted without its local files resumes from it
+type dbPositionStore struct {
+	db    *sql.DB
+	table string // quoted db.table
+	key   string
+}
+
+// create creates the position table unless it exists
+func (d *dbPositionStore) create(ctx context.Context) error {
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (`sync_key` VARCHAR(255) NOT NULL PRIMARY KEY, "+
+		"`position` TEXT NOT NULL, `updated_at` TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6))", d.table)
+	if _, err := d.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create MariaDB position table %s: %w", d.table, err)
+	}
+	return nil
+}
+
+// load reads the position row of the key; a failed read fails the start rather than
+// copying everything again
+func (d *dbPositionStore) load(ctx context.Context) (*binlogPosition, error) {
+	var data string
+	err := d.db.QueryRowContext(ctx, fmt.Sprintf("SELECT `position` FROM %s WHERE `sync_key` = ?", d.table), d.key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MariaDB binlog position from %s: %w", d.table, err)
+	}
+	var pos binlogPosition
+	if err := json.Unmarshal([]byte(data), &pos); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal MariaDB binlog position from %s: %w", d.table, err)
+	}
+	return &pos, nil
+}
+
+func (d *dbPositionStore) save(ctx context.Context, pos binlogPosition) error {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return fmt.Errorf("failed to marshal binlog position: %w", err)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (`sync_key`, `position`) VALUES (?, ?) "+
+		"ON DUPLICATE KEY UPDATE `position` = VALUES(`position`)", d.table)
+	if _, err := d.db.ExecContext(ctx, query, d.key, string(data)); err != nil {
+		return fmt.Errorf("failed to save MariaDB binlog position to %s: %w", d.table, err)
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+const (
+	defaultPreflightMaxAttempts = 10
+	defaultPreflightTimeout     = 2 * time.Minute
+)
+
+// preflightPolicy returns the connection attempts and overall time the startup check waits
+// for each database, defaulting unset values
+func (s *MariaDBSyncer) preflightPolicy() (int, time.Duration, error) {
+	attempts, timeout := s.cfg.PreflightMaxAttempts, s.cfg.PreflightTimeout
+	if attempts < 0 {
+		return 0, 0, fmt.Errorf("invalid preflight_max_attempts %d for MariaDB: must not be negative", attempts)
+	}
+	if timeout < 0 {
+		return 0, 0, fmt.Errorf("invalid preflight_timeout %s for MariaDB: must be positive", timeout)
+	}
+	if attempts == 0 {
+		attempts = defaultPreflightMaxAttempts
+	}
+	if timeout == 0 {
+		timeout = defaultPreflightTimeout
+	}
+	return attempts, timeout, nil
+}
+
+// preflight waits until the source and the target accept connections. sql.Open does not
+// connect, so without it a database still starting up would only fail the first query.
+func (s *MariaDBSyncer) preflight(ctx context.Context, targetDSN string) error {
+	attempts, timeout, err := s.preflightPolicy()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	sourceDB, err := s.openSource()
+	if err != nil {
+		return fmt.Errorf("failed to open source DB for MariaDB: %w", err)
+	}
+	defer sourceDB.Close()
+	if err := s.pingWithRetry(ctx, sourceDB, "source", attempts, defaultReconnectBaseDelay, timeout); err != nil {
+		return err
+	}
+
+	targetDB, err := sql.Open("mysql", targetDSN)
+	if err != nil {
+		return fmt.Errorf("failed to open target DB for MariaDB: %w", err)
+	}
+	defer targetDB.Close()
+	return s.pingWithRetry(ctx, targetDB, "target", attempts, defaultReconnectBaseDelay, timeout)
+}
+
+// pingWithRetry pings db until it answers, waiting with exponential backoff from delay
+// between attempts, and gives up after attempts pings or once timeout has passed
+func (s *MariaDBSyncer) pingWithRetry(ctx context.Context, db *sql.DB, name string, attempts int, delay, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = db.PingContext(ctx); err == nil {
+			if attempt > 1 {
+				s.logger.Infof("[MariaDB] %s is reachable after %d attempts", name, attempt)
+			}
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+		wait := reconnectDelay(delay, attempt)
+		s.logger.Warnf("[MariaDB] %s is not reachable (attempt %d/%d), retrying in %v: %v", name, attempt, attempts, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return &ConnectionError{Database: name, Err: fmt.Errorf("MariaDB %s is not reachable within %v: %w", name, timeout, err)}
+		}
+	}
+	return &ConnectionError{Database: name, Err: fmt.Errorf("MariaDB %s is not reachable after %d attempts: %w", name, attempts, err)}
+}
+
+// MySQL error numbers of a target write refused by privileges or read_only, as opposed to
+// a canary row the table's constraints reject
+var writeDeniedErrorNumbers = map[uint16]bool{
+	1036: true, // ER_OPEN_AS_READONLY
+	1044: true, // ER_DBACCESS_DENIED_ERROR
+	1142: true, // ER_TABLEACCESS_DENIED_ERROR
+	1227: true, // ER_SPECIFIC_ACCESS_DENIED_ERROR
+	1290: true, // ER_OPTION_PREVENTS_STATEMENT, e.g. read_only
+}
+
+// PreflightCheck is the outcome of one check run by Preflight
+type PreflightCheck struct {
+	Name   string // what was checked, e.g. "source binlog format"
+	Detail string // what was found
+	Err    error  // nil when the check passed or could not run
+}
+
+// PreflightError reports that Preflight found problems. Checks lists every check in the
+// order they ran, including those that passed.
+type PreflightError struct {
+	Checks []PreflightCheck
+}
+
+func (e *PreflightError) Error() string {
+	var failed []string
+	for _, c := range e.Checks {
+		if c.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", c.Name, c.Err))
+		}
+	}
+	return fmt.Sprintf("MariaDB preflight failed %d of %d checks:\n%s", len(failed), len(e.Checks), strings.Join(failed, "\n"))
+}
+
+// Unwrap returns the errors of the failed checks, such as a ConnectionError
+func (e *PreflightError) Unwrap() []error {
+	var errs []error
+	for _, c := range e.Checks {
+		if c.Err != nil {
+			errs = append(errs, c.Err)
+		}
+	}
+	return errs
+}
+
+// Preflight checks before going live that the syncer can run: that the source and the target
+// accept connections with the configured TLS, SSH tunnel and dialers, that the source writes
+// a ROW format binlog its user may read with REPLICATION SLAVE, and that the first enabled
+// target table accepts writes, by inserting and deleting a canary row in a transaction that
+// is rolled back. It runs every check it can, logs each, and returns a *PreflightError listing
+// them all when any failed. Unlike Start it does not wait for the databases to come up. Call
+// it before Start, not while the syncer runs.
+func (s *MariaDBSyncer) Preflight(ctx context.Context) error {
+	if problems := ValidateConfig(s.cfg); len(problems) > 0 {
+		return &ConfigError{Err: fmt.Errorf("invalid MariaDB configuration:\n%w", errors.Join(problems...))}
+	}
+	conns, err := s.prepareConnections()
+	if err != nil {
+		return err
+	}
+	defer conns.release()
+
+	sourceDB, err := s.openSource()
+	if err != nil {
+		return &ConfigError{Err: fmt.Errorf("failed to open source DB for MariaDB: %w", err)}
+	}
+	defer sourceDB.Close()
+	targetDB, err := sql.Open("mysql", conns.targetDSN)
+	if err != nil {
+		return &ConfigError{Err: fmt.Errorf("failed to open target DB for MariaDB: %w", err)}
+	}
+	defer targetDB.Close()
+
+	var database, table string
+	for _, mapping := range s.cfg.Mappings {
+		for _, tableMap := range mapping.Tables {
+			if tableMap.IsEnabled() && table == "" {
+				database, table = mapping.TargetDatabase, tableMap.TargetTable
+			}
+		}
+	}
+
+	checks := runPreflightChecks(ctx, sourceDB, targetDB, database, table)
+	failed := false
+	for _, c := range checks {
+		if c.Err != nil {
+			failed = true
+			s.logger.Errorf("[MariaDB] Preflight %s: %v", c.Name, c.Err)
+			continue
+		}
+		s.logger.Infof("[MariaDB] Preflight %s: %s", c.Name, c.Detail)
+	}
+	if failed {
+		return &PreflightError{Checks: checks}
+	}
+	return nil
+}
+
+// runPreflightChecks runs the checks of Preflight, skipping those of a database that cannot
+// be reached, and the write check without a target table
+func runPreflightChecks(ctx context.Context, source, target *sql.DB, database, table string) []PreflightCheck {
+	var checks []PreflightCheck
+	if err := source.PingContext(ctx); err != nil {
+		checks = append(checks,
+			PreflightCheck{Name: "source connection", Err: &ConnectionError{Database: "source", Err: err}},
+			PreflightCheck{Name: "source binlog", Detail: "not checked, the source is not reachable"},
+			PreflightCheck{Name: "source replication privilege", Detail: "not checked, the source is not reachable"})
+	} else {
+		checks = append(checks,
+			PreflightCheck{Name: "source connection", Detail: "reachable"},
+			checkBinlog(ctx, source),
+			checkReplicationGrant(ctx, source))
+	}
+
+	const writeCheck = "target write access"
+	switch err := target.PingContext(ctx); {
+	case err != nil:
+		checks = append(checks,
+			PreflightCheck{Name: "target connection", Err: &ConnectionError{Database: "target", Err: err}},
+			PreflightCheck{Name: writeCheck, Detail: "not checked, the target is not reachable"})
+	case table == "":
+		checks = append(checks,
+			PreflightCheck{Name: "target connection", Detail: "reachable"},
+			PreflightCheck{Name: writeCheck, Detail: "not checked, no table is enabled"})
+	default:
+		checks = append(checks,
+			PreflightCheck{Name: "target connection", Detail: "reachable"},
+			checkTargetWrite(ctx, target, database, table))
+	}
+	return checks
+}
+
+// showVariable returns the value of a server variable, empty when the server has none
+func showVariable(ctx context.Context, db *sql.DB, name string) (string, error) {
+	var varName, value string
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SHOW VARIABLES LIKE '%s'", name)).Scan(&varName, &value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// checkBinlog checks that the source has binary logging enabled in ROW format
+func checkBinlog(ctx context.Context, db *sql.DB) PreflightCheck {
+	check := PreflightCheck{Name: "source binlog"}
+	logBin, err := showVariable(ctx, db, "log_bin")
+	if err != nil {
+		check.Err = fmt.Errorf("failed to read log_bin: %w", err)
+		return check
+	}
+	if !strings.EqualFold(logBin, "ON") && logBin != "1" {
+		check.Err = fmt.Errorf("binary logging is disabled (log_bin is %q)", logBin)
+		return check
+	}
+	format, err := showVariable(ctx, db, "binlog_format")
+	if err != nil {
+		check.Err = fmt.Errorf("failed to read binlog_format: %w", err)
+		return check
+	}
+	if !strings.EqualFold(format, "ROW") {
+		check.Err = fmt.Errorf("binlog_format is %q, row events require ROW", format)
+		return check
+	}
+	check.Detail = "enabled in ROW format"
+	return check
+}
+
+// checkReplicationGrant checks that the source user may stream the binlog. Privileges granted
+// through a role are not resolved, so such a user fails the check.
+func checkReplicationGrant(ctx context.Context, db *sql.DB) PreflightCheck {
+	check := PreflightCheck{Name: "source replication privilege"}
+	rows, err := db.QueryContext(ctx, "SHOW GRANTS")
+	if err != nil {
+		check.Err = fmt.Errorf("failed to read the grants of the source user: %w", err)
+		return check
+	}
+	defer rows.Close()
+	var grants []string
+	for rows.Next() {
+		var grant string
+		if err := rows.Scan(&grant); err != nil {
+			check.Err = fmt.Errorf("failed to read the grants of the source user: %w", err)
+			return check
+		}
+		grants = append(grants, grant)
+		upper := strings.ToUpper(grant)
+		if strings.Contains(upper, "REPLICATION SLAVE") || strings.Contains(upper, "REPLICATION REPLICA") ||
+			strings.Contains(upper, "ALL PRIVILEGES ON *.*") {
+			check.Detail = "granted"
+			return check
+		}
+	}
+	if err := rows.Err(); err != nil {
+		check.Err = fmt.Errorf("failed to read the grants of the source user: %w", err)
+		return check
+	}
+	check.Err = fmt.Errorf("the source user lacks REPLICATION SLAVE; its grants are: %s", strings.Join(grants, "; "))
+	return check
+}
+
+// checkTargetWrite inserts and deletes a canary row of default values in database.table, in a
+// transaction that is rolled back. A table that cannot roll back is not written. A canary the
+// table's constraints reject still shows that the insert was permitted, and without a single
+// column key the delete runs on no row.
+func checkTargetWrite(ctx context.Context, db *sql.DB, database, table string) PreflightCheck {
+	name := database + "." + table
+	check := PreflightCheck{Name: "target write access to " + name}
+	var engine sql.NullString
+	err := db.QueryRowContext(ctx,
+		"SELECT ENGINE FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", database, table).Scan(&engine)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		check.Err = fmt.Errorf("target table %s does not exist", name)
+		return check
+	case err != nil:
+		check.Err = fmt.Errorf("failed to look up target table %s: %w", name, err)
+		return check
+	case !strings.EqualFold(engine.String, "InnoDB"):
+		check.Detail = fmt.Sprintf("not checked, engine %s cannot roll back a canary row", engine.String)
+		return check
+	}
+	pkCols, err := primaryKeyColumns(ctx, db, database, table)
+	if err != nil {
+		check.Err = fmt.Errorf("failed to look up primary key of %s: %w", name, err)
+		return check
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		check.Err = fmt.Errorf("failed to begin target transaction: %w", err)
+		return check
+	}
+	defer tx.Rollback()
+
+	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE 1 = 0", quoteTable(database, table))
+	var deleteArgs []interface{}
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s () VALUES ()", quoteTable(database, table)))
+	var myErr *mysqldriver.MySQLError
+	switch {
+	case errors.As(err, &myErr) && writeDeniedErrorNumbers[myErr.Number]:
+		check.Err = fmt.Errorf("insert into %s was refused: %w", name, err)
+		return check
+	case err != nil:
+		check.Detail = fmt.Sprintf("insert permitted, though the table rejects a canary row of default values (%v); ", err)
+	default:
+		if id, err := res.LastInsertId(); err == nil && id > 0 && len(pkCols) == 1 {
+			deleteSQL = fmt.Sprintf("DELETE FROM %s WHERE %s = ?", quoteTable(database, table), quoteIdent(pkCols[0]))
+			deleteArgs = []interface{}{id}
+			check.Detail = "canary row inserted; "
+		} else {
+			check.Detail = "canary row inserted but not keyed by an auto-increment primary key; "
+		}
+	}
+	if _, err := tx.ExecContext(ctx, deleteSQL, deleteArgs...); err != nil {
+		check.Err = fmt.Errorf("delete from %s was refused: %w", name, err)
+		return check
+	}
+	if err := tx.Rollback(); err != nil {
+		check.Err = fmt.Errorf("failed to roll back the canary row in %s: %w", name, err)
+		return check
+	}
+	check.Detail += "delete permitted, rolled back"
+	return check
+}
@@ -0,0 +1,93 @@
+package mariadb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/retail-ai-inc/sync/pkg/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultInitialSyncProgressInterval = 30 * time.Second
+
+// initialSyncProgressPolicy returns how often the initial sync logs the progress of a table:
+// every so many rows, 0 for no row limit, and at least every interval
+func (s *MariaDBSyncer) initialSyncProgressPolicy() (int, time.Duration, error) {
+	rows, interval := s.cfg.InitialSyncProgressRows, s.cfg.InitialSyncProgressInterval
+	if rows < 0 {
+		return 0, 0, fmt.Errorf("invalid initial_sync_progress_rows %d for MariaDB: must not be negative", rows)
+	}
+	if interval < 0 {
+		return 0, 0, fmt.Errorf("invalid initial_sync_progress_interval %s for MariaDB: must be positive", interval)
+	}
+	if interval == 0 {
+		interval = defaultInitialSyncProgressInterval
+	}
+	return rows, interval, nil
+}
+
+// copyProgress logs the rows/sec and ETA of the copy of one table and keeps its progress
+// gauge current. The row estimate is looked up by its first log unless it is known up front,
+// so tables copied quickly cost no extra query.
+type copyProgress struct {
+	logger   *logrus.Logger
+	table    string       // checkpoint key of the copy
+	total    int64        // estimated rows, 0 when unknown
+	estimate func() int64 // looks up total; nil once it is known
+	every    int64        // rows between logs, 0 for no row limit
+	interval time.Duration
+
+	started, logged time.Time
+	loggedRows      int64
+}
+
+// newCopyProgress starts tracking the copy of table; estimate is nil when total is known
+func (s *MariaDBSyncer) newCopyProgress(table string, total int64, estimate func() int64) *copyProgress {
+	now := time.Now()
+	metrics.SetInitialSyncProgress(metricsType, table, 0)
+	return &copyProgress{
+		logger:   s.logger,
+		table:    table,
+		total:    total,
+		estimate: estimate,
+		every:    int64(s.progressRows),
+		interval: s.progressInterval,
+		started:  now,
+		logged:   now,
+	}
+}
+
+// observe records the rows copied so far and logs them when enough rows or time passed
+func (p *copyProgress) observe(copied int64) {
+	now := time.Now()
+	byRows := p.every > 0 && copied-p.loggedRows >= p.every
+	byTime := p.interval > 0 && now.Sub(p.logged) >= p.interval
+	if (byRows || byTime) && p.estimate != nil {
+		p.total, p.estimate = p.estimate(), nil
+	}
+	if p.total > 0 {
+		metrics.SetInitialSyncProgress(metricsType, p.table, min(float64(copied)/float64(p.total), 1))
+	}
+	if !byRows && !byTime {
+		return
+	}
+	p.logged, p.loggedRows = now, copied
+
+	elapsed := now.Sub(p.started).Seconds()
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(copied) / elapsed
+	}
+	if p.total <= 0 || copied >= p.total || rate == 0 {
+		p.logger.Infof("[MariaDB] Initial sync of %s: %d rows copied, %.0f rows/s", p.table, copied, rate)
+		return
+	}
+	eta := time.Duration(float64(p.total-copied) / rate * float64(time.Second)).Round(time.Second)
+	p.logger.Infof("[MariaDB] Initial sync of %s: %d of about %d rows copied (%.1f%%), %.0f rows/s, ETA %v",
+		p.table, copied, p.total, 100*float64(copied)/float64(p.total), rate, eta)
+}
+
+// done marks the copy complete in the progress gauge
+func (p *copyProgress) done() {
+	metrics.SetInitialSyncProgress(metricsType, p.table, 1)
+}
@@ -0,0 +1,23 @@
+package mariadb
+
+import "strings"
+
+// quoteIdent quotes an identifier with backticks, so reserved words such as order and
+// names with special characters can be used as table and column names
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// quoteTable quotes a database-qualified table name
+func quoteTable(database, table string) string {
+	return quoteIdent(database) + "." + quoteIdent(table)
+}
+
+// quoteIdents quotes each identifier of names
+func quoteIdents(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return quoted
+}
@@ -0,0 +1,103 @@
+package mariadb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+const (
+	defaultReconnectMaxAttempts = 5
+	defaultReconnectBaseDelay   = time.Second
+	maxReconnectDelay           = time.Minute
+	// reconnectResetAfter is how long a canal must run before its failure counts as a new outage
+	reconnectResetAfter = 5 * time.Minute
+)
+
+// Source server errors that clear up on their own; other server errors, such as denied
+// access or a purged binlog, need an operator and stop the sync
+var recoverableSourceErrorCodes = map[uint16]bool{
+	1040: true, // ER_CON_COUNT_ERROR
+	1053: true, // ER_SERVER_SHUTDOWN
+	1205: true, // ER_LOCK_WAIT_TIMEOUT
+	1213: true, // ER_LOCK_DEADLOCK
+}
+
+// isRecoverableCanalError reports whether canal stopped because of a transient failure,
+// such as a restarted source or a lost connection, that a reconnect can get past
+func isRecoverableCanalError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var sourceErr *mysql.MyError
+	if errors.As(err, &sourceErr) {
+		return recoverableSourceErrorCodes[sourceErr.Code]
+	}
+	// Target write failures that outlasted the write retries
+	if isRetriableError(err) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, mysql.ErrBadConn)
+}
+
+// reconnectPolicy returns the reconnect attempts and first delay, defaulting unset values
+func (s *MariaDBSyncer) reconnectPolicy() (int, time.Duration, error) {
+	attempts, delay := s.cfg.ReconnectMaxAttempts, s.cfg.ReconnectBaseDelay
+	if attempts < 0 {
+		return 0, 0, fmt.Errorf("invalid reconnect_max_attempts %d for MariaDB: must not be negative", attempts)
+	}
+	if delay < 0 {
+		return 0, 0, fmt.Errorf("invalid reconnect_base_delay %s for MariaDB: must be positive", delay)
+	}
+	if attempts == 0 {
+		attempts = defaultReconnectMaxAttempts
+	}
+	if delay == 0 {
+		delay = defaultReconnectBaseDelay
+	}
+	return attempts, delay, nil
+}
+
+// reconnectDelay doubles the base delay per attempt, capped at maxReconnectDelay
+func reconnectDelay(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < maxReconnectDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxReconnectDelay {
+		delay = maxReconnectDelay
+	}
+	return delay
+}
+
+// runCanal runs c from the GTID set, the position or canal's default start, in that order
+// of preference, and reports its exit on the returned channel
+func runCanal(c *canal.Canal, startPos *mysql.Position, startGTID mysql.GTIDSet) <-chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		switch {
+		case startGTID != nil:
+			errCh <- c.StartFromGTID(startGTID)
+		case startPos != nil:
+			errCh <- c.RunFrom(*startPos)
+		default:
+			errCh <- c.Run()
+		}
+	}()
+	return errCh
+}
@@ -0,0 +1,307 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// liveSync is the part of a running incremental sync Reload works with
+type liveSync struct {
+	ctx      context.Context
+	targetDB *sql.DB
+	mode     string
+	canal    *atomic.Pointer[canal.Canal] // the canal currently running
+	reloads  chan *reloadRequest
+}
+
+// reloadRequest hands validated mappings to the sync loop, which swaps them in while canal
+// is stopped, so OnRow never sees them change under it
+type reloadRequest struct {
+	mappings     []config.DatabaseMapping
+	filters      map[string]*rowFilter
+	generated    map[string]map[string]bool // generated columns of target_connection
+	destinations map[string]*destination    // extra targets with their reloaded generated columns
+	include      []string                   // canal include and exclude regexes
+	exclude      []string
+	startPos     *mysql.Position // where canal restarts; nil resumes from the synced position
+	catchUp      map[string]bool // added source db.table whose events are applied from startPos
+	resync       map[string]bool // source db.table whose events are held back, see ResyncTable
+	resumedAt    mysql.Position  // synced position of the stopped canal, set by the sync loop
+	done         chan error
+}
+
+// Reload applies changed table mappings to the running incremental sync without dropping
+// its binlog stream. In full+incremental mode added tables are copied by the initial sync
+// first while the other tables keep streaming; canal then restarts from the position the
+// copy began at, or from its consistent snapshot, and applies the events read again only to
+// the added tables, upserting their inserts since the copy may hold them already. Removed
+// tables stop syncing, and changed mappings apply to the events that follow. Extra targets must use connections already open, and settings other than the
+// mappings take effect on the next Start.
+func (s *MariaDBSyncer) Reload(cfg config.SyncConfig) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	live := s.live
+	if live == nil {
+		return fmt.Errorf("MariaDB incremental sync is not running")
+	}
+	ctx := live.ctx
+	cfg.Mappings = prefixTargetDatabases(cfg.Mappings, s.cfg.TargetDatabasePrefix)
+
+	current, next := s.cfg, cfg
+	current.Mappings, next.Mappings = nil, nil
+	if !reflect.DeepEqual(current, next) {
+		s.logger.Warnf("[MariaDB] Reload only applies mapping changes; other settings take effect on restart")
+	}
+	added, removed, changed := diffMappings(s.cfg.Mappings, cfg.Mappings)
+	if len(added)+len(removed)+len(changed) == 0 {
+		s.logger.Info("[MariaDB] Reload found no mapping changes")
+		return nil
+	}
+
+	// Validate everything before the stream is touched, as Start does
+	req := &reloadRequest{mappings: cfg.Mappings, done: make(chan error, 1)}
+	var err error
+	if req.filters, err = buildSourceFilters(cfg.Mappings); err != nil {
+		return err
+	}
+	if err := validateTransforms(cfg.Mappings); err != nil {
+		return err
+	}
+	if err := s.validateMappings(ctx, cfg.Mappings); err != nil {
+		return err
+	}
+	enabled, _ := s.tables.reduce(cfg.Mappings)
+	if req.include, req.exclude, err = canalTableFilters(enabled, s.cfg.ExcludeDatabases, s.cfg.SkipTables); err != nil {
+		return err
+	}
+	if len(req.include) == 0 {
+		return fmt.Errorf("every mapped MariaDB table is disabled")
+	}
+	for _, mapping := range cfg.Mappings {
+		for _, tableMap := range mapping.Tables {
+			for _, et := range tableMap.ExtraTargets {
+				if et.TargetConnection == "" || et.TargetDatabase == "" {
+					return fmt.Errorf("extra target of %s.%s for MariaDB needs target_connection and target_database",
+						mapping.SourceDatabase, tableMap.SourceTable)
+				}
+				if s.destinations[et.TargetConnection] == nil {
+					return fmt.Errorf("extra target of %s.%s uses a connection that is not open; restart the MariaDB syncer to add it",
+						mapping.SourceDatabase, tableMap.SourceTable)
+				}
+			}
+		}
+	}
+	if err := s.createTargetDatabases(ctx, live.targetDB, cfg.Mappings); err != nil {
+		return err
+	}
+	if err := checkSoftDeleteColumns(ctx, live.targetDB, cfg.Mappings); err != nil {
+		return err
+	}
+	if req.generated, err = loadGeneratedColumns(ctx, live.targetDB, cfg.Mappings); err != nil {
+		return err
+	}
+	req.destinations = make(map[string]*destination, len(s.destinations))
+	for conn, d := range s.destinations {
+		reloaded := &destination{name: d.name, db: d.db, stmts: d.stmts}
+		mappings := extraTargetsTo(cfg.Mappings, conn)
+		if err := s.createTargetDatabases(ctx, d.db, mappings); err != nil {
+			return fmt.Errorf("extra target %s: %w", d.name, err)
+		}
+		if err := checkSoftDeleteColumns(ctx, d.db, mappings); err != nil {
+			return fmt.Errorf("extra target %s: %w", d.name, err)
+		}
+		if reloaded.generated, err = loadGeneratedColumns(ctx, d.db, mappings); err != nil {
+			return fmt.Errorf("extra target %s: %w", d.name, err)
+		}
+		req.destinations[conn] = reloaded
+	}
+
+	// Added tables are not streamed yet, so their copy does not race their events; those
+	// written meanwhile are read again once canal restarts from where the copy began
+	if len(added) > 0 && live.mode == config.ModeFullIncremental {
+		start := live.canal.Load().SyncedPosition()
+		req.catchUp = make(map[string]bool, len(added))
+		for _, table := range added {
+			req.catchUp[table] = true
+		}
+		primary := &destination{db: live.targetDB, generated: req.generated}
+		snapshotPos, err := s.doInitialFullSyncIfNeeded(ctx, nil, primary, req.destinations, mappingsOf(cfg.Mappings, req.catchUp))
+		if err != nil {
+			return fmt.Errorf("initial sync of tables added to MariaDB mappings failed: %w", err)
+		}
+		if snapshotPos != nil {
+			start = *snapshotPos
+		}
+		req.startPos = &start
+	}
+
+	if err := live.apply(req); err != nil {
+		return err
+	}
+	s.logger.Infof("[MariaDB] Reloaded mappings: added [%s], removed [%s], changed [%s]",
+		strings.Join(added, ", "), strings.Join(removed, ", "), strings.Join(changed, ", "))
+	return nil
+}
+
+// apply hands req to the sync loop and waits until canal runs with it
+func (l *liveSync) apply(req *reloadRequest) error {
+	select {
+	case l.reloads <- req:
+	case <-l.ctx.Done():
+		return fmt.Errorf("MariaDB sync stopped before the reload was applied")
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-l.ctx.Done():
+		return fmt.Errorf("MariaDB sync stopped before the reload was applied")
+	}
+}
+
+// setLive publishes the running incremental sync to Reload, or withdraws it with nil
+func (s *MariaDBSyncer) setLive(live *liveSync) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.live = live
+}
+
+// applyReload swaps the reloaded mappings into the syncer and the stopped handler
+func (s *MariaDBSyncer) applyReload(h *MariaDBEventHandler, req *reloadRequest) {
+	s.tables.mu.Lock()
+	s.cfg.Mappings = req.mappings
+	s.tables.mu.Unlock()
+	s.tables.start(req.mappings)
+	s.generatedColumns = req.generated
+	s.destinations = req.destinations
+
+	h.mappings = req.mappings
+	h.filters = req.filters
+	h.generatedColumns = req.generated
+	h.destinations = req.destinations
+	h.catchUp = req.catchUp
+	h.unmapped.reset()
+	s.tables.setResyncing(req.resync)
+}
+
+// restartForReload swaps in the mappings of req while canal c is stopped and returns the
+// canal streaming them, with the position it starts from
+func (s *MariaDBSyncer) restartForReload(
+	h *MariaDBEventHandler,
+	c *canal.Canal,
+	cfg *canal.Config,
+	req *reloadRequest,
+) (*canal.Canal, *mysql.Position, mysql.GTIDSet, error) {
+	// Rows of a partly read transaction are read again
+	h.discardPending()
+	pos, gset := h.applied.get()
+	if pos.Name == "" {
+		// Nothing was applied yet, as while canal's dump runs
+		pos = c.SyncedPosition()
+	}
+	req.resumedAt = pos
+	// The saves below run from where held-back events, if any, are read again
+	s.holdSaves(false)
+	startPos, startGTID := &pos, mysql.GTIDSet(nil)
+	if req.startPos != nil {
+		// Saved before streaming, so a restart does not lose the events of the added tables
+		startPos = req.startPos
+		h.applied.set(*startPos, nil)
+		if s.positions != nil {
+			if err := s.saveSyncedPosition(*startPos, nil); err != nil {
+				s.logger.Errorf("Failed to save MariaDB binlog position: %v", err)
+			}
+		}
+	} else {
+		if s.positions != nil {
+			if err := s.savePosition(h); err != nil {
+				s.logger.Errorf("Failed to save MariaDB binlog position: %v", err)
+			}
+		}
+		if s.cfg.UseGTID && gset != nil {
+			startPos, startGTID = nil, gset
+		}
+	}
+	if req.resync != nil {
+		// The position saved above stays until the resume request restarts canal, so a stop
+		// during the copy reads the held-back events again
+		s.holdSaves(true)
+	}
+
+	s.applyReload(h, req)
+	cfg.IncludeTableRegex, cfg.ExcludeTableRegex = req.include, req.exclude
+	next, err := canal.NewCanal(cfg)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to recreate canal for MariaDB after reload: %w", err)
+	}
+	next.SetEventHandler(h)
+	h.canal = next
+	return next, startPos, startGTID, nil
+}
+
+// diffMappings compares two sets of mappings by source db.table, in sorted order
+func diffMappings(current, next []config.DatabaseMapping) (added, removed, changed []string) {
+	before, after := tableMappings(current), tableMappings(next)
+	for table, mapping := range after {
+		prev, ok := before[table]
+		switch {
+		case !ok:
+			added = append(added, table)
+		case !reflect.DeepEqual(prev, mapping):
+			changed = append(changed, table)
+		}
+	}
+	for table := range before {
+		if _, ok := after[table]; !ok {
+			removed = append(removed, table)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// tableMappings returns a single table mapping per source db.table; as in OnRow, the first
+// mapping of a table wins
+func tableMappings(mappings []config.DatabaseMapping) map[string]config.DatabaseMapping {
+	tables := make(map[string]config.DatabaseMapping)
+	for _, mapping := range mappings {
+		for _, tableMap := range mapping.Tables {
+			key := mapping.SourceDatabase + "." + tableMap.SourceTable
+			if _, ok := tables[key]; ok {
+				continue
+			}
+			single := mapping
+			single.Tables = []config.TableMapping{tableMap}
+			tables[key] = single
+		}
+	}
+	return tables
+}
+
+// mappingsOf returns the mappings reduced to the given source db.table
+func mappingsOf(mappings []config.DatabaseMapping, tables map[string]bool) []config.DatabaseMapping {
+	var reduced []config.DatabaseMapping
+	for _, mapping := range mappings {
+		subset := mapping
+		subset.Tables = nil
+		for _, tableMap := range mapping.Tables {
+			if tables[mapping.SourceDatabase+"."+tableMap.SourceTable] {
+				subset.Tables = append(subset.Tables, tableMap)
+			}
+		}
+		if len(subset.Tables) > 0 {
+			reduced = append(reduced, subset)
+		}
+	}
+	return reduced
+}
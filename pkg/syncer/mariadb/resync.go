@@ -0,0 +1,133 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// ResyncTable re-copies one mapped source table into its truncated target tables, including
+// its extra targets, while the other tables keep streaming; with source_tag only the rows of
+// the table are deleted, so merged targets keep those of their other sources. Canal is
+// restarted to hold back the events of the table, so none is written during the copy; once it
+// is done canal restarts from where they were held back, or from its consistent snapshot, and
+// applies the events read again only to the table, upserting their inserts as the copy may
+// hold them already. Positions past the held-back events are not saved during the copy. A
+// failed copy resumes streaming the table all the same, over the rows copied so far.
+func (s *MariaDBSyncer) ResyncTable(ctx context.Context, sourceDB, sourceTable string) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	live := s.live
+	if live == nil {
+		return fmt.Errorf("MariaDB incremental sync is not running")
+	}
+	table := sourceDB + "." + sourceTable
+	tables := map[string]bool{table: true}
+	mappings := mappingsOf(s.cfg.Mappings, tables)
+	if len(mappings) == 0 {
+		return fmt.Errorf("source table %s is not mapped for MariaDB", table)
+	}
+	// As in OnRow, the first mapping of a table wins
+	mappings = mappings[:1]
+	mappings[0].Tables = mappings[0].Tables[:1]
+	if !s.tables.enabled(sourceDB, mappings[0].Tables[0]) {
+		return fmt.Errorf("source table %s is disabled for MariaDB", table)
+	}
+
+	hold, err := s.currentRequest()
+	if err != nil {
+		return err
+	}
+	hold.resync = tables
+	if err := live.apply(hold); err != nil {
+		return err
+	}
+	s.logger.Infof("[MariaDB] Holding back events of %s from %v to re-copy it", table, hold.resumedAt)
+
+	snapshotPos, copyErr := s.recopyTable(ctx, live, mappings)
+	start := hold.resumedAt
+	if snapshotPos != nil {
+		start = *snapshotPos
+	}
+
+	resume, err := s.currentRequest()
+	if err != nil {
+		return err
+	}
+	resume.startPos, resume.catchUp = &start, tables
+	if err := live.apply(resume); err != nil {
+		return err
+	}
+	if copyErr != nil {
+		return fmt.Errorf("re-copy of %s failed; its events are applied from %v over the rows copied so far: %w", table, start, copyErr)
+	}
+	s.logger.Infof("[MariaDB] Re-copied %s; applying its events from %v", table, start)
+	return nil
+}
+
+// currentRequest returns a reload request for the mappings in force, which restarts canal
+// with them unchanged
+func (s *MariaDBSyncer) currentRequest() (*reloadRequest, error) {
+	req := &reloadRequest{
+		mappings:     s.cfg.Mappings,
+		generated:    s.generatedColumns,
+		destinations: s.destinations,
+		done:         make(chan error, 1),
+	}
+	var err error
+	if req.filters, err = buildSourceFilters(s.cfg.Mappings); err != nil {
+		return nil, err
+	}
+	enabled, _ := s.tables.reduce(s.cfg.Mappings)
+	if req.include, req.exclude, err = canalTableFilters(enabled, s.cfg.ExcludeDatabases, s.cfg.SkipTables); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// recopyTable truncates the targets of a single table mapping, or deletes the rows of the
+// source table from them with source_tag, and copies it again, returning the position of the consistent snapshot it was copied from, if any
+func (s *MariaDBSyncer) recopyTable(ctx context.Context, live *liveSync, mappings []config.DatabaseMapping) (*mysql.Position, error) {
+	mapping, tableMap := mappings[0], mappings[0].Tables[0]
+	type recopyTarget struct {
+		db      *sql.DB
+		mapping config.DatabaseMapping
+	}
+	targets := []recopyTarget{{live.targetDB, mapping}}
+	for _, et := range tableMap.ExtraTargets {
+		d := s.destinations[et.TargetConnection]
+		if d == nil {
+			return nil, fmt.Errorf("extra target connection of %s.%s is not open", mapping.SourceDatabase, tableMap.SourceTable)
+		}
+		targets = append(targets, recopyTarget{d.db, extraMapping(mapping, tableMap, et)})
+	}
+	for _, target := range targets {
+		name := target.mapping.TargetDatabase + "." + target.mapping.Tables[0].TargetTable
+		query := fmt.Sprintf("TRUNCATE TABLE %s", quoteTable(target.mapping.TargetDatabase, target.mapping.Tables[0].TargetTable))
+		var args []interface{}
+		if tag := tableMap.SourceTag; tag != "" {
+			// A merged target keeps the rows of its other sources
+			query = fmt.Sprintf("DELETE FROM %s WHERE %s = ?", quoteTable(target.mapping.TargetDatabase, target.mapping.Tables[0].TargetTable), quoteIdent(tag))
+			args = append(args, mapping.SourceDatabase+"."+tableMap.SourceTable)
+		}
+		if _, err := target.db.ExecContext(ctx, query, args...); err != nil {
+			return nil, fmt.Errorf("failed to empty target table %s before re-copy: %w", name, err)
+		}
+		s.logger.Infof("[MariaDB] Emptied target table %s before re-copy", name)
+	}
+
+	if s.cfg.ResumableInitialSync {
+		checkpoints, err := loadCheckpointStore(s.initialSyncCheckpointPath())
+		if err != nil {
+			return nil, err
+		}
+		if err := checkpoints.reset(mapping.SourceDatabase + "." + tableMap.SourceTable); err != nil {
+			return nil, err
+		}
+	}
+	primary := &destination{db: live.targetDB, generated: s.generatedColumns}
+	return s.doInitialFullSyncIfNeeded(ctx, nil, primary, s.destinations, mappings)
+}
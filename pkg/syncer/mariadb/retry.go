@@ -0,0 +1,66 @@
+package mariadb
+
+import (
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseDelay   = 100 * time.Millisecond
+)
+
+// MySQL error numbers that indicate a transient failure worth retrying
+var retriableErrorNumbers = map[uint16]bool{
+	1205: true, // ER_LOCK_WAIT_TIMEOUT
+	1213: true, // ER_LOCK_DEADLOCK
+	2006: true, // CR_SERVER_GONE_ERROR
+	2013: true, // CR_SERVER_LOST
+}
+
+// isRetriableError reports whether a target write error is transient
+func isRetriableError(err error) bool {
+	var myErr *mysqldriver.MySQLError
+	if errors.As(err, &myErr) {
+		return retriableErrorNumbers[myErr.Number]
+	}
+	// Lost connections surface as driver errors rather than server error numbers
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysqldriver.ErrInvalidConn)
+}
+
+// withRetry runs fn, retrying transient failures with exponential backoff. Non-retriable
+// errors and the error of the last attempt are returned to the caller.
+func (h *MariaDBEventHandler) withRetry(desc string, fn func() error) error {
+	maxAttempts := h.retryMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+	delay := h.retryBaseDelay
+	if delay <= 0 {
+		delay = defaultRetryBaseDelay
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || !isRetriableError(err) || attempt >= maxAttempts {
+			return err
+		}
+		h.logger.Warnf("[MariaDB] Transient error on %s (attempt %d/%d), retrying in %v: %v",
+			desc, attempt, maxAttempts, delay, err)
+
+		// Stop waiting when canal is shutting down
+		var done <-chan struct{}
+		if h.canal != nil {
+			done = h.canal.Ctx().Done()
+		}
+		select {
+		case <-time.After(delay):
+		case <-done:
+			return err
+		}
+		delay *= 2
+	}
+}
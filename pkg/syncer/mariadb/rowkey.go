@@ -0,0 +1,69 @@
+package mariadb
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// rowCondition returns the WHERE clauses and values matching row on the target. Rows are
+// matched by primary key; with allow_no_primary_key a table without one is matched by its
+// key_columns or else by every written column, compared NULL-safe with the values as they
+// were written. byPrimaryKey tells whether the match is unique.
+func (h *MariaDBEventHandler) rowCondition(t *rowTarget, row []interface{}) (clauses []string, values []interface{}, byPrimaryKey bool, err error) {
+	if len(t.table.PKColumns) > 0 {
+		for _, pkIndex := range t.table.PKColumns {
+			keyCol, err := keyColumn(t.targetColumns, t.sourceColumns, pkIndex)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			clauses = append(clauses, fmt.Sprintf("%s = ?", quoteIdent(keyCol)))
+			values = append(values, row[pkIndex])
+		}
+		clauses, values = t.withSourceTag(clauses, values)
+		return clauses, values, true, nil
+	}
+
+	written := applyTransforms(t.tableMap, t.sourceColumns, row)
+	var indexes []int
+	if len(t.tableMap.KeyColumns) > 0 {
+		for _, name := range t.tableMap.KeyColumns {
+			idx := t.table.FindColumn(name)
+			if idx < 0 || idx >= len(t.targetColumns) || t.targetColumns[idx] == "" {
+				return nil, nil, false, fmt.Errorf("key column %s of %s is missing or not written", name, t.qualifiedName())
+			}
+			indexes = append(indexes, idx)
+		}
+	} else {
+		for i, col := range t.targetColumns {
+			// A JSON column does not compare equal to its text
+			if col != "" && i < len(t.table.Columns) && t.table.Columns[i].Type != schema.TYPE_JSON {
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	if len(indexes) == 0 {
+		return nil, nil, false, fmt.Errorf("no written column of %s can match its rows", t.qualifiedName())
+	}
+	for _, idx := range indexes {
+		clauses = append(clauses, fmt.Sprintf("%s <=> ?", quoteIdent(t.targetColumns[idx])))
+		values = append(values, written[idx])
+	}
+	clauses, values = t.withSourceTag(clauses, values)
+	return clauses, values, false, nil
+}
+
+// logMatchedRows reports how many target rows an update or delete matched without a
+// primary key; more than one means duplicate rows were all changed
+func (h *MariaDBEventHandler) logMatchedRows(t *rowTarget, action string, res sql.Result) {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected > 1 {
+		h.logger.Warnf("[MariaDB] %s on %s without a primary key affected %d rows", action, t.qualifiedName(), affected)
+		return
+	}
+	h.logger.Debugf("[MariaDB] %s on %s without a primary key affected %d rows", action, t.qualifiedName(), affected)
+}
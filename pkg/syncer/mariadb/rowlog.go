@@ -0,0 +1,50 @@
+package mariadb
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/retail-ai-inc/sync/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+// rowLogger logs the values of written rows at debug level for debug_rows, with the columns
+// that have transforms redacted. Its methods are no-ops on a nil logger.
+type rowLogger struct {
+	logger *logrus.Logger
+	rate   float64 // fraction of rows logged
+}
+
+// newRowLogger validates debug_rows_sample_rate; it returns nil unless debug_rows is set
+func (s *MariaDBSyncer) newRowLogger() (*rowLogger, error) {
+	rate := s.cfg.DebugRowsSampleRate
+	switch {
+	case rate < 0 || rate > 1:
+		return nil, fmt.Errorf("invalid debug_rows_sample_rate %v for MariaDB: must be between 0 and 1", rate)
+	case !s.cfg.DebugRows:
+		return nil, nil
+	case rate == 0:
+		rate = 1
+	}
+	return &rowLogger{logger: s.logger, rate: rate}, nil
+}
+
+// log logs a row written to target; sourceColumns names the source column of each value and
+// targetColumns the target column it is written to, "" when it is not written
+func (l *rowLogger) log(phase, action, source, target string, tableMap config.TableMapping, sourceColumns, targetColumns []string, row []interface{}) {
+	if l == nil || !l.logger.IsLevelEnabled(logrus.DebugLevel) || (l.rate < 1 && rand.Float64() >= l.rate) {
+		return
+	}
+	values := make(map[string]interface{}, len(targetColumns))
+	for i, col := range targetColumns {
+		if col == "" || i >= len(row) {
+			continue
+		}
+		if _, masked := tableMap.Transforms[sourceColumns[i]]; masked && row[i] != nil {
+			values[col] = redactedValue
+			continue
+		}
+		values[col] = auditValue(row[i])
+	}
+	l.logger.Debugf("[MariaDB] Writing %s %s row from %s to %s: %v", phase, action, source, target, values)
+}
@@ -0,0 +1,40 @@
+package mariadb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// slowWriteLogger warns about target writes slower than a threshold and counts them in the
+// status. Its methods are no-ops on a nil logger.
+type slowWriteLogger struct {
+	threshold time.Duration
+	logger    *logrus.Logger
+	status    *statusTracker
+}
+
+// newSlowWriteLogger validates slow_write_threshold; it returns nil when the check is disabled
+func (s *MariaDBSyncer) newSlowWriteLogger() (*slowWriteLogger, error) {
+	switch {
+	case s.cfg.SlowWriteThreshold < 0:
+		return nil, fmt.Errorf("invalid slow_write_threshold %s for MariaDB: must not be negative", s.cfg.SlowWriteThreshold)
+	case s.cfg.SlowWriteThreshold == 0:
+		return nil, nil
+	default:
+		return &slowWriteLogger{threshold: s.cfg.SlowWriteThreshold, logger: s.logger, status: &s.status}, nil
+	}
+}
+
+// observe checks a write of rows to table, begun at start, against the threshold
+func (w *slowWriteLogger) observe(start time.Time, action, table string, rows int) {
+	if w == nil {
+		return
+	}
+	if elapsed := time.Since(start); elapsed >= w.threshold {
+		w.logger.Warnf("[MariaDB] Slow target write: %s of %d row(s) on %s took %v (threshold %v)",
+			action, rows, table, elapsed.Round(time.Millisecond), w.threshold)
+		w.status.slowWrite()
+	}
+}
@@ -0,0 +1,169 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// querier runs the source reads of the initial sync, on the pool or within a snapshot
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sourceSnapshot is a source connection holding a consistent snapshot transaction, and the
+// binlog position the snapshot corresponds to
+type sourceSnapshot struct {
+	conn *sql.Conn
+	pos  mysql.Position
+}
+
+// openSnapshot starts a read-only REPEATABLE READ transaction WITH CONSISTENT SNAPSHOT on a
+// dedicated source connection. MariaDB reports the binlog position of the snapshot itself,
+// so no lock is taken; other servers are locked with FLUSH TABLES WITH READ LOCK while the
+// snapshot starts and the position is read, as mysqldump --single-transaction does.
+func openSnapshot(ctx context.Context, db *sql.DB) (*sourceSnapshot, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source connection: %w", err)
+	}
+	snap := &sourceSnapshot{conn: conn}
+	if err := snap.begin(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	found, err := snap.snapshotPosition(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !found {
+		if _, err := conn.ExecContext(ctx, "ROLLBACK"); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to roll back snapshot transaction: %w", err)
+		}
+		if err := snap.lockedBegin(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return snap, nil
+}
+
+// begin starts the snapshot transaction
+func (s *sourceSnapshot) begin(ctx context.Context) error {
+	if _, err := s.conn.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		return fmt.Errorf("failed to set REPEATABLE READ isolation: %w", err)
+	}
+	if _, err := s.conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY"); err != nil {
+		return fmt.Errorf("failed to start consistent snapshot: %w", err)
+	}
+	return nil
+}
+
+// snapshotPosition reads the binlog_snapshot_file and binlog_snapshot_position status of
+// MariaDB, reporting whether the server has them
+func (s *sourceSnapshot) snapshotPosition(ctx context.Context) (bool, error) {
+	rows, err := s.conn.QueryContext(ctx, "SHOW STATUS LIKE 'binlog_snapshot_%'")
+	if err != nil {
+		return false, fmt.Errorf("failed to read binlog snapshot status: %w", err)
+	}
+	defer rows.Close()
+
+	var file, position string
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return false, fmt.Errorf("failed to read binlog snapshot status: %w", err)
+		}
+		switch strings.ToLower(name) {
+		case "binlog_snapshot_file":
+			file = value
+		case "binlog_snapshot_position":
+			position = value
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to read binlog snapshot status: %w", err)
+	}
+	if file == "" || position == "" {
+		return false, nil
+	}
+	offset, err := strconv.ParseUint(position, 10, 32)
+	if err != nil {
+		return false, fmt.Errorf("invalid binlog_snapshot_position %q: %w", position, err)
+	}
+	s.pos = mysql.Position{Name: file, Pos: uint32(offset)}
+	return true, nil
+}
+
+// lockedBegin starts the snapshot under a global read lock, so that no write commits between
+// the snapshot and the binlog position read from the server. Requires the RELOAD privilege.
+func (s *sourceSnapshot) lockedBegin(ctx context.Context) (err error) {
+	if _, err := s.conn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err != nil {
+		return fmt.Errorf("failed to lock source tables for the snapshot: %w", err)
+	}
+	defer func() {
+		if _, unlockErr := s.conn.ExecContext(ctx, "UNLOCK TABLES"); unlockErr != nil && err == nil {
+			err = fmt.Errorf("failed to unlock source tables after the snapshot: %w", unlockErr)
+		}
+	}()
+	if err := s.begin(ctx); err != nil {
+		return err
+	}
+	if s.pos, err = masterPosition(ctx, s.conn); err != nil {
+		return err
+	}
+	return nil
+}
+
+// masterPosition reads the current binlog position; MySQL 8.4 renamed SHOW MASTER STATUS
+func masterPosition(ctx context.Context, q querier) (mysql.Position, error) {
+	rows, err := q.QueryContext(ctx, "SHOW MASTER STATUS")
+	if err != nil {
+		if rows, err = q.QueryContext(ctx, "SHOW BINARY LOG STATUS"); err != nil {
+			return mysql.Position{}, fmt.Errorf("failed to read binlog position: %w", err)
+		}
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return mysql.Position{}, fmt.Errorf("failed to read binlog position: %w", err)
+		}
+		return mysql.Position{}, fmt.Errorf("source reports no binlog position; is binary logging enabled?")
+	}
+	// File and Position come first, followed by a server specific set of columns
+	cols, err := rows.Columns()
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("failed to read binlog position: %w", err)
+	}
+	if len(cols) < 2 {
+		return mysql.Position{}, fmt.Errorf("unexpected binlog status columns %v", cols)
+	}
+	var file string
+	var offset uint32
+	dest := make([]interface{}, len(cols))
+	dest[0], dest[1] = &file, &offset
+	for i := 2; i < len(dest); i++ {
+		dest[i] = new(sql.RawBytes)
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return mysql.Position{}, fmt.Errorf("failed to read binlog position: %w", err)
+	}
+	return mysql.Position{Name: file, Pos: offset}, nil
+}
+
+// close ends the snapshot transaction and releases its connection
+func (s *sourceSnapshot) close() error {
+	_, err := s.conn.ExecContext(context.Background(), "COMMIT")
+	if closeErr := s.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
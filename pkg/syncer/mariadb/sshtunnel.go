@@ -0,0 +1,144 @@
+package mariadb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/retail-ai-inc/sync/pkg/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshHandshakeTimeout bounds connecting to the bastion and the SSH handshake
+const sshHandshakeTimeout = 30 * time.Second
+
+// sshTunnel dials through an SSH bastion. It connects on first use, so an unreachable
+// bastion fails the startup check like an unreachable database, and connects again once
+// the SSH connection is lost.
+type sshTunnel struct {
+	addr   string // bastion host:port
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// newSSHTunnel loads the key and host key settings of ssh_tunnel. Every referenced file must
+// exist, so a typo fails at startup instead of at the first connection.
+func newSSHTunnel(c *config.SSHTunnelConfig) (*sshTunnel, error) {
+	if c.Host == "" || c.User == "" || c.KeyFile == "" {
+		return nil, fmt.Errorf("invalid ssh_tunnel for MariaDB: host, user and key_file are required")
+	}
+	pem, err := os.ReadFile(c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh_tunnel key_file for MariaDB: %w", err)
+	}
+	var signer ssh.Signer
+	if c.KeyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(c.KeyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(pem)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh_tunnel key_file for MariaDB: %w", err)
+	}
+
+	var hostKey ssh.HostKeyCallback
+	switch {
+	case c.KnownHostsFile != "" && c.InsecureIgnoreHostKey:
+		return nil, fmt.Errorf("invalid ssh_tunnel for MariaDB: known_hosts_file and insecure_ignore_host_key cannot be combined")
+	case c.KnownHostsFile != "":
+		if hostKey, err = knownhosts.New(c.KnownHostsFile); err != nil {
+			return nil, fmt.Errorf("invalid ssh_tunnel known_hosts_file for MariaDB: %w", err)
+		}
+	case c.InsecureIgnoreHostKey:
+		hostKey = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("invalid ssh_tunnel for MariaDB: set known_hosts_file, or insecure_ignore_host_key to skip verifying the bastion")
+	}
+
+	addr := c.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	return &sshTunnel{
+		addr: addr,
+		config: &ssh.ClientConfig{
+			User:            c.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKey,
+			Timeout:         sshHandshakeTimeout,
+		},
+	}, nil
+}
+
+// dial connects to addr from the bastion. A failed dial on an established SSH connection
+// reconnects once, since the bastion may have dropped it.
+func (t *sshTunnel) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.DialContext(ctx, network, addr)
+	if err == nil {
+		return conn, nil
+	}
+	t.drop(client)
+	if client, err = t.connect(ctx); err != nil {
+		return nil, err
+	}
+	if conn, err = client.DialContext(ctx, network, addr); err != nil {
+		return nil, fmt.Errorf("failed to dial %s through SSH bastion %s: %w", addr, t.addr, err)
+	}
+	return conn, nil
+}
+
+// connect returns the SSH connection to the bastion, connecting when there is none
+func (t *sshTunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+	dialer := net.Dialer{Timeout: sshHandshakeTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH bastion %s: %w", t.addr, err)
+	}
+	// The handshake does not take a context, so it is bounded by a deadline instead
+	conn.SetDeadline(time.Now().Add(sshHandshakeTimeout))
+	c, chans, reqs, err := ssh.NewClientConn(conn, t.addr, t.config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SSH handshake with bastion %s failed: %w", t.addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	t.client = ssh.NewClient(c, chans, reqs)
+	return t.client, nil
+}
+
+// drop closes client unless another dial already replaced it
+func (t *sshTunnel) drop(client *ssh.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client == client {
+		t.client.Close()
+		t.client = nil
+	}
+}
+
+// close closes the SSH connection and with it every connection dialed through it
+func (t *sshTunnel) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client == nil {
+		return nil
+	}
+	err := t.client.Close()
+	t.client = nil
+	return err
+}
@@ -0,0 +1,106 @@
+package mariadb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// SyncStatus is a point-in-time view of a MariaDB syncer, e.g. for a health endpoint
+type SyncStatus struct {
+	Running           bool             // canal is streaming binlog events
+	Paused            bool             // target writes are held back by Pause
+	LastEventTime     time.Time        // when the last row event was applied to the target
+	Lag               time.Duration    // replication lag: age of the last applied event plus the time since; 0 before the first
+	LastSavedPosition mysql.Position   // last binlog position persisted to the position file
+	LastError         error            // most recent apply or replication error, nil if none
+	RowsApplied       map[string]int64 // incremental rows applied per action (insert, update, delete)
+	SlowWrites        int64            // target writes slower than slow_write_threshold
+	QueueDepth        int64            // row events queued for the apply workers or held in the write batch
+}
+
+// statusTracker guards the status shared by Start, the position saver and the event handler.
+// Its methods are no-ops on a nil tracker.
+type statusTracker struct {
+	mu     sync.Mutex
+	status SyncStatus
+}
+
+func (t *statusTracker) setRunning(running bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.Running = running
+}
+
+func (t *statusTracker) eventApplied(action string, rows int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastEventTime = time.Now()
+	if t.status.RowsApplied == nil {
+		t.status.RowsApplied = make(map[string]int64)
+	}
+	t.status.RowsApplied[action] += int64(rows)
+}
+
+func (t *statusTracker) slowWrite() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.SlowWrites++
+}
+
+func (t *statusTracker) setQueueDepth(n int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.QueueDepth = n
+}
+
+func (t *statusTracker) positionSaved(pos mysql.Position) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastSavedPosition = pos
+}
+
+func (t *statusTracker) setError(err error) {
+	if t == nil || err == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastError = err
+}
+
+// snapshot returns a copy that callers may keep without further locking
+func (t *statusTracker) snapshot() SyncStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := t.status
+	status.RowsApplied = make(map[string]int64, len(t.status.RowsApplied))
+	for action, n := range t.status.RowsApplied {
+		status.RowsApplied[action] = n
+	}
+	return status
+}
+
+// Status reports whether the syncer is running, its progress and its last error
+func (s *MariaDBSyncer) Status() SyncStatus {
+	status := s.status.snapshot()
+	status.Paused = s.pause.paused()
+	status.Lag = s.lag.current(time.Now())
+	return status
+}
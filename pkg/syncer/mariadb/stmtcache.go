@@ -0,0 +1,129 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// maxCachedStmts bounds the statements a cache prepares; minimal_updates builds one UPDATE
+// per set of changed columns, and each one is prepared on every pooled connection
+const maxCachedStmts = 256
+
+// stmtKey names the statement a write runs: its target table (db.table) and action
+type stmtKey struct {
+	table  string
+	action string
+}
+
+// cacheKey identifies a cached statement by its target table and query text
+type cacheKey struct {
+	table string
+	query string
+}
+
+type cachedStmt struct {
+	stmt    *sql.Stmt
+	users   int  // executions holding the statement
+	dropped bool // left the cache; closed once the last user releases it
+}
+
+// stmtCache holds prepared incremental write statements per target table so they are
+// prepared once per pooled connection instead of on every event. Entries are dropped when the table's schema changes.
+type stmtCache struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	stmts map[cacheKey]*cachedStmt
+	drops int // invalidate and close calls, so a statement prepared meanwhile is not cached
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, stmts: make(map[cacheKey]*cachedStmt)}
+}
+
+// get returns the prepared statement of query on the target table of key, preparing it on
+// a miss, and the func releasing it once the caller is done executing it. It returns a nil
+// statement once the cache is full, and the query is then executed unprepared. The prepare
+// runs without holding mu, so writes of statements already cached do not wait behind it.
+func (c *stmtCache) get(ctx context.Context, key stmtKey, query string) (*sql.Stmt, func(), error) {
+	ck := cacheKey{table: key.table, query: query}
+	c.mu.Lock()
+	if cached, ok := c.stmts[ck]; ok {
+		cached.users++
+		c.mu.Unlock()
+		return cached.stmt, func() { c.release(cached) }, nil
+	}
+	if len(c.stmts) >= maxCachedStmts {
+		c.mu.Unlock()
+		return nil, func() {}, nil
+	}
+	drops := c.drops
+	c.mu.Unlock()
+
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to prepare statement for %s: %w", key.table, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.stmts[ck]
+	switch {
+	case ok:
+		// Another caller prepared it meanwhile
+		stmt.Close()
+	case c.drops != drops || len(c.stmts) >= maxCachedStmts:
+		// It may predate a schema change, or the cache filled up; closed once released
+		cached = &cachedStmt{stmt: stmt, dropped: true}
+	default:
+		cached = &cachedStmt{stmt: stmt}
+		c.stmts[ck] = cached
+	}
+	cached.users++
+	return cached.stmt, func() { c.release(cached) }, nil
+}
+
+// release ends one use of cached, closing it when it was dropped meanwhile
+func (c *stmtCache) release(cached *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached.users--
+	if cached.dropped && cached.users == 0 {
+		cached.stmt.Close()
+	}
+}
+
+// drop removes an entry, closing its statement unless an execution still holds it; callers
+// hold mu
+func (c *stmtCache) drop(key cacheKey, cached *cachedStmt) {
+	delete(c.stmts, key)
+	cached.dropped = true
+	if cached.users == 0 {
+		cached.stmt.Close()
+	}
+}
+
+// invalidate closes and drops every statement of a target table
+func (c *stmtCache) invalidate(table string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drops++
+
+	for key, cached := range c.stmts {
+		if key.table == table {
+			c.drop(key, cached)
+		}
+	}
+}
+
+// close releases all cached statements
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drops++
+
+	for key, cached := range c.stmts {
+		c.drop(key, cached)
+	}
+}
@@ -0,0 +1,101 @@
+package mariadb
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// rowsAffectedError reports a strict_apply write that changed an unexpected number of rows.
+// Like other rejected writes it is wrapped in an ApplyError and handled by error_policy.
+type rowsAffectedError struct {
+	table    string // target db.table
+	action   string
+	key      string // primary key of the row, empty for a multi-row INSERT
+	affected int64
+	expected string
+}
+
+func (e *rowsAffectedError) Error() string {
+	if e.key == "" {
+		return fmt.Sprintf("strict_apply: %s on %s affected %d rows, expected %s", e.action, e.table, e.affected, e.expected)
+	}
+	return fmt.Sprintf("strict_apply: %s on %s of row %s affected %d rows, expected %s",
+		e.action, e.table, e.key, e.affected, e.expected)
+}
+
+// dsnWithFoundRows makes UPDATE report the rows it matched rather than those it changed, so
+// an update to the values a row already has still counts under strict_apply
+func dsnWithFoundRows(dsn string) (string, error) {
+	dsnCfg, err := parseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	dsnCfg.ClientFoundRows = true
+	return dsnCfg.FormatDSN(), nil
+}
+
+// insertAffected returns the rows an INSERT of rows in insert_mode may affect with found
+// rows; hi is negative without an upper bound
+func insertAffected(mode string, rows int64) (lo, hi int64) {
+	switch mode {
+	case insertModeIgnore:
+		// A duplicate is skipped by design
+		return 0, rows
+	case insertModeUpsert:
+		// 1 for an inserted row, 2 for an updated one
+		return rows, 2 * rows
+	case insertModeReplace:
+		// A replaced row counts its delete too, once for every unique key it collided on
+		return rows, -1
+	default:
+		return rows, rows
+	}
+}
+
+// checkAffected fails a write under strict_apply that affected fewer than lo or, unless hi
+// is negative, more than hi target rows. row identifies the source row in the error; it is
+// nil for a multi-row INSERT. A replayed write may find its row already updated or deleted
+// by the copy, so it may affect none.
+func (h *MariaDBEventHandler) checkAffected(t *rowTarget, action string, res sql.Result, row []interface{}, lo, hi int64) error {
+	if !h.strictApply {
+		return nil
+	}
+	if t.replay {
+		lo = 0
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("strict_apply: failed to read the rows affected by %s on %s: %w", action, t.qualifiedName(), err)
+	}
+	if affected >= lo && (hi < 0 || affected <= hi) {
+		return nil
+	}
+	expected := fmt.Sprintf("%d to %d", lo, hi)
+	switch {
+	case hi < 0:
+		expected = fmt.Sprintf("at least %d", lo)
+	case lo == hi:
+		expected = fmt.Sprintf("%d", lo)
+	}
+	e := &rowsAffectedError{table: t.qualifiedName(), action: action, affected: affected, expected: expected}
+	if row != nil {
+		e.key = formatRowKey(t, row)
+	}
+	return e
+}
+
+// formatRowKey renders the primary key of a source row as col=value pairs by target column
+func formatRowKey(t *rowTarget, row []interface{}) string {
+	key := t.auditKeyValues(row)
+	if len(key) == 0 {
+		return "without a primary key"
+	}
+	pairs := make([]string, 0, len(key))
+	for col, v := range key {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", col, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
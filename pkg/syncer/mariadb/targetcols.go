@@ -0,0 +1,119 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// loadTargetColumns returns the lower-cased column names of a target table, or nil when the
+// table does not exist
+func loadTargetColumns(ctx context.Context, db querier, database, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+		database, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols map[string]bool
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		if cols == nil {
+			cols = make(map[string]bool)
+		}
+		cols[strings.ToLower(col)] = true
+	}
+	return cols, rows.Err()
+}
+
+// dropMissingColumns blanks the target columns the target table does not have, in place, and
+// returns their names; present nil checks nothing
+func dropMissingColumns(targetCols []string, present map[string]bool) []string {
+	if present == nil {
+		return nil
+	}
+	var dropped []string
+	for i, col := range targetCols {
+		if col != "" && !present[strings.ToLower(col)] {
+			dropped = append(dropped, col)
+			targetCols[i] = ""
+		}
+	}
+	return dropped
+}
+
+// targetColumnKey identifies a target table on one of the target pools
+type targetColumnKey struct {
+	db    *sql.DB
+	table string // db.table
+}
+
+// targetColumnCache holds the columns of the target tables incremental rows are written to,
+// looked up once per table until a DDL invalidates them
+type targetColumnCache struct {
+	mu      sync.Mutex
+	columns map[targetColumnKey]map[string]bool
+}
+
+func newTargetColumnCache() *targetColumnCache {
+	return &targetColumnCache{columns: make(map[targetColumnKey]map[string]bool)}
+}
+
+// get returns the columns of a target table and whether they were looked up by this call
+func (c *targetColumnCache) get(ctx context.Context, db *sql.DB, database, table string) (map[string]bool, bool, error) {
+	key := targetColumnKey{db: db, table: database + "." + table}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cols, ok := c.columns[key]; ok {
+		return cols, false, nil
+	}
+	cols, err := loadTargetColumns(ctx, db, database, table)
+	if err != nil {
+		return nil, false, err
+	}
+	c.columns[key] = cols
+	return cols, true, nil
+}
+
+// invalidate drops the cached columns of a target db.table on every pool
+func (c *targetColumnCache) invalidate(table string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.columns {
+		if key.table == table {
+			delete(c.columns, key)
+		}
+	}
+}
+
+// checkTargetColumns stops writing the columns of t its target table lacks, warning once per
+// lookup, or fails with strict_schema. A failed lookup checks nothing.
+func (h *MariaDBEventHandler) checkTargetColumns(t *rowTarget) error {
+	if h.targetColumns == nil {
+		return nil
+	}
+	present, loaded, err := h.targetColumns.get(h.context(), h.targetDBOf(t), t.dbName, t.tableMap.TargetTable)
+	if err != nil {
+		// Not cached, so the next event looks the columns up again
+		h.logger.Warnf("[MariaDB] Failed to look up columns of target table %s, writing every mapped column: %v", t.qualifiedName(), err)
+		return nil
+	}
+	dropped := dropMissingColumns(t.targetColumns, present)
+	switch {
+	case len(dropped) == 0:
+	case h.strictSchema:
+		return fmt.Errorf("target table %s lacks columns %s written from %s.%s",
+			t.qualifiedName(), strings.Join(dropped, ", "), t.table.Schema, t.table.Name)
+	case loaded:
+		h.logger.Warnf("[MariaDB] Target table %s lacks columns %s of source %s.%s; they are not written",
+			t.qualifiedName(), strings.Join(dropped, ", "), t.table.Schema, t.table.Name)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package mariadb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// tlsConfigSeq makes the name each syncer registers with the mysql driver unique
+var tlsConfigSeq atomic.Int64
+
+// buildTLSConfig loads the configured CA and client certificate. Every referenced file
+// must exist, so a typo fails at startup instead of at the first TLS handshake.
+func buildTLSConfig(c *config.TLSConfig) (*tls.Config, error) {
+	for _, f := range []struct{ option, path string }{
+		{"ca_file", c.CAFile}, {"cert_file", c.CertFile}, {"key_file", c.KeyFile},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			return nil, fmt.Errorf("invalid tls_config %s for MariaDB: %w", f.option, err)
+		}
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, fmt.Errorf("invalid tls_config for MariaDB: cert_file and key_file must be set together")
+	}
+
+	tlsCfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls_config ca_file for MariaDB: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid tls_config ca_file for MariaDB: no PEM certificates in %s", c.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls_config client certificate for MariaDB: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// registerTLSConfig registers tlsCfg with the mysql driver under a new name for use in DSNs
+func registerTLSConfig(tlsCfg *tls.Config) (string, error) {
+	name := fmt.Sprintf("sync-mariadb-%d", tlsConfigSeq.Add(1))
+	if err := mysqldriver.RegisterTLSConfig(name, tlsCfg); err != nil {
+		return "", fmt.Errorf("failed to register TLS config for MariaDB: %w", err)
+	}
+	return name, nil
+}
+
+// withTLSServerName returns a copy of tlsCfg that verifies the host of addr when no
+// server name is configured; the mysql driver does the same for registered configs.
+func withTLSServerName(tlsCfg *tls.Config, addr string) *tls.Config {
+	if tlsCfg.ServerName != "" || tlsCfg.InsecureSkipVerify {
+		return tlsCfg
+	}
+	cloned := tlsCfg.Clone()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	cloned.ServerName = host
+	return cloned
+}
+
+// dsnWithTLSConfig points a DSN at a registered TLS config
+func dsnWithTLSConfig(dsn, name string) (string, error) {
+	dsnCfg, err := parseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	dsnCfg.TLSConfig = name
+	return dsnCfg.FormatDSN(), nil
+}
+
+// registerTLS loads and registers tls_config, and points the DSN of direct source queries,
+// such as mapping validation and the initial sync, at it. The caller deregisters the name.
+func (s *MariaDBSyncer) registerTLS() (*tls.Config, string, error) {
+	tlsCfg, err := buildTLSConfig(s.cfg.TLSConfig)
+	if err != nil {
+		return nil, "", err
+	}
+	name, err := registerTLSConfig(tlsCfg)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.sourceDSN, err = dsnWithTLSConfig(s.cfg.SourceConnection, name); err != nil {
+		mysqldriver.DeregisterTLSConfig(name)
+		return nil, "", err
+	}
+	return tlsCfg, name, nil
+}
+
+// openSource opens the source for direct queries, with the TLS config canal uses
+func (s *MariaDBSyncer) openSource() (*sql.DB, error) {
+	dsn := s.sourceDSN
+	if dsn == "" {
+		dsn = s.cfg.SourceConnection
+	}
+	return sql.Open("mysql", dsn)
+}
@@ -0,0 +1,109 @@
+package mariadb
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// tableToggles tracks which mapped tables are synced. The zero value follows the enabled
+// flag of each table mapping. Its lock also guards the syncer's mappings, which Reload swaps.
+type tableToggles struct {
+	mu        sync.RWMutex
+	override  map[string]bool // enabled state by source db.table, set through SetTableEnabled
+	streamed  map[string]bool // source db.table canal streams; nil before Start
+	resyncing map[string]bool // source db.table whose events ResyncTable holds back while it copies
+}
+
+// SetTableEnabled starts or stops syncing a mapped source table without a restart. Events of a
+// disabled table are dropped, so re-enabling it does not replay the changes made meanwhile.
+// Canal only streams the tables enabled when Start runs; enabling any other table fails
+// until the syncer is restarted.
+func (s *MariaDBSyncer) SetTableEnabled(db, table string, enabled bool) error {
+	s.tables.mu.Lock()
+	defer s.tables.mu.Unlock()
+	mapped := false
+	for _, mapping := range s.cfg.Mappings {
+		for _, tableMap := range mapping.Tables {
+			if mapping.SourceDatabase == db && tableMap.SourceTable == table {
+				mapped = true
+			}
+		}
+	}
+	if !mapped {
+		return fmt.Errorf("source table %s.%s is not mapped for MariaDB", db, table)
+	}
+
+	key := db + "." + table
+	if enabled && s.tables.streamed != nil && !s.tables.streamed[key] {
+		return fmt.Errorf("source table %s was disabled when the MariaDB sync started; restart the syncer to enable it", key)
+	}
+	if s.tables.override == nil {
+		s.tables.override = make(map[string]bool)
+	}
+	s.tables.override[key] = enabled
+	if enabled {
+		s.logger.Infof("[MariaDB] Enabled sync of %s", key)
+	} else {
+		s.logger.Infof("[MariaDB] Disabled sync of %s", key)
+	}
+	return nil
+}
+
+// enabled reports whether a source table is synced
+func (t *tableToggles) enabled(db string, tableMap config.TableMapping) bool {
+	if t == nil {
+		return tableMap.IsEnabled()
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if enabled, ok := t.override[db+"."+tableMap.SourceTable]; ok {
+		return enabled
+	}
+	return tableMap.IsEnabled()
+}
+
+// start records the tables enabled as canal starts and returns the mappings reduced to them
+func (t *tableToggles) start(mappings []config.DatabaseMapping) []config.DatabaseMapping {
+	enabled, streamed := t.reduce(mappings)
+	t.mu.Lock()
+	t.streamed = streamed
+	t.mu.Unlock()
+	return enabled
+}
+
+// reduce returns the mappings reduced to their enabled tables, and the set of those tables
+func (t *tableToggles) reduce(mappings []config.DatabaseMapping) ([]config.DatabaseMapping, map[string]bool) {
+	streamed := make(map[string]bool)
+	var enabled []config.DatabaseMapping
+	for _, mapping := range mappings {
+		reduced := mapping
+		reduced.Tables = nil
+		for _, tableMap := range mapping.Tables {
+			if t.enabled(mapping.SourceDatabase, tableMap) {
+				streamed[mapping.SourceDatabase+"."+tableMap.SourceTable] = true
+				reduced.Tables = append(reduced.Tables, tableMap)
+			}
+		}
+		enabled = append(enabled, reduced)
+	}
+	return enabled, streamed
+}
+
+// setResyncing replaces the set of tables being re-copied by ResyncTable
+func (t *tableToggles) setResyncing(tables map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.resyncing = tables
+}
+
+// isResyncing reports whether ResyncTable is re-copying a source table
+func (t *tableToggles) isResyncing(table string) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.resyncing[table]
+}
@@ -0,0 +1,91 @@
+package mariadb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// transformFunc masks one non-NULL value before it is written to the target
+type transformFunc func(v interface{}) interface{}
+
+// redactedValue replaces redacted values
+const redactedValue = "REDACTED"
+
+// transforms holds the masking functions selectable in a table mapping's transforms
+var transforms = map[string]transformFunc{
+	"hash":       hashValue,
+	"redact":     func(interface{}) interface{} { return redactedValue },
+	"email-mask": maskEmail,
+	"null-out":   func(interface{}) interface{} { return nil },
+}
+
+// hashValue replaces a value with the hex SHA-256 of its text form, so equal inputs still match
+func hashValue(v interface{}) interface{} {
+	sum := sha256.Sum256([]byte(keyString(v)))
+	return hex.EncodeToString(sum[:])
+}
+
+// maskEmail keeps the first character of the local part and the domain: a***@example.com
+func maskEmail(v interface{}) interface{} {
+	s := keyString(v)
+	at := strings.LastIndex(s, "@")
+	if at <= 0 {
+		return "***"
+	}
+	return s[:1] + "***" + s[at:]
+}
+
+// validateTransforms checks that every configured transform type exists
+func validateTransforms(mappings []config.DatabaseMapping) error {
+	var problems []error
+	for _, mapping := range mappings {
+		for _, tableMap := range mapping.Tables {
+			for _, column := range sortedKeys(tableMap.Transforms) {
+				if _, ok := transforms[tableMap.Transforms[column]]; !ok {
+					problems = append(problems, fmt.Errorf("unknown transform %q for column %s of %s.%s",
+						tableMap.Transforms[column], column, mapping.SourceDatabase, tableMap.SourceTable))
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid MariaDB transforms:\n%w", errors.Join(problems...))
+	}
+	return nil
+}
+
+// applyTransforms returns row with the mapping's transforms applied; cols names the source
+// column of each value. The input row is not modified, so filters and keys see raw values.
+func applyTransforms(tableMap config.TableMapping, cols []string, row []interface{}) []interface{} {
+	if len(tableMap.Transforms) == 0 {
+		return row
+	}
+	masked := make([]interface{}, len(row))
+	copy(masked, row)
+	for i, col := range cols {
+		name, ok := tableMap.Transforms[col]
+		if !ok || i >= len(masked) || masked[i] == nil {
+			continue
+		}
+		if fn := transforms[name]; fn != nil {
+			masked[i] = fn(masked[i])
+		}
+	}
+	return masked
+}
+
+// sortedKeys returns the keys of m in order, for deterministic error messages
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
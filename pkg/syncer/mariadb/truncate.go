@@ -0,0 +1,85 @@
+package mariadb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// truncateAction names a propagated TRUNCATE in errors and logs
+const truncateAction = "truncate"
+
+// truncateTarget deletes every target row of a truncated source table, on the mapping's
+// target and its extra targets, or marks them deleted with soft_delete. With source_tag only
+// the rows written from this source table are touched. Tables that do not replicate deletes
+// are left alone, and a TRUNCATE read again after a restart is skipped, since it would also
+// remove the rows inserted after it.
+func (h *MariaDBEventHandler) truncateTarget(header *replication.EventHeader, sourceDB, sourceTable string, dbMap config.DatabaseMapping, tableMap config.TableMapping) error {
+	source := sourceDB + "." + sourceTable
+	switch {
+	case h.alreadyApplied(header):
+		h.logger.Debugf("[MariaDB] Skipping TRUNCATE of %s at %s:%d, already applied", source, h.binlogFile, header.LogPos)
+		return nil
+	case !h.tables.enabled(sourceDB, tableMap):
+		h.logger.Debugf("[MariaDB] Skipping TRUNCATE of %s, table disabled", source)
+		return nil
+	case h.tables.isResyncing(source):
+		h.logger.Debugf("[MariaDB] Holding back TRUNCATE of %s while the table is re-copied", source)
+		return nil
+	case !tableMap.ActionEnabled(canal.DeleteAction):
+		h.logger.Infof("[MariaDB] Not propagating TRUNCATE of %s; its deletes are not replicated", source)
+		return nil
+	}
+
+	target := &rowTarget{
+		dbName:   dbMap.TargetDatabase,
+		tableMap: tableMap,
+		table:    &schema.Table{Schema: sourceDB, Name: sourceTable},
+	}
+	for _, t := range append(h.extraTargets(target), target) {
+		query, args := truncateSQL(t)
+		err := h.withRetry(fmt.Sprintf("TRUNCATE of %s", t.qualifiedName()), func() error {
+			ctx, cancel := h.writeContext()
+			defer cancel()
+			if _, err := h.targetDBOf(t).ExecContext(ctx, query, args...); err != nil {
+				return &statementError{query: query, err: h.writeError(ctx, err)}
+			}
+			return nil
+		})
+		if err != nil {
+			return &ApplyError{Table: t.qualifiedName(), Action: truncateAction, Err: err}
+		}
+		h.logger.Infof("[MariaDB] Propagated TRUNCATE of %s to target: %s", source, query)
+	}
+	h.markApplied(header)
+	return nil
+}
+
+// truncateSQL returns the statement emptying the target table of t. It deletes rather than
+// truncates, so it stays within source_tag and fires the target's delete triggers.
+func truncateSQL(t *rowTarget) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	query := "DELETE FROM " + quoteTable(t.dbName, t.tableMap.TargetTable)
+	if sd := t.tableMap.SoftDelete; sd != nil {
+		// Rows already marked keep their marker, such as the time they were deleted
+		col := quoteIdent(sd.Column)
+		if strings.EqualFold(strings.TrimSpace(sd.Value), "NOW()") {
+			query = fmt.Sprintf("UPDATE %s SET %s = NOW()", quoteTable(t.dbName, t.tableMap.TargetTable), col)
+			clauses = append(clauses, col+" IS NULL")
+		} else {
+			query = fmt.Sprintf("UPDATE %s SET %s = ?", quoteTable(t.dbName, t.tableMap.TargetTable), col)
+			clauses = append(clauses, fmt.Sprintf("NOT (%s <=> ?)", col))
+			args = append(args, sd.Value, sd.Value)
+		}
+	}
+	clauses, args = t.withSourceTag(clauses, args)
+	if len(clauses) > 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+	return query, args
+}
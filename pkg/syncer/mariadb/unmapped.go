@@ -0,0 +1,58 @@
+package mariadb
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// unmappedSummaryInterval is how often the events skipped for a source table without a
+// mapping are summarized after its first warning
+const unmappedSummaryInterval = 5 * time.Minute
+
+// sourceTable identifies a source table by its exact schema and name
+type sourceTable struct{ db, table string }
+
+// unmappedTables remembers the source tables whose events have no mapping, so each is warned
+// about once and its later events are skipped by a map lookup. It is only used from OnRow
+// and while canal is stopped for a reload, so it needs no lock.
+type unmappedTables struct {
+	tables map[sourceTable]*unmappedTable
+}
+
+// unmappedTable counts the events skipped since the last warning or summary
+type unmappedTable struct {
+	skipped int64
+	since   time.Time
+}
+
+// skip reports whether db.table is known to have no mapping, counting the event and logging
+// how many were skipped once unmappedSummaryInterval passed
+func (u *unmappedTables) skip(logger *logrus.Logger, db, table string) bool {
+	t, ok := u.tables[sourceTable{db, table}]
+	if !ok {
+		return false
+	}
+	t.skipped++
+	if now := time.Now(); now.Sub(t.since) >= unmappedSummaryInterval {
+		logger.Warnf("[MariaDB] Skipped %d event(s) of source table %s.%s without a mapping in the last %v",
+			t.skipped, db, table, now.Sub(t.since).Round(time.Second))
+		t.skipped, t.since = 0, now
+	}
+	return true
+}
+
+// add warns that db.table has no mapping and skips its further events
+func (u *unmappedTables) add(logger *logrus.Logger, db, table string) {
+	if u.tables == nil {
+		u.tables = make(map[sourceTable]*unmappedTable)
+	}
+	u.tables[sourceTable{db, table}] = &unmappedTable{since: time.Now()}
+	logger.Warnf("No mapping found for source table %s.%s (MariaDB); its further events are skipped and summarized every %v",
+		db, table, unmappedSummaryInterval)
+}
+
+// reset forgets every table, since reloaded mappings may now cover them
+func (u *unmappedTables) reset() {
+	u.tables = nil
+}
@@ -0,0 +1,350 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/retail-ai-inc/sync/pkg/config"
+)
+
+// maxIdentifierLength is the longest database name MariaDB accepts
+const maxIdentifierLength = 64
+
+// ValidateConfig checks a MariaDB sync configuration without connecting anywhere: that both
+// DSNs parse, that there are mappings, that no source table is mapped twice and tables merged
+// into one target agree on source_tag, that insert_mode, error_policy, ignore_error_codes,
+// initial_sync_method and the cutover settings are valid, that apply SQL has no empty
+// statements, that initial_sync_order_by has no empty names, and that the directories of the
+// position and dump paths exist. It returns every problem found, so a standalone validation
+// reports them all at once; Start runs it first.
+func ValidateConfig(cfg config.SyncConfig) []error {
+	var problems []error
+	if _, err := parseDSN(cfg.SourceConnection); err != nil {
+		problems = append(problems, fmt.Errorf("source_connection: %w", err))
+	}
+	if _, err := parseDSN(cfg.TargetConnection); err != nil {
+		problems = append(problems, fmt.Errorf("target_connection: %w", err))
+	}
+
+	if len(cfg.Mappings) == 0 {
+		problems = append(problems, fmt.Errorf("no mappings configured for MariaDB"))
+	}
+	sources := make(map[string]bool)
+	tags := make(map[string]string) // source_tag of each target db.table
+	for _, mapping := range prefixTargetDatabases(cfg.Mappings, cfg.TargetDatabasePrefix) {
+		if len(mapping.TargetDatabase) > maxIdentifierLength {
+			problems = append(problems, fmt.Errorf("target database %s is longer than %d characters", mapping.TargetDatabase, maxIdentifierLength))
+		}
+		for _, tableMap := range mapping.Tables {
+			source := mapping.SourceDatabase + "." + tableMap.SourceTable
+			if sources[source] {
+				// OnRow uses the first mapping of a table, so later ones never apply
+				problems = append(problems, fmt.Errorf("source table %s is mapped more than once", source))
+				continue
+			}
+			sources[source] = true
+			target := mapping.TargetDatabase + "." + tableMap.TargetTable
+			if tag, ok := tags[target]; ok && tag != tableMap.SourceTag {
+				problems = append(problems, fmt.Errorf("source tables merged into target table %s must set the same source_tag", target))
+			} else if !ok {
+				tags[target] = tableMap.SourceTag
+			}
+			switch tableMap.InsertMode {
+			case "", insertModeInsert, insertModeUpsert, insertModeIgnore, insertModeReplace:
+			default:
+				problems = append(problems, fmt.Errorf("invalid insert_mode %q of %s: must be %s, %s, %s or %s",
+					tableMap.InsertMode, source, insertModeInsert, insertModeUpsert, insertModeIgnore, insertModeReplace))
+			}
+			for _, stmt := range append(append([]string(nil), tableMap.PreApplySQL...), tableMap.PostApplySQL...) {
+				if strings.TrimSpace(stmt) == "" {
+					problems = append(problems, fmt.Errorf("pre_apply_sql and post_apply_sql of %s must not contain empty statements", source))
+					break
+				}
+			}
+			if tableMap.ApplySQLIncremental && len(tableMap.PreApplySQL)+len(tableMap.PostApplySQL) == 0 {
+				problems = append(problems, fmt.Errorf("apply_sql_incremental of %s requires pre_apply_sql or post_apply_sql", source))
+			}
+			if err := validateConflictResolution(source, tableMap); err != nil {
+				problems = append(problems, err)
+			}
+			if slices.Contains(tableMap.InitialSyncOrderBy, "") {
+				problems = append(problems, fmt.Errorf("initial_sync_order_by of %s must not contain empty column names", source))
+			}
+		}
+	}
+
+	s := &MariaDBSyncer{cfg: cfg}
+	if _, err := s.errorPolicy(); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := s.ignoreErrorCodes(); err != nil {
+		problems = append(problems, err)
+	}
+	if _, _, err := s.cutoverPolicy(); err != nil {
+		problems = append(problems, err)
+	}
+	mode, modeErr := s.mode()
+	if modeErr == nil {
+		if _, err := s.initialSyncMethod(mode); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	// Position and checkpoint directories are created at startup when missing
+	for _, path := range []struct{ name, path string }{
+		{"mysql_position_path", cfg.MySQLPositionPath},
+		{"initial_sync_checkpoint_path", cfg.InitialSyncCheckpointPath},
+	} {
+		if err := checkCreatableDir(filepath.Dir(path.path)); path.path != "" && err != nil {
+			problems = append(problems, fmt.Errorf("invalid %s %q: %w", path.name, path.path, err))
+		}
+	}
+	// A bare dump_execution_path is looked up in PATH once canal would dump
+	if dump := cfg.DumpExecutionPath; dump != "" && !s.canalDumpDisabled(mode) && strings.ContainsRune(dump, filepath.Separator) {
+		if info, err := os.Stat(filepath.Dir(dump)); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Errorf("invalid dump_execution_path %q: directory %s does not exist", dump, filepath.Dir(dump)))
+		}
+	}
+	return problems
+}
+
+// checkCreatableDir reports an error unless dir exists or MkdirAll can create it, that is
+// unless its nearest existing ancestor is a directory
+func checkCreatableDir(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		switch {
+		case err == nil && info.IsDir():
+			return nil
+		case err == nil:
+			return fmt.Errorf("%s is not a directory", dir)
+		case !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+}
+
+// validateMappings checks that every mapped source database and table exists and has a
+// primary key, unless allow_no_primary_key is set, before canal starts streaming. All
+// problems are reported in one error.
+func (s *MariaDBSyncer) validateMappings(ctx context.Context, mappings []config.DatabaseMapping) error {
+	sourceDB, err := s.openSource()
+	if err != nil {
+		return fmt.Errorf("failed to open source DB for mapping validation in MariaDB: %w", err)
+	}
+	defer sourceDB.Close()
+
+	return checkMappings(ctx, sourceDB, mappings, s.cfg.AllowNoPrimaryKey, s.cfg.ResumableInitialSync)
+}
+
+// checkMappings validates mappings against the live source schema in information_schema;
+// allowNoPrimaryKey accepts tables without a primary key, whose key_columns must exist, and
+// resumable requires initial_sync_order_by columns that can key a checkpoint
+func checkMappings(ctx context.Context, db *sql.DB, mappings []config.DatabaseMapping, allowNoPrimaryKey, resumable bool) error {
+	var problems []error
+	for _, mapping := range mappings {
+		var dbCount int
+		err := db.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?",
+			mapping.SourceDatabase).Scan(&dbCount)
+		if err != nil {
+			return fmt.Errorf("failed to look up source database %s: %w", mapping.SourceDatabase, err)
+		}
+		if dbCount == 0 {
+			problems = append(problems, fmt.Errorf("source database %s does not exist", mapping.SourceDatabase))
+			continue
+		}
+
+		for _, tableMap := range mapping.Tables {
+			var tableCount int
+			err := db.QueryRowContext(ctx,
+				"SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+				mapping.SourceDatabase, tableMap.SourceTable).Scan(&tableCount)
+			if err != nil {
+				return fmt.Errorf("failed to look up source table %s.%s: %w", mapping.SourceDatabase, tableMap.SourceTable, err)
+			}
+			if tableCount == 0 {
+				problems = append(problems, fmt.Errorf("source table %s.%s does not exist", mapping.SourceDatabase, tableMap.SourceTable))
+				continue
+			}
+
+			pkCols, err := primaryKeyColumns(ctx, db, mapping.SourceDatabase, tableMap.SourceTable)
+			if err != nil {
+				return fmt.Errorf("failed to look up primary key of %s.%s: %w", mapping.SourceDatabase, tableMap.SourceTable, err)
+			}
+			if len(pkCols) == 0 && !allowNoPrimaryKey {
+				problems = append(problems, fmt.Errorf("source table %s.%s has no primary key, which updates and deletes require",
+					mapping.SourceDatabase, tableMap.SourceTable))
+			}
+			if len(pkCols) == 0 && allowNoPrimaryKey {
+				for _, keyCol := range tableMap.KeyColumns {
+					var colCount int
+					err := db.QueryRowContext(ctx,
+						"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+						mapping.SourceDatabase, tableMap.SourceTable, keyCol).Scan(&colCount)
+					if err != nil {
+						return fmt.Errorf("failed to look up key column %s of %s.%s: %w", keyCol, mapping.SourceDatabase, tableMap.SourceTable, err)
+					}
+					if colCount == 0 {
+						problems = append(problems, fmt.Errorf("key column %s of %s.%s does not exist",
+							keyCol, mapping.SourceDatabase, tableMap.SourceTable))
+					}
+				}
+			}
+			// Masked keys would no longer match the WHERE clauses of updates and deletes
+			for _, pkCol := range pkCols {
+				if _, ok := tableMap.Transforms[pkCol]; ok {
+					problems = append(problems, fmt.Errorf("primary key column %s of %s.%s cannot be transformed",
+						pkCol, mapping.SourceDatabase, tableMap.SourceTable))
+				}
+			}
+			orderProblems, err := checkInitialSyncOrder(ctx, db, mapping.SourceDatabase, tableMap, resumable)
+			if err != nil {
+				return err
+			}
+			problems = append(problems, orderProblems...)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Err: fmt.Errorf("invalid MariaDB mappings:\n%w", errors.Join(problems...))}
+	}
+	return nil
+}
+
+// checkInitialSyncOrder checks that the initial_sync_index_hint and initial_sync_order_by of a
+// table name an index and columns of the source table. A resumable copy compares its key with
+// >, which never matches NULL, so its order columns must be NOT NULL.
+func checkInitialSyncOrder(ctx context.Context, db *sql.DB, database string, tableMap config.TableMapping, resumable bool) ([]error, error) {
+	var problems []error
+	if hint := tableMap.InitialSyncIndexHint; hint != "" {
+		var indexCount int
+		err := db.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND INDEX_NAME = ?",
+			database, tableMap.SourceTable, hint).Scan(&indexCount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up index %s of %s.%s: %w", hint, database, tableMap.SourceTable, err)
+		}
+		if indexCount == 0 {
+			problems = append(problems, fmt.Errorf("initial_sync_index_hint %s of %s.%s is not an index of the table",
+				hint, database, tableMap.SourceTable))
+		}
+	}
+	for _, col := range tableMap.InitialSyncOrderBy {
+		var nullable string
+		err := db.QueryRowContext(ctx,
+			"SELECT IS_NULLABLE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+			database, tableMap.SourceTable, col).Scan(&nullable)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			problems = append(problems, fmt.Errorf("initial_sync_order_by column %s of %s.%s does not exist",
+				col, database, tableMap.SourceTable))
+		case err != nil:
+			return nil, fmt.Errorf("failed to look up initial_sync_order_by column %s of %s.%s: %w", col, database, tableMap.SourceTable, err)
+		case resumable && nullable == "YES":
+			problems = append(problems, fmt.Errorf("initial_sync_order_by column %s of %s.%s is nullable, which a resumable initial sync cannot order by",
+				col, database, tableMap.SourceTable))
+		}
+	}
+	return problems, nil
+}
+
+// primaryKeyColumns returns the primary key columns of a source table
+func primaryKeyColumns(ctx context.Context, db querier, database, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY' ORDER BY ORDINAL_POSITION",
+		database, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	return cols, rows.Err()
+}
+
+// checkSoftDeleteColumns verifies that every soft-delete column exists on its target table
+func checkSoftDeleteColumns(ctx context.Context, db *sql.DB, mappings []config.DatabaseMapping) error {
+	var problems []error
+	for _, mapping := range mappings {
+		for _, tableMap := range mapping.Tables {
+			sd := tableMap.SoftDelete
+			if sd == nil {
+				continue
+			}
+			if sd.Column == "" {
+				problems = append(problems, fmt.Errorf("soft_delete for %s.%s has no column", mapping.TargetDatabase, tableMap.TargetTable))
+				continue
+			}
+			var count int
+			err := db.QueryRowContext(ctx,
+				"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+				mapping.TargetDatabase, tableMap.TargetTable, sd.Column).Scan(&count)
+			if err != nil {
+				return fmt.Errorf("failed to look up soft delete column of %s.%s: %w", mapping.TargetDatabase, tableMap.TargetTable, err)
+			}
+			if count == 0 {
+				problems = append(problems, fmt.Errorf("soft delete column %s does not exist on target table %s.%s",
+					sd.Column, mapping.TargetDatabase, tableMap.TargetTable))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid MariaDB soft delete settings:\n%w", errors.Join(problems...))
+	}
+	return nil
+}
+
+// loadGeneratedColumns returns the generated columns of every mapped target table, keyed by
+// target db.table and lower-cased column name
+func loadGeneratedColumns(ctx context.Context, db *sql.DB, mappings []config.DatabaseMapping) (map[string]map[string]bool, error) {
+	generated := make(map[string]map[string]bool)
+	for _, mapping := range mappings {
+		for _, tableMap := range mapping.Tables {
+			target := mapping.TargetDatabase + "." + tableMap.TargetTable
+			if _, ok := generated[target]; ok {
+				continue
+			}
+			rows, err := db.QueryContext(ctx,
+				"SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND EXTRA LIKE '%GENERATED%'",
+				mapping.TargetDatabase, tableMap.TargetTable)
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up generated columns of %s: %w", target, err)
+			}
+			cols := make(map[string]bool)
+			for rows.Next() {
+				var col string
+				if err := rows.Scan(&col); err != nil {
+					rows.Close()
+					return nil, fmt.Errorf("failed to read generated columns of %s: %w", target, err)
+				}
+				cols[strings.ToLower(col)] = true
+			}
+			err = rows.Err()
+			rows.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read generated columns of %s: %w", target, err)
+			}
+			generated[target] = cols
+		}
+	}
+	return generated, nil
+}
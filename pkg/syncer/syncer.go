@@ -21,6 +21,11 @@ func NewMariaDBSyncer(cfg config.SyncConfig, logger *logrus.Logger) *mariadb.Mar
 	return mariadb.NewMariaDBSyncer(cfg, logger)
 }
 
+// ValidateMariaDBConfig returns every problem of a MariaDB sync configuration, see mariadb.ValidateConfig
+func ValidateMariaDBConfig(cfg config.SyncConfig) []error {
+	return mariadb.ValidateConfig(cfg)
+}
+
 func NewPostgreSQLSyncer(cfg config.SyncConfig, logger *logrus.Logger) *postgresql.PostgreSQLSyncer {
 	return postgresql.NewPostgreSQLSyncer(cfg, logger)
 }